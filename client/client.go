@@ -0,0 +1,920 @@
+// Package client provides the runtime of the typed HTTP clients generated with the
+// "http_client" parameter: the requests are encoded by the http rule of the routes like
+// the gateway decodes them, and the responses decoded into the response messages.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Route describes the http binding of a method, as generated.
+type Route struct {
+	// HTTPMethod is the HTTP method, e.g. "POST".
+	HTTPMethod string
+	// Path is the path template, e.g. "/v1/rooms/{room_id}".
+	Path string
+	// Body is the "body" of the http rule: empty if none, "*" for the whole request message,
+	// or else a field path. The fields which are neither in the path nor in the body go to the query.
+	Body string
+	// ResponseBody is the "response_body" of the http rule, empty for the whole response message.
+	ResponseBody string
+	// HeaderParams are the fields of the request sent as headers or cookies.
+	HeaderParams []HeaderParam
+	// HTTPBodyRequest tells whether the body is the google.api.HttpBody at Body, sent as is.
+	HTTPBodyRequest bool
+	// HTTPBodyResponse tells whether the response is the google.api.HttpBody at ResponseBody, received as is.
+	HTTPBodyResponse bool
+	// ResponseHeaders are the fields of the response which the gateway writes as headers
+	// instead of in the body, with the "@resheader ... omit" tags of the method.
+	ResponseHeaders []ResponseHeader
+	// StatusField is the field of the response which the gateway writes as the HTTP status
+	// instead of in the body, with the "@status field omit" tag of the method.
+	StatusField string
+}
+
+// ResponseHeader is a field of the response received as a header.
+type ResponseHeader struct {
+	// Field is the path of the field in the response message.
+	Field string
+	// Header is the name of the header.
+	Header string
+}
+
+// HeaderParam is a field of the request sent as a header or a cookie.
+type HeaderParam struct {
+	// Source is "header" or "cookie".
+	Source string
+	// Name is the name of the header or the cookie.
+	Name string
+	// Field is the path of the field in the request message.
+	Field string
+}
+
+// Envelope unwraps the responses of the gateways configured with runtime.WithEnvelope.
+type Envelope struct {
+	// CodeField is the name of the code member, "code" if empty.
+	CodeField string
+	// MessageField is the name of the message member, "msg" if empty.
+	MessageField string
+	// DataField is the name of the member holding the reply, "data" if empty.
+	DataField string
+	// SuccessCode is the code of the replies.
+	SuccessCode int
+	// GRPCCode maps the code of an error envelope to a gRPC code. If nil, the codes
+	// from 1 to 16 are taken as gRPC codes, as the gateway writes them by default.
+	GRPCCode func(code int) codes.Code
+}
+
+// Client sends the requests of the generated clients to a gateway.
+// A Client is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	header     http.Header
+	envelope   *Envelope
+	marshaler  *jsonpb.Marshaler
+	separator  string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// New returns a Client sending the requests to the gateway at "baseURL", e.g. "https://api.example.com".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		header:     make(http.Header),
+		marshaler:  &jsonpb.Marshaler{OrigName: true},
+		separator:  ",",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithHTTPClient sends the requests with "hc" instead of http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithHeader adds a header to all the requests, e.g. "Authorization".
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// WithEnvelope unwraps the responses of a gateway configured with runtime.WithEnvelope.
+func WithEnvelope(e Envelope) Option {
+	return func(c *Client) {
+		if e.CodeField == "" {
+			e.CodeField = "code"
+		}
+		if e.MessageField == "" {
+			e.MessageField = "msg"
+		}
+		if e.DataField == "" {
+			e.DataField = "data"
+		}
+		c.envelope = &e
+	}
+}
+
+// WithRepeatedPathParamSeparator joins the values of the repeated path parameters with "sep",
+// "," by default, as the "repeated_path_param_separator" parameter of the gateway.
+func WithRepeatedPathParamSeparator(sep string) Option {
+	return func(c *Client) {
+		c.separator = sep
+	}
+}
+
+// CallOption configures a request.
+type CallOption func(*http.Request)
+
+// Header adds a header to the request.
+func Header(key, value string) CallOption {
+	return func(req *http.Request) {
+		req.Header.Add(key, value)
+	}
+}
+
+// Error is the error of a request answered with an error status.
+type Error struct {
+	// StatusCode is the HTTP status.
+	StatusCode int
+	// Code is the gRPC code of the error body, or else the one closest to StatusCode.
+	Code codes.Code
+	// Message is the message of the error body, or else the status text.
+	Message string
+	// EnvelopeCode is the code of the error envelope, if the client is configured with WithEnvelope.
+	EnvelopeCode int
+	// Body is the error body.
+	Body []byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("http %d: %s", e.StatusCode, e.Message)
+}
+
+// GRPCStatus returns the status of the error, so that status.Code(err) works.
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Message)
+}
+
+// Invoke sends "in" by "route" and decodes the response into "out".
+func (c *Client) Invoke(ctx context.Context, route *Route, in, out proto.Message, opts ...CallOption) error {
+	req, err := c.newRequest(ctx, route, in, opts)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return c.decodeResponse(route, resp, out)
+}
+
+// InvokeClientStream sends the messages returned by "next" until io.EOF as the body of a client
+// streaming "route", and decodes the response into "out". The messages are sent as they come.
+func (c *Client) InvokeClientStream(ctx context.Context, route *Route, next func() (proto.Message, error), out proto.Message, opts ...CallOption) error {
+	req, err := c.newStreamRequest(ctx, route, next, opts)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return c.decodeResponse(route, resp, out)
+}
+
+// Stream sends "in", or the messages returned by "next" for a bidi streaming route,
+// and returns the stream of the messages of the response.
+func (c *Client) Stream(ctx context.Context, route *Route, in proto.Message, next func() (proto.Message, error), opts ...CallOption) (*Stream, error) {
+	var req *http.Request
+	var err error
+	if next != nil {
+		req, err = c.newStreamRequest(ctx, route, next, opts)
+	} else {
+		req, err = c.newRequest(ctx, route, in, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, c.decodeError(resp)
+	}
+	return &Stream{c: c, route: route, resp: resp, dec: json.NewDecoder(resp.Body)}, nil
+}
+
+// Stream is the stream of the messages of a server streaming response.
+type Stream struct {
+	c     *Client
+	route *Route
+	resp  *http.Response
+	dec   *json.Decoder
+	read  bool
+}
+
+// Recv decodes the next message into "msg". It returns io.EOF at the end of the stream.
+func (s *Stream) Recv(msg proto.Message) error {
+	if s.route.HTTPBodyResponse {
+		buf := make([]byte, 32<<10)
+		n, err := io.ReadFull(s.resp.Body, buf)
+		if n == 0 {
+			if err == io.ErrUnexpectedEOF || err == nil {
+				err = io.EOF
+			}
+			return err
+		}
+		contentType := ""
+		if !s.read {
+			contentType = s.resp.Header.Get("Content-Type")
+		}
+		s.read = true
+		return s.c.unmarshal(httpBodyJSON(contentType, buf[:n]), "", msg)
+	}
+	var chunk json.RawMessage
+	if err := s.dec.Decode(&chunk); err != nil {
+		return err
+	}
+	s.read = true
+	if s.c.envelope != nil {
+		data, err := s.c.unwrapEnvelope(s.resp.StatusCode, chunk)
+		if err != nil {
+			return err
+		}
+		return s.c.unmarshal(data, "", msg)
+	}
+	var body struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			GRPCCode   int32  `json:"grpc_code"`
+			HTTPCode   int    `json:"http_code"`
+			Message    string `json:"message"`
+			HTTPStatus string `json:"http_status"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(chunk, &body); err != nil {
+		return err
+	}
+	if body.Error != nil {
+		e := body.Error
+		return &Error{StatusCode: e.HTTPCode, Code: codes.Code(e.GRPCCode), Message: e.Message, Body: chunk}
+	}
+	return s.c.unmarshal(body.Result, "", msg)
+}
+
+// Close closes the response.
+func (s *Stream) Close() error {
+	return s.resp.Body.Close()
+}
+
+// newRequest makes the request sending "in" by "route".
+func (c *Client) newRequest(ctx context.Context, route *Route, in proto.Message, opts []CallOption) (*http.Request, error) {
+	fields, err := c.fields(in)
+	if err != nil {
+		return nil, err
+	}
+	path, err := c.expandPath(route.Path, fields)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	var cookies []*http.Cookie
+	for _, p := range route.HeaderParams {
+		v, ok := takeField(fields, p.Field)
+		if !ok {
+			continue
+		}
+		s, err := c.paramString(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", p.Source, p.Name, err)
+		}
+		if p.Source == "cookie" {
+			cookies = append(cookies, &http.Cookie{Name: p.Name, Value: s})
+		} else {
+			header.Set(p.Name, s)
+		}
+	}
+
+	var body io.Reader
+	switch {
+	case route.HTTPBodyRequest:
+		prefix := ""
+		if route.Body != "*" {
+			prefix = route.Body + "."
+		}
+		contentType, _ := takeField(fields, prefix+"content_type")
+		data, _ := takeField(fields, prefix+"data")
+		s, _ := data.(string)
+		raw, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("data of the request: %v", err)
+		}
+		if ct, _ := contentType.(string); ct != "" {
+			header.Set("Content-Type", ct)
+		}
+		body = bytes.NewReader(raw)
+		if route.Body == "*" {
+			fields = nil
+		} else {
+			takeField(fields, route.Body)
+		}
+	case route.Body == "*":
+		buf, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(buf)
+		header.Set("Content-Type", "application/json")
+		fields = nil
+	case route.Body != "":
+		v, _ := takeField(fields, route.Body)
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(buf)
+		header.Set("Content-Type", "application/json")
+	}
+
+	query := make(url.Values)
+	if err := c.flattenQuery(query, "", fields); err != nil {
+		return nil, err
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(route.HTTPMethod, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, vs := range c.header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	return req, nil
+}
+
+// newStreamRequest makes the request of a client streaming "route", whose body is written
+// with the messages returned by "next" as they come.
+func (c *Client) newStreamRequest(ctx context.Context, route *Route, next func() (proto.Message, error), opts []CallOption) (*http.Request, error) {
+	path, err := c.expandPath(route.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the first message is read ahead for the content type of a google.api.HttpBody stream.
+	first, err := next()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	contentType := "application/json"
+	if route.HTTPBodyRequest && err == nil {
+		contentType = ""
+		if fields, ferr := c.fields(first); ferr == nil {
+			prefix := ""
+			if route.Body != "*" {
+				prefix = route.Body + "."
+			}
+			if ct, _ := getField(fields, prefix+"content_type"); ct != nil {
+				contentType, _ = ct.(string)
+			}
+		}
+	}
+	pr, pw := io.Pipe()
+	go func(msg proto.Message, err error) {
+		for err == nil {
+			if err = c.writeStreamMessage(pw, route, msg); err == nil {
+				msg, err = next()
+			}
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		pw.CloseWithError(err)
+	}(first, err)
+	req, err := http.NewRequest(route.HTTPMethod, c.baseURL+path, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, vs := range c.header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	return req, nil
+}
+
+// writeStreamMessage writes a message of a client stream to "w".
+func (c *Client) writeStreamMessage(w io.Writer, route *Route, msg proto.Message) error {
+	fields, err := c.fields(msg)
+	if err != nil {
+		return err
+	}
+	var v interface{} = fields
+	if route.Body != "*" && route.Body != "" {
+		v, _ = getField(fields, route.Body)
+	}
+	if route.HTTPBodyRequest {
+		m, _ := v.(map[string]interface{})
+		s, _ := m["data"].(string)
+		raw, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(raw)
+		return err
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+// fields returns the JSON object of "msg" with the proto field names.
+func (c *Client) fields(msg proto.Message) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if msg == nil {
+		return fields, nil
+	}
+	s, err := c.marshaler.MarshalToString(msg)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// expandPath replaces the variables of the path template with the fields of the request,
+// which are removed from "fields".
+func (c *Client) expandPath(tmpl string, fields map[string]interface{}) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(tmpl, '{')
+		if i < 0 {
+			b.WriteString(tmpl)
+			return b.String(), nil
+		}
+		j := strings.IndexByte(tmpl[i:], '}')
+		if j < 0 {
+			return "", fmt.Errorf("bad path template %q", tmpl)
+		}
+		b.WriteString(tmpl[:i])
+		name := tmpl[i+1 : i+j]
+		multi := false
+		if k := strings.IndexByte(name, '='); k >= 0 {
+			multi = strings.Contains(name[k+1:], "/") || strings.Contains(name[k+1:], "**")
+			name = name[:k]
+		}
+		v, ok := takeField(fields, name)
+		if !ok {
+			return "", fmt.Errorf("missing path parameter %s", name)
+		}
+		s, err := c.paramString(v)
+		if err != nil {
+			return "", fmt.Errorf("path parameter %s: %v", name, err)
+		}
+		if multi {
+			segs := strings.Split(s, "/")
+			for k := range segs {
+				segs[k] = url.PathEscape(segs[k])
+			}
+			b.WriteString(strings.Join(segs, "/"))
+		} else {
+			b.WriteString(url.PathEscape(s))
+		}
+		tmpl = tmpl[i+j+1:]
+	}
+}
+
+// paramString formats a path or header parameter.
+func (c *Client) paramString(v interface{}) (string, error) {
+	if values, ok := v.([]interface{}); ok {
+		s := make([]string, len(values))
+		for i, value := range values {
+			var err error
+			if s[i], err = scalarString(value); err != nil {
+				return "", err
+			}
+		}
+		return strings.Join(s, c.separator), nil
+	}
+	return scalarString(v)
+}
+
+func scalarString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	}
+	return "", fmt.Errorf("%T is not a scalar", v)
+}
+
+// flattenQuery adds the fields to "query" with the dotted paths of the nested fields.
+func (c *Client) flattenQuery(query url.Values, prefix string, fields map[string]interface{}) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := prefix + name
+		switch v := fields[name].(type) {
+		case map[string]interface{}:
+			if err := c.flattenQuery(query, key+".", v); err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, value := range v {
+				s, err := scalarString(value)
+				if err != nil {
+					return fmt.Errorf("query parameter %s: %v", key, err)
+				}
+				query.Add(key, s)
+			}
+		default:
+			s, err := scalarString(v)
+			if err != nil {
+				return fmt.Errorf("query parameter %s: %v", key, err)
+			}
+			query.Add(key, s)
+		}
+	}
+	return nil
+}
+
+// getField returns the field at the dotted "path" of "fields".
+func getField(fields map[string]interface{}, path string) (interface{}, bool) {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		next, ok := fields[name].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		fields = next
+	}
+	v, ok := fields[names[len(names)-1]]
+	return v, ok
+}
+
+// takeField returns and removes the field at the dotted "path" of "fields".
+func takeField(fields map[string]interface{}, path string) (interface{}, bool) {
+	v, ok := getField(fields, path)
+	if !ok {
+		return nil, false
+	}
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		fields = fields[name].(map[string]interface{})
+	}
+	delete(fields, names[len(names)-1])
+	return v, true
+}
+
+// decodeResponse decodes the response to a request by "route" into "out".
+func (c *Client) decodeResponse(route *Route, resp *http.Response, out proto.Message) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return c.decodeError(resp)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if route.HTTPBodyResponse {
+		return c.unmarshal(httpBodyJSON(resp.Header.Get("Content-Type"), body), route.ResponseBody, out)
+	}
+	if c.envelope != nil {
+		if body, err = c.unwrapEnvelope(resp.StatusCode, body); err != nil {
+			return err
+		}
+	}
+	if err := c.unmarshal(body, route.ResponseBody, out); err != nil {
+		return err
+	}
+	return setResponseFields(route, resp, out)
+}
+
+// setResponseFields sets the fields of "out" which the gateway writes as the headers and the status of "resp".
+func setResponseFields(route *Route, resp *http.Response, out proto.Message) error {
+	for _, h := range route.ResponseHeaders {
+		values := resp.Header[http.CanonicalHeaderKey(h.Header)]
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(out, h.Field, values); err != nil {
+			return fmt.Errorf("failed to set %s from header %s: %v", h.Field, h.Header, err)
+		}
+	}
+	if route.StatusField != "" {
+		if err := setField(out, route.StatusField, []string{strconv.Itoa(resp.StatusCode)}); err != nil {
+			return fmt.Errorf("failed to set %s from the status: %v", route.StatusField, err)
+		}
+	}
+	return nil
+}
+
+// setField sets the scalar or repeated field at the dotted "path" of "msg" to "values",
+// formatted as the gateway writes them in the headers.
+func setField(msg proto.Message, path string, values []string) error {
+	v := reflect.ValueOf(msg).Elem()
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("%s is not a message", name)
+		}
+		j := protoFieldIndex(v.Type(), name)
+		if j < 0 {
+			return fmt.Errorf("no field %s", name)
+		}
+		f := v.Field(j)
+		if i == len(names)-1 {
+			return setScalar(f, v.Type().Field(j).Tag.Get("protobuf"), values)
+		}
+		if f.Kind() == reflect.Ptr {
+			if f.IsNil() {
+				f.Set(reflect.New(f.Type().Elem()))
+			}
+			f = f.Elem()
+		}
+		v = f
+	}
+	return nil
+}
+
+// protoFieldIndex returns the index of the field of the generated struct type "t"
+// named "name" in the proto file, or -1.
+func protoFieldIndex(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		for _, opt := range strings.Split(t.Field(i).Tag.Get("protobuf"), ",") {
+			if opt == "name="+name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// setScalar sets the field "f" with the protobuf struct tag "tag" to "values".
+func setScalar(f reflect.Value, tag string, values []string) error {
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(f.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := setScalar(s.Index(i), tag, []string{v}); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+		return nil
+	}
+	if f.Kind() == reflect.Ptr {
+		// proto2 optional fields.
+		p := reflect.New(f.Type().Elem())
+		if err := setScalar(p.Elem(), tag, values); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+	s := values[0]
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Slice:
+		f.SetBytes([]byte(s))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			// the enums are written by the names of their values.
+			var ok bool
+			if n, ok = enumValue(tag, s); !ok {
+				return err
+			}
+		}
+		f.SetInt(n)
+	case reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
+
+// enumValue returns the number of the value "name" of the enum of the protobuf struct tag "tag".
+func enumValue(tag, name string) (int64, bool) {
+	for _, opt := range strings.Split(tag, ",") {
+		if strings.HasPrefix(opt, "enum=") {
+			n, ok := proto.EnumValueMap(strings.TrimPrefix(opt, "enum="))[name]
+			return int64(n), ok
+		}
+	}
+	return 0, false
+}
+
+// unmarshal decodes the JSON "data" into the field at "path" of "out", or "out" itself if empty.
+func (c *Client) unmarshal(data []byte, path string, out proto.Message) error {
+	if len(bytes.TrimSpace(data)) == 0 || string(data) == "null" {
+		return nil
+	}
+	if path != "" {
+		names := strings.Split(path, ".")
+		for i := len(names) - 1; i >= 0; i-- {
+			key, err := json.Marshal(names[i])
+			if err != nil {
+				return err
+			}
+			data = []byte(fmt.Sprintf("{%s:%s}", key, data))
+		}
+	}
+	u := &jsonpb.Unmarshaler{AllowUnknownFields: true}
+	return u.Unmarshal(bytes.NewReader(data), out)
+}
+
+func httpBodyJSON(contentType string, data []byte) []byte {
+	buf, _ := json.Marshal(map[string]interface{}{
+		"content_type": contentType,
+		"data":         data,
+	})
+	return buf
+}
+
+// unwrapEnvelope returns the data of the envelope "body", or the error it holds.
+func (c *Client) unwrapEnvelope(statusCode int, body []byte) ([]byte, error) {
+	e := c.envelope
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return nil, err
+	}
+	var code int
+	var msg string
+	json.Unmarshal(obj[e.CodeField], &code)
+	json.Unmarshal(obj[e.MessageField], &msg)
+	if code != e.SuccessCode {
+		err := &Error{StatusCode: statusCode, Code: codes.Unknown, Message: msg, EnvelopeCode: code, Body: body}
+		if c, ok := c.grpcCode(code); ok {
+			err.Code = c
+		}
+		return nil, err
+	}
+	return obj[e.DataField], nil
+}
+
+// grpcCode returns the gRPC code of the code of an error envelope, if it maps to one.
+func (c *Client) grpcCode(code int) (codes.Code, bool) {
+	if c.envelope.GRPCCode != nil {
+		return c.envelope.GRPCCode(code), true
+	}
+	if code > int(codes.OK) && code <= int(codes.Unauthenticated) {
+		return codes.Code(code), true
+	}
+	return codes.Unknown, false
+}
+
+// decodeError returns the error of an error response, in the formats of the gateway.
+func (c *Client) decodeError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Code:       codeOfHTTPStatus(resp.StatusCode),
+		Message:    http.StatusText(resp.StatusCode),
+		Body:       body,
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(body, &obj) != nil {
+		return e
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/problem+json":
+		json.Unmarshal(obj["detail"], &e.Message)
+		var name string
+		if json.Unmarshal(obj["code"], &name) == nil {
+			if code, ok := codeNames[name]; ok {
+				e.Code = code
+			}
+		}
+	case c.envelope != nil:
+		json.Unmarshal(obj[c.envelope.MessageField], &e.Message)
+		if json.Unmarshal(obj[c.envelope.CodeField], &e.EnvelopeCode) == nil {
+			if code, ok := c.grpcCode(e.EnvelopeCode); ok {
+				e.Code = code
+			}
+		}
+	default:
+		json.Unmarshal(obj["message"], &e.Message)
+		var code int32
+		if json.Unmarshal(obj["code"], &code) == nil {
+			e.Code = codes.Code(code)
+		}
+	}
+	return e
+}
+
+var codeNames = func() map[string]codes.Code {
+	names := make(map[string]codes.Code)
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		names[c.String()] = c
+	}
+	return names
+}()
+
+// codeOfHTTPStatus returns the gRPC code closest to the HTTP status "code".
+func codeOfHTTPStatus(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if code >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInvoke(t *testing.T) {
+	var gotPath, gotQuery, gotBody, gotHeader string
+	reply := `{"identifier_value": "ok", "positive_int_value": "9"}`
+	replyStatus := http.StatusOK
+	replyType := "application/json"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		gotPath, gotQuery, gotBody, gotHeader = req.URL.EscapedPath(), req.URL.RawQuery, string(body), req.Header.Get("X-Id")
+		w.Header().Set("Content-Type", replyType)
+		w.WriteHeader(replyStatus)
+		io.WriteString(w, reply)
+	}))
+	defer srv.Close()
+	c := New(srv.URL + "/")
+	in := &descriptor.UninterpretedOption{
+		IdentifierValue:  proto.String("a b/c"),
+		PositiveIntValue: proto.Uint64(7),
+		AggregateValue:   proto.String("x"),
+		StringValue:      []byte("v"),
+	}
+
+	out := new(descriptor.UninterpretedOption)
+	route := &Route{
+		HTTPMethod:   "GET",
+		Path:         "/v1/opts/{identifier_value}",
+		HeaderParams: []HeaderParam{{Source: "header", Name: "X-Id", Field: "aggregate_value"}},
+	}
+	if err := c.Invoke(context.Background(), route, in, out); err != nil {
+		t.Fatalf("Invoke(%s) failed with %v", route.Path, err)
+	}
+	if want := "/v1/opts/a%20b%2Fc"; gotPath != want {
+		t.Errorf("Invoke(%s) requested path %s; want %s", route.Path, gotPath, want)
+	}
+	if want := "positive_int_value=7&string_value=dg%3D%3D"; gotQuery != want {
+		t.Errorf("Invoke(%s) requested query %s; want %s", route.Path, gotQuery, want)
+	}
+	if gotHeader != "x" {
+		t.Errorf("Invoke(%s) sent X-Id %q; want %q", route.Path, gotHeader, "x")
+	}
+	if out.GetIdentifierValue() != "ok" || out.GetPositiveIntValue() != 9 {
+		t.Errorf("Invoke(%s) decoded %v; want %s", route.Path, out, reply)
+	}
+
+	route = &Route{HTTPMethod: "POST", Path: "/v1/opts/{identifier_value=**}", Body: "*", ResponseBody: "identifier_value"}
+	reply = `"z"`
+	out.Reset()
+	if err := c.Invoke(context.Background(), route, in, out, Header("X-Id", "y")); err != nil {
+		t.Fatalf("Invoke(%s) failed with %v", route.Path, err)
+	}
+	if want := "/v1/opts/a%20b/c"; gotPath != want {
+		t.Errorf("Invoke(%s) requested path %s; want %s", route.Path, gotPath, want)
+	}
+	if want := `{"aggregate_value":"x","positive_int_value":"7","string_value":"dg=="}`; gotBody != want || gotQuery != "" {
+		t.Errorf("Invoke(%s) sent body %s and query %q; want body %s", route.Path, gotBody, gotQuery, want)
+	}
+	if gotHeader != "y" || out.GetIdentifierValue() != "z" {
+		t.Errorf("Invoke(%s) sent X-Id %q and decoded %v; want y and the response body z", route.Path, gotHeader, out)
+	}
+
+	for _, spec := range []struct {
+		status      int
+		contentType string
+		body        string
+		code        codes.Code
+		message     string
+	}{
+		{status: http.StatusNotFound, contentType: "application/json", body: `{"code": 5, "message": "gone"}`, code: codes.NotFound, message: "gone"},
+		{status: http.StatusConflict, contentType: "application/problem+json", body: `{"code": "AlreadyExists", "detail": "taken"}`, code: codes.AlreadyExists, message: "taken"},
+		{status: http.StatusServiceUnavailable, contentType: "text/plain", body: "down", code: codes.Unavailable, message: "Service Unavailable"},
+	} {
+		replyStatus, replyType, reply = spec.status, spec.contentType, spec.body
+		err := c.Invoke(context.Background(), route, in, out)
+		if s := status.Convert(err); s.Code() != spec.code || s.Message() != spec.message {
+			t.Errorf("Invoke() of a %d %s response = %v; want %v %q", spec.status, spec.body, err, spec.code, spec.message)
+		}
+	}
+
+	c = New(srv.URL, WithEnvelope(Envelope{}))
+	replyStatus, replyType = http.StatusOK, "application/json"
+	reply = `{"code": 0, "msg": "", "data": {"identifier_value": "wrapped"}}`
+	route = &Route{HTTPMethod: "POST", Path: "/v1/opts", Body: "*"}
+	if err := c.Invoke(context.Background(), route, in, out); err != nil || out.GetIdentifierValue() != "wrapped" {
+		t.Errorf("Invoke() with envelope = %v, %v; want the data of the envelope", out, err)
+	}
+	reply = `{"code": 1001, "msg": "expired", "data": null}`
+	err := c.Invoke(context.Background(), route, in, out)
+	if e, ok := err.(*Error); !ok || e.Message != "expired" || e.EnvelopeCode != 1001 || e.Code != codes.Unknown {
+		t.Errorf("Invoke() of an envelope with code 1001 = %#v; want the error expired with the envelope code", err)
+	}
+	reply = `{"code": 5, "msg": "gone", "data": null}`
+	if err := c.Invoke(context.Background(), route, in, out); status.Code(err) != codes.NotFound {
+		t.Errorf("Invoke() of an envelope with code 5 = %v; want NotFound", err)
+	}
+}
+
+func TestInvokeResponseFields(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/v1/fields/f")
+		w.Header().Set("X-Type", "TYPE_STRING")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"json_name": "f"}`)
+	}))
+	defer srv.Close()
+	route := &Route{
+		HTTPMethod:      "POST",
+		Path:            "/v1/fields",
+		Body:            "*",
+		ResponseHeaders: []ResponseHeader{{Field: "name", Header: "Location"}, {Field: "type", Header: "X-Type"}, {Field: "extendee", Header: "X-Missing"}},
+		StatusField:     "number",
+	}
+	out := new(descriptor.FieldDescriptorProto)
+	if err := New(srv.URL).Invoke(context.Background(), route, &descriptor.FieldDescriptorProto{}, out); err != nil {
+		t.Fatalf("Invoke() failed with %v", err)
+	}
+	if out.GetName() != "/v1/fields/f" || out.GetType() != descriptor.FieldDescriptorProto_TYPE_STRING || out.GetNumber() != 201 || out.GetJsonName() != "f" || out.Extendee != nil {
+		t.Errorf("Invoke() decoded %v; want the fields of the headers, the status and the body", out)
+	}
+}
+
+func TestStream(t *testing.T) {
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		gotBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"result": {"identifier_value": "a"}}`+"\n")
+		io.WriteString(w, `{"result": {"identifier_value": "b"}}`+"\n")
+		io.WriteString(w, `{"error": {"grpc_code": 14, "http_code": 503, "message": "lost", "http_status": "Service Unavailable"}}`+"\n")
+	}))
+	defer srv.Close()
+	c := New(srv.URL)
+	route := &Route{HTTPMethod: "POST", Path: "/v1/opts:stream", Body: "*"}
+
+	sent := []string{"1", "2"}
+	next := func() (proto.Message, error) {
+		if len(sent) == 0 {
+			return nil, io.EOF
+		}
+		msg := &descriptor.UninterpretedOption{IdentifierValue: proto.String(sent[0])}
+		sent = sent[1:]
+		return msg, nil
+	}
+	stream, err := c.Stream(context.Background(), route, nil, next)
+	if err != nil {
+		t.Fatalf("Stream() failed with %v", err)
+	}
+	defer stream.Close()
+	if want := "{\"identifier_value\":\"1\"}\n{\"identifier_value\":\"2\"}\n"; gotBody != want {
+		t.Errorf("Stream() sent %q; want %q", gotBody, want)
+	}
+	var got []string
+	for {
+		msg := new(descriptor.UninterpretedOption)
+		if err = stream.Recv(msg); err != nil {
+			break
+		}
+		got = append(got, msg.GetIdentifierValue())
+	}
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Stream() received %q; want [a b]", got)
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Stream() ended with %v; want the error of the stream", err)
+	}
+	if err = stream.Recv(new(descriptor.UninterpretedOption)); err != io.EOF {
+		t.Errorf("Recv() after the end = %v; want io.EOF", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/golang/glog"
@@ -133,6 +134,63 @@ func (r *Registry) ParseCommentsSource(fileDesc []*descriptor.FileDescriptorProt
 	return nil
 }
 
+// LoadComments sets the comments of the services and the methods of "file",
+// as loaded by AddComments and ParseCommentsSource.
+func (r *Registry) LoadComments(file *File) {
+	comments := r.FileComments[file.GetName()]
+	getComment := func(keys ...string) string {
+		if pp, ok := r.CommentsMap[strings.Join(keys, "/")]; ok {
+			return comments[pp]
+		}
+		return ""
+	}
+	for _, svc := range file.Services {
+		svc.Comment = getComment(file.GetName(), svc.GetName())
+		for _, m := range svc.Methods {
+			m.Comment = getComment(file.GetName(), svc.GetName(), m.GetName())
+		}
+	}
+}
+
+// SourceComments returns the leading comments of the source code info of "file" by their paths,
+// e.g. "6,0,2,1" for the second method of the first service, as loaded by AddComments.
+func SourceComments(file *descriptor.FileDescriptorProto) map[string]string {
+	comments := make(map[string]string)
+	for _, loc := range file.GetSourceCodeInfo().GetLocation() {
+		if loc.LeadingComments == nil {
+			continue
+		}
+		var t []string
+		for _, n := range loc.Path {
+			t = append(t, strconv.Itoa(int(n)))
+		}
+		comments[strings.Join(t, ",")] = strings.TrimSpace(*loc.LeadingComments)
+	}
+	return comments
+}
+
+// SourcePaths returns the source code paths of the messages and the enums of "file" by their descriptors,
+// e.g. "4,0" for the first message. The comments of AddComments are keyed by these paths, followed by
+// ",2,<index>" for the fields of a message and the values of an enum.
+func SourcePaths(file *descriptor.FileDescriptorProto) map[interface{}]string {
+	paths := make(map[interface{}]string)
+	var walk func(prefix string, msgs []*descriptor.DescriptorProto, enums []*descriptor.EnumDescriptorProto, msgTag, enumTag int)
+	walk = func(prefix string, msgs []*descriptor.DescriptorProto, enums []*descriptor.EnumDescriptorProto, msgTag, enumTag int) {
+		for i, e := range enums {
+			paths[e] = fmt.Sprintf("%s%d,%d", prefix, enumTag, i)
+		}
+		for i, msg := range msgs {
+			path := fmt.Sprintf("%s%d,%d", prefix, msgTag, i)
+			paths[msg] = path
+			// the nested messages and enums are the fields 3 and 4 of DescriptorProto.
+			walk(path+",", msg.GetNestedType(), msg.GetEnumType(), 3, 4)
+		}
+	}
+	// the messages and enums are the fields 4 and 5 of FileDescriptorProto.
+	walk("", file.GetMessageType(), file.GetEnumType(), 4, 5)
+	return paths
+}
+
 // Load loads definitions of services, methods, messages, enumerations and fields from "req".
 func (r *Registry) Load(req *plugin.CodeGeneratorRequest) error {
 	for _, file := range req.GetProtoFile() {
@@ -9,6 +9,7 @@ import (
 	"github.com/golang/protobuf/protoc-gen-go/descriptor"
 	options "google.golang.org/genproto/googleapis/api/annotations"
 
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/httpgw"
 	"github.com/generalzgd/protoc-gen-grpc-httpgw/httprule"
 )
 
@@ -137,6 +138,11 @@ func (r *Registry) newMethod(svc *Service, md *descriptor.MethodDescriptorProto,
 			b.PathParams = append(b.PathParams, param)
 		}
 
+		b.HeaderParams, err = r.newHeaderParams(meth, b.PathParams)
+		if err != nil {
+			return nil, err
+		}
+
 		// TODO(yugui) Handle query params
 
 		b.Body, err = r.newBody(meth, opts.Body)
@@ -229,6 +235,249 @@ func (r *Registry) newParam(meth *Method, path string) (Parameter, error) {
 	}, nil
 }
 
+// newHeaderParams returns the parameters of the fields of the request message, nested ones included,
+// which have the "httpgw.from_header" or "httpgw.from_cookie" option.
+func (r *Registry) newHeaderParams(meth *Method, pathParams []Parameter) ([]HeaderParameter, error) {
+	bound := make(map[string]bool)
+	for _, p := range pathParams {
+		bound[p.FieldPath.String()] = true
+	}
+	var params []HeaderParameter
+	var walk func(msg *Message, prefix string, seen map[string]bool) error
+	walk = func(msg *Message, prefix string, seen map[string]bool) error {
+		if seen[msg.FQMN()] {
+			return nil
+		}
+		seen[msg.FQMN()] = true
+		defer delete(seen, msg.FQMN())
+
+		for _, f := range msg.Fields {
+			path := prefix + f.GetName()
+			source, name, err := extractHeaderOptions(f)
+			if err != nil {
+				return fmt.Errorf("%v: %s in %s.%s", err, path, meth.Service.GetName(), meth.GetName())
+			}
+			if source != "" {
+				if bound[path] {
+					return fmt.Errorf("field %s of %s.%s is bound to both a path parameter and a %s", path, meth.Service.GetName(), meth.GetName(), source)
+				}
+				param, err := r.newParam(meth, path)
+				if err != nil {
+					return err
+				}
+				params = append(params, HeaderParameter{Parameter: param, Source: source, Name: name})
+				continue
+			}
+			if f.GetType() != descriptor.FieldDescriptorProto_TYPE_MESSAGE || f.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED || IsWellKnownType(f.GetTypeName()) {
+				continue
+			}
+			fmsg, err := r.LookupMsg(msg.FQMN(), f.GetTypeName())
+			if err != nil {
+				// map entries and unloaded types can not carry the options.
+				continue
+			}
+			if err := walk(fmsg, path+".", seen); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(meth.RequestType, "", make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// extractHeaderOptions returns the source ("header" or "cookie") and the name the field is bound to.
+func extractHeaderOptions(f *Field) (string, string, error) {
+	if f.Options == nil {
+		return "", "", nil
+	}
+	var source, name string
+	for _, opt := range []struct {
+		source string
+		desc   *proto.ExtensionDesc
+	}{
+		{"header", httpgw.E_FromHeader},
+		{"cookie", httpgw.E_FromCookie},
+	} {
+		if !proto.HasExtension(f.Options, opt.desc) {
+			continue
+		}
+		ext, err := proto.GetExtension(f.Options, opt.desc)
+		if err != nil {
+			return "", "", err
+		}
+		v, ok := ext.(*string)
+		if !ok || *v == "" {
+			return "", "", fmt.Errorf("empty %s", opt.desc.Name)
+		}
+		if source != "" {
+			return "", "", fmt.Errorf("both %s and %s are set", httpgw.E_FromHeader.Name, httpgw.E_FromCookie.Name)
+		}
+		source, name = opt.source, *v
+	}
+	return source, name, nil
+}
+
+// CheckResponseFields checks the fields declared by the "@resheader" and "@status" tags of "meth"
+// are scalar fields of its response message, and the status field is an integer or an enum.
+// It must be called after the comments of the method are loaded.
+func (r *Registry) CheckResponseFields(meth *Method) error {
+	headers, err := meth.GetResponseHeaders()
+	if err != nil {
+		return err
+	}
+	for _, h := range headers {
+		if _, err := r.resolveResponseField(meth, h.Field, true); err != nil {
+			return fmt.Errorf("%s %s: %v", TagResHeader, h.Field, err)
+		}
+	}
+	st, err := meth.GetResponseStatus()
+	if err != nil {
+		return err
+	}
+	if st.Field == "" {
+		return nil
+	}
+	f, err := r.resolveResponseField(meth, st.Field, false)
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", TagStatus, st.Field, err)
+	}
+	switch f.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_INT64,
+		descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_UINT64,
+		descriptor.FieldDescriptorProto_TYPE_SINT32, descriptor.FieldDescriptorProto_TYPE_SINT64,
+		descriptor.FieldDescriptorProto_TYPE_FIXED32, descriptor.FieldDescriptorProto_TYPE_FIXED64,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED32, descriptor.FieldDescriptorProto_TYPE_SFIXED64,
+		descriptor.FieldDescriptorProto_TYPE_ENUM:
+		return nil
+	}
+	return fmt.Errorf("%s %s: not an integer field of %s.%s", TagStatus, st.Field, meth.Service.GetName(), meth.GetName())
+}
+
+// CheckHashKey checks the source declared by the "@hashkey" tag of "meth" exists:
+// a field key must be a scalar field of the request message, and a path key must be
+// a path parameter of every binding. Field keys are not supported by client streaming methods,
+// whose endpoint is picked before the first message is read.
+// It must be called after the comments of the method are loaded.
+func (r *Registry) CheckHashKey(meth *Method) error {
+	key, err := meth.GetHashKey()
+	if err != nil {
+		return err
+	}
+	switch key.Source {
+	case "field":
+		if meth.GetClientStreaming() {
+			return fmt.Errorf("%s field:%s: not supported by client streaming method %s.%s", TagHashKey, key.Name, meth.Service.GetName(), meth.GetName())
+		}
+		fields, err := r.resolveFieldPath(meth.RequestType, key.Name, false)
+		if err != nil {
+			return fmt.Errorf("%s field:%s: %v", TagHashKey, key.Name, err)
+		}
+		for _, c := range fields {
+			f := c.Target
+			if f.OneofIndex != nil || f.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED {
+				return fmt.Errorf("%s field:%s: oneof or repeated field %s not allowed in %s.%s", TagHashKey, key.Name, f.GetName(), meth.Service.GetName(), meth.GetName())
+			}
+		}
+		f := fields[len(fields)-1].Target
+		if f.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE || f.GetType() == descriptor.FieldDescriptorProto_TYPE_GROUP {
+			return fmt.Errorf("%s field:%s: message field not allowed in %s.%s", TagHashKey, key.Name, meth.Service.GetName(), meth.GetName())
+		}
+	case "path":
+		for _, b := range meth.Bindings {
+			found := false
+			for _, p := range b.PathParams {
+				if p.FieldPath.String() == key.Name {
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s path:%s: no such path parameter in %s of %s.%s", TagHashKey, key.Name, b.PathTmpl.Template, meth.Service.GetName(), meth.GetName())
+			}
+		}
+	}
+	return nil
+}
+
+// CheckUploads checks the uploads declared by the "@upload" tags of "meth": the part fields must be
+// bytes fields of the request message, the filename and content type fields string fields, and every
+// binding must have a body. A client streaming method takes one upload, and bidi streaming methods none.
+// Only client streaming methods take a chunk size.
+// It must be called after the comments of the method are loaded.
+func (r *Registry) CheckUploads(meth *Method) error {
+	uploads, err := meth.GetUploads()
+	if err != nil || len(uploads) == 0 {
+		return err
+	}
+	name := meth.Service.GetName() + "." + meth.GetName()
+	switch {
+	case meth.GetClientStreaming() && meth.GetServerStreaming():
+		return fmt.Errorf("%s: not supported by bidi streaming method %s", TagUpload, name)
+	case meth.GetClientStreaming() && len(uploads) > 1:
+		return fmt.Errorf("%s: client streaming method %s takes one upload", TagUpload, name)
+	}
+	for _, b := range meth.Bindings {
+		if b.Body == nil {
+			return fmt.Errorf("%s: %s %s of %s has no body", TagUpload, b.HTTPMethod, b.PathTmpl.Template, name)
+		}
+	}
+	for _, u := range uploads {
+		if u.ChunkSize > 0 && !meth.GetClientStreaming() {
+			return fmt.Errorf("%s %s: chunk only applies to client streaming methods, not %s", TagUpload, u.Part, name)
+		}
+		for _, f := range []struct {
+			path string
+			typ  descriptor.FieldDescriptorProto_Type
+		}{
+			{u.Field, descriptor.FieldDescriptorProto_TYPE_BYTES},
+			{u.FilenameField, descriptor.FieldDescriptorProto_TYPE_STRING},
+			{u.ContentTypeField, descriptor.FieldDescriptorProto_TYPE_STRING},
+		} {
+			if f.path == "" {
+				continue
+			}
+			fields, err := r.resolveFieldPath(meth.RequestType, f.path, false)
+			if err != nil {
+				return fmt.Errorf("%s %s: %v", TagUpload, u.Part, err)
+			}
+			for _, c := range fields {
+				if c.Target.OneofIndex != nil || c.Target.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED {
+					return fmt.Errorf("%s %s: oneof or repeated field %s not allowed in %s", TagUpload, u.Part, c.Target.GetName(), name)
+				}
+			}
+			if typ := fields[len(fields)-1].Target.GetType(); typ != f.typ {
+				return fmt.Errorf("%s %s: field %s is %s, want %s in %s", TagUpload, u.Part, f.path, typ, f.typ, name)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveResponseField resolves "path" in the response message of "meth" into a scalar field.
+// Only the last field may be repeated, and only if "allowRepeated".
+func (r *Registry) resolveResponseField(meth *Method, path string, allowRepeated bool) (*Field, error) {
+	fields, err := r.resolveFieldPath(meth.ResponseType, path, true)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range fields {
+		f := c.Target
+		if f.OneofIndex != nil {
+			return nil, fmt.Errorf("oneof field %s not supported in %s.%s", f.GetName(), meth.Service.GetName(), meth.GetName())
+		}
+		if f.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED && (i < len(fields)-1 || !allowRepeated) {
+			return nil, fmt.Errorf("repeated field %s not allowed in %s.%s", f.GetName(), meth.Service.GetName(), meth.GetName())
+		}
+	}
+	f := fields[len(fields)-1].Target
+	if f.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE || f.GetType() == descriptor.FieldDescriptorProto_TYPE_GROUP {
+		return nil, fmt.Errorf("message field %s not allowed in %s.%s", f.GetName(), meth.Service.GetName(), meth.GetName())
+	}
+	return f, nil
+}
+
 func (r *Registry) newBody(meth *Method, path string) (*Body, error) {
 	msg := meth.RequestType
 	switch path {
@@ -268,6 +517,88 @@ func lookupField(msg *Message, name string) *Field {
 	return nil
 }
 
+// QueryParams returns the fields of the request message of "b" which the gateway parses from the query
+// parameters named by their paths: the scalar fields, repeated or not, the well-known messages parsed
+// from a single value, and the fields of the nested messages, except the ones bound to the path, the body
+// or the headers. There are none if the whole request message is the body.
+func (r *Registry) QueryParams(b *Binding) []FieldPath {
+	if b.Body != nil && len(b.Body.FieldPath) == 0 {
+		return nil
+	}
+	excluded := make(map[string]bool)
+	for _, p := range b.ExplicitParams() {
+		excluded[p] = true
+	}
+	return r.queryParams(b.Method.RequestType, nil, excluded, make(map[string]bool))
+}
+
+// FormParams returns the fields of the request message of "b" which the gateway parses from the
+// non-file parts of a multipart/form-data body, named by their paths like the query parameters:
+// the fields of QueryParams with the body included, except the ones of the "@upload" tags.
+func (r *Registry) FormParams(b *Binding) ([]FieldPath, error) {
+	uploads, err := b.Method.GetUploads()
+	if err != nil {
+		return nil, err
+	}
+	excluded := make(map[string]bool)
+	for _, p := range b.PathParams {
+		excluded[p.FieldPath.String()] = true
+	}
+	for _, p := range b.HeaderParams {
+		excluded[p.FieldPath.String()] = true
+	}
+	for _, u := range uploads {
+		excluded[u.Field] = true
+		excluded[u.FilenameField] = true
+		excluded[u.ContentTypeField] = true
+	}
+	return r.queryParams(b.Method.RequestType, nil, excluded, make(map[string]bool)), nil
+}
+
+func (r *Registry) queryParams(msg *Message, prefix FieldPath, excluded, visiting map[string]bool) []FieldPath {
+	visiting[msg.FQMN()] = true
+	defer delete(visiting, msg.FQMN())
+	var params []FieldPath
+	for _, f := range msg.Fields {
+		path := append(append(FieldPath(nil), prefix...), FieldPathComponent{Name: f.GetName(), Target: f})
+		if excluded[path.String()] {
+			continue
+		}
+		if f.GetType() != descriptor.FieldDescriptorProto_TYPE_MESSAGE && f.GetType() != descriptor.FieldDescriptorProto_TYPE_GROUP {
+			params = append(params, path)
+			continue
+		}
+		if f.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED {
+			continue
+		}
+		child, err := r.LookupMsg("", f.GetTypeName())
+		if err != nil || child.GetOptions().GetMapEntry() || visiting[child.FQMN()] {
+			continue
+		}
+		switch {
+		case IsWellKnownType(child.FQMN()):
+			params = append(params, path)
+		case strings.HasPrefix(child.FQMN(), ".google.protobuf.") || child.FQMN() == HTTPBodyType:
+		default:
+			params = append(params, r.queryParams(child, path, excluded, visiting)...)
+		}
+	}
+	return params
+}
+
+// LookupField returns the field at the dotted "path" of "msg", e.g. the field of a
+// "@resheader" tag in the response message.
+func (r *Registry) LookupField(msg *Message, path string) (*Field, error) {
+	fields, err := r.resolveFieldPath(msg, path, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty field path")
+	}
+	return fields[len(fields)-1].Target, nil
+}
+
 // resolveFieldPath resolves "path" into a list of fieldDescriptor, starting from "msg".
 func (r *Registry) resolveFieldPath(msg *Message, path string, isPathParam bool) ([]FieldPathComponent, error) {
 	if path == "" {
@@ -1109,6 +1109,40 @@ func TestResolveFieldPath(t *testing.T) {
 	}
 }
 
+func TestLookupField(t *testing.T) {
+	src := `
+		name: 'example.proto'
+		package: 'example'
+		message_type <
+			name: 'ExampleMessage'
+			field < name: 'nested' type: TYPE_MESSAGE type_name: 'AnotherMessage' label: LABEL_OPTIONAL number: 1 >
+		>
+		message_type <
+			name: 'AnotherMessage'
+			field < name: 'tags' type: TYPE_STRING label: LABEL_REPEATED number: 1 >
+		>
+	`
+	var file descriptor.FileDescriptorProto
+	if err := proto.UnmarshalText(src, &file); err != nil {
+		t.Fatalf("proto.Unmarshal(%s) failed with %v; want success", src, err)
+	}
+	reg := NewRegistry()
+	reg.loadFile(&file)
+	f, err := reg.LookupFile(file.GetName())
+	if err != nil {
+		t.Fatalf("reg.LookupFile(%q) failed with %v; want success", file.GetName(), err)
+	}
+	field, err := reg.LookupField(f.Messages[0], "nested.tags")
+	if err != nil || field != f.Messages[1].Fields[0] {
+		t.Errorf("reg.LookupField(%q) = %v, %v; want the field tags", "nested.tags", field, err)
+	}
+	for _, path := range []string{"", "nested.missing"} {
+		if _, err := reg.LookupField(f.Messages[0], path); err == nil {
+			t.Errorf("reg.LookupField(%q) succeeded; want an error", path)
+		}
+	}
+}
+
 func TestExtractServicesWithDeleteBody(t *testing.T) {
 	for _, spec := range []struct {
 		allowDeleteBody bool
@@ -1209,3 +1243,364 @@ func TestExtractServicesWithDeleteBody(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestExtractServicesWithHeaderParams(t *testing.T) {
+	src := `
+		name: "path/to/example.proto",
+		package: "example"
+		message_type <
+			name: "EchoRequest"
+			field <
+				name: "id"
+				number: 1
+				label: LABEL_OPTIONAL
+				type: TYPE_STRING
+			>
+			field <
+				name: "device_id"
+				number: 2
+				label: LABEL_OPTIONAL
+				type: TYPE_STRING
+				options <
+					[httpgw.from_header]: "X-Device-Id"
+				>
+			>
+			field <
+				name: "client"
+				number: 3
+				label: LABEL_OPTIONAL
+				type: TYPE_MESSAGE
+				type_name: "Client"
+			>
+		>
+		message_type <
+			name: "Client"
+			field <
+				name: "guid"
+				number: 1
+				label: LABEL_OPTIONAL
+				type: TYPE_STRING
+				options <
+					[httpgw.from_cookie]: "ZQ_GUID"
+				>
+			>
+			field <
+				name: "parent"
+				number: 2
+				label: LABEL_OPTIONAL
+				type: TYPE_MESSAGE
+				type_name: "Client"
+			>
+		>
+		service <
+			name: "ExampleService"
+			method <
+				name: "Echo"
+				input_type: "EchoRequest"
+				output_type: "EchoRequest"
+				options <
+					[google.api.http] <
+						get: "/v1/example/echo/{id}"
+					>
+				>
+			>
+		>
+	`
+	var fd descriptor.FileDescriptorProto
+	if err := proto.UnmarshalText(src, &fd); err != nil {
+		t.Fatalf("proto.UnmarshalText(%s, &fd) failed with %v; want success", src, err)
+	}
+	reg := NewRegistry()
+	reg.loadFile(&fd)
+	file := reg.files["path/to/example.proto"]
+	if err := reg.loadServices(file); err != nil {
+		t.Fatalf("loadServices(%q) failed with %v; want success", file.GetName(), err)
+	}
+
+	params := file.Services[0].Methods[0].Bindings[0].HeaderParams
+	var got []string
+	for _, p := range params {
+		got = append(got, p.Source+":"+p.Name+"="+p.FieldPath.String())
+	}
+	want := []string{"header:X-Device-Id=device_id", "cookie:ZQ_GUID=client.guid"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HeaderParams = %q; want %q", got, want)
+	}
+	if got, want := params[1].Target.GetName(), "guid"; got != want {
+		t.Errorf("HeaderParams[1].Target = %q; want %q", got, want)
+	}
+
+	// a field can not be bound to both a path parameter and a header.
+	fd.MessageType[0].Field[0].Options = fd.MessageType[0].Field[1].Options
+	reg = NewRegistry()
+	reg.loadFile(&fd)
+	if err := reg.loadServices(reg.files["path/to/example.proto"]); err == nil {
+		t.Errorf("loadServices succeeded with a path parameter bound to a header; want failure")
+	}
+}
+
+func TestCheckResponseFields(t *testing.T) {
+	src := `
+		name: "path/to/example.proto",
+		package: "example"
+		message_type <
+			name: "Reply"
+			field <
+				name: "location"
+				number: 1
+				label: LABEL_OPTIONAL
+				type: TYPE_STRING
+			>
+			field <
+				name: "http_status"
+				number: 2
+				label: LABEL_OPTIONAL
+				type: TYPE_INT32
+			>
+			field <
+				name: "page"
+				number: 3
+				label: LABEL_OPTIONAL
+				type: TYPE_MESSAGE
+				type_name: "Reply"
+			>
+			field <
+				name: "tags"
+				number: 4
+				label: LABEL_REPEATED
+				type: TYPE_STRING
+			>
+		>
+		service <
+			name: "ExampleService"
+			method <
+				name: "Echo"
+				input_type: "Reply"
+				output_type: "Reply"
+			>
+		>
+	`
+	var fd descriptor.FileDescriptorProto
+	if err := proto.UnmarshalText(src, &fd); err != nil {
+		t.Fatalf("proto.UnmarshalText(%s, &fd) failed with %v; want success", src, err)
+	}
+	reg := NewRegistry()
+	reg.loadFile(&fd)
+	file := reg.files["path/to/example.proto"]
+	if err := reg.loadServices(file); err != nil {
+		t.Fatalf("loadServices(%q) failed with %v; want success", file.GetName(), err)
+	}
+	meth := file.Services[0].Methods[0]
+	for _, spec := range []struct {
+		comment string
+		wantErr bool
+	}{
+		{comment: "@transmit\n@resheader location=Location\n@resheader page.tags=X-Tags\n@status http_status omit"},
+		{comment: "@transmit\n@resheader page=X-Page", wantErr: true},
+		{comment: "@transmit\n@resheader missing=X-Missing", wantErr: true},
+		{comment: "@transmit\n@status location", wantErr: true},
+		{comment: "@transmit\n@status tags", wantErr: true},
+	} {
+		meth.Comment, meth.CommentList = spec.comment, nil
+		err := reg.CheckResponseFields(meth)
+		if got, want := err != nil, spec.wantErr; got != want {
+			t.Errorf("CheckResponseFields() with comment %q = %v; want error %v", spec.comment, err, want)
+		}
+	}
+}
+
+func TestCheckHashKey(t *testing.T) {
+	src := `
+		name: "path/to/example.proto",
+		package: "example"
+		message_type <
+			name: "EchoRequest"
+			field <
+				name: "id"
+				number: 1
+				label: LABEL_OPTIONAL
+				type: TYPE_STRING
+			>
+			field <
+				name: "user"
+				number: 2
+				label: LABEL_OPTIONAL
+				type: TYPE_MESSAGE
+				type_name: "User"
+			>
+			field <
+				name: "tags"
+				number: 3
+				label: LABEL_REPEATED
+				type: TYPE_STRING
+			>
+		>
+		message_type <
+			name: "User"
+			field <
+				name: "uid"
+				number: 1
+				label: LABEL_OPTIONAL
+				type: TYPE_INT64
+			>
+		>
+		service <
+			name: "ExampleService"
+			method <
+				name: "Echo"
+				input_type: "EchoRequest"
+				output_type: "EchoRequest"
+				options <
+					[google.api.http] <
+						get: "/v1/example/echo/{id}"
+					>
+				>
+			>
+		>
+	`
+	var fd descriptor.FileDescriptorProto
+	if err := proto.UnmarshalText(src, &fd); err != nil {
+		t.Fatalf("proto.UnmarshalText(%s, &fd) failed with %v; want success", src, err)
+	}
+	reg := NewRegistry()
+	reg.loadFile(&fd)
+	file := reg.files["path/to/example.proto"]
+	if err := reg.loadServices(file); err != nil {
+		t.Fatalf("loadServices(%q) failed with %v; want success", file.GetName(), err)
+	}
+	meth := file.Services[0].Methods[0]
+	for _, spec := range []struct {
+		comment string
+		wantErr bool
+	}{
+		{comment: "@transmit\n@hashkey field:user.uid"},
+		{comment: "@transmit\n@hashkey path:id"},
+		{comment: "@transmit\n@hashkey header:X-User-Id"},
+		{comment: "@transmit\n@hashkey session:uid"},
+		{comment: "@transmit\n@hashkey field:user", wantErr: true},
+		{comment: "@transmit\n@hashkey field:tags", wantErr: true},
+		{comment: "@transmit\n@hashkey field:missing", wantErr: true},
+		{comment: "@transmit\n@hashkey path:user.uid", wantErr: true},
+	} {
+		meth.Comment, meth.CommentList = spec.comment, nil
+		err := reg.CheckHashKey(meth)
+		if got, want := err != nil, spec.wantErr; got != want {
+			t.Errorf("CheckHashKey() with comment %q = %v; want error %v", spec.comment, err, want)
+		}
+	}
+}
+
+func TestCheckUploads(t *testing.T) {
+	src := `
+		name: "path/to/example.proto",
+		package: "example"
+		message_type <
+			name: "UploadRequest"
+			field <
+				name: "data"
+				number: 1
+				label: LABEL_OPTIONAL
+				type: TYPE_BYTES
+			>
+			field <
+				name: "name"
+				number: 2
+				label: LABEL_OPTIONAL
+				type: TYPE_STRING
+			>
+			field <
+				name: "size"
+				number: 3
+				label: LABEL_OPTIONAL
+				type: TYPE_INT64
+			>
+			field <
+				name: "thumb"
+				number: 4
+				label: LABEL_OPTIONAL
+				type: TYPE_MESSAGE
+				type_name: "Thumb"
+			>
+			field <
+				name: "parts"
+				number: 5
+				label: LABEL_REPEATED
+				type: TYPE_BYTES
+			>
+		>
+		message_type <
+			name: "Thumb"
+			field <
+				name: "data"
+				number: 1
+				label: LABEL_OPTIONAL
+				type: TYPE_BYTES
+			>
+		>
+		service <
+			name: "ExampleService"
+			method <
+				name: "Upload"
+				input_type: "UploadRequest"
+				output_type: "UploadRequest"
+				options <
+					[google.api.http] <
+						post: "/v1/example/upload"
+						body: "*"
+					>
+				>
+			>
+			method <
+				name: "Get"
+				input_type: "UploadRequest"
+				output_type: "UploadRequest"
+				options <
+					[google.api.http] <
+						get: "/v1/example/upload"
+					>
+				>
+			>
+		>
+	`
+	var fd descriptor.FileDescriptorProto
+	if err := proto.UnmarshalText(src, &fd); err != nil {
+		t.Fatalf("proto.UnmarshalText(%s, &fd) failed with %v; want success", src, err)
+	}
+	reg := NewRegistry()
+	reg.loadFile(&fd)
+	file := reg.files["path/to/example.proto"]
+	if err := reg.loadServices(file); err != nil {
+		t.Fatalf("loadServices(%q) failed with %v; want success", file.GetName(), err)
+	}
+	meth, get := file.Services[0].Methods[0], file.Services[0].Methods[1]
+	for _, spec := range []struct {
+		comment         string
+		clientStreaming bool
+		serverStreaming bool
+		wantErr         bool
+	}{
+		{comment: "@transmit\n@upload avatar=data filename=name max=2MB"},
+		{comment: "@transmit\n@upload avatar=data\n@upload thumb=thumb.data"},
+		{comment: "@transmit\n@upload file=data chunk=64KB", clientStreaming: true},
+		{comment: "@transmit\n@upload avatar=data", serverStreaming: true},
+		{comment: "@transmit\n@upload avatar=name", wantErr: true},
+		{comment: "@transmit\n@upload avatar=data filename=size", wantErr: true},
+		{comment: "@transmit\n@upload avatar=parts", wantErr: true},
+		{comment: "@transmit\n@upload avatar=missing", wantErr: true},
+		{comment: "@transmit\n@upload avatar=data chunk=64KB", wantErr: true},
+		{comment: "@transmit\n@upload avatar=data\n@upload thumb=thumb.data", clientStreaming: true, wantErr: true},
+		{comment: "@transmit\n@upload avatar=data", clientStreaming: true, serverStreaming: true, wantErr: true},
+	} {
+		meth.Comment, meth.CommentList = spec.comment, nil
+		meth.ClientStreaming, meth.ServerStreaming = proto.Bool(spec.clientStreaming), proto.Bool(spec.serverStreaming)
+		err := reg.CheckUploads(meth)
+		if got, want := err != nil, spec.wantErr; got != want {
+			t.Errorf("CheckUploads() with comment %q = %v; want error %v", spec.comment, err, want)
+		}
+	}
+
+	get.Comment = "@transmit\n@upload avatar=data"
+	if err := reg.CheckUploads(get); err == nil {
+		t.Errorf("CheckUploads() of a binding without body succeeded; want failure")
+	}
+}
@@ -2,6 +2,7 @@ package descriptor
 
 import (
 	"fmt"
+	"regexp"
 	`strconv`
 	"strings"
 
@@ -191,6 +192,25 @@ func (s *Service) FQSN() string {
 	return strings.Join(components, ".")
 }
 
+// GetTargetMethods returns the first transmitted method with bindings of each distinct "@target"
+// service of the service, in the order of the methods.
+func (s *Service) GetTargetMethods() []*Method {
+	var methods []*Method
+	seen := make(map[string]bool)
+	for _, m := range s.Methods {
+		if len(m.Bindings) == 0 || !m.CanOutput() {
+			continue
+		}
+		target := m.GetTargetSvrPackage() + m.GetTargetSvrName()
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		methods = append(methods, m)
+	}
+	return methods
+}
+
 // Method wraps descriptor.MethodDescriptorProto for richer features.
 type Method struct {
 	// Service is the service which this method belongs to.
@@ -208,11 +228,51 @@ type Method struct {
 }
 
 func (m *Method) ParseComment() {
-	commentLines := strings.Split(m.Comment, "\n")
+	m.CommentList = splitComment(m.Comment)
+}
+
+// splitComment splits "comment" into lines without the leading "//" and spaces.
+func splitComment(comment string) []string {
+	commentLines := strings.Split(comment, "\n")
 	for i, it := range commentLines {
 		commentLines[i] = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(it), "//"))
 	}
-	m.CommentList = commentLines
+	return commentLines
+}
+
+// DocLines splits "comment" into the lines of the documentation of the generated code, leaving out
+// the lines of the tags and the empty lines around.
+func DocLines(comment string) []string {
+	var lines []string
+	for _, line := range splitComment(comment) {
+		if strings.HasPrefix(line, "@") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// tagArgs returns the words following "tag" for each line of "lines" starting with the tag.
+func tagArgs(lines []string, tag string) [][]string {
+	var args [][]string
+	for _, line := range lines {
+		if isTagLine(line, tag) {
+			args = append(args, strings.Fields(strings.TrimPrefix(line, tag)))
+		}
+	}
+	return args
+}
+
+// isTagLine returns whether "line" is the tag "tag", followed by its arguments if any.
+func isTagLine(line, tag string) bool {
+	return line == tag || strings.HasPrefix(line, tag+" ")
 }
 
 func (m *Method) GetFormatComment() string {
@@ -221,9 +281,7 @@ func (m *Method) GetFormatComment() string {
 	}
 	li := make([]string, 0, len(m.CommentList))
 	for _, line := range m.CommentList {
-		if strings.Contains(line, TagTransmit) || strings.Contains(line, TagTarget) ||
-			strings.Contains(line, TagId) || strings.Contains(line, TagUpId) ||
-			strings.Contains(line, TagDownId) {
+		if isFormatSkipLine(line) {
 			continue
 		}
 
@@ -233,15 +291,36 @@ func (m *Method) GetFormatComment() string {
 }
 
 const (
-	TagImport   = "@import"
-	TagTransmit = "@transmit"
-	TagTarget   = "@target"
-	TagTarPkg   = "@tarpkg"
-	TagId       = "@id"     // 上行请求协议对应的id
-	TagUpId     = "@upid"   // 上行请求协议对应的id
-	TagDownId   = "@downid" // 下行响应协议对应的id
+	TagImport    = "@import"
+	TagTransmit  = "@transmit"
+	TagTarget    = "@target"
+	TagTarPkg    = "@tarpkg"
+	TagId        = "@id"        // 上行请求协议对应的id
+	TagUpId      = "@upid"      // 上行请求协议对应的id
+	TagDownId    = "@downid"    // 下行响应协议对应的id
+	TagSession   = "@session"   // 会话角色: login, logout, none, 默认required
+	TagAuth      = "@auth"      // 鉴权: required(默认), optional, none
+	TagScope     = "@scope"     // 需要的全部scope, 空格分隔
+	TagRole      = "@role"      // 需要的任一role, 空格分隔
+	TagMetadata  = "@metadata"  // header/cookie转发为grpc metadata, 例: @metadata cookie:ZQ_GUID=guid required pattern=^\d+$
+	TagResHeader = "@resheader" // 返回字段写入http响应头, 例: @resheader location=Location omit
+	TagStatus    = "@status"    // 成功时的http状态码, 固定值或返回字段, 例: @status 201 或 @status http_status omit
+	TagHashKey   = "@hashkey"   // 一致性哈希路由的key, 例: @hashkey field:uid 或 @hashkey header:X-User-Id
+	TagUpload    = "@upload"    // multipart/form-data文件part映射到bytes字段, 例: @upload avatar=data filename=name content_type=mime max=2MB
 )
 
+// formatSkipTags are the tags which are not copied into the comments of the generated code.
+var formatSkipTags = []string{TagTransmit, TagTarget, TagId, TagUpId, TagDownId, TagSession, TagAuth, TagScope, TagRole, TagMetadata, TagResHeader, TagStatus, TagHashKey, TagUpload}
+
+func isFormatSkipLine(line string) bool {
+	for _, tag := range formatSkipTags {
+		if isTagLine(line, tag) {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *Method) CanOutput() bool {
 	if m.CommentList == nil {
 		m.ParseComment()
@@ -292,6 +371,401 @@ func (m *Method) GetTargetSvrPackage() string {
 	return ""
 }
 
+// getTagValue returns the first word following "tag" in the comment of the method,
+// or an empty string if the method is not transmitted or has no such tag.
+func (m *Method) getTagValue(tag string) string {
+	if !m.CanOutput() {
+		return ""
+	}
+	for _, args := range tagArgs(m.CommentList, tag) {
+		if len(args) > 0 {
+			return args[0]
+		}
+	}
+	return ""
+}
+
+// getTagValues returns all the words following "tag" in the comment of the method.
+// The tag may be repeated.
+func (m *Method) getTagValues(tag string) []string {
+	if !m.CanOutput() {
+		return nil
+	}
+	var values []string
+	for _, args := range tagArgs(m.CommentList, tag) {
+		values = append(values, args...)
+	}
+	return values
+}
+
+// GetSessionRole returns the role of the method in the session subsystem of the runtime package,
+// i.e. the value of the "@session" tag. It defaults to "required".
+func (m *Method) GetSessionRole() (string, error) {
+	switch role := m.getTagValue(TagSession); role {
+	case "":
+		return "required", nil
+	case "required", "login", "logout", "none":
+		return role, nil
+	default:
+		return "", fmt.Errorf("unknown %s %q of %s.%s", TagSession, role, m.Service.GetName(), m.GetName())
+	}
+}
+
+// MetadataMapping is a header or a cookie forwarded to the target service as gRPC metadata.
+// It is declared with the "@metadata" tag of a service or a method:
+//   @metadata <header|cookie>:<name>[=<key>] [required] [pattern=<regexp>]
+type MetadataMapping struct {
+	Source   string
+	Name     string
+	Key      string
+	Required bool
+	Pattern  string
+}
+
+// MetadataKey returns the gRPC metadata key of the mapping.
+func (m MetadataMapping) MetadataKey() string {
+	if m.Key != "" {
+		return strings.ToLower(m.Key)
+	}
+	return strings.ToLower(m.Name)
+}
+
+func parseMetadataMapping(args []string) (MetadataMapping, error) {
+	var mapping MetadataMapping
+	if len(args) == 0 {
+		return mapping, fmt.Errorf("empty %s", TagMetadata)
+	}
+	spec := strings.SplitN(args[0], ":", 2)
+	if len(spec) != 2 || (spec[0] != "header" && spec[0] != "cookie") {
+		return mapping, fmt.Errorf("%s %q: want header:<name> or cookie:<name>", TagMetadata, args[0])
+	}
+	mapping.Source = spec[0]
+	nameKey := strings.SplitN(spec[1], "=", 2)
+	mapping.Name = nameKey[0]
+	if len(nameKey) == 2 {
+		mapping.Key = nameKey[1]
+	}
+	if mapping.Name == "" {
+		return mapping, fmt.Errorf("%s %q: no %s name", TagMetadata, args[0], mapping.Source)
+	}
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "required":
+			mapping.Required = true
+		case arg == "optional":
+			mapping.Required = false
+		case strings.HasPrefix(arg, "pattern="):
+			mapping.Pattern = strings.TrimPrefix(arg, "pattern=")
+			if _, err := regexp.Compile(mapping.Pattern); err != nil {
+				return mapping, fmt.Errorf("%s %q: bad pattern: %v", TagMetadata, args[0], err)
+			}
+		default:
+			return mapping, fmt.Errorf("%s %q: unknown flag %q", TagMetadata, args[0], arg)
+		}
+	}
+	return mapping, nil
+}
+
+// GetMetadataMappings returns the metadata mappings declared by the "@metadata" tags
+// of the service and the method. The method ones override the service ones with the same key.
+func (m *Method) GetMetadataMappings() ([]MetadataMapping, error) {
+	if !m.CanOutput() {
+		return nil, nil
+	}
+	var mappings []MetadataMapping
+	index := make(map[string]int)
+	for _, lines := range [][]string{splitComment(m.Service.Comment), m.CommentList} {
+		for _, args := range tagArgs(lines, TagMetadata) {
+			mapping, err := parseMetadataMapping(args)
+			if err != nil {
+				return nil, fmt.Errorf("%v in %s.%s", err, m.Service.GetName(), m.GetName())
+			}
+			if i, ok := index[mapping.MetadataKey()]; ok {
+				mappings[i] = mapping
+				continue
+			}
+			index[mapping.MetadataKey()] = len(mappings)
+			mappings = append(mappings, mapping)
+		}
+	}
+	return mappings, nil
+}
+
+// GetAuthMode returns whether the method requires an authenticated caller,
+// i.e. the value of the "@auth" tag. It defaults to "required".
+func (m *Method) GetAuthMode() (string, error) {
+	switch mode := m.getTagValue(TagAuth); mode {
+	case "":
+		return "required", nil
+	case "required", "optional", "none":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown %s %q of %s.%s", TagAuth, mode, m.Service.GetName(), m.GetName())
+	}
+}
+
+// GetScopes returns the scopes listed by the "@scope" tags of the method.
+func (m *Method) GetScopes() []string {
+	return m.getTagValues(TagScope)
+}
+
+// GetRoles returns the roles listed by the "@role" tags of the method.
+func (m *Method) GetRoles() []string {
+	return m.getTagValues(TagRole)
+}
+
+// ResponseHeader is a field of the response message written into an HTTP response header.
+// It is declared with the "@resheader" tag of a method:
+//   @resheader <field path>=<header> [omit]
+type ResponseHeader struct {
+	Field  string
+	Header string
+	// Omit removes the field from the response body.
+	Omit bool
+}
+
+// GetResponseHeaders returns the response headers declared by the "@resheader" tags of the method.
+func (m *Method) GetResponseHeaders() ([]ResponseHeader, error) {
+	if !m.CanOutput() {
+		return nil, nil
+	}
+	var headers []ResponseHeader
+	for _, args := range tagArgs(m.CommentList, TagResHeader) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("empty %s in %s.%s", TagResHeader, m.Service.GetName(), m.GetName())
+		}
+		spec := strings.SplitN(args[0], "=", 2)
+		if len(spec) != 2 || spec[0] == "" || spec[1] == "" {
+			return nil, fmt.Errorf("%s %q: want <field>=<header> in %s.%s", TagResHeader, args[0], m.Service.GetName(), m.GetName())
+		}
+		header := ResponseHeader{Field: spec[0], Header: spec[1]}
+		for _, arg := range args[1:] {
+			if arg != "omit" {
+				return nil, fmt.Errorf("%s %q: unknown flag %q in %s.%s", TagResHeader, args[0], arg, m.Service.GetName(), m.GetName())
+			}
+			header.Omit = true
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+// ResponseStatus is the HTTP status of the successful responses of a method.
+// It is declared with the "@status" tag of a method, either a fixed code or a field of the response message:
+//   @status <code>
+//   @status <field path> [omit]
+// A zero field value falls back to 200.
+type ResponseStatus struct {
+	Code  int
+	Field string
+	// Omit removes the field from the response body.
+	Omit bool
+}
+
+// GetResponseStatus returns the status declared by the "@status" tag of the method.
+// Its Code is 0 and its Field is empty if the method has no such tag.
+func (m *Method) GetResponseStatus() (ResponseStatus, error) {
+	var st ResponseStatus
+	if !m.CanOutput() {
+		return st, nil
+	}
+	all := tagArgs(m.CommentList, TagStatus)
+	if len(all) == 0 {
+		return st, nil
+	}
+	args := all[len(all)-1]
+	if len(args) == 0 {
+		return st, fmt.Errorf("empty %s in %s.%s", TagStatus, m.Service.GetName(), m.GetName())
+	}
+	if code, err := strconv.Atoi(args[0]); err == nil {
+		if code < 200 || code > 299 {
+			return st, fmt.Errorf("%s %d: want a 2xx code in %s.%s", TagStatus, code, m.Service.GetName(), m.GetName())
+		}
+		if len(args) > 1 {
+			return st, fmt.Errorf("%s %d: unexpected %q in %s.%s", TagStatus, code, args[1], m.Service.GetName(), m.GetName())
+		}
+		st.Code = code
+		return st, nil
+	}
+	st.Field = args[0]
+	for _, arg := range args[1:] {
+		if arg != "omit" {
+			return st, fmt.Errorf("%s %q: unknown flag %q in %s.%s", TagStatus, args[0], arg, m.Service.GetName(), m.GetName())
+		}
+		st.Omit = true
+	}
+	return st, nil
+}
+
+// GetOmittedResponseFields returns the paths of the fields of the response message which the
+// gateway moves from the body to the headers or the status with the "omit" flag of the
+// "@resheader" and "@status" tags of the method.
+func (m *Method) GetOmittedResponseFields() ([]string, error) {
+	headers, err := m.GetResponseHeaders()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, h := range headers {
+		if h.Omit {
+			paths = append(paths, h.Field)
+		}
+	}
+	st, err := m.GetResponseStatus()
+	if err != nil {
+		return nil, err
+	}
+	if st.Omit {
+		paths = append(paths, st.Field)
+	}
+	return paths, nil
+}
+
+// HashKey is the source of the key routing the calls of a method to the same endpoint
+// by consistent hashing. It is declared with the "@hashkey" tag of a service or a method:
+//   @hashkey <field|path|header|cookie|session>:<name>
+// where <name> is a field path of the request message, a path parameter,
+// a header, a cookie or a session value respectively.
+type HashKey struct {
+	Source string
+	Name   string
+}
+
+// GetHashKey returns the hash key declared by the "@hashkey" tag of the method, or else of the service.
+// Its Source is empty if there is no such tag.
+func (m *Method) GetHashKey() (HashKey, error) {
+	var key HashKey
+	if !m.CanOutput() {
+		return key, nil
+	}
+	all := tagArgs(m.CommentList, TagHashKey)
+	if len(all) == 0 {
+		all = tagArgs(splitComment(m.Service.Comment), TagHashKey)
+	}
+	if len(all) == 0 {
+		return key, nil
+	}
+	args := all[len(all)-1]
+	if len(args) != 1 {
+		return key, fmt.Errorf("%s %q: want <source>:<name> in %s.%s", TagHashKey, strings.Join(args, " "), m.Service.GetName(), m.GetName())
+	}
+	spec := strings.SplitN(args[0], ":", 2)
+	if len(spec) != 2 || spec[1] == "" {
+		return key, fmt.Errorf("%s %q: want <source>:<name> in %s.%s", TagHashKey, args[0], m.Service.GetName(), m.GetName())
+	}
+	switch spec[0] {
+	case "field", "path", "header", "cookie", "session":
+	default:
+		return key, fmt.Errorf("%s %q: unknown source %q in %s.%s", TagHashKey, args[0], spec[0], m.Service.GetName(), m.GetName())
+	}
+	key.Source, key.Name = spec[0], spec[1]
+	return key, nil
+}
+
+// Upload maps a file part of a multipart/form-data request to a bytes field of the request message.
+// It is declared with the "@upload" tag of a method:
+//   @upload <part>=<field path> [filename=<field path>] [content_type=<field path>] [max=<size>] [chunk=<size>]
+// where <size> is a number of bytes with an optional KB, MB or GB suffix.
+// A client streaming method takes one upload, sent in messages of ChunkSize bytes.
+type Upload struct {
+	Part             string
+	Field            string
+	FilenameField    string
+	ContentTypeField string
+	// MaxSize is the size limit of the part, 0 for the default of the runtime package.
+	MaxSize int64
+	// ChunkSize is the size of the chunks of a client streaming method, 0 for the default of the runtime package.
+	ChunkSize int64
+}
+
+// parseSize parses a number of bytes with an optional KB, MB or GB suffix.
+func parseSize(s string) (int64, error) {
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		unit   int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(strings.ToUpper(s), u.suffix) {
+			s, unit = s[:len(s)-len(u.suffix)], u.unit
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return n * unit, nil
+}
+
+func parseUpload(args []string) (Upload, error) {
+	var upload Upload
+	if len(args) == 0 {
+		return upload, fmt.Errorf("empty %s", TagUpload)
+	}
+	spec := strings.SplitN(args[0], "=", 2)
+	if len(spec) != 2 || spec[0] == "" || spec[1] == "" {
+		return upload, fmt.Errorf("%s %q: want <part>=<field>", TagUpload, args[0])
+	}
+	upload.Part, upload.Field = spec[0], spec[1]
+	for _, arg := range args[1:] {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return upload, fmt.Errorf("%s %q: unknown flag %q", TagUpload, args[0], arg)
+		}
+		var err error
+		switch kv[0] {
+		case "filename":
+			upload.FilenameField = kv[1]
+		case "content_type":
+			upload.ContentTypeField = kv[1]
+		case "max":
+			upload.MaxSize, err = parseSize(kv[1])
+		case "chunk":
+			upload.ChunkSize, err = parseSize(kv[1])
+		default:
+			return upload, fmt.Errorf("%s %q: unknown flag %q", TagUpload, args[0], arg)
+		}
+		if err != nil {
+			return upload, fmt.Errorf("%s %q: %v", TagUpload, args[0], err)
+		}
+	}
+	return upload, nil
+}
+
+// GetUploads returns the uploads declared by the "@upload" tags of the method.
+func (m *Method) GetUploads() ([]Upload, error) {
+	if !m.CanOutput() {
+		return nil, nil
+	}
+	var uploads []Upload
+	parts := make(map[string]bool)
+	for _, args := range tagArgs(m.CommentList, TagUpload) {
+		upload, err := parseUpload(args)
+		if err != nil {
+			return nil, fmt.Errorf("%v in %s.%s", err, m.Service.GetName(), m.GetName())
+		}
+		if parts[upload.Part] {
+			return nil, fmt.Errorf("%s %s: duplicate part in %s.%s", TagUpload, upload.Part, m.Service.GetName(), m.GetName())
+		}
+		parts[upload.Part] = true
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+// GetStreamingKind returns "unary", "client", "server" or "bidi" by the streaming sides of the method.
+func (m *Method) GetStreamingKind() string {
+	switch {
+	case m.GetClientStreaming() && m.GetServerStreaming():
+		return "bidi"
+	case m.GetClientStreaming():
+		return "client"
+	case m.GetServerStreaming():
+		return "server"
+	}
+	return "unary"
+}
+
 // FQMN returns a fully qualified rpc method name of this method.
 func (m *Method) FQMN() string {
 	components := make([]string, 0, 4)
@@ -316,6 +790,8 @@ type Binding struct {
 	Body *Body
 	// ResponseBody describes field in response struct to marshal in HTTP response body.
 	ResponseBody *Body
+	// HeaderParams is the list of parameters provided in HTTP request headers and cookies.
+	HeaderParams []HeaderParameter
 }
 
 // ExplicitParams returns a list of explicitly bound parameters of "b",
@@ -328,9 +804,57 @@ func (b *Binding) ExplicitParams() []string {
 	for _, p := range b.PathParams {
 		result = append(result, p.FieldPath.String())
 	}
+	for _, p := range b.HeaderParams {
+		result = append(result, p.FieldPath.String())
+	}
 	return result
 }
 
+// GetBodyPath returns the "body" of the http rule of "b": empty if there is none,
+// "*" for the whole request message, or else a field path.
+func (b *Binding) GetBodyPath() string {
+	if b.Body == nil {
+		return ""
+	}
+	if len(b.Body.FieldPath) == 0 {
+		return "*"
+	}
+	return b.Body.FieldPath.String()
+}
+
+// GetResponseBodyPath returns the "response_body" of the http rule of "b",
+// empty for the whole response message.
+func (b *Binding) GetResponseBodyPath() string {
+	if b.ResponseBody == nil {
+		return ""
+	}
+	return b.ResponseBody.FieldPath.String()
+}
+
+// HTTPBodyType is the full name of google.api.HttpBody, whose messages carry raw HTTP bodies.
+const HTTPBodyType = ".google.api.HttpBody"
+
+// HasHTTPBodyRequest tells whether the request body of "b" is a google.api.HttpBody message,
+// either the request message itself or the field of the "body".
+func (b *Binding) HasHTTPBodyRequest() bool {
+	if b.Body == nil {
+		return false
+	}
+	if len(b.Body.FieldPath) == 0 {
+		return b.Method.RequestType.FQMN() == HTTPBodyType
+	}
+	return b.Body.FieldPath[len(b.Body.FieldPath)-1].Target.GetTypeName() == HTTPBodyType
+}
+
+// HasHTTPBodyResponse tells whether the response body of "b" is a google.api.HttpBody message,
+// either the response message itself or the field of the "response_body".
+func (b *Binding) HasHTTPBodyResponse() bool {
+	if b.ResponseBody == nil || len(b.ResponseBody.FieldPath) == 0 {
+		return b.Method.ResponseType.FQMN() == HTTPBodyType
+	}
+	return b.ResponseBody.FieldPath[len(b.ResponseBody.FieldPath)-1].Target.GetTypeName() == HTTPBodyType
+}
+
 // Field wraps descriptor.FieldDescriptorProto for richer features.
 type Field struct {
 	// Message is the message type which this field belongs to.
@@ -350,6 +874,16 @@ type Parameter struct {
 	Method *Method
 }
 
+// HeaderParameter is a parameter provided in http request headers or cookies.
+// It is declared with the "httpgw.from_header" and "httpgw.from_cookie" field options.
+type HeaderParameter struct {
+	Parameter
+	// Source is either "header" or "cookie".
+	Source string
+	// Name is the name of the header or the cookie.
+	Name string
+}
+
 // ConvertFuncExpr returns a go expression of a converter function.
 // The converter function converts a string into a value for the parameter.
 func (p Parameter) ConvertFuncExpr() (string, error) {
@@ -1,6 +1,7 @@
 package descriptor
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
@@ -204,3 +205,426 @@ func TestFieldPath(t *testing.T) {
 		t.Errorf("fpEmpty.AssignableExpr(%q) = %q; want %q", "resp", got, want)
 	}
 }
+
+func TestMethodGetSessionRole(t *testing.T) {
+	for _, spec := range []struct {
+		comment string
+		want    string
+		wantErr bool
+	}{
+		{
+			comment: "@transmit\n@target Authorize",
+			want:    "required",
+		},
+		{
+			comment: "@transmit\n@target Authorize\n@session login",
+			want:    "login",
+		},
+		{
+			comment: "// @transmit\n// @session logout 退出登录",
+			want:    "logout",
+		},
+		{
+			comment: "@transmit\n@session none",
+			want:    "none",
+		},
+		{
+			comment: "@transmit\n@sessionfoo none",
+			want:    "required",
+		},
+		{
+			comment: "@transmit\n@session unknown",
+			wantErr: true,
+		},
+	} {
+		m := &Method{
+			Service:               &Service{ServiceDescriptorProto: &descriptor.ServiceDescriptorProto{Name: proto.String("ImGate")}},
+			MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Login")},
+			Comment:               spec.comment,
+		}
+		got, err := m.GetSessionRole()
+		if spec.wantErr {
+			if err == nil {
+				t.Errorf("GetSessionRole() with comment %q succeeded; want failure", spec.comment)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("GetSessionRole() with comment %q failed with %v; want success", spec.comment, err)
+			continue
+		}
+		if got != spec.want {
+			t.Errorf("GetSessionRole() with comment %q = %q; want %q", spec.comment, got, spec.want)
+		}
+	}
+}
+
+func TestMethodAuthTags(t *testing.T) {
+	m := &Method{
+		Service:               &Service{ServiceDescriptorProto: &descriptor.ServiceDescriptorProto{Name: proto.String("ImGate")}},
+		MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Read")},
+		Comment:               "已读\n@transmit\n@target Im\n@auth optional\n@scope im:read im:write\n@scope room:read\n@role admin",
+	}
+	if got, err := m.GetAuthMode(); err != nil || got != "optional" {
+		t.Errorf("GetAuthMode() = %q, %v; want %q", got, err, "optional")
+	}
+	if got, want := m.GetScopes(), []string{"im:read", "im:write", "room:read"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetScopes() = %v; want %v", got, want)
+	}
+	if got, want := m.GetRoles(), []string{"admin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRoles() = %v; want %v", got, want)
+	}
+	if got, want := m.GetFormatComment(), "// 已读"; got != want {
+		t.Errorf("GetFormatComment() = %q; want %q", got, want)
+	}
+}
+
+func TestMethodGetFormatComment(t *testing.T) {
+	m := &Method{
+		Service:               &Service{ServiceDescriptorProto: &descriptor.ServiceDescriptorProto{Name: proto.String("ImGate")}},
+		MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Read")},
+		Comment:               "已读\n@author zgd\n@roles 见文档\n联系 x@sessions.io\n@transmit\n@target Im\n@session login\n@role admin",
+	}
+	want := "// 已读\n// @author zgd\n// @roles 见文档\n// 联系 x@sessions.io"
+	if got := m.GetFormatComment(); got != want {
+		t.Errorf("GetFormatComment() = %q; want %q", got, want)
+	}
+}
+
+func TestMethodGetMetadataMappings(t *testing.T) {
+	svc := &Service{
+		ServiceDescriptorProto: &descriptor.ServiceDescriptorProto{Name: proto.String("ImGate")},
+		Comment:                "网关\n@metadata cookie:ZQ_GUID=guid required\n@metadata header:X-Trace",
+	}
+	m := &Method{
+		Service:               svc,
+		MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Read")},
+		Comment:               "@transmit\n@metadata header:X-Device=device pattern=^(ios|android)$\n@metadata cookie:ZQ_GUID=guid optional",
+	}
+	got, err := m.GetMetadataMappings()
+	if err != nil {
+		t.Fatalf("GetMetadataMappings() failed with %v; want success", err)
+	}
+	want := []MetadataMapping{
+		{Source: "cookie", Name: "ZQ_GUID", Key: "guid"},
+		{Source: "header", Name: "X-Trace"},
+		{Source: "header", Name: "X-Device", Key: "device", Pattern: "^(ios|android)$"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMetadataMappings() = %#v; want %#v", got, want)
+	}
+
+	for _, comment := range []string{
+		"@transmit\n@metadata query:uid",
+		"@transmit\n@metadata header:",
+		"@transmit\n@metadata header:X-Device pattern=(",
+		"@transmit\n@metadata header:X-Device mandatory",
+	} {
+		m := &Method{
+			Service:               svc,
+			MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Read")},
+			Comment:               comment,
+		}
+		if _, err := m.GetMetadataMappings(); err == nil {
+			t.Errorf("GetMetadataMappings() with comment %q succeeded; want failure", comment)
+		}
+	}
+}
+
+func TestMethodResponseTags(t *testing.T) {
+	svc := &Service{
+		ServiceDescriptorProto: &descriptor.ServiceDescriptorProto{Name: proto.String("ImGate")},
+	}
+	for _, spec := range []struct {
+		comment string
+		headers []ResponseHeader
+		status  ResponseStatus
+	}{
+		{
+			comment: "@transmit",
+		},
+		{
+			comment: "@transmit\n@resheader location=Location omit\n@resheader page.total=X-Total-Count\n@status 201",
+			headers: []ResponseHeader{
+				{Field: "location", Header: "Location", Omit: true},
+				{Field: "page.total", Header: "X-Total-Count"},
+			},
+			status: ResponseStatus{Code: 201},
+		},
+		{
+			comment: "@transmit\n@status http_status omit",
+			status:  ResponseStatus{Field: "http_status", Omit: true},
+		},
+		{
+			comment: "@resheader location=Location\n@status 201",
+		},
+	} {
+		m := &Method{
+			Service:               svc,
+			MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Login")},
+			Comment:               spec.comment,
+		}
+		headers, err := m.GetResponseHeaders()
+		if err != nil {
+			t.Errorf("GetResponseHeaders() with comment %q failed with %v; want success", spec.comment, err)
+		} else if !reflect.DeepEqual(headers, spec.headers) {
+			t.Errorf("GetResponseHeaders() with comment %q = %#v; want %#v", spec.comment, headers, spec.headers)
+		}
+		status, err := m.GetResponseStatus()
+		if err != nil {
+			t.Errorf("GetResponseStatus() with comment %q failed with %v; want success", spec.comment, err)
+		} else if status != spec.status {
+			t.Errorf("GetResponseStatus() with comment %q = %#v; want %#v", spec.comment, status, spec.status)
+		}
+	}
+
+	for _, comment := range []string{
+		"@transmit\n@resheader location",
+		"@transmit\n@resheader =Location",
+		"@transmit\n@resheader location=Location drop",
+		"@transmit\n@status 404",
+		"@transmit\n@status 201 omit",
+		"@transmit\n@status http_status drop",
+	} {
+		m := &Method{
+			Service:               svc,
+			MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Login")},
+			Comment:               comment,
+		}
+		_, herr := m.GetResponseHeaders()
+		_, serr := m.GetResponseStatus()
+		if herr == nil && serr == nil {
+			t.Errorf("GetResponseHeaders() and GetResponseStatus() with comment %q succeeded; want failure", comment)
+		}
+	}
+}
+
+func TestMethodHashKey(t *testing.T) {
+	for _, spec := range []struct {
+		svcComment string
+		comment    string
+		key        HashKey
+	}{
+		{
+			comment: "@transmit",
+		},
+		{
+			comment: "@transmit\n@hashkey field:user.uid",
+			key:     HashKey{Source: "field", Name: "user.uid"},
+		},
+		{
+			svcComment: "@hashkey session:uid",
+			comment:    "@transmit",
+			key:        HashKey{Source: "session", Name: "uid"},
+		},
+		{
+			svcComment: "@hashkey session:uid",
+			comment:    "@transmit\n@hashkey header:X-User-Id",
+			key:        HashKey{Source: "header", Name: "X-User-Id"},
+		},
+	} {
+		m := &Method{
+			Service: &Service{
+				ServiceDescriptorProto: &descriptor.ServiceDescriptorProto{Name: proto.String("ImGate")},
+				Comment:                spec.svcComment,
+			},
+			MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Read")},
+			Comment:               spec.comment,
+		}
+		key, err := m.GetHashKey()
+		if err != nil {
+			t.Errorf("GetHashKey() with comment %q failed with %v; want success", spec.comment, err)
+		} else if key != spec.key {
+			t.Errorf("GetHashKey() with comment %q = %#v; want %#v", spec.comment, key, spec.key)
+		}
+	}
+
+	for _, comment := range []string{
+		"@transmit\n@hashkey",
+		"@transmit\n@hashkey uid",
+		"@transmit\n@hashkey query:uid",
+		"@transmit\n@hashkey field:",
+		"@transmit\n@hashkey field:uid header:X-User-Id",
+	} {
+		m := &Method{
+			Service: &Service{
+				ServiceDescriptorProto: &descriptor.ServiceDescriptorProto{Name: proto.String("ImGate")},
+			},
+			MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Read")},
+			Comment:               comment,
+		}
+		if _, err := m.GetHashKey(); err == nil {
+			t.Errorf("GetHashKey() with comment %q succeeded; want failure", comment)
+		}
+	}
+}
+
+func TestMethodUploads(t *testing.T) {
+	for _, spec := range []struct {
+		comment string
+		uploads []Upload
+	}{
+		{
+			comment: "@transmit",
+		},
+		{
+			comment: "@transmit\n@upload avatar=data",
+			uploads: []Upload{{Part: "avatar", Field: "data"}},
+		},
+		{
+			comment: "@transmit\n@upload avatar=data filename=name content_type=mime max=2MB\n@upload thumb=thumb.data max=512",
+			uploads: []Upload{
+				{Part: "avatar", Field: "data", FilenameField: "name", ContentTypeField: "mime", MaxSize: 2 << 20},
+				{Part: "thumb", Field: "thumb.data", MaxSize: 512},
+			},
+		},
+		{
+			comment: "@transmit\n@upload file=chunk chunk=64kb max=1GB",
+			uploads: []Upload{{Part: "file", Field: "chunk", ChunkSize: 64 << 10, MaxSize: 1 << 30}},
+		},
+	} {
+		m := &Method{
+			Service: &Service{
+				ServiceDescriptorProto: &descriptor.ServiceDescriptorProto{Name: proto.String("ImGate")},
+			},
+			MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Upload")},
+			Comment:               spec.comment,
+		}
+		uploads, err := m.GetUploads()
+		if err != nil {
+			t.Errorf("GetUploads() with comment %q failed with %v; want success", spec.comment, err)
+		} else if !reflect.DeepEqual(uploads, spec.uploads) {
+			t.Errorf("GetUploads() with comment %q = %#v; want %#v", spec.comment, uploads, spec.uploads)
+		}
+	}
+
+	for _, comment := range []string{
+		"@transmit\n@upload",
+		"@transmit\n@upload avatar",
+		"@transmit\n@upload avatar=",
+		"@transmit\n@upload avatar=data max=big",
+		"@transmit\n@upload avatar=data max=0",
+		"@transmit\n@upload avatar=data omit",
+		"@transmit\n@upload avatar=data\n@upload avatar=data2",
+	} {
+		m := &Method{
+			Service: &Service{
+				ServiceDescriptorProto: &descriptor.ServiceDescriptorProto{Name: proto.String("ImGate")},
+			},
+			MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String("Upload")},
+			Comment:               comment,
+		}
+		if _, err := m.GetUploads(); err == nil {
+			t.Errorf("GetUploads() with comment %q succeeded; want failure", comment)
+		}
+	}
+}
+
+func TestServiceGetTargetMethods(t *testing.T) {
+	svc := &Service{
+		ServiceDescriptorProto: &descriptor.ServiceDescriptorProto{Name: proto.String("ImGate")},
+	}
+	for _, spec := range []struct {
+		name     string
+		comment  string
+		bindings int
+	}{
+		{name: "Login", comment: "@transmit\n@tarpkg auth\n@target Authorize", bindings: 1},
+		{name: "Read", comment: "@transmit\n@target Im", bindings: 1},
+		{name: "Logout", comment: "@transmit\n@tarpkg auth\n@target Authorize", bindings: 1},
+		{name: "Write", comment: "@target Im", bindings: 1},
+		{name: "Watch", comment: "@transmit\n@tarpkg watch\n@target Im"},
+		{name: "Notify", comment: "@transmit\n@tarpkg notify\n@target Im", bindings: 2},
+	} {
+		m := &Method{
+			Service:               svc,
+			MethodDescriptorProto: &descriptor.MethodDescriptorProto{Name: proto.String(spec.name)},
+			Comment:               spec.comment,
+		}
+		for i := 0; i < spec.bindings; i++ {
+			m.Bindings = append(m.Bindings, &Binding{Method: m, Index: i})
+		}
+		svc.Methods = append(svc.Methods, m)
+	}
+	var got []string
+	for _, m := range svc.GetTargetMethods() {
+		got = append(got, m.GetName())
+	}
+	if want := []string{"Login", "Read", "Notify"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTargetMethods() = %q; want %q", got, want)
+	}
+}
+
+func TestBindingBodyPaths(t *testing.T) {
+	for _, spec := range []struct {
+		binding      *Binding
+		body         string
+		responseBody string
+	}{
+		{binding: &Binding{}},
+		{
+			binding: &Binding{Body: &Body{}, ResponseBody: &Body{FieldPath: FieldPath{{Name: "page"}, {Name: "items"}}}},
+			body:    "*", responseBody: "page.items",
+		},
+		{
+			binding: &Binding{Body: &Body{FieldPath: FieldPath{{Name: "user"}}}},
+			body:    "user",
+		},
+	} {
+		if got := spec.binding.GetBodyPath(); got != spec.body {
+			t.Errorf("GetBodyPath() = %q; want %q", got, spec.body)
+		}
+		if got := spec.binding.GetResponseBodyPath(); got != spec.responseBody {
+			t.Errorf("GetResponseBodyPath() = %q; want %q", got, spec.responseBody)
+		}
+	}
+}
+
+func TestBindingHTTPBody(t *testing.T) {
+	httpBody := &Message{
+		File:            &File{FileDescriptorProto: &descriptor.FileDescriptorProto{Package: proto.String("google.api")}},
+		DescriptorProto: &descriptor.DescriptorProto{Name: proto.String("HttpBody")},
+	}
+	other := &Message{
+		File:            &File{FileDescriptorProto: &descriptor.FileDescriptorProto{Package: proto.String("example")}},
+		DescriptorProto: &descriptor.DescriptorProto{Name: proto.String("ExportRequest")},
+	}
+	bodyField := FieldPath{{Name: "file", Target: &Field{FieldDescriptorProto: &descriptor.FieldDescriptorProto{TypeName: proto.String(HTTPBodyType)}}}}
+	for _, spec := range []struct {
+		binding  *Binding
+		request  bool
+		response bool
+	}{
+		{binding: &Binding{Method: &Method{RequestType: other, ResponseType: other}, Body: &Body{}}},
+		{binding: &Binding{Method: &Method{RequestType: httpBody, ResponseType: other}}},
+		{binding: &Binding{Method: &Method{RequestType: httpBody, ResponseType: httpBody}, Body: &Body{}}, request: true, response: true},
+		{binding: &Binding{Method: &Method{RequestType: other, ResponseType: other}, Body: &Body{FieldPath: bodyField}, ResponseBody: &Body{FieldPath: bodyField}}, request: true, response: true},
+	} {
+		if got := spec.binding.HasHTTPBodyRequest(); got != spec.request {
+			t.Errorf("HasHTTPBodyRequest() of body %q = %v; want %v", spec.binding.GetBodyPath(), got, spec.request)
+		}
+		if got := spec.binding.HasHTTPBodyResponse(); got != spec.response {
+			t.Errorf("HasHTTPBodyResponse() of response body %q = %v; want %v", spec.binding.GetResponseBodyPath(), got, spec.response)
+		}
+	}
+}
+
+func TestMethodGetStreamingKind(t *testing.T) {
+	for _, spec := range []struct {
+		client, server bool
+		want           string
+	}{
+		{want: "unary"},
+		{client: true, want: "client"},
+		{server: true, want: "server"},
+		{client: true, server: true, want: "bidi"},
+	} {
+		m := &Method{MethodDescriptorProto: &descriptor.MethodDescriptorProto{
+			ClientStreaming: proto.Bool(spec.client),
+			ServerStreaming: proto.Bool(spec.server),
+		}}
+		if got := m.GetStreamingKind(); got != spec.want {
+			t.Errorf("GetStreamingKind() with client %v and server %v = %q; want %q", spec.client, spec.server, got, spec.want)
+		}
+	}
+}
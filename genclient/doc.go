@@ -0,0 +1,2 @@
+// Package genclient provides a code generator for the typed HTTP clients of the gateway services.
+package genclient
@@ -0,0 +1,137 @@
+package genclient
+
+import (
+	"errors"
+	"fmt"
+	"go/format"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+	gen "github.com/generalzgd/protoc-gen-grpc-httpgw/generator"
+)
+
+var (
+	errNoTargetService = errors.New("no target service defined in the file")
+)
+
+type generator struct {
+	reg            *descriptor.Registry
+	baseImports    []descriptor.GoPackage
+	sourceRelative bool
+}
+
+// New returns a new generator which generates the typed HTTP client files, next to the
+// gateway files of the same proto files. "pathType" is the "paths" parameter.
+func New(reg *descriptor.Registry, pathType string) gen.Generator {
+	var imports []descriptor.GoPackage
+	for _, pkgpath := range []string{
+		"context",
+		"io",
+		"github.com/golang/protobuf/proto",
+	} {
+		pkg := descriptor.GoPackage{
+			Path: pkgpath,
+			Name: path.Base(pkgpath),
+		}
+		if err := reg.ReserveGoPackageAlias(pkg.Name, pkg.Path); err != nil {
+			for i := 0; ; i++ {
+				alias := fmt.Sprintf("%s_%d", pkg.Name, i)
+				if err := reg.ReserveGoPackageAlias(alias, pkg.Path); err != nil {
+					continue
+				}
+				pkg.Alias = alias
+				break
+			}
+		}
+		imports = append(imports, pkg)
+	}
+	gwclient := descriptor.GoPackage{
+		Path:  "github.com/generalzgd/protoc-gen-grpc-httpgw/client",
+		Name:  "client",
+		Alias: "gwclient",
+	}
+	if err := reg.ReserveGoPackageAlias(gwclient.Alias, gwclient.Path); err != nil {
+		glog.Fatalf("Cannot reserve the alias of %s: %v", gwclient.Path, err)
+	}
+	imports = append(imports, gwclient)
+
+	return &generator{
+		reg:            reg,
+		baseImports:    imports,
+		sourceRelative: pathType == "source_relative",
+	}
+}
+
+func (g *generator) Generate(targets []*descriptor.File) ([]*plugin.CodeGeneratorResponse_File, error) {
+	var files []*plugin.CodeGeneratorResponse_File
+	for _, file := range targets {
+		glog.V(1).Infof("Processing %s", file.GetName())
+		code, err := g.generate(file)
+		if err == errNoTargetService {
+			glog.V(1).Infof("%s: %v", file.GetName(), err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		formatted, err := format.Source([]byte(code))
+		if err != nil {
+			glog.Errorf("%v: %s", err, code)
+			return nil, err
+		}
+		name := file.GetName()
+		if !g.sourceRelative && file.GoPkg.Path != "" {
+			name = fmt.Sprintf("%s/%s", file.GoPkg.Path, filepath.Base(name))
+		}
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		output := fmt.Sprintf("%s.pb.httpclient.go", base)
+		files = append(files, &plugin.CodeGeneratorResponse_File{
+			Name:    proto.String(output),
+			Content: proto.String(string(formatted)),
+		})
+		glog.V(1).Infof("Will emit %s", output)
+	}
+	return files, nil
+}
+
+func (g *generator) generate(file *descriptor.File) (string, error) {
+	pkgSeen := make(map[string]bool)
+	var imports []descriptor.GoPackage
+	for _, pkg := range g.baseImports {
+		pkgSeen[pkg.Path] = true
+		imports = append(imports, pkg)
+	}
+	g.reg.LoadComments(file)
+	var services []*service
+	for _, svc := range file.Services {
+		s := &service{Service: svc}
+		for _, m := range svc.Methods {
+			if len(m.Bindings) == 0 || !m.CanOutput() {
+				continue
+			}
+			s.Methods = append(s.Methods, m)
+			for _, msg := range []*descriptor.Message{m.RequestType, m.ResponseType} {
+				pkg := msg.File.GoPkg
+				if pkg == file.GoPkg || pkgSeen[pkg.Path] {
+					continue
+				}
+				pkgSeen[pkg.Path] = true
+				imports = append(imports, pkg)
+			}
+		}
+		if len(s.Methods) > 0 {
+			services = append(services, s)
+		}
+	}
+	if len(services) == 0 {
+		return "", errNoTargetService
+	}
+	return applyTemplate(param{File: file, Imports: imports, Services: services})
+}
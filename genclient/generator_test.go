@@ -0,0 +1,116 @@
+package genclient
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+)
+
+// loadRequest loads the request of room.proto shared by the tests of the generators.
+func loadRequest(t *testing.T) *plugin.CodeGeneratorRequest {
+	b, err := ioutil.ReadFile("../testdata/room.prototext")
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile() failed with %v", err)
+	}
+	var req plugin.CodeGeneratorRequest
+	if err := proto.UnmarshalText(string(b), &req); err != nil {
+		t.Fatalf("proto.UnmarshalText() failed with %v", err)
+	}
+	return &req
+}
+
+func generateClient(t *testing.T) (string, *descriptor.File) {
+	req := loadRequest(t)
+	reg := descriptor.NewRegistry()
+	if err := reg.Load(req); err != nil {
+		t.Fatalf("reg.Load() failed with %v", err)
+	}
+	file, err := reg.LookupFile("room.proto")
+	if err != nil {
+		t.Fatalf("reg.LookupFile() failed with %v", err)
+	}
+	reg.AddComments("room.proto", descriptor.SourceComments(file.FileDescriptorProto))
+	if err := reg.ParseCommentsSource(req.ProtoFile); err != nil {
+		t.Fatalf("reg.ParseCommentsSource() failed with %v", err)
+	}
+	files, err := New(reg, "source_relative").Generate([]*descriptor.File{file})
+	if err != nil {
+		t.Fatalf("Generate() failed with %v", err)
+	}
+	if len(files) != 1 || files[0].GetName() != "room.pb.httpclient.go" {
+		t.Fatalf("Generate() = %v; want room.pb.httpclient.go", files)
+	}
+	return files[0].GetContent(), file
+}
+
+func TestGenerate(t *testing.T) {
+	got, _ := generateClient(t)
+	for _, want := range []string{
+		"// ListRooms calls GET /v1/users/{owner_id}/rooms.\n// ListRooms lists the rooms of a user.\n// The rooms are paged.\n",
+		"func (c *RoomServiceHTTPClient) ListRooms(ctx context.Context, in *ListRoomsRequest, opts ...gwclient.CallOption) (*ListRoomsReply, error) {",
+		// the path parameters are expanded and the other fields sent in the query without a body.
+		"httpRoute_RoomService_ListRooms = &gwclient.Route{\n\t\tHTTPMethod:       \"GET\",\n\t\tPath:             \"/v1/users/{owner_id}/rooms\",\n\t\tBody:             \"\",\n",
+		"httpRoute_AdminService_CreateRoom = &gwclient.Route{\n\t\tHTTPMethod:       \"POST\",\n\t\tPath:             \"/v1/rooms\",\n\t\tBody:             \"*\",\n",
+		"{Field: \"icon_url\", Header: \"Location\"},",
+		"func (c *AdminServiceHTTPClient) WatchRooms(ctx context.Context, in *ListRoomsRequest, opts ...gwclient.CallOption) (*AdminService_WatchRoomsHTTPStream, error) {",
+		"stream, err := c.client.Stream(ctx, httpRoute_AdminService_WatchRooms, in, nil, opts...)",
+		"func (s *AdminService_WatchRoomsHTTPStream) Next() bool {",
+		"func (s *AdminService_WatchRoomsHTTPStream) Msg() *Room {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Generate() = %s; want to contain %s", got, want)
+		}
+	}
+	for _, unwanted := range []string{"@transmit", "@target", "Hidden"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("Generate() contains %s; want not", unwanted)
+		}
+	}
+}
+
+// TestGenerateCompiles type-checks the generated client with the client package, the messages
+// of room.proto being declared as empty proto messages.
+func TestGenerateCompiles(t *testing.T) {
+	got, file := generateClient(t)
+	var stub bytes.Buffer
+	fmt.Fprintf(&stub, "package %s\n", file.GoPkg.Name)
+	for _, msg := range file.Messages {
+		name := msg.GoType(file.GoPkg.Path)
+		fmt.Fprintf(&stub, "type %s struct{}\n", name)
+		fmt.Fprintf(&stub, "func (*%s) Reset() {}\n", name)
+		fmt.Fprintf(&stub, "func (*%s) String() string { return \"\" }\n", name)
+		fmt.Fprintf(&stub, "func (*%s) ProtoMessage() {}\n", name)
+	}
+
+	// the files are placed in this directory for the imports to be resolved within the module.
+	dir, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatalf("filepath.Abs() failed with %v", err)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for name, src := range map[string]string{"room.pb.httpclient.go": got, "room.pb.go": stub.String()} {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), src, 0)
+		if err != nil {
+			t.Fatalf("parser.ParseFile(%s) failed with %v", name, err)
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check(file.GoPkg.Path, fset, files, nil); err != nil {
+		t.Errorf("the generated client does not compile: %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package genclient
+
+import (
+	"bytes"
+	"text/template"
+
+	generator2 "github.com/golang/protobuf/protoc-gen-go/generator"
+
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+)
+
+type param struct {
+	*descriptor.File
+	Imports  []descriptor.GoPackage
+	Services []*service
+}
+
+// service is a gateway service with its transmitted methods which have bindings.
+type service struct {
+	*descriptor.Service
+	Methods []*descriptor.Method
+}
+
+func applyTemplate(p param) (string, error) {
+	w := bytes.NewBuffer(nil)
+	if err := clientTemplate.Execute(w, p); err != nil {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+var (
+	funcMap = template.FuncMap{
+		"camel": generator2.CamelCase,
+	}
+
+	clientTemplate = template.Must(template.New("client").Funcs(funcMap).Parse(`
+// Code generated by protoc-gen-grpc-httpgw. DO NOT EDIT.
+// source: {{.GetName}}
+
+package {{.GoPkg.Name}}
+
+import (
+	{{range $i := .Imports}}{{if $i.Standard}}{{$i | printf "%s\n"}}{{end}}{{end}}
+
+	{{range $i := .Imports}}{{if not $i.Standard}}{{$i | printf "%s\n"}}{{end}}{{end}}
+)
+
+var _ io.Reader
+var _ proto.Message
+{{range $svc := .Services}}
+{{$name := camel $svc.GetName}}
+// {{$name}}HTTPClient calls the routes of service {{$name}} over HTTP, the first binding of each method.
+type {{$name}}HTTPClient struct {
+	client *gwclient.Client
+}
+
+// New{{$name}}HTTPClient returns a client of service {{$name}} sending the requests with "c", e.g.
+//   New{{$name}}HTTPClient(gwclient.New("https://api.example.com", gwclient.WithHTTPClient(hc)))
+func New{{$name}}HTTPClient(c *gwclient.Client) *{{$name}}HTTPClient {
+	return &{{$name}}HTTPClient{client: c}
+}
+{{range $m := $svc.Methods}}
+{{$b := index $m.Bindings 0}}
+{{$meth := camel $m.GetName}}
+{{$in := $m.RequestType.GoType $svc.File.GoPkg.Path}}
+{{$out := $m.ResponseType.GoType $svc.File.GoPkg.Path}}
+{{- if and $m.GetClientStreaming $m.GetServerStreaming}}
+// {{$meth}} calls {{$b.HTTPMethod}} {{$b.PathTmpl.Template}} with the messages returned by "next" until io.EOF.
+{{- if $m.GetFormatComment}}
+{{$m.GetFormatComment}}
+{{- end}}
+func (c *{{$name}}HTTPClient) {{$meth}}(ctx context.Context, next func() (*{{$in}}, error), opts ...gwclient.CallOption) (*{{$name}}_{{$meth}}HTTPStream, error) {
+	stream, err := c.client.Stream(ctx, httpRoute_{{$name}}_{{$meth}}, nil, func() (proto.Message, error) {
+		msg, err := next()
+		if err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &{{$name}}_{{$meth}}HTTPStream{stream: stream}, nil
+}
+{{- else if $m.GetClientStreaming}}
+// {{$meth}} calls {{$b.HTTPMethod}} {{$b.PathTmpl.Template}} with the messages returned by "next" until io.EOF.
+{{- if $m.GetFormatComment}}
+{{$m.GetFormatComment}}
+{{- end}}
+func (c *{{$name}}HTTPClient) {{$meth}}(ctx context.Context, next func() (*{{$in}}, error), opts ...gwclient.CallOption) (*{{$out}}, error) {
+	out := new({{$out}})
+	err := c.client.InvokeClientStream(ctx, httpRoute_{{$name}}_{{$meth}}, func() (proto.Message, error) {
+		msg, err := next()
+		if err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+{{- else if $m.GetServerStreaming}}
+// {{$meth}} calls {{$b.HTTPMethod}} {{$b.PathTmpl.Template}}.
+{{- if $m.GetFormatComment}}
+{{$m.GetFormatComment}}
+{{- end}}
+func (c *{{$name}}HTTPClient) {{$meth}}(ctx context.Context, in *{{$in}}, opts ...gwclient.CallOption) (*{{$name}}_{{$meth}}HTTPStream, error) {
+	stream, err := c.client.Stream(ctx, httpRoute_{{$name}}_{{$meth}}, in, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &{{$name}}_{{$meth}}HTTPStream{stream: stream}, nil
+}
+{{- else}}
+// {{$meth}} calls {{$b.HTTPMethod}} {{$b.PathTmpl.Template}}.
+{{- if $m.GetFormatComment}}
+{{$m.GetFormatComment}}
+{{- end}}
+func (c *{{$name}}HTTPClient) {{$meth}}(ctx context.Context, in *{{$in}}, opts ...gwclient.CallOption) (*{{$out}}, error) {
+	out := new({{$out}})
+	if err := c.client.Invoke(ctx, httpRoute_{{$name}}_{{$meth}}, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+{{- end}}
+{{if $m.GetServerStreaming}}
+// {{$name}}_{{$meth}}HTTPStream iterates over the messages of {{$name}}.{{$meth}}:
+//   for stream.Next() {
+//   	msg := stream.Msg()
+//   }
+//   if err := stream.Err(); err != nil {
+//   }
+type {{$name}}_{{$meth}}HTTPStream struct {
+	stream *gwclient.Stream
+	msg    *{{$out}}
+	err    error
+	done   bool
+}
+
+// Next receives the next message, and returns false at the end of the stream or on error.
+// The response is closed then.
+func (s *{{$name}}_{{$meth}}HTTPStream) Next() bool {
+	if s.done {
+		return false
+	}
+	msg := new({{$out}})
+	if err := s.stream.Recv(msg); err != nil {
+		if err != io.EOF {
+			s.err = err
+		}
+		s.done = true
+		s.stream.Close()
+		return false
+	}
+	s.msg = msg
+	return true
+}
+
+// Msg returns the message received by the last call to Next.
+func (s *{{$name}}_{{$meth}}HTTPStream) Msg() *{{$out}} {
+	return s.msg
+}
+
+// Err returns the error which ended the stream, nil at its normal end.
+func (s *{{$name}}_{{$meth}}HTTPStream) Err() error {
+	return s.err
+}
+
+// Close closes the response before the end of the stream.
+func (s *{{$name}}_{{$meth}}HTTPStream) Close() error {
+	s.done = true
+	return s.stream.Close()
+}
+{{end}}
+{{end}}
+var (
+	{{- range $m := $svc.Methods}}
+	{{- $b := index $m.Bindings 0}}
+	httpRoute_{{$name}}_{{camel $m.GetName}} = &gwclient.Route{
+		HTTPMethod:   {{$b.HTTPMethod | printf "%q"}},
+		Path:         {{$b.PathTmpl.Template | printf "%q"}},
+		Body:         {{$b.GetBodyPath | printf "%q"}},
+		ResponseBody: {{$b.GetResponseBodyPath | printf "%q"}},
+		{{- with $b.HeaderParams}}
+		HeaderParams: []gwclient.HeaderParam{
+			{{- range $p := .}}
+			{Source: {{$p.Source | printf "%q"}}, Name: {{$p.Name | printf "%q"}}, Field: {{$p.FieldPath.String | printf "%q"}}},
+			{{- end}}
+		},
+		{{- end}}
+		HTTPBodyRequest:  {{$b.HasHTTPBodyRequest}},
+		HTTPBodyResponse: {{$b.HasHTTPBodyResponse}},
+		{{- with $hs := $m.GetResponseHeaders}}
+		ResponseHeaders: []gwclient.ResponseHeader{
+			{{- range $h := $hs}}{{if $h.Omit}}
+			{Field: {{$h.Field | printf "%q"}}, Header: {{$h.Header | printf "%q"}}},
+			{{- end}}{{end}}
+		},
+		{{- end}}
+		{{- with $st := $m.GetResponseStatus}}{{if $st.Omit}}
+		StatusField: {{$st.Field | printf "%q"}},
+		{{- end}}{{end}}
+	}
+	{{- end}}
+)
+{{end}}
+`))
+)
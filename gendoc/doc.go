@@ -0,0 +1,2 @@
+// Package gendoc provides a code generator for the Markdown or HTML API reference of the gateway services.
+package gendoc
@@ -0,0 +1,765 @@
+package gendoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	protodescriptor "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+	gen "github.com/generalzgd/protoc-gen-grpc-httpgw/generator"
+)
+
+// wellKnownExamples are the example JSON values of the messages with a special JSON mapping.
+var wellKnownExamples = map[string]interface{}{
+	".google.protobuf.Timestamp":   "1970-01-01T00:00:00Z",
+	".google.protobuf.Duration":    "1s",
+	".google.protobuf.FieldMask":   "field",
+	".google.protobuf.Struct":      object{},
+	".google.protobuf.Value":       nil,
+	".google.protobuf.ListValue":   []interface{}{},
+	".google.protobuf.Empty":       object{},
+	".google.protobuf.Any":         object{{"@type", "type.googleapis.com/package.Message"}},
+	".google.protobuf.DoubleValue": 0,
+	".google.protobuf.FloatValue":  0,
+	".google.protobuf.Int32Value":  0,
+	".google.protobuf.UInt32Value": 0,
+	".google.protobuf.Int64Value":  "0",
+	".google.protobuf.UInt64Value": "0",
+	".google.protobuf.BoolValue":   false,
+	".google.protobuf.StringValue": "string",
+	".google.protobuf.BytesValue":  "Ynl0ZXM=",
+}
+
+// scalarNames are the names of the scalar types as written in the proto files.
+var scalarNames = map[protodescriptor.FieldDescriptorProto_Type]string{
+	protodescriptor.FieldDescriptorProto_TYPE_DOUBLE:   "double",
+	protodescriptor.FieldDescriptorProto_TYPE_FLOAT:    "float",
+	protodescriptor.FieldDescriptorProto_TYPE_INT32:    "int32",
+	protodescriptor.FieldDescriptorProto_TYPE_SINT32:   "sint32",
+	protodescriptor.FieldDescriptorProto_TYPE_SFIXED32: "sfixed32",
+	protodescriptor.FieldDescriptorProto_TYPE_UINT32:   "uint32",
+	protodescriptor.FieldDescriptorProto_TYPE_FIXED32:  "fixed32",
+	protodescriptor.FieldDescriptorProto_TYPE_INT64:    "int64",
+	protodescriptor.FieldDescriptorProto_TYPE_SINT64:   "sint64",
+	protodescriptor.FieldDescriptorProto_TYPE_SFIXED64: "sfixed64",
+	protodescriptor.FieldDescriptorProto_TYPE_UINT64:   "uint64",
+	protodescriptor.FieldDescriptorProto_TYPE_FIXED64:  "fixed64",
+	protodescriptor.FieldDescriptorProto_TYPE_BOOL:     "bool",
+	protodescriptor.FieldDescriptorProto_TYPE_STRING:   "string",
+	protodescriptor.FieldDescriptorProto_TYPE_BYTES:    "bytes",
+}
+
+type generator struct {
+	reg            *descriptor.Registry
+	sourceRelative bool
+	html           bool
+}
+
+// New returns a new generator which generates the API reference of each gateway service with transmitted
+// routes, in Markdown or in a static HTML page if "html", next to where the gateway file would be.
+// "pathType" is the "paths" parameter.
+func New(reg *descriptor.Registry, pathType string, html bool) gen.Generator {
+	return &generator{
+		reg:            reg,
+		sourceRelative: pathType == "source_relative",
+		html:           html,
+	}
+}
+
+func (g *generator) Generate(targets []*descriptor.File) ([]*plugin.CodeGeneratorResponse_File, error) {
+	var files []*plugin.CodeGeneratorResponse_File
+	for _, file := range targets {
+		glog.V(1).Infof("Processing %s", file.GetName())
+		g.reg.LoadComments(file)
+		name := file.GetName()
+		if !g.sourceRelative && file.GoPkg.Path != "" {
+			name = fmt.Sprintf("%s/%s", file.GoPkg.Path, filepath.Base(name))
+		}
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		for _, svc := range file.Services {
+			doc, err := g.service(svc)
+			if err != nil {
+				return nil, err
+			}
+			if doc == nil {
+				glog.V(1).Infof("%s: no transmitted method with http bindings", svc.GetName())
+				continue
+			}
+			code, err := applyTemplate(doc, g.html)
+			if err != nil {
+				return nil, err
+			}
+			ext := "md"
+			if g.html {
+				ext = "html"
+			}
+			output := fmt.Sprintf("%s.%s.%s", base, svc.GetName(), ext)
+			files = append(files, &plugin.CodeGeneratorResponse_File{
+				Name:    proto.String(output),
+				Content: proto.String(code),
+			})
+			glog.V(1).Infof("Will emit %s", output)
+		}
+	}
+	return files, nil
+}
+
+// service returns the reference of the transmitted routes of "svc", or nil if there is none.
+func (g *generator) service(svc *descriptor.Service) (*serviceDoc, error) {
+	b := &builder{
+		reg:       g.reg,
+		jsonNames: g.reg.GetUseJSONNamesForFields(),
+		seen:      make(map[string]bool),
+		paths:     make(map[*descriptor.File]map[interface{}]string),
+	}
+	doc := &serviceDoc{
+		Name:    svc.GetName(),
+		FQSN:    strings.TrimPrefix(svc.FQSN(), "."),
+		Comment: descriptor.DocLines(svc.Comment),
+	}
+	targets := make(map[string]*targetDoc)
+	for _, m := range svc.Methods {
+		if len(m.Bindings) == 0 || !m.CanOutput() {
+			continue
+		}
+		name := svc.File.GoPkg.Name + "." + m.GetTargetSvrName()
+		target, ok := targets[name]
+		if !ok {
+			target = &targetDoc{
+				Service: name,
+				Package: strings.TrimSuffix(m.GetTargetSvrPackage(), "."),
+			}
+			targets[name] = target
+			doc.Targets = append(doc.Targets, target)
+		}
+		for _, binding := range m.Bindings {
+			r, err := b.route(binding)
+			if err != nil {
+				return nil, err
+			}
+			target.Routes = append(target.Routes, r)
+		}
+	}
+	if len(doc.Targets) == 0 {
+		return nil, nil
+	}
+	// the types are listed as they are found, including the ones they refer to.
+	for i := 0; i < len(b.types); i++ {
+		b.addFields(b.types[i])
+	}
+	doc.Types = b.types
+	return doc, nil
+}
+
+// serviceDoc is the reference of a gateway service.
+type serviceDoc struct {
+	Name    string
+	FQSN    string
+	Comment []string
+	Targets []*targetDoc
+	Types   []*typeDoc
+}
+
+// targetDoc groups the routes transmitted to a target service.
+type targetDoc struct {
+	// Service is the target service, as the Method of the runtime routes.
+	Service string
+	// Package is the Go package of the target client given by "@tarpkg".
+	Package string
+	Routes  []*routeDoc
+}
+
+// routeDoc is the reference of a binding.
+type routeDoc struct {
+	Anchor     string
+	Name       string
+	HTTPMethod string
+	Path       string
+	Comment    []string
+	// TargetMethod is the target method, as the Method of the runtime routes.
+	TargetMethod string
+	Streaming    string
+	Auth         string
+	Scopes       []string
+	Roles        []string
+	Session      string
+	Params       []*paramDoc
+	Body         *bodyDoc
+	Response     *bodyDoc
+}
+
+// paramDoc is a parameter of a route, a field of a body or a response header.
+type paramDoc struct {
+	Name     string
+	In       string
+	Type     typeRef
+	Required bool
+	Comment  string
+}
+
+// bodyDoc is the request or the response body of a route.
+type bodyDoc struct {
+	Type typeRef
+	// Field is the field path of the "body" or the "response_body" of the http rule, if any.
+	Field string
+	// Raw is set for google.api.HttpBody, Stream for the streaming methods.
+	Raw    bool
+	Stream bool
+	// Status is the status code of the response, unless given by the field StatusField.
+	Status      string
+	StatusField string
+	Fields      []*paramDoc
+	// Form are the parts of the multipart/form-data body of the "@upload" tags, if any.
+	Form    []*paramDoc
+	Headers []*paramDoc
+	Example string
+}
+
+// typeDoc is the reference of a message or an enum.
+type typeDoc struct {
+	Name    string
+	Anchor  string
+	Comment []string
+	Enum    bool
+	Fields  []*paramDoc
+	Values  []*valueDoc
+
+	msg *descriptor.Message
+}
+
+type valueDoc struct {
+	Name    string
+	Number  int32
+	Comment string
+}
+
+// typeRef is the type of a field, linked to the reference of its message or enum if listed.
+type typeRef struct {
+	Name     string
+	Anchor   string
+	Repeated bool
+	// Key is the key type of a map, whose values are of the type.
+	Key string
+}
+
+// builder collects the routes and the types of a service.
+type builder struct {
+	reg       *descriptor.Registry
+	jsonNames bool
+	seen      map[string]bool
+	types     []*typeDoc
+	// paths are the source code paths of the messages and the enums of each file.
+	paths map[*descriptor.File]map[interface{}]string
+}
+
+var pathVarRegexp = regexp.MustCompile(`\{([^}=]+)=[^}]*\}`)
+
+func (b *builder) route(binding *descriptor.Binding) (*routeDoc, error) {
+	m := binding.Method
+	name := m.Service.GetName() + "_" + m.GetName()
+	if binding.Index > 0 {
+		name = fmt.Sprintf("%s_%d", name, binding.Index)
+	}
+	r := &routeDoc{
+		Anchor:       strings.ToLower(name),
+		Name:         name,
+		HTTPMethod:   binding.HTTPMethod,
+		Path:         pathVarRegexp.ReplaceAllString(binding.PathTmpl.Template, "{$1}"),
+		Comment:      descriptor.DocLines(m.Comment),
+		TargetMethod: m.Service.File.GoPkg.Name + "." + m.GetTargetSvrName() + "/" + m.GetName(),
+		Scopes:       m.GetScopes(),
+		Roles:        m.GetRoles(),
+	}
+	switch {
+	case m.GetClientStreaming() && m.GetServerStreaming():
+		r.Streaming = "bidi"
+	case m.GetClientStreaming():
+		r.Streaming = "client"
+	case m.GetServerStreaming():
+		r.Streaming = "server"
+	}
+	var err error
+	if r.Auth, err = m.GetAuthMode(); err != nil {
+		return nil, err
+	}
+	if r.Session, err = m.GetSessionRole(); err != nil {
+		return nil, err
+	}
+	if err := b.addParams(r, binding); err != nil {
+		return nil, err
+	}
+	if r.Body, err = b.requestBody(binding); err != nil {
+		return nil, err
+	}
+	if r.Response, err = b.responseBody(binding); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (b *builder) addParams(r *routeDoc, binding *descriptor.Binding) error {
+	for _, p := range binding.PathParams {
+		r.Params = append(r.Params, &paramDoc{Name: p.FieldPath.String(), In: "path", Type: b.typeRef(p.Target), Required: true, Comment: b.fieldComment(p.Target)})
+	}
+	for _, p := range binding.HeaderParams {
+		r.Params = append(r.Params, &paramDoc{Name: p.Name, In: p.Source, Type: b.typeRef(p.Target), Comment: b.fieldComment(p.Target)})
+	}
+	mappings, err := binding.Method.GetMetadataMappings()
+	if err != nil {
+		return err
+	}
+	for _, mapping := range mappings {
+		comment := fmt.Sprintf("Forwarded to the target as the gRPC metadata %q.", mapping.MetadataKey())
+		if mapping.Pattern != "" {
+			comment += fmt.Sprintf(" Matches %q.", mapping.Pattern)
+		}
+		if p := findParam(r.Params, mapping.Source, mapping.Name); p != nil {
+			// the header or the cookie is also bound to a field.
+			p.Required = p.Required || mapping.Required
+			p.Comment = strings.TrimSpace(p.Comment + " " + comment)
+			continue
+		}
+		r.Params = append(r.Params, &paramDoc{Name: mapping.Name, In: mapping.Source, Type: typeRef{Name: "string"}, Required: mapping.Required, Comment: comment})
+	}
+	for _, path := range b.reg.QueryParams(binding) {
+		f := path[len(path)-1].Target
+		r.Params = append(r.Params, &paramDoc{Name: path.String(), In: "query", Type: b.typeRef(f), Comment: b.fieldComment(f)})
+	}
+	return nil
+}
+
+// findParam returns the parameter "name" of the header or cookie "in", or nil if there is none.
+func findParam(params []*paramDoc, in, name string) *paramDoc {
+	for _, p := range params {
+		if p.In == in && strings.EqualFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (b *builder) requestBody(binding *descriptor.Binding) (*bodyDoc, error) {
+	if binding.Body == nil {
+		return nil, nil
+	}
+	m := binding.Method
+	body := &bodyDoc{Stream: m.GetClientStreaming()}
+	if binding.HasHTTPBodyRequest() {
+		body.Raw = true
+		return body, nil
+	}
+	var example interface{}
+	if fp := binding.Body.FieldPath; len(fp) > 0 {
+		f := fp[len(fp)-1].Target
+		body.Field = fp.String()
+		body.Type = b.typeRef(f)
+		body.Fields = []*paramDoc{{Name: b.jsonName(f), Type: body.Type, Comment: b.fieldComment(f)}}
+		example = b.fieldExample(f, make(map[string]bool))
+	} else {
+		body.Type = b.messageRef(m.RequestType)
+		// the fields bound to the path or the headers are overwritten by them.
+		bound := make(map[string]bool)
+		for _, p := range binding.ExplicitParams() {
+			bound[p] = true
+		}
+		ex := object{}
+		for _, f := range m.RequestType.Fields {
+			if bound[f.GetName()] {
+				continue
+			}
+			body.Fields = append(body.Fields, &paramDoc{Name: b.jsonName(f), Type: b.typeRef(f), Comment: b.fieldComment(f)})
+			ex = append(ex, member{b.jsonName(f), b.fieldExample(f, map[string]bool{m.RequestType.FQMN(): true})})
+		}
+		example = ex
+	}
+	var err error
+	if body.Example, err = marshalExample(example); err != nil {
+		return nil, err
+	}
+	if body.Form, err = b.formParts(binding); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// formParts returns the parts of the multipart/form-data body of the "@upload" tags of the method of
+// "binding": the files, then the other fields of the request as form values.
+func (b *builder) formParts(binding *descriptor.Binding) ([]*paramDoc, error) {
+	uploads, err := binding.Method.GetUploads()
+	if err != nil || len(uploads) == 0 {
+		return nil, err
+	}
+	var parts []*paramDoc
+	for _, u := range uploads {
+		comment := fmt.Sprintf("The file read into the field %s.", u.Field)
+		if u.FilenameField != "" {
+			comment += fmt.Sprintf(" Its name sets the field %s.", u.FilenameField)
+		}
+		if u.ContentTypeField != "" {
+			comment += fmt.Sprintf(" Its Content-Type sets the field %s.", u.ContentTypeField)
+		}
+		parts = append(parts, &paramDoc{Name: u.Part, Type: typeRef{Name: "file"}, Comment: comment})
+	}
+	params, err := b.reg.FormParams(binding)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range params {
+		f := path[len(path)-1].Target
+		parts = append(parts, &paramDoc{Name: path.String(), Type: b.typeRef(f), Comment: b.fieldComment(f)})
+	}
+	return parts, nil
+}
+
+func (b *builder) responseBody(binding *descriptor.Binding) (*bodyDoc, error) {
+	m := binding.Method
+	st, err := m.GetResponseStatus()
+	if err != nil {
+		return nil, err
+	}
+	body := &bodyDoc{Stream: m.GetServerStreaming(), Status: "200", StatusField: st.Field}
+	if st.Code != 0 {
+		body.Status = fmt.Sprint(st.Code)
+	}
+	headers, err := m.GetResponseHeaders()
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		f, err := b.reg.LookupField(m.ResponseType, h.Field)
+		if err != nil {
+			return nil, err
+		}
+		comment := fmt.Sprintf("The value of the field %s.", h.Field)
+		if h.Omit {
+			comment += " Omitted from the body."
+		}
+		body.Headers = append(body.Headers, &paramDoc{Name: h.Header, In: "header", Type: b.typeRef(f), Comment: comment})
+	}
+	if binding.HasHTTPBodyResponse() {
+		body.Raw = true
+		return body, nil
+	}
+	omitted, err := m.GetOmittedResponseFields()
+	if err != nil {
+		return nil, err
+	}
+	if body.Stream {
+		// the streamed results keep all their fields.
+		omitted = nil
+	}
+	var example interface{}
+	if binding.ResponseBody != nil && len(binding.ResponseBody.FieldPath) > 0 {
+		fp := binding.ResponseBody.FieldPath
+		f := fp[len(fp)-1].Target
+		body.Field = fp.String()
+		body.Type = b.typeRef(f)
+		example = b.fieldExample(f, make(map[string]bool))
+		if msg := b.singularMessage(f); msg != nil {
+			if paths := splitPaths(omitted, fp.String()+"."); len(paths) > 0 {
+				body.Fields, example = b.omitFields(msg, paths)
+			}
+		}
+	} else {
+		body.Type = b.messageRef(m.ResponseType)
+		example = b.messageExample(m.ResponseType, make(map[string]bool))
+		if paths := splitPaths(omitted, ""); len(paths) > 0 {
+			body.Fields, example = b.omitFields(m.ResponseType, paths)
+		}
+	}
+	if body.Stream {
+		example = object{{"result", example}}
+	}
+	body.Example, err = marshalExample(example)
+	return body, err
+}
+
+// singularMessage returns the message of "f", or nil unless "f" is a singular message field.
+func (b *builder) singularMessage(f *descriptor.Field) *descriptor.Message {
+	if f.GetType() != protodescriptor.FieldDescriptorProto_TYPE_MESSAGE || f.GetLabel() == protodescriptor.FieldDescriptorProto_LABEL_REPEATED {
+		return nil
+	}
+	msg, err := b.reg.LookupMsg("", f.GetTypeName())
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+// splitPaths returns the field paths with the "prefix" split into their field names.
+func splitPaths(paths []string, prefix string) [][]string {
+	var split [][]string
+	for _, path := range paths {
+		if strings.HasPrefix(path, prefix) {
+			split = append(split, strings.Split(strings.TrimPrefix(path, prefix), "."))
+		}
+	}
+	return split
+}
+
+// omitFields returns the fields of "msg" and its example without the fields at "paths", which the
+// gateway moves from the response body to the headers or the status.
+func (b *builder) omitFields(msg *descriptor.Message, paths [][]string) ([]*paramDoc, object) {
+	omitted := make(map[string]bool)
+	nested := make(map[string][][]string)
+	for _, path := range paths {
+		if len(path) == 1 {
+			omitted[path[0]] = true
+		} else {
+			nested[path[0]] = append(nested[path[0]], path[1:])
+		}
+	}
+	var fields []*paramDoc
+	ex := object{}
+	for _, f := range msg.Fields {
+		if omitted[f.GetName()] {
+			continue
+		}
+		fields = append(fields, &paramDoc{Name: b.jsonName(f), Type: b.typeRef(f), Comment: b.fieldComment(f)})
+		var value interface{}
+		if child := b.singularMessage(f); child != nil && len(nested[f.GetName()]) > 0 {
+			_, value = b.omitFields(child, nested[f.GetName()])
+		} else {
+			value = b.fieldExample(f, map[string]bool{msg.FQMN(): true})
+		}
+		ex = append(ex, member{b.jsonName(f), value})
+	}
+	return fields, ex
+}
+
+// jsonName returns the name of "f" in the JSON bodies.
+func (b *builder) jsonName(f *descriptor.Field) string {
+	if b.jsonNames && f.GetJsonName() != "" {
+		return f.GetJsonName()
+	}
+	return f.GetName()
+}
+
+// typeRef returns the type of "f", listing its message or enum in the types of the service.
+func (b *builder) typeRef(f *descriptor.Field) typeRef {
+	t := typeRef{Repeated: f.GetLabel() == protodescriptor.FieldDescriptorProto_LABEL_REPEATED}
+	switch f.GetType() {
+	case protodescriptor.FieldDescriptorProto_TYPE_ENUM:
+		e, err := b.reg.LookupEnum("", f.GetTypeName())
+		if err != nil {
+			t.Name = strings.TrimPrefix(f.GetTypeName(), ".")
+			return t
+		}
+		name := strings.TrimPrefix(e.FQEN(), ".")
+		if !b.seen[e.FQEN()] {
+			b.seen[e.FQEN()] = true
+			b.types = append(b.types, b.enumDoc(e))
+		}
+		t.Name, t.Anchor = name, anchor(name)
+	case protodescriptor.FieldDescriptorProto_TYPE_MESSAGE, protodescriptor.FieldDescriptorProto_TYPE_GROUP:
+		msg, err := b.reg.LookupMsg("", f.GetTypeName())
+		if err != nil {
+			t.Name = strings.TrimPrefix(f.GetTypeName(), ".")
+			return t
+		}
+		if msg.GetOptions().GetMapEntry() && len(msg.Fields) == 2 {
+			value := b.typeRef(msg.Fields[1])
+			value.Key = scalarNames[msg.Fields[0].GetType()]
+			return value
+		}
+		ref := b.messageRef(msg)
+		t.Name, t.Anchor = ref.Name, ref.Anchor
+	default:
+		t.Name = scalarNames[f.GetType()]
+	}
+	return t
+}
+
+// messageRef returns the type of "msg", listing it in the types of the service unless it is a well known type.
+func (b *builder) messageRef(msg *descriptor.Message) typeRef {
+	name := strings.TrimPrefix(msg.FQMN(), ".")
+	if _, ok := wellKnownExamples[msg.FQMN()]; ok || msg.FQMN() == descriptor.HTTPBodyType {
+		return typeRef{Name: name}
+	}
+	if !b.seen[msg.FQMN()] {
+		b.seen[msg.FQMN()] = true
+		b.types = append(b.types, &typeDoc{
+			Name:    name,
+			Anchor:  anchor(name),
+			Comment: descriptor.DocLines(b.sourceComment(msg.File, b.sourcePath(msg.File, msg.DescriptorProto))),
+			msg:     msg,
+		})
+	}
+	return typeRef{Name: name, Anchor: anchor(name)}
+}
+
+// addFields adds the fields of the message of "t", listing the types they refer to.
+func (b *builder) addFields(t *typeDoc) {
+	if t.msg == nil {
+		return
+	}
+	for _, f := range t.msg.Fields {
+		t.Fields = append(t.Fields, &paramDoc{Name: b.jsonName(f), Type: b.typeRef(f), Comment: b.fieldComment(f)})
+	}
+}
+
+func (b *builder) enumDoc(e *descriptor.Enum) *typeDoc {
+	name := strings.TrimPrefix(e.FQEN(), ".")
+	path := b.sourcePath(e.File, e.EnumDescriptorProto)
+	t := &typeDoc{
+		Name:    name,
+		Anchor:  anchor(name),
+		Comment: descriptor.DocLines(b.sourceComment(e.File, path)),
+		Enum:    true,
+	}
+	for i, v := range e.GetValue() {
+		t.Values = append(t.Values, &valueDoc{
+			Name:    v.GetName(),
+			Number:  v.GetNumber(),
+			Comment: strings.Join(descriptor.DocLines(b.sourceComment(e.File, fmt.Sprintf("%s,2,%d", path, i))), " "),
+		})
+	}
+	return t
+}
+
+// anchor returns the HTML id of the reference of the type "name".
+func anchor(name string) string {
+	return "type-" + strings.ToLower(strings.Replace(name, ".", "-", -1))
+}
+
+// fieldComment returns the comment of "f" on a single line.
+func (b *builder) fieldComment(f *descriptor.Field) string {
+	msg := f.Message
+	path := b.sourcePath(msg.File, msg.DescriptorProto)
+	for i, field := range msg.Fields {
+		if field == f {
+			return strings.Join(descriptor.DocLines(b.sourceComment(msg.File, fmt.Sprintf("%s,2,%d", path, i))), " ")
+		}
+	}
+	return ""
+}
+
+// sourcePath returns the source code path of the message or the enum "desc" of "file".
+func (b *builder) sourcePath(file *descriptor.File, desc interface{}) string {
+	paths, ok := b.paths[file]
+	if !ok {
+		paths = descriptor.SourcePaths(file.FileDescriptorProto)
+		b.paths[file] = paths
+	}
+	return paths[desc]
+}
+
+// sourceComment returns the comment at the source code "path" of "file".
+func (b *builder) sourceComment(file *descriptor.File, path string) string {
+	if path == "" {
+		return ""
+	}
+	return b.reg.FileComments[file.GetName()][path]
+}
+
+// object is a JSON object keeping the order of its members.
+type object []member
+
+type member struct {
+	Key   string
+	Value interface{}
+}
+
+// MarshalJSON marshals the members in order.
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func marshalExample(v interface{}) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// messageExample returns an example of the JSON of "msg". The messages being visited are left empty
+// to end the recursive types.
+func (b *builder) messageExample(msg *descriptor.Message, visiting map[string]bool) interface{} {
+	if ex, ok := wellKnownExamples[msg.FQMN()]; ok {
+		return ex
+	}
+	if visiting[msg.FQMN()] {
+		return object{}
+	}
+	visiting[msg.FQMN()] = true
+	defer delete(visiting, msg.FQMN())
+	ex := object{}
+	for _, f := range msg.Fields {
+		ex = append(ex, member{b.jsonName(f), b.fieldExample(f, visiting)})
+	}
+	return ex
+}
+
+// fieldExample returns an example of the JSON of "f", as marshaled by jsonpb.
+func (b *builder) fieldExample(f *descriptor.Field, visiting map[string]bool) interface{} {
+	var ex interface{}
+	switch f.GetType() {
+	case protodescriptor.FieldDescriptorProto_TYPE_ENUM:
+		ex = ""
+		if e, err := b.reg.LookupEnum("", f.GetTypeName()); err == nil && len(e.GetValue()) > 0 {
+			ex = e.GetValue()[0].GetName()
+		}
+	case protodescriptor.FieldDescriptorProto_TYPE_MESSAGE, protodescriptor.FieldDescriptorProto_TYPE_GROUP:
+		msg, err := b.reg.LookupMsg("", f.GetTypeName())
+		if err != nil {
+			return object{}
+		}
+		if msg.GetOptions().GetMapEntry() && len(msg.Fields) == 2 {
+			key := fmt.Sprint(b.fieldExample(msg.Fields[0], visiting))
+			return object{{key, b.fieldExample(msg.Fields[1], visiting)}}
+		}
+		ex = b.messageExample(msg, visiting)
+	default:
+		ex = scalarExample(f.GetType())
+	}
+	if f.GetLabel() == protodescriptor.FieldDescriptorProto_LABEL_REPEATED {
+		return []interface{}{ex}
+	}
+	return ex
+}
+
+func scalarExample(t protodescriptor.FieldDescriptorProto_Type) interface{} {
+	switch t {
+	case protodescriptor.FieldDescriptorProto_TYPE_INT64, protodescriptor.FieldDescriptorProto_TYPE_SINT64,
+		protodescriptor.FieldDescriptorProto_TYPE_SFIXED64, protodescriptor.FieldDescriptorProto_TYPE_UINT64,
+		protodescriptor.FieldDescriptorProto_TYPE_FIXED64:
+		// jsonpb marshals the 64-bit integers as strings.
+		return "0"
+	case protodescriptor.FieldDescriptorProto_TYPE_BOOL:
+		return false
+	case protodescriptor.FieldDescriptorProto_TYPE_STRING:
+		return "string"
+	case protodescriptor.FieldDescriptorProto_TYPE_BYTES:
+		return "Ynl0ZXM="
+	default:
+		return 0
+	}
+}
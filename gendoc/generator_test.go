@@ -0,0 +1,123 @@
+package gendoc
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+)
+
+// loadRequest loads the request of room.proto shared by the tests of the generators.
+func loadRequest(t *testing.T) *plugin.CodeGeneratorRequest {
+	b, err := ioutil.ReadFile("../testdata/room.prototext")
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile() failed with %v", err)
+	}
+	var req plugin.CodeGeneratorRequest
+	if err := proto.UnmarshalText(string(b), &req); err != nil {
+		t.Fatalf("proto.UnmarshalText() failed with %v", err)
+	}
+	return &req
+}
+
+// generateDoc returns the contents of the documents of room.proto by the names of their services.
+func generateDoc(t *testing.T, html bool) map[string]string {
+	req := loadRequest(t)
+	reg := descriptor.NewRegistry()
+	if err := reg.Load(req); err != nil {
+		t.Fatalf("reg.Load() failed with %v", err)
+	}
+	file, err := reg.LookupFile("room.proto")
+	if err != nil {
+		t.Fatalf("reg.LookupFile() failed with %v", err)
+	}
+	reg.AddComments("room.proto", descriptor.SourceComments(file.FileDescriptorProto))
+	if err := reg.ParseCommentsSource(req.ProtoFile); err != nil {
+		t.Fatalf("reg.ParseCommentsSource() failed with %v", err)
+	}
+	files, err := New(reg, "source_relative", html).Generate([]*descriptor.File{file})
+	if err != nil {
+		t.Fatalf("Generate() failed with %v", err)
+	}
+	ext := ".md"
+	if html {
+		ext = ".html"
+	}
+	docs := make(map[string]string)
+	for _, f := range files {
+		docs[strings.TrimSuffix(f.GetName(), ext)] = f.GetContent()
+	}
+	if len(docs) != 2 || docs["room.RoomService"] == "" || docs["room.AdminService"] == "" {
+		t.Fatalf("Generate() = %v; want room.RoomService%s and room.AdminService%s", files, ext, ext)
+	}
+	return docs
+}
+
+func TestGenerateMarkdown(t *testing.T) {
+	docs := generateDoc(t, false)
+	for name, wants := range map[string][]string{
+		"room.RoomService": {
+			"# RoomService\n\nRoomService serves the <rooms>.\n",
+			"| [RoomService_ListRooms](#roomservice_listrooms) | GET | `/v1/users/{owner_id}/rooms` | `room.Lister/ListRooms` |\n",
+			"## Target `room.Lister`\n\nGo package of the client: `list`.\n",
+			"### <a id=\"roomservice_listrooms\"></a>RoomService_ListRooms\n\n`GET /v1/users/{owner_id}/rooms`\n\nListRooms lists the rooms of a user.\nThe rooms are paged.\n",
+			"- Authentication: required, scopes: `room.read`\n",
+			"| `owner_id` | path | uint64 | yes |  |\n",
+			"| `page.page_token` | query | string | no |  |\n",
+			"Status 200, [room.ListRoomsReply](#type-room-listroomsreply).\n",
+			"### <a id=\"type-room-room\"></a>room.Room\n\nRoom is a chat room.\n",
+			"| `ACTIVE` | 1 | ACTIVE rooms take messages. |\n",
+		},
+		"room.AdminService": {
+			"## Target `room.Admin`\n\nGo package of the client: `admin`.\n",
+			"| `X-Trace-Id` | header | string | yes | Forwarded to the target as the gRPC metadata \"trace\". |\n",
+			"| `room_id` | int64 | room_id is the id of the room. |\n| `status` | [room.Status](#type-room-status) |  |\n",
+			"| `labels` | map&lt;string, string&gt; |  |\n",
+			"| `parent` | [room.Room](#type-room-room) |  |\n",
+			"```json\n{\n  \"room_id\": \"0\",\n  \"status\": \"UNKNOWN\",\n  \"labels\": {\n    \"string\": \"string\"\n  },\n  \"parent\": {},\n  \"tags\": [\n    \"string\"\n  ]\n}\n```",
+			"Status 201, [room.Room](#type-room-room).\n",
+			"Or a multipart/form-data body:\n\n| Part | Type | Description |\n| --- | --- | --- |\n| `icon` | file | The file read into the field icon. Its name sets the field icon_name. |\n| `note` | string |  |\n\n",
+			"| `Location` | string | The value of the field icon_url. Omitted from the body. |\n\n| Field | Type | Description |\n| --- | --- | --- |\n| `room` | [room.Room](#type-room-room) |  |\n\n```json\n{\n  \"room\": {\n",
+		},
+	} {
+		for _, want := range wants {
+			if !strings.Contains(docs[name], want) {
+				t.Errorf("Generate() of %s = %s; want to contain %s", name, docs[name], want)
+			}
+		}
+	}
+	for name, got := range docs {
+		for _, unwanted := range []string{"@transmit", "@target", "RoomService_Hidden", "LabelsEntry", `"icon_url":`} {
+			if strings.Contains(got, unwanted) {
+				t.Errorf("Generate() of %s contains %s; want not", name, unwanted)
+			}
+		}
+	}
+}
+
+func TestGenerateHTML(t *testing.T) {
+	docs := generateDoc(t, true)
+	for name, wants := range map[string][]string{
+		"room.RoomService": {
+			"<p>RoomService serves the &lt;rooms&gt;.</p>",
+			`<h3 id="roomservice_listrooms">RoomService_ListRooms</h3>`,
+			`<td><a href="#type-room-status">room.Status</a></td>`,
+			"<td>map&lt;string, string&gt;</td>",
+		},
+		"room.AdminService": {
+			"<pre><code>{\n  &#34;room_id&#34;: &#34;0&#34;,",
+			"<p>Or a multipart/form-data body:</p>\n<table>\n<tr><th>Part</th><th>Type</th><th>Description</th></tr>\n<tr><td><code>icon</code></td><td>file</td>",
+			"<tr><td><code>room</code></td><td><a href=\"#type-room-room\">room.Room</a></td><td></td></tr>",
+		},
+	} {
+		for _, want := range wants {
+			if !strings.Contains(docs[name], want) {
+				t.Errorf("Generate() of %s = %s; want to contain %s", name, docs[name], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package gendoc
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+)
+
+func applyTemplate(doc *serviceDoc, html bool) (string, error) {
+	w := bytes.NewBuffer(nil)
+	var err error
+	if html {
+		err = htmlTemplate.Execute(w, doc)
+	} else {
+		err = mdTemplate.Execute(w, doc)
+	}
+	if err != nil {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+// typeName returns the name of "t" as written in the proto files.
+func typeName(t typeRef, link func(name, anchor string) string) string {
+	name := t.Name
+	if t.Anchor != "" {
+		name = link(name, t.Anchor)
+	}
+	switch {
+	case t.Key != "":
+		return "map&lt;" + t.Key + ", " + name + "&gt;"
+	case t.Repeated:
+		return "repeated " + name
+	}
+	return name
+}
+
+// mdType returns the Markdown of "t", linked to the reference of its type.
+func mdType(t typeRef) string {
+	return typeName(t, func(name, anchor string) string {
+		return "[" + name + "](#" + anchor + ")"
+	})
+}
+
+// htmlType returns the HTML of "t", linked to the reference of its type.
+func htmlType(t typeRef) htmltemplate.HTML {
+	return htmltemplate.HTML(typeName(t, func(name, anchor string) string {
+		return `<a href="#` + htmltemplate.HTMLEscapeString(anchor) + `">` + htmltemplate.HTMLEscapeString(name) + `</a>`
+	}))
+}
+
+// cell escapes "s" for a cell of a Markdown table.
+func cell(s string) string {
+	return strings.Replace(s, "|", `\|`, -1)
+}
+
+var (
+	funcMap = template.FuncMap{
+		"mdType": mdType,
+		"cell":   cell,
+		"join":   strings.Join,
+	}
+
+	mdTemplate = template.Must(template.New("md").Funcs(funcMap).Parse(`# {{.Name}}
+{{if .Comment}}
+{{join .Comment "\n"}}
+{{end}}
+Gateway service ` + "`{{.FQSN}}`" + `. The JSON bodies are marshaled as by jsonpb: the 64-bit integers are strings, the bytes base64 strings and the enums the names of their values.
+
+## Routes
+
+| Route | Method | Path | Target |
+| --- | --- | --- | --- |
+{{range .Targets}}{{range .Routes}}| [{{.Name}}](#{{.Anchor}}) | {{.HTTPMethod}} | ` + "`{{.Path}}`" + ` | ` + "`{{.TargetMethod}}`" + ` |
+{{end}}{{end}}{{range .Targets}}
+## Target ` + "`{{.Service}}`" + `
+{{if .Package}}
+Go package of the client: ` + "`{{.Package}}`" + `.
+{{end}}{{range .Routes}}
+### <a id="{{.Anchor}}"></a>{{.Name}}
+
+` + "`{{.HTTPMethod}} {{.Path}}`" + `
+{{if .Comment}}
+{{join .Comment "\n"}}
+{{end}}
+- Target method: ` + "`{{.TargetMethod}}`" + `
+- Authentication: {{.Auth}}{{if .Scopes}}, scopes: {{range $i, $s := .Scopes}}{{if $i}}, {{end}}` + "`{{$s}}`" + `{{end}}{{end}}{{if .Roles}}, one of the roles: {{range $i, $r := .Roles}}{{if $i}}, {{end}}` + "`{{$r}}`" + `{{end}}{{end}}
+- Session: {{.Session}}{{if .Streaming}}
+- Streaming: {{.Streaming}}{{end}}
+{{if .Params}}
+#### Parameters
+
+| Name | In | Type | Required | Description |
+| --- | --- | --- | --- | --- |
+{{range .Params}}| ` + "`{{.Name}}`" + ` | {{.In}} | {{mdType .Type}} | {{if .Required}}yes{{else}}no{{end}} | {{cell .Comment}} |
+{{end}}{{end}}{{with .Body}}
+#### Request body
+{{if .Raw}}
+The raw data of a google.api.HttpBody{{if .Stream}}, streamed{{end}}, with its Content-Type.
+{{else}}
+{{if .Field}}The field ` + "`{{.Field}}`" + ` of type {{mdType .Type}}{{else}}{{mdType .Type}}{{end}}{{if .Stream}}, a stream of messages, one JSON per line{{end}}.
+{{if .Fields}}
+| Field | Type | Description |
+| --- | --- | --- |
+{{range .Fields}}| ` + "`{{.Name}}`" + ` | {{mdType .Type}} | {{cell .Comment}} |
+{{end}}{{end}}
+` + "```json" + `
+{{.Example}}
+` + "```" + `
+{{end}}{{if .Form}}
+Or a multipart/form-data body:
+
+| Part | Type | Description |
+| --- | --- | --- |
+{{range .Form}}| ` + "`{{.Name}}`" + ` | {{mdType .Type}} | {{cell .Comment}} |
+{{end}}{{end}}{{end}}{{with .Response}}
+#### Response
+
+{{if .StatusField}}Status given by the field ` + "`{{.StatusField}}`" + `{{else}}Status {{.Status}}{{end}}{{if .Raw}}, the raw data of a google.api.HttpBody{{if .Stream}}, streamed{{end}} with its Content-Type{{else}}, {{if .Field}}the field ` + "`{{.Field}}`" + ` of type {{mdType .Type}}{{else}}{{mdType .Type}}{{end}}{{if .Stream}}, a stream of results, one JSON per line, ending with an ` + "`error`" + ` if the call fails{{end}}{{end}}.
+{{if .Headers}}
+| Header | Type | Description |
+| --- | --- | --- |
+{{range .Headers}}| ` + "`{{.Name}}`" + ` | {{mdType .Type}} | {{cell .Comment}} |
+{{end}}{{end}}{{if .Fields}}
+| Field | Type | Description |
+| --- | --- | --- |
+{{range .Fields}}| ` + "`{{.Name}}`" + ` | {{mdType .Type}} | {{cell .Comment}} |
+{{end}}{{end}}{{if .Example}}
+` + "```json" + `
+{{.Example}}
+` + "```" + `
+{{end}}{{end}}{{end}}{{end}}{{if .Types}}
+## Types
+{{range .Types}}
+### <a id="{{.Anchor}}"></a>{{.Name}}
+{{if .Comment}}
+{{join .Comment "\n"}}
+{{end}}{{if .Enum}}
+| Value | Number | Description |
+| --- | --- | --- |
+{{range .Values}}| ` + "`{{.Name}}`" + ` | {{.Number}} | {{cell .Comment}} |
+{{end}}{{else if .Fields}}
+| Field | Type | Description |
+| --- | --- | --- |
+{{range .Fields}}| ` + "`{{.Name}}`" + ` | {{mdType .Type}} | {{cell .Comment}} |
+{{end}}{{end}}{{end}}{{end}}`))
+
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{
+		"htmlType": htmlType,
+		"join":     strings.Join,
+	}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 0 auto; padding: 16px; color: #222; }
+table { border-collapse: collapse; margin: 8px 0; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+code, pre { background: #f4f4f4; }
+pre { padding: 8px; overflow: auto; }
+.method { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{range .Comment}}<p>{{.}}</p>
+{{end}}<p>Gateway service <code>{{.FQSN}}</code>. The JSON bodies are marshaled as by jsonpb: the 64-bit integers are strings, the bytes base64 strings and the enums the names of their values.</p>
+<h2>Routes</h2>
+<table>
+<tr><th>Route</th><th>Method</th><th>Path</th><th>Target</th></tr>
+{{range .Targets}}{{range .Routes}}<tr><td><a href="#{{.Anchor}}">{{.Name}}</a></td><td>{{.HTTPMethod}}</td><td><code>{{.Path}}</code></td><td><code>{{.TargetMethod}}</code></td></tr>
+{{end}}{{end}}</table>
+{{range .Targets}}<h2>Target <code>{{.Service}}</code></h2>
+{{if .Package}}<p>Go package of the client: <code>{{.Package}}</code>.</p>
+{{end}}{{range .Routes}}<h3 id="{{.Anchor}}">{{.Name}}</h3>
+<p><code><span class="method">{{.HTTPMethod}}</span> {{.Path}}</code></p>
+{{range .Comment}}<p>{{.}}</p>
+{{end}}<ul>
+<li>Target method: <code>{{.TargetMethod}}</code></li>
+<li>Authentication: {{.Auth}}{{if .Scopes}}, scopes: {{range $i, $s := .Scopes}}{{if $i}}, {{end}}<code>{{$s}}</code>{{end}}{{end}}{{if .Roles}}, one of the roles: {{range $i, $r := .Roles}}{{if $i}}, {{end}}<code>{{$r}}</code>{{end}}{{end}}</li>
+<li>Session: {{.Session}}</li>
+{{if .Streaming}}<li>Streaming: {{.Streaming}}</li>
+{{end}}</ul>
+{{if .Params}}<h4>Parameters</h4>
+<table>
+<tr><th>Name</th><th>In</th><th>Type</th><th>Required</th><th>Description</th></tr>
+{{range .Params}}<tr><td><code>{{.Name}}</code></td><td>{{.In}}</td><td>{{htmlType .Type}}</td><td>{{if .Required}}yes{{else}}no{{end}}</td><td>{{.Comment}}</td></tr>
+{{end}}</table>
+{{end}}{{with .Body}}<h4>Request body</h4>
+{{if .Raw}}<p>The raw data of a google.api.HttpBody{{if .Stream}}, streamed{{end}}, with its Content-Type.</p>
+{{else}}<p>{{if .Field}}The field <code>{{.Field}}</code> of type {{htmlType .Type}}{{else}}{{htmlType .Type}}{{end}}{{if .Stream}}, a stream of messages, one JSON per line{{end}}.</p>
+{{if .Fields}}<table>
+<tr><th>Field</th><th>Type</th><th>Description</th></tr>
+{{range .Fields}}<tr><td><code>{{.Name}}</code></td><td>{{htmlType .Type}}</td><td>{{.Comment}}</td></tr>
+{{end}}</table>
+{{end}}<pre><code>{{.Example}}</code></pre>
+{{end}}{{if .Form}}<p>Or a multipart/form-data body:</p>
+<table>
+<tr><th>Part</th><th>Type</th><th>Description</th></tr>
+{{range .Form}}<tr><td><code>{{.Name}}</code></td><td>{{htmlType .Type}}</td><td>{{.Comment}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}{{with .Response}}<h4>Response</h4>
+<p>{{if .StatusField}}Status given by the field <code>{{.StatusField}}</code>{{else}}Status {{.Status}}{{end}}{{if .Raw}}, the raw data of a google.api.HttpBody{{if .Stream}}, streamed{{end}} with its Content-Type{{else}}, {{if .Field}}the field <code>{{.Field}}</code> of type {{htmlType .Type}}{{else}}{{htmlType .Type}}{{end}}{{if .Stream}}, a stream of results, one JSON per line, ending with an <code>error</code> if the call fails{{end}}{{end}}.</p>
+{{if .Headers}}<table>
+<tr><th>Header</th><th>Type</th><th>Description</th></tr>
+{{range .Headers}}<tr><td><code>{{.Name}}</code></td><td>{{htmlType .Type}}</td><td>{{.Comment}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Fields}}<table>
+<tr><th>Field</th><th>Type</th><th>Description</th></tr>
+{{range .Fields}}<tr><td><code>{{.Name}}</code></td><td>{{htmlType .Type}}</td><td>{{.Comment}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Example}}<pre><code>{{.Example}}</code></pre>
+{{end}}{{end}}{{end}}{{end}}{{if .Types}}<h2>Types</h2>
+{{range .Types}}<h3 id="{{.Anchor}}">{{.Name}}</h3>
+{{range .Comment}}<p>{{.}}</p>
+{{end}}{{if .Enum}}<table>
+<tr><th>Value</th><th>Number</th><th>Description</th></tr>
+{{range .Values}}<tr><td><code>{{.Name}}</code></td><td>{{.Number}}</td><td>{{.Comment}}</td></tr>
+{{end}}</table>
+{{else if .Fields}}<table>
+<tr><th>Field</th><th>Type</th><th>Description</th></tr>
+{{range .Fields}}<tr><td><code>{{.Name}}</code></td><td>{{htmlType .Type}}</td><td>{{.Comment}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}{{end}}</body>
+</html>
+`))
+)
@@ -41,7 +41,6 @@ func New(reg *descriptor.Registry, useRequestContext bool, registerFuncSuffix, p
 	var imports []descriptor.GoPackage
 	for _, pkgpath := range []string{
 		"context",
-		"errors",
 		"io",
 		"net/http",
 		"time",
@@ -50,6 +49,7 @@ func New(reg *descriptor.Registry, useRequestContext bool, registerFuncSuffix, p
 		"github.com/golang/protobuf/proto",
 		"google.golang.org/grpc",
 		"google.golang.org/grpc/codes",
+		"google.golang.org/grpc/grpclog",
 		"google.golang.org/grpc/status",
 	} {
 		pkg := descriptor.GoPackage{
@@ -68,6 +68,16 @@ func New(reg *descriptor.Registry, useRequestContext bool, registerFuncSuffix, p
 		}
 		imports = append(imports, pkg)
 	}
+	// the runtime package of this project shares its name with the grpc-gateway one.
+	gwruntime := descriptor.GoPackage{
+		Path:  "github.com/generalzgd/protoc-gen-grpc-httpgw/runtime",
+		Name:  "runtime",
+		Alias: "gwruntime",
+	}
+	if err := reg.ReserveGoPackageAlias(gwruntime.Alias, gwruntime.Path); err != nil {
+		glog.Fatalf("Cannot reserve the alias of %s: %v", gwruntime.Path, err)
+	}
+	imports = append(imports, gwruntime)
 
 	var pathType pathType
 	switch pathTypeString {
@@ -131,23 +141,18 @@ func (g *generator) generate(file *descriptor.File) (string, error) {
 		pkgSeen[pkg.Path] = true
 		imports = append(imports, pkg)
 	}
-	name2path := g.reg.CommentsMap
-	path2Comments := g.reg.FileComments[*file.Name]
-
-	getComment := func (keys ...string) string {
-		comment := ""
-		pt := strings.Join(keys, "/")
-		if pp, ok := name2path[pt]; ok {
-			comment = path2Comments[pp]
-		}
-		return comment
-	}
-
+	g.reg.LoadComments(file)
 	for _, svc := range file.Services {
-		svc.Comment = getComment(*file.Name, *svc.Name)
-
 		for _, m := range svc.Methods {
-			m.Comment = getComment(*file.Name, *svc.Name, *m.Name)
+			if err := g.reg.CheckResponseFields(m); err != nil {
+				return "", err
+			}
+			if err := g.reg.CheckHashKey(m); err != nil {
+				return "", err
+			}
+			if err := g.reg.CheckUploads(m); err != nil {
+				return "", err
+			}
 
 			imports = append(imports, g.addEnumPathParamImports(file, m, pkgSeen)...)
 			pkg := m.RequestType.File.GoPkg
@@ -88,7 +88,7 @@ func newExampleFileDescriptorWithGoPkg(gp *descriptor.GoPackage) *descriptor.Fil
 
 func TestGenerateServiceWithoutBindings(t *testing.T) {
 	file := newExampleFileDescriptor()
-	g := &generator{}
+	g := &generator{reg: descriptor.NewRegistry()}
 	got, err := g.generate(crossLinkFixture(file))
 	if err != nil {
 		t.Errorf("generate(%#v) failed with %v; want success", file, err)
@@ -146,7 +146,7 @@ func TestGenerateOutputPath(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		g := &generator{pathType: c.pathType}
+		g := &generator{reg: descriptor.NewRegistry(), pathType: c.pathType}
 
 		file := c.file
 		gots, err := g.Generate([]*descriptor.File{crossLinkFixture(file)})
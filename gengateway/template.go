@@ -55,6 +55,9 @@ func (b binding) HasQueryParam() bool {
 	for _, p := range b.PathParams {
 		delete(fields, p.FieldPath.String())
 	}
+	for _, p := range b.HeaderParams {
+		delete(fields, p.FieldPath.String())
+	}
 	return len(fields) > 0
 }
 
@@ -66,9 +69,18 @@ func (b binding) QueryParamFilter() queryParamFilter {
 	for _, p := range b.PathParams {
 		seqs = append(seqs, strings.Split(p.FieldPath.String(), "."))
 	}
+	for _, p := range b.HeaderParams {
+		seqs = append(seqs, strings.Split(p.FieldPath.String(), "."))
+	}
 	return queryParamFilter{utilities.NewDoubleArray(seqs)}
 }
 
+// BindAssignableExpr is the AssignableExpr of the header parameter "p" in the bind function of
+// the binding, which returns only an error if the oneof of "p" is set to another field.
+func (b binding) BindAssignableExpr(p descriptor.HeaderParameter) string {
+	return strings.Replace(p.AssignableExpr("protoReq"), "return nil, metadata, ", "return ", -1)
+}
+
 // HasEnumPathParam returns true if the path parameter slice contains a parameter
 // that maps to an enum proto field that is not repeated, if not false is returned.
 func (b binding) HasEnumPathParam() bool {
@@ -236,6 +248,8 @@ var _ io.Reader
 var _ status.Status
 var _ = runtime.String
 var _ = utilities.NewDoubleArray
+var _ = gwruntime.NewGateway
+var _ = grpclog.Infof
 `))
 
 	handlerTemplate = template.Must(template.New("handler").Parse(`
@@ -250,9 +264,9 @@ var _ = utilities.NewDoubleArray
 
 	_ = template.Must(handlerTemplate.New("request-func-signature").Parse(strings.Replace(`
 {{if .Method.GetServerStreaming}}
-func request_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.GetName}}_{{.Index}}(ctx context.Context, marshaler runtime.Marshaler, client {{.Method.GetTargetSvrPackage}}{{.Method.GetTargetSvrName}}Client, req *http.Request, pathParams map[string]string) ({{.Method.GetTargetSvrName}}_{{.Method.GetName}}Client, runtime.ServerMetadata, error)
+func request_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.GetName}}_{{.Index}}(ctx context.Context, marshaler runtime.Marshaler, client {{.Method.GetTargetSvrPackage}}{{.Method.GetTargetSvrName}}Client, req *http.Request, pathParams map[string]string, gw *gwruntime.Gateway, route *gwruntime.Route) ({{.Method.GetTargetSvrPackage}}{{.Method.GetTargetSvrName}}_{{.Method.GetName}}Client, runtime.ServerMetadata, error)
 {{else}}
-func request_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.GetName}}_{{.Index}}(ctx context.Context, marshaler runtime.Marshaler, client {{.Method.GetTargetSvrPackage}}{{.Method.GetTargetSvrName}}Client, req *http.Request, pathParams map[string]string) (proto.Message, runtime.ServerMetadata, error)
+func request_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.GetName}}_{{.Index}}(ctx context.Context, marshaler runtime.Marshaler, client {{.Method.GetTargetSvrPackage}}{{.Method.GetTargetSvrName}}Client, req *http.Request, pathParams map[string]string, gw *gwruntime.Gateway, route *gwruntime.Route) (proto.Message, runtime.ServerMetadata, error)
 {{end}}`, "\n", "", -1)))
 
 	_ = template.Must(handlerTemplate.New("client-streaming-request-func").Parse(`
@@ -263,6 +277,22 @@ func request_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.Get
 		grpclog.Infof("Failed to start streaming: %v", err)
 		return nil, metadata, err
 	}
+{{- if .HasHTTPBodyRequest}}
+	err = gwruntime.DecodeHTTPBodyChunks(req, {{.GetBodyPath | printf "%q"}}, {{template "chunk-funcs" .}})
+	if err != nil && err != io.EOF {
+		grpclog.Infof("Failed to send request: %v", err)
+		return nil, metadata, err
+	}
+{{- else}}
+{{- if .Method.GetUploads}}
+	if gwruntime.IsMultipart(req) {
+		err = gwruntime.DecodeMultipartChunks(req, route, {{template "chunk-funcs" .}})
+		if err != nil && err != io.EOF {
+			grpclog.Infof("Failed to send request: %v", err)
+			return nil, metadata, err
+		}
+	} else {
+{{- end}}
 	dec := marshaler.NewDecoder(req.Body)
 	for {
 		var protoReq {{.Method.RequestType.GoType .Method.Service.File.GoPkg.Path}}
@@ -274,6 +304,9 @@ func request_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.Get
 			grpclog.Infof("Failed to decode request: %v", err)
 			return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
 		}
+		if err = gw.HookRequest(ctx, req, route, &protoReq); err != nil {
+			return nil, metadata, err
+		}
 		if err = stream.Send(&protoReq); err != nil {
 			if err == io.EOF {
 				break
@@ -282,6 +315,10 @@ func request_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.Get
 			return nil, metadata, err
 		}
 	}
+{{- if .Method.GetUploads}}
+	}
+{{- end}}
+{{- end}}
 
 	if err := stream.CloseSend(); err != nil {
 		grpclog.Infof("Failed to terminate client stream: %v", err)
@@ -303,6 +340,15 @@ func request_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.Get
 }
 `))
 
+	_ = template.Must(handlerTemplate.New("chunk-funcs").Parse(`func() proto.Message {
+		return new({{.Method.RequestType.GoType .Method.Service.File.GoPkg.Path}})
+	}, func(msg proto.Message) error {
+		if err := gw.HookRequest(ctx, req, route, msg); err != nil {
+			return err
+		}
+		return stream.Send(msg.(*{{.Method.RequestType.GoType .Method.Service.File.GoPkg.Path}}))
+	}`))
+
 	_ = template.Must(handlerTemplate.New("client-rpc-request-func").Parse(`
 {{$AllowPatchFeature := .AllowPatchFeature}}
 {{if .HasQueryParam}}
@@ -310,10 +356,53 @@ var (
 	filter_{{.Method.Service.GetName}}_{{.Method.GetName}}_{{.Index}} = {{.QueryParamFilter}}
 )
 {{end}}
+{{if .HeaderParams}}
+// bind_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.GetName}}_{{.Index}} sets the fields of "protoReq" read from the headers and the cookies of "req".
+func bind_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.GetName}}_{{.Index}}(req *http.Request, protoReq *{{.Method.RequestType.GoType .Method.Service.File.GoPkg.Path}}) error {
+{{- $binding := .}}
+{{- range $param := .HeaderParams}}
+{{- $enum := $binding.LookupEnum $param.Parameter}}
+	if val, ok := gwruntime.RequestValue(req, {{$param.Source | printf "%q"}}, {{$param.Name | printf "%q"}}); ok {
+		var err error
+{{- if $param.IsNestedProto3}}
+		err = runtime.PopulateFieldFromPath(protoReq, {{$param | printf "%q"}}, val)
+{{- else if $enum}}
+		e{{if $param.IsRepeated}}s{{end}}, err := {{$param.ConvertFuncExpr}}(val{{if $param.IsRepeated}}, {{$binding.Registry.GetRepeatedPathParamSeparator | printf "%c" | printf "%q"}}{{end}}, {{$enum.GoType $param.Target.Message.File.GoPkg.Path}}_value)
+{{- else}}
+		{{$binding.BindAssignableExpr $param}}, err = {{$param.ConvertFuncExpr}}(val{{if $param.IsRepeated}}, {{$binding.Registry.GetRepeatedPathParamSeparator | printf "%c" | printf "%q"}}{{end}})
+{{- end}}
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "type mismatch, {{$param.Source}}: %s, error: %v", {{$param.Name | printf "%q"}}, err)
+		}
+{{- if and $enum $param.IsRepeated}}
+		s := make([]{{$enum.GoType $param.Target.Message.File.GoPkg.Path}}, len(es))
+		for i, v := range es {
+			s[i] = {{$enum.GoType $param.Target.Message.File.GoPkg.Path}}(v)
+		}
+		{{$binding.BindAssignableExpr $param}} = s
+{{- else if $enum}}
+		{{$binding.BindAssignableExpr $param}} = {{$enum.GoType $param.Target.Message.File.GoPkg.Path}}(e)
+{{- end}}
+	}
+{{- end}}
+	return nil
+}
+{{end}}
 {{template "request-func-signature" .}} {
 	var protoReq {{.Method.RequestType.GoType .Method.Service.File.GoPkg.Path}}
 	var metadata runtime.ServerMetadata
-{{if .Body}}
+{{if .HasHTTPBodyRequest}}
+	if err := gwruntime.DecodeHTTPBody(req, &protoReq, {{.GetBodyPath | printf "%q"}}); err != nil {
+		return nil, metadata, err
+	}
+{{else if .Body}}
+	{{- if .Method.GetUploads}}
+	if gwruntime.IsMultipart(req) {
+		if err := gwruntime.DecodeMultipart(req, route, &protoReq); err != nil {
+			return nil, metadata, err
+		}
+	} else {
+	{{- end}}
 	newReader, berr := utilities.IOReaderFactory(req.Body)
 	if berr != nil {
 		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", berr)
@@ -332,6 +421,9 @@ var (
 			}
 	} {{end}}
 	{{end}}
+	{{- if .Method.GetUploads}}
+	}
+	{{- end}}
 {{end}}
 {{if .PathParams}}
 	var (
@@ -382,6 +474,14 @@ var (
 		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
 	}
 {{end}}
+{{- if .HeaderParams}}
+	if err := bind_{{.Method.Service.Name}}_{{.Method.GetTargetSvrName}}_{{.Method.GetName}}_{{.Index}}(req, &protoReq); err != nil {
+		return nil, metadata, err
+	}
+{{- end}}
+	if err := gw.HookRequest(ctx, req, route, &protoReq); err != nil {
+		return nil, metadata, err
+	}
 {{if .Method.GetServerStreaming}}
 	stream, err := client.{{.Method.GetName}}(ctx, &protoReq)
 	if err != nil {
@@ -418,6 +518,9 @@ var (
 			grpclog.Infof("Failed to decode request: %v", err)
 			return err
 		}
+		if err := gw.HookRequest(ctx, req, route, &protoReq); err != nil {
+			return err
+		}
 		if err := stream.Send(&protoReq); err != nil {
 			grpclog.Infof("Failed to send request: %v", err)
 			return err
@@ -454,7 +557,7 @@ var (
 `))
 
 	trailerTemplate = template.Must(template.New("trailer").Parse(`
-// type HttpPrehandler func(string, *http.Request) (int, bool)
+// type HttpPrehandler gwruntime.BeginHandler
 // type HttpDoneHandler func(string, proto.Message, http.ResponseWriter, *http.Request)
 // type QpsHandler func(time.Duration)
 
@@ -469,24 +572,30 @@ var (
 // @param getEndpoint: a callback func( 'package.Service/Method' ) 'endpoint address'
 // @param endCallback: a callback when grpc end, then callback('package.Service/Method' string, reply proto.Message) bool[false:quit]
 // @param getClientConn: a callback func( 'package.Service/Method' )(conn, error) to get long connection by method
+// @param doneHandler: a callback after the call succeeds, with the reply of a unary method and nil for a server
+// streaming method, whose replies are streamed afterwards
+// @param gwOpts: options of the runtime package, e.g. gwruntime.WithSessionManager
 func Register{{$svc.GetName}}{{$.RegisterFuncSuffix}}Client(
 	ctx context.Context, 
 	mux *runtime.ServeMux, 
 	opts []grpc.DialOption, 
 	getEndpoint func(string)string, 
 	getClientConn func(string) (*grpc.ClientConn, func(), error),
-	beginHandler func(string, *http.Request) (int, bool), 
+	beginHandler gwruntime.BeginHandler, 
 	doneHandler func(string, proto.Message, http.ResponseWriter, *http.Request), 
-	qpsHandler func(time.Duration)) error {
+	qpsHandler func(time.Duration),
+	gwOpts ...gwruntime.GatewayOption) error {
 
-	makeConn := func(meth string) (*grpc.ClientConn, func(), error) {
-		if getClientConn != nil {
-			return getClientConn(meth)
-		}
-		addr := getEndpoint(meth)
-		conn, err := grpc.Dial(addr, opts...)
-		return conn, func() { conn.Close() }, err
+	gw := gwruntime.NewGateway(gwOpts...)
+	gw.AddRoutes({{$svc.GetName}}Routes)
+	gw.HandleBatch(mux)
+
+	handlers := &gwruntime.Handlers{
+		MakeConn: gwruntime.ConnFunc(opts, getEndpoint, getClientConn),
+		Begin:    beginHandler,
+		Done:     doneHandler,
 	}
+	gw.HandleJSONRPC(mux, {{$svc.GetName}}JSONRPCMethods, handlers, qpsHandler)
 
 	{{range $m := $svc.Methods}}
 	{{range $b := $m.Bindings}}
@@ -494,65 +603,84 @@ func Register{{$svc.GetName}}{{$.RegisterFuncSuffix}}Client(
 	{{if $m.Comment}}{{$m.GetFormatComment}}{{end}}
 	mux.Handle({{$b.HTTPMethod | printf "%q"}}, pattern_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		begin := time.Now()
-		defer qpsHandler(time.Since(begin))
+		defer func() { qpsHandler(time.Since(begin)) }()
 		
 	{{- if $UseRequestContext }}
 		ctx, cancel := context.WithCancel(req.Context())
-	{{- else -}}
+	{{- else}}
 		ctx, cancel := context.WithCancel(ctx)
 	{{- end }}
 		defer cancel()
+		ctx, w, observed := gw.ObserveRequest(ctx, w, req, route_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}})
+		defer observed()
+		w, compressed := gw.CompressResponse(w, req)
+		defer compressed()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
-
-		meth := "{{$svc.File.GoPkg.Name}}.{{$m.GetTargetSvrName}}/{{$m.Name}}"
-		if code, ok := beginHandler(meth, req); code == http.StatusAccepted {
-			if !ok {
-				runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, errors.New("not login yet"))
-				return
-			}
-		} else {
-			runtime.OtherErrorHandler(w, req, http.StatusText(code), code)
+		outboundMarshaler = gw.OutboundMarshaler(outboundMarshaler)
+		if err := gw.DecodeRequest(req); err != nil {
+			gw.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 			return
 		}
-		
-		rctx, err := runtime.AnnotateContext(ctx, mux, req)
-		if err != nil {
-			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
-			return
-		}
-		
-		conn, closeFunc, err := makeConn(meth)
-		if err != nil {
-			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
-			return
-		}
-		defer closeFunc()
-
-		client := {{$m.GetTargetSvrPackage}}New{{$m.GetTargetSvrName}}Client(conn)
 
-		resp, md, err := request_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}(rctx, inboundMarshaler, client, req, pathParams)
-		ctx = runtime.NewServerMetadataContext(ctx, md)
+		ctx, err := gw.Invoke(ctx, mux, w, req, route_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}, pathParams, handlers, func(ctx context.Context, conn *grpc.ClientConn) (*gwruntime.Reply, runtime.ServerMetadata, error) {
+			client := {{$m.GetTargetSvrPackage}}New{{$m.GetTargetSvrName}}Client(conn)
+			resp, md, err := request_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}(ctx, inboundMarshaler, client, req, pathParams, gw, route_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}})
+			{{- if $m.GetServerStreaming}}
+			return &gwruntime.Reply{Recv: func() (proto.Message, error) { return resp.Recv() }}, md, err
+			{{- else}}
+			return &gwruntime.Reply{Message: resp}, md, err
+			{{- end}}
+		}, func(ctx context.Context, reply *gwruntime.Reply) error {
+			if gw.AnswerEarly(ctx, mux, outboundMarshaler, w, req, reply) {
+				return nil
+			}
+		{{- if $m.GetServerStreaming}}
+			forward_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}({{if $b.HasHTTPBodyResponse}}gw, {{end}}ctx, mux, outboundMarshaler, w, req, reply.Recv, mux.GetForwardResponseOptions()...)
+		{{- else}}
+			w, resp, err := gw.PrepareResponse(w, route_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}, reply.Message)
+			if err != nil {
+				return err
+			}
+			{{- if $b.ResponseBody}}
+			forward_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}({{if $b.HasHTTPBodyResponse}}gw, {{end}}ctx, mux, outboundMarshaler, w, req, response_{{$svc.GetName}}_{{$m.GetName}}_{{$b.Index}}{resp}, mux.GetForwardResponseOptions()...)
+			{{- else}}
+			forward_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}({{if $b.HasHTTPBodyResponse}}gw, {{end}}ctx, mux, outboundMarshaler, w, req, resp, mux.GetForwardResponseOptions()...)
+			{{- end}}
+		{{- end}}
+			return nil
+		})
 		if err != nil {
-			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
-			return
+			gw.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 		}
-		doneHandler(meth, resp, w, req)
-
-		{{if $m.GetServerStreaming}}
-		forward_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}(ctx, mux, outboundMarshaler, w, req, func() (proto.Message, error) { return resp.Recv() }, mux.GetForwardResponseOptions()...)
-		{{else}}
-		{{ if $b.ResponseBody }}
-		forward_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}(ctx, mux, outboundMarshaler, w, req, response_{{$svc.GetName}}_{{$m.GetName}}_{{$b.Index}}{resp}, mux.GetForwardResponseOptions()...)
-		{{ else }}
-		forward_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}}(ctx, mux, outboundMarshaler, w, req, resp, mux.GetForwardResponseOptions()...)
-		{{end}}
-		{{end}}
 	})
 	{{end}}
 	{{end}}
 	return nil
 }
 
+// Register{{$svc.GetName}}HealthHandler adds the "@target" services of service {{$svc.GetName}} to "checker", which
+// checks them with the grpc.health.v1 protocol over the connections made like Register{{$svc.GetName}}{{$.RegisterFuncSuffix}}Client
+// does, and registers its GET /healthz and /readyz to "mux" unless they are already. The services sharing
+// a checker are checked together.
+func Register{{$svc.GetName}}HealthHandler(
+	mux *runtime.ServeMux,
+	checker *gwruntime.HealthChecker,
+	opts []grpc.DialOption,
+	getEndpoint func(string) string,
+	getClientConn func(string) (*grpc.ClientConn, func(), error)) {
+
+	checker.AddTargets(healthTargets_{{$svc.GetName}}, gwruntime.ConnFunc(opts, getEndpoint, getClientConn))
+	checker.Register(mux)
+}
+
+var (
+	healthTargets_{{$svc.GetName}} = []gwruntime.HealthTarget{
+		{{- range $m := $svc.GetTargetMethods}}
+		{Name: "{{with $m.GetTargetSvrPackage}}{{.}}{{else}}{{$svc.File.GoPkg.Name}}.{{end}}{{$m.GetTargetSvrName}}", Method: "{{$svc.File.GoPkg.Name}}.{{$m.GetTargetSvrName}}/{{$m.Name}}"},
+		{{- end}}
+	}
+)
+
 {{range $m := $svc.Methods}}
 {{range $b := $m.Bindings}}
 {{if $b.ResponseBody}}
@@ -561,7 +689,11 @@ type response_{{$svc.GetName}}_{{$m.GetName}}_{{$b.Index}} struct {
 }
 
 func (m response_{{$svc.GetName}}_{{$m.GetName}}_{{$b.Index}}) XXX_ResponseBody() interface{} {
-	response := m.Message.(*{{$m.ResponseType.GoType $m.Service.File.GoPkg.Path}})
+	response, ok := m.Message.(*{{$m.ResponseType.GoType $m.Service.File.GoPkg.Path}})
+	if !ok {
+		// replaced by a response hook.
+		return m.Message
+	}
 	return {{$b.ResponseBody.AssignableExpr "response"}}
 }
 {{end}}
@@ -579,7 +711,104 @@ var (
 var (
 	{{range $m := $svc.Methods}}
 	{{range $b := $m.Bindings}}
-	forward_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}} = {{if $m.GetServerStreaming}}runtime.ForwardResponseStream{{else}}runtime.ForwardResponseMessage{{end}}
+	route_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}} = &gwruntime.Route{
+		Service:      "{{$svc.File.GoPkg.Name}}.{{$svc.GetName}}",
+		HTTPMethod:   {{$b.HTTPMethod | printf "%q"}},
+		Path:         {{$b.PathTmpl.Template | printf "%q"}},
+		Body:         {{$b.GetBodyPath | printf "%q"}},
+		ResponseBody: {{$b.GetResponseBodyPath | printf "%q"}},
+		Method:       "{{$svc.File.GoPkg.Name}}.{{$m.GetTargetSvrName}}/{{$m.Name}}",
+		Streaming:    gwruntime.StreamingKind({{$m.GetStreamingKind | printf "%q"}}),
+		Session: gwruntime.SessionRole({{$m.GetSessionRole | printf "%q"}}),
+		Auth:    gwruntime.AuthMode({{$m.GetAuthMode | printf "%q"}}),
+		Scopes:  {{$m.GetScopes | printf "%#v"}},
+		Roles:   {{$m.GetRoles | printf "%#v"}},
+		Metadata: []gwruntime.MetadataMapping{
+			{{- range $md := $m.GetMetadataMappings}}
+			{Source: {{$md.Source | printf "%q"}}, Name: {{$md.Name | printf "%q"}}, Key: {{$md.Key | printf "%q"}}, Required: {{$md.Required}}, Pattern: {{$md.Pattern | printf "%q"}}},
+			{{- end}}
+		},
+		ResponseHeaders: []gwruntime.ResponseHeader{
+			{{- range $h := $m.GetResponseHeaders}}
+			{Field: {{$h.Field | printf "%q"}}, Header: {{$h.Header | printf "%q"}}, Omit: {{$h.Omit}}},
+			{{- end}}
+		},
+		{{- with $st := $m.GetResponseStatus}}
+		Status:          {{$st.Code}},
+		StatusField:     {{$st.Field | printf "%q"}},
+		OmitStatusField: {{$st.Omit}},
+		{{- end}}
+		{{- with $k := $m.GetHashKey}}{{if $k.Source}}
+		HashKey: gwruntime.HashKey{Source: gwruntime.HashKeySource({{$k.Source | printf "%q"}}), Name: {{$k.Name | printf "%q"}}},
+		{{- end}}{{end}}
+		{{- with $m.GetUploads}}
+		Uploads: []gwruntime.Upload{
+			{{- range $u := .}}
+			{Part: {{$u.Part | printf "%q"}}, Field: {{$u.Field | printf "%q"}}, FilenameField: {{$u.FilenameField | printf "%q"}}, ContentTypeField: {{$u.ContentTypeField | printf "%q"}}, MaxSize: {{$u.MaxSize}}, ChunkSize: {{$u.ChunkSize}}},
+			{{- end}}
+		},
+		{{- end}}
+	}
+	{{end}}
+	{{end}}
+)
+
+// {{$svc.GetName}}Routes are the routes registered by Register{{$svc.GetName}}{{$.RegisterFuncSuffix}}Client,
+// in the order of registration.
+var {{$svc.GetName}}Routes = []*gwruntime.Route{
+	{{- range $m := $svc.Methods}}
+	{{- range $b := $m.Bindings}}
+	route_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}},
+	{{- end}}
+	{{- end}}
+}
+
+// {{$svc.GetName}}JSONRPCMethods are the unary and server streaming methods served as "{{$svc.GetName}}.Method"
+// by the JSON-RPC endpoint of Register{{$svc.GetName}}{{$.RegisterFuncSuffix}}Client, see gwruntime.WithJSONRPC.
+{{- range $m := $svc.Methods}}
+{{- if $m.CanOutput}}
+{{- if not $m.Bindings}}
+// {{$svc.GetName}}.{{$m.GetName}} is not served: it has no http binding.
+{{- else if $m.GetClientStreaming}}
+// {{$svc.GetName}}.{{$m.GetName}} is not served: the params of a call are a single request message.
+{{- end}}
+{{- end}}
+{{- end}}
+var {{$svc.GetName}}JSONRPCMethods = []*gwruntime.JSONRPCMethod{
+	{{- range $m := $svc.Methods}}
+	{{- if and $m.CanOutput $m.Bindings (not $m.GetClientStreaming)}}
+	{
+		Name:  "{{$svc.GetName}}.{{$m.GetName}}",
+		Route: route_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{(index $m.Bindings 0).Index}},
+		NewRequest: func() proto.Message {
+			return new({{$m.RequestType.GoType $m.Service.File.GoPkg.Path}})
+		},
+		{{- if (index $m.Bindings 0).HeaderParams}}
+		Bind: func(req *http.Request, msg proto.Message) error {
+			return bind_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{(index $m.Bindings 0).Index}}(req, msg.(*{{$m.RequestType.GoType $m.Service.File.GoPkg.Path}}))
+		},
+		{{- end}}
+		Invoke: func(ctx context.Context, conn *grpc.ClientConn, msg proto.Message, opts ...grpc.CallOption) (*gwruntime.Reply, error) {
+			{{- if $m.GetServerStreaming}}
+			stream, err := {{$m.GetTargetSvrPackage}}New{{$m.GetTargetSvrName}}Client(conn).{{$m.GetName}}(ctx, msg.(*{{$m.RequestType.GoType $m.Service.File.GoPkg.Path}}), opts...)
+			if err != nil {
+				return nil, err
+			}
+			return &gwruntime.Reply{Recv: func() (proto.Message, error) { return stream.Recv() }}, nil
+			{{- else}}
+			resp, err := {{$m.GetTargetSvrPackage}}New{{$m.GetTargetSvrName}}Client(conn).{{$m.GetName}}(ctx, msg.(*{{$m.RequestType.GoType $m.Service.File.GoPkg.Path}}), opts...)
+			return &gwruntime.Reply{Message: resp}, err
+			{{- end}}
+		},
+	},
+	{{- end}}
+	{{- end}}
+}
+
+var (
+	{{range $m := $svc.Methods}}
+	{{range $b := $m.Bindings}}
+	forward_{{$m.Service.Name}}_{{$m.GetTargetSvrName}}_{{$m.GetName}}_{{$b.Index}} = {{if $b.HasHTTPBodyResponse}}(*gwruntime.Gateway).ForwardHTTPBody{{if $m.GetServerStreaming}}Stream{{end}}{{else if $m.GetServerStreaming}}runtime.ForwardResponseStream{{else}}runtime.ForwardResponseMessage{{end}}
 	{{end}}
 	{{end}}
 )
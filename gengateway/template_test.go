@@ -6,6 +6,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	protodescriptor "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
 
 	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
 	"github.com/generalzgd/protoc-gen-grpc-httpgw/httprule"
@@ -134,11 +135,11 @@ func TestApplyTemplateRequestWithoutClientStreaming(t *testing.T) {
 	}{
 		{
 			serverStreaming: false,
-			sigWant:         `func request_ExampleService_Echo_0(ctx context.Context, marshaler runtime.Marshaler, client ExampleServiceClient, req *http.Request, pathParams map[string]string) (proto.Message, runtime.ServerMetadata, error) {`,
+			sigWant:         `func request_ExampleService_Echo_Echo_0(ctx context.Context, marshaler runtime.Marshaler, client EchoClient, req *http.Request, pathParams map[string]string, gw *gwruntime.Gateway, route *gwruntime.Route) (proto.Message, runtime.ServerMetadata, error) {`,
 		},
 		{
 			serverStreaming: true,
-			sigWant:         `func request_ExampleService_Echo_0(ctx context.Context, marshaler runtime.Marshaler, client ExampleServiceClient, req *http.Request, pathParams map[string]string) (ExampleService_EchoClient, runtime.ServerMetadata, error) {`,
+			sigWant:         `func request_ExampleService_Echo_Echo_0(ctx context.Context, marshaler runtime.Marshaler, client EchoClient, req *http.Request, pathParams map[string]string, gw *gwruntime.Gateway, route *gwruntime.Route) (Echo_EchoClient, runtime.ServerMetadata, error) {`,
 		},
 	} {
 		meth.ServerStreaming = proto.Bool(spec.serverStreaming)
@@ -240,10 +241,10 @@ func TestApplyTemplateRequestWithoutClientStreaming(t *testing.T) {
 		if want := `protoReq.GetNested().Int32, err = runtime.Int32P(val)`; !strings.Contains(got, want) {
 			t.Errorf("applyTemplate(%#v) = %s; want to contain %s", file, got, want)
 		}
-		if want := `func RegisterExampleServiceHandler(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {`; !strings.Contains(got, want) {
+		if want := `func RegisterExampleServiceHandlerClient(`; !strings.Contains(got, want) {
 			t.Errorf("applyTemplate(%#v) = %s; want to contain %s", file, got, want)
 		}
-		if want := `pattern_ExampleService_Echo_0 = runtime.MustPattern(runtime.NewPattern(1, []int{0, 0}, []string(nil), "", runtime.AssumeColonVerbOpt(true)))`; !strings.Contains(got, want) {
+		if want := `pattern_ExampleService_Echo_Echo_0 = runtime.MustPattern(runtime.NewPattern(1, []int{0, 0}, []string(nil), "", runtime.AssumeColonVerbOpt(true)))`; !strings.Contains(got, want) {
 			t.Errorf("applyTemplate(%#v) = %s; want to contain %s", file, got, want)
 		}
 	}
@@ -295,11 +296,11 @@ func TestApplyTemplateRequestWithClientStreaming(t *testing.T) {
 	}{
 		{
 			serverStreaming: false,
-			sigWant:         `func request_ExampleService_Echo_0(ctx context.Context, marshaler runtime.Marshaler, client ExampleServiceClient, req *http.Request, pathParams map[string]string) (proto.Message, runtime.ServerMetadata, error) {`,
+			sigWant:         `func request_ExampleService_Echo_Echo_0(ctx context.Context, marshaler runtime.Marshaler, client EchoClient, req *http.Request, pathParams map[string]string, gw *gwruntime.Gateway, route *gwruntime.Route) (proto.Message, runtime.ServerMetadata, error) {`,
 		},
 		{
 			serverStreaming: true,
-			sigWant:         `func request_ExampleService_Echo_0(ctx context.Context, marshaler runtime.Marshaler, client ExampleServiceClient, req *http.Request, pathParams map[string]string) (ExampleService_EchoClient, runtime.ServerMetadata, error) {`,
+			sigWant:         `func request_ExampleService_Echo_Echo_0(ctx context.Context, marshaler runtime.Marshaler, client EchoClient, req *http.Request, pathParams map[string]string, gw *gwruntime.Gateway, route *gwruntime.Route) (Echo_EchoClient, runtime.ServerMetadata, error) {`,
 		},
 	} {
 		meth.ServerStreaming = proto.Bool(spec.serverStreaming)
@@ -392,10 +393,10 @@ func TestApplyTemplateRequestWithClientStreaming(t *testing.T) {
 		if want := spec.sigWant; !strings.Contains(got, want) {
 			t.Errorf("applyTemplate(%#v) = %s; want to contain %s", file, got, want)
 		}
-		if want := `func RegisterExampleServiceHandler(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {`; !strings.Contains(got, want) {
+		if want := `func RegisterExampleServiceHandlerClient(`; !strings.Contains(got, want) {
 			t.Errorf("applyTemplate(%#v) = %s; want to contain %s", file, got, want)
 		}
-		if want := `pattern_ExampleService_Echo_0 = runtime.MustPattern(runtime.NewPattern(1, []int{0, 0}, []string(nil), "", runtime.AssumeColonVerbOpt(true)))`; !strings.Contains(got, want) {
+		if want := `pattern_ExampleService_Echo_Echo_0 = runtime.MustPattern(runtime.NewPattern(1, []int{0, 0}, []string(nil), "", runtime.AssumeColonVerbOpt(true)))`; !strings.Contains(got, want) {
 			t.Errorf("applyTemplate(%#v) = %s; want to contain %s", file, got, want)
 		}
 	}
@@ -574,3 +575,568 @@ func TestIdentifierCapitalization(t *testing.T) {
 		t.Errorf("applyTemplate(%#v) = %s; want to contain %s", file, got, want)
 	}
 }
+
+// applyTemplateToText applies the template to example.proto of the request "text", whose services and
+// methods have the "comments" by their names.
+func applyTemplateToText(t *testing.T, text string, comments map[string]string) string {
+	var req plugin.CodeGeneratorRequest
+	if err := proto.UnmarshalText(text, &req); err != nil {
+		t.Fatalf("proto.UnmarshalText(%s) failed with %v; want success", text, err)
+	}
+	reg := descriptor.NewRegistry()
+	if err := reg.Load(&req); err != nil {
+		t.Fatalf("reg.Load(%s) failed with %v; want success", text, err)
+	}
+	file, err := reg.LookupFile("example.proto")
+	if err != nil {
+		t.Fatalf("reg.LookupFile(%q) failed with %v; want success", "example.proto", err)
+	}
+	for _, svc := range file.Services {
+		svc.Comment = comments[svc.GetName()]
+		for _, m := range svc.Methods {
+			m.Comment = comments[m.GetName()]
+		}
+	}
+	got, err := applyTemplate(param{File: file, RegisterFuncSuffix: "Handler"}, reg)
+	if err != nil {
+		t.Fatalf("applyTemplate(%s) failed with %v; want success", text, err)
+	}
+	return got
+}
+
+func TestApplyTemplateHeaderParams(t *testing.T) {
+	got := applyTemplateToText(t, `
+		file_to_generate: "example.proto"
+		proto_file <
+			name: "example.proto"
+			package: "example"
+			syntax: "proto3"
+			options < go_package: "example.com/path/to/example/example_pb" >
+			message_type <
+				name: "EchoRequest"
+				field < name: "id" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+				field <
+					name: "device_id" label: LABEL_OPTIONAL type: TYPE_STRING number: 2
+					options < [httpgw.from_header]: "X-Device-Id" >
+				>
+				field <
+					name: "guid" label: LABEL_OPTIONAL type: TYPE_INT64 number: 3
+					options < [httpgw.from_cookie]: "ZQ_GUID" >
+				>
+			>
+			service <
+				name: "ExampleService"
+				method <
+					name: "Echo"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+					options < [google.api.http] < get: "/v1/echo/{id}" > >
+				>
+			>
+		>`, map[string]string{"Echo": "@transmit\n@target Echoer"})
+	for _, want := range []string{
+		`if val, ok := gwruntime.RequestValue(req, "header", "X-Device-Id"); ok {`,
+		`protoReq.DeviceId, err = runtime.String(val)`,
+		`func bind_ExampleService_Echoer_Echo_0(req *http.Request, protoReq *EchoRequest) error {`,
+		`return status.Errorf(codes.InvalidArgument, "type mismatch, header: %s, error: %v", "X-Device-Id", err)`,
+		`if val, ok := gwruntime.RequestValue(req, "cookie", "ZQ_GUID"); ok {`,
+		`protoReq.Guid, err = runtime.Int64(val)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyTemplate() = %s; want to contain %s", got, want)
+		}
+	}
+}
+
+func TestApplyTemplateResponseFields(t *testing.T) {
+	got := applyTemplateToText(t, `
+		file_to_generate: "example.proto"
+		proto_file <
+			name: "example.proto"
+			package: "example"
+			syntax: "proto3"
+			options < go_package: "example.com/path/to/example/example_pb" >
+			message_type <
+				name: "CreateRequest"
+				field < name: "name" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+			>
+			message_type <
+				name: "CreateReply"
+				field < name: "id" label: LABEL_OPTIONAL type: TYPE_INT64 number: 1 >
+				field < name: "location" label: LABEL_OPTIONAL type: TYPE_STRING number: 2 >
+				field < name: "http_status" label: LABEL_OPTIONAL type: TYPE_INT32 number: 3 >
+			>
+			service <
+				name: "ExampleService"
+				method <
+					name: "Create"
+					input_type: ".example.CreateRequest"
+					output_type: ".example.CreateReply"
+					options < [google.api.http] < post: "/v1/items" body: "*" > >
+				>
+				method <
+					name: "Put"
+					input_type: ".example.CreateRequest"
+					output_type: ".example.CreateReply"
+					options < [google.api.http] < put: "/v1/items" body: "*" > >
+				>
+			>
+		>`, map[string]string{
+		"Create": "@transmit\n@target Creator\n@status http_status omit\n@resheader location=Location omit\n@resheader id=X-Item-Id",
+		"Put":    "@transmit\n@target Creator\n@status 201",
+	})
+	for _, want := range []string{
+		`{Field: "location", Header: "Location", Omit: true},`,
+		`{Field: "id", Header: "X-Item-Id", Omit: false},`,
+		`StatusField:     "http_status",`,
+		`OmitStatusField: true,`,
+		`w, resp, err := gw.PrepareResponse(w, route_ExampleService_Creator_Create_0, reply.Message)`,
+		`Status:          201,`,
+		`w, resp, err := gw.PrepareResponse(w, route_ExampleService_Creator_Put_0, reply.Message)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyTemplate() = %s; want to contain %s", got, want)
+		}
+	}
+}
+
+func TestApplyTemplateHooks(t *testing.T) {
+	got := applyTemplateToText(t, `
+		file_to_generate: "example.proto"
+		proto_file <
+			name: "example.proto"
+			package: "example"
+			syntax: "proto3"
+			options < go_package: "example.com/path/to/example/example_pb" >
+			message_type <
+				name: "EchoRequest"
+				field < name: "id" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+			>
+			service <
+				name: "ExampleService"
+				method <
+					name: "Echo"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+					options < [google.api.http] < get: "/v1/echo/{id}" > >
+				>
+				method <
+					name: "Upload"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+					client_streaming: true
+					options < [google.api.http] < post: "/v1/upload" body: "*" > >
+				>
+				method <
+					name: "Watch"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+					server_streaming: true
+					options < [google.api.http] < get: "/v1/watch" > >
+				>
+			>
+		>`, map[string]string{
+		"Echo":   "@transmit\n@target Echoer",
+		"Upload": "@transmit\n@target Echoer",
+		"Watch":  "@transmit\n@target Echoer",
+	})
+	for _, want := range []string{
+		// the unary and the server streaming requests.
+		`if err := gw.HookRequest(ctx, req, route, &protoReq); err != nil {`,
+		`ctx, err := gw.Invoke(ctx, mux, w, req, route_ExampleService_Echoer_Echo_0, pathParams, handlers, func(ctx context.Context, conn *grpc.ClientConn) (*gwruntime.Reply, runtime.ServerMetadata, error) {`,
+		`return &gwruntime.Reply{Message: resp}, md, err`,
+		// each message of the client stream.
+		`if err = gw.HookRequest(ctx, req, route, &protoReq); err != nil {`,
+		// the response hooks of the stream are called by gw.Invoke on each message received with reply.Recv.
+		`return &gwruntime.Reply{Recv: func() (proto.Message, error) { return resp.Recv() }}, md, err`,
+		`forward_ExampleService_Echoer_Watch_0(ctx, mux, outboundMarshaler, w, req, reply.Recv, mux.GetForwardResponseOptions()...)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyTemplate() = %s; want to contain %s", got, want)
+		}
+	}
+}
+
+func TestApplyTemplateHashKey(t *testing.T) {
+	got := applyTemplateToText(t, `
+		file_to_generate: "example.proto"
+		proto_file <
+			name: "example.proto"
+			package: "example"
+			syntax: "proto3"
+			options < go_package: "example.com/path/to/example/example_pb" >
+			message_type <
+				name: "RoomRequest"
+				field < name: "room_id" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+			>
+			service <
+				name: "ExampleService"
+				method <
+					name: "Get"
+					input_type: ".example.RoomRequest"
+					output_type: ".example.RoomRequest"
+					options < [google.api.http] < get: "/v1/rooms/{room_id}" > >
+				>
+				method <
+					name: "List"
+					input_type: ".example.RoomRequest"
+					output_type: ".example.RoomRequest"
+					options < [google.api.http] < get: "/v1/rooms" > >
+				>
+			>
+		>`, map[string]string{
+		"ExampleService": "@hashkey header:X-User-Id",
+		"Get":            "@transmit\n@target Rooms\n@hashkey path:room_id",
+		"List":           "@transmit\n@target Rooms",
+	})
+	for _, want := range []string{
+		`HashKey: gwruntime.HashKey{Source: gwruntime.HashKeySource("path"), Name: "room_id"},`,
+		`ctx, err := gw.Invoke(ctx, mux, w, req, route_ExampleService_Rooms_Get_0, pathParams, handlers, func(`,
+		// the method without a key of its own takes the one of the service.
+		`HashKey: gwruntime.HashKey{Source: gwruntime.HashKeySource("header"), Name: "X-User-Id"},`,
+		`ctx, err := gw.Invoke(ctx, mux, w, req, route_ExampleService_Rooms_List_0, pathParams, handlers, func(`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyTemplate() = %s; want to contain %s", got, want)
+		}
+	}
+}
+
+func TestApplyTemplateRoutes(t *testing.T) {
+	got := applyTemplateToText(t, `
+		file_to_generate: "example.proto"
+		proto_file <
+			name: "example.proto"
+			package: "example"
+			syntax: "proto3"
+			options < go_package: "example.com/path/to/example/example_pb" >
+			message_type <
+				name: "ListRequest"
+				field < name: "owner_id" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+			>
+			message_type <
+				name: "ListReply"
+				field < name: "rooms" label: LABEL_REPEATED type: TYPE_STRING number: 1 >
+				field < name: "page" label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".example.Page" number: 2 >
+			>
+			message_type <
+				name: "Page"
+				field < name: "token" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+			>
+			service <
+				name: "ExampleService"
+				method <
+					name: "List"
+					input_type: ".example.ListRequest"
+					output_type: ".example.ListReply"
+					options <
+						[google.api.http] <
+							get: "/v1/users/{owner_id}/rooms"
+							additional_bindings < post: "/v1/rooms:list" body: "*" response_body: "page" >
+						>
+					>
+				>
+			>
+		>`, map[string]string{
+		"List": "@transmit\n@target Rooms\n@session login\n@auth optional\n@scope room.read\n@role admin\n@metadata header:X-Trace-Id=trace required",
+	})
+	for _, want := range []string{
+		`route_ExampleService_Rooms_List_0 = &gwruntime.Route{`,
+		`Service:      "example_pb.ExampleService",`,
+		`HTTPMethod:   "GET",`,
+		`Path:         "/v1/users/{owner_id}/rooms",`,
+		`Method:       "example_pb.Rooms/List",`,
+		`Session: gwruntime.SessionRole("login"),`,
+		`Auth:    gwruntime.AuthMode("optional"),`,
+		`Scopes:  []string{"room.read"},`,
+		`Roles:   []string{"admin"},`,
+		`{Source: "header", Name: "X-Trace-Id", Key: "trace", Required: true, Pattern: ""},`,
+		`route_ExampleService_Rooms_List_1 = &gwruntime.Route{`,
+		`Path:         "/v1/rooms:list",`,
+		`Body:         "*",`,
+		`ResponseBody: "page",`,
+		`var ExampleServiceRoutes = []*gwruntime.Route{`,
+		`route_ExampleService_Rooms_List_0,`,
+		`route_ExampleService_Rooms_List_1,`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyTemplate() = %s; want to contain %s", got, want)
+		}
+	}
+}
+
+func TestApplyTemplateUploads(t *testing.T) {
+	got := applyTemplateToText(t, `
+		file_to_generate: "example.proto"
+		proto_file <
+			name: "example.proto"
+			package: "example"
+			syntax: "proto3"
+			options < go_package: "example.com/path/to/example/example_pb" >
+			message_type <
+				name: "UploadRequest"
+				field < name: "room_id" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+				field < name: "data" label: LABEL_OPTIONAL type: TYPE_BYTES number: 2 >
+				field < name: "name" label: LABEL_OPTIONAL type: TYPE_STRING number: 3 >
+				field < name: "mime" label: LABEL_OPTIONAL type: TYPE_STRING number: 4 >
+			>
+			service <
+				name: "ExampleService"
+				method <
+					name: "SetAvatar"
+					input_type: ".example.UploadRequest"
+					output_type: ".example.UploadRequest"
+					options < [google.api.http] < post: "/v1/avatar" body: "*" > >
+				>
+				method <
+					name: "Upload"
+					input_type: ".example.UploadRequest"
+					output_type: ".example.UploadRequest"
+					client_streaming: true
+					options < [google.api.http] < post: "/v1/files" body: "*" > >
+				>
+			>
+		>`, map[string]string{
+		"SetAvatar": "@transmit\n@target Files\n@upload avatar=data filename=name content_type=mime max=2MB",
+		"Upload":    "@transmit\n@target Files\n@upload file=data chunk=64KB max=1GB",
+	})
+	for _, want := range []string{
+		`if gwruntime.IsMultipart(req) {`,
+		// the unary method.
+		`if err := gwruntime.DecodeMultipart(req, route, &protoReq); err != nil {`,
+		`{Part: "avatar", Field: "data", FilenameField: "name", ContentTypeField: "mime", MaxSize: 2097152, ChunkSize: 0},`,
+		// the client streaming method.
+		`err = gwruntime.DecodeMultipartChunks(req, route, func() proto.Message {`,
+		`return stream.Send(msg.(*UploadRequest))`,
+		`{Part: "file", Field: "data", FilenameField: "", ContentTypeField: "", MaxSize: 1073741824, ChunkSize: 65536},`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyTemplate() = %s; want to contain %s", got, want)
+		}
+	}
+}
+
+func TestApplyTemplateHTTPBody(t *testing.T) {
+	got := applyTemplateToText(t, `
+		file_to_generate: "example.proto"
+		proto_file <
+			name: "google/api/httpbody.proto"
+			package: "google.api"
+			syntax: "proto3"
+			options < go_package: "google.golang.org/genproto/googleapis/api/httpbody;httpbody" >
+			message_type <
+				name: "HttpBody"
+				field < name: "content_type" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+				field < name: "data" label: LABEL_OPTIONAL type: TYPE_BYTES number: 2 >
+			>
+		>
+		proto_file <
+			name: "example.proto"
+			package: "example"
+			dependency: "google/api/httpbody.proto"
+			syntax: "proto3"
+			options < go_package: "example.com/path/to/example/example_pb" >
+			message_type <
+				name: "PutRequest"
+				field < name: "name" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+				field < name: "content" label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.api.HttpBody" number: 2 >
+			>
+			service <
+				name: "ExampleService"
+				method <
+					name: "Put"
+					input_type: ".example.PutRequest"
+					output_type: ".google.api.HttpBody"
+					options < [google.api.http] < put: "/v1/files/{name}" body: "content" > >
+				>
+				method <
+					name: "Push"
+					input_type: ".google.api.HttpBody"
+					output_type: ".google.api.HttpBody"
+					client_streaming: true
+					options < [google.api.http] < post: "/v1/push" body: "*" > >
+				>
+				method <
+					name: "Download"
+					input_type: ".example.PutRequest"
+					output_type: ".google.api.HttpBody"
+					server_streaming: true
+					options < [google.api.http] < get: "/v1/files/{name}" > >
+				>
+			>
+		>`, map[string]string{
+		"Put":      "@transmit\n@target Files",
+		"Push":     "@transmit\n@target Files",
+		"Download": "@transmit\n@target Files",
+	})
+	for _, want := range []string{
+		// the request of Put and its response.
+		`if err := gwruntime.DecodeHTTPBody(req, &protoReq, "content"); err != nil {`,
+		`forward_ExampleService_Files_Put_0 = (*gwruntime.Gateway).ForwardHTTPBody`,
+		// the client stream of Push.
+		`err = gwruntime.DecodeHTTPBodyChunks(req, "*", func() proto.Message {`,
+		`forward_ExampleService_Files_Push_0 = (*gwruntime.Gateway).ForwardHTTPBody`,
+		// the server stream of Download.
+		`forward_ExampleService_Files_Download_0 = (*gwruntime.Gateway).ForwardHTTPBodyStream`,
+		`forward_ExampleService_Files_Put_0(gw, ctx, mux, outboundMarshaler, w, req, resp, mux.GetForwardResponseOptions()...)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyTemplate() = %s; want to contain %s", got, want)
+		}
+	}
+}
+
+func TestApplyTemplateBatch(t *testing.T) {
+	got := applyTemplateToText(t, `
+		file_to_generate: "example.proto"
+		proto_file <
+			name: "example.proto"
+			package: "example"
+			syntax: "proto3"
+			options < go_package: "example.com/path/to/example/example_pb" >
+			message_type <
+				name: "EchoRequest"
+				field < name: "id" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+			>
+			service <
+				name: "ExampleService"
+				method <
+					name: "Echo"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+					options < [google.api.http] < post: "/v1/echo" body: "*" > >
+				>
+			>
+		>`, map[string]string{"Echo": "@transmit\n@target Echoer"})
+	// the batch endpoint runs the sub-requests through the routes added to the gateway.
+	for _, want := range []string{
+		`gw.AddRoutes(ExampleServiceRoutes)`,
+		`gw.HandleBatch(mux)`,
+		`route_ExampleService_Echoer_Echo_0,`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyTemplate() = %s; want to contain %s", got, want)
+		}
+	}
+}
+
+func TestApplyTemplateJSONRPC(t *testing.T) {
+	got := applyTemplateToText(t, `
+		file_to_generate: "example.proto"
+		proto_file <
+			name: "example.proto"
+			package: "example"
+			syntax: "proto3"
+			options < go_package: "example.com/path/to/example/example_pb" >
+			message_type <
+				name: "EchoRequest"
+				field < name: "id" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+				field <
+					name: "device_id" label: LABEL_OPTIONAL type: TYPE_STRING number: 2
+					options < [httpgw.from_header]: "X-Device-Id" >
+				>
+			>
+			service <
+				name: "ExampleService"
+				method <
+					name: "Echo"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+					options < [google.api.http] < post: "/v1/echo" body: "*" > >
+				>
+				method <
+					name: "Watch"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+					server_streaming: true
+					options < [google.api.http] < get: "/v1/watch" > >
+				>
+				method <
+					name: "Upload"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+					client_streaming: true
+					options < [google.api.http] < post: "/v1/upload" body: "*" > >
+				>
+				method <
+					name: "Ping"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+				>
+			>
+		>`, map[string]string{
+		"Echo":   "@transmit\n@target Echoer",
+		"Watch":  "@transmit\n@target Echoer",
+		"Upload": "@transmit\n@target Echoer",
+		"Ping":   "@transmit\n@target Echoer",
+	})
+	for _, want := range []string{
+		`gw.HandleJSONRPC(mux, ExampleServiceJSONRPCMethods, handlers, qpsHandler)`,
+		`var ExampleServiceJSONRPCMethods = []*gwruntime.JSONRPCMethod{`,
+		`Name:  "ExampleService.Echo",`,
+		`Route: route_ExampleService_Echoer_Echo_0,`,
+		`return new(EchoRequest)`,
+		`Bind: func(req *http.Request, msg proto.Message) error {`,
+		`return bind_ExampleService_Echoer_Echo_0(req, msg.(*EchoRequest))`,
+		`resp, err := NewEchoerClient(conn).Echo(ctx, msg.(*EchoRequest), opts...)`,
+		`return &gwruntime.Reply{Message: resp}, err`,
+		// the replies of the server streaming method are the array result.
+		`Name:  "ExampleService.Watch",`,
+		`stream, err := NewEchoerClient(conn).Watch(ctx, msg.(*EchoRequest), opts...)`,
+		`return &gwruntime.Reply{Recv: func() (proto.Message, error) { return stream.Recv() }}, nil`,
+		// the methods left out are listed.
+		`// ExampleService.Upload is not served: the params of a call are a single request message.`,
+		`// ExampleService.Ping is not served: it has no http binding.`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyTemplate() = %s; want to contain %s", got, want)
+		}
+	}
+	for _, unwanted := range []string{`Name:  "ExampleService.Upload",`, `Name:  "ExampleService.Ping",`} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("applyTemplate() = %s; want not to contain %s", got, unwanted)
+		}
+	}
+}
+
+func TestApplyTemplateHealthTargets(t *testing.T) {
+	got := applyTemplateToText(t, `
+		file_to_generate: "example.proto"
+		proto_file <
+			name: "example.proto"
+			package: "example"
+			syntax: "proto3"
+			options < go_package: "example.com/path/to/example/example_pb" >
+			message_type <
+				name: "EchoRequest"
+				field < name: "id" label: LABEL_OPTIONAL type: TYPE_STRING number: 1 >
+			>
+			service <
+				name: "ExampleService"
+				method <
+					name: "Echo"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+					options < [google.api.http] < post: "/v1/echo" body: "*" > >
+				>
+				method <
+					name: "Login"
+					input_type: ".example.EchoRequest"
+					output_type: ".example.EchoRequest"
+					options < [google.api.http] < post: "/v1/login" body: "*" > >
+				>
+			>
+		>`, map[string]string{
+		"Echo":  "@transmit\n@target Echoer",
+		"Login": "@transmit\n@tarpkg auth\n@target Authorize",
+	})
+	for _, want := range []string{
+		`{Name: "example_pb.Echoer", Method: "example_pb.Echoer/Echo"},`,
+		// the target in another package is named after it.
+		`{Name: "auth.Authorize", Method: "example_pb.Authorize/Login"},`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("applyTemplate() = %s; want to contain %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+// Package genopenapi provides a code generator for the OpenAPI v3 document of the gateway routes.
+package genopenapi
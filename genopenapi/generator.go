@@ -0,0 +1,766 @@
+package genopenapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	protodescriptor "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+	gen "github.com/generalzgd/protoc-gen-grpc-httpgw/generator"
+)
+
+var (
+	errNoTargetRoute = errors.New("no transmitted method with http bindings in the files")
+)
+
+const (
+	// bearerAuth is the security scheme of the methods requiring an authenticated caller.
+	bearerAuth = "bearerAuth"
+	// errorSchema and streamErrorSchema are the schemas of the error bodies of the gateway.
+	errorSchema       = "gatewayError"
+	streamErrorSchema = "gatewayStreamError"
+)
+
+// wellKnownSchemas are the schemas of the messages with a special JSON mapping.
+var wellKnownSchemas = map[string]openAPISchema{
+	".google.protobuf.Timestamp":   {Type: "string", Format: "date-time"},
+	".google.protobuf.Duration":    {Type: "string"},
+	".google.protobuf.FieldMask":   {Type: "string"},
+	".google.protobuf.Struct":      {Type: "object", AdditionalProperties: true},
+	".google.protobuf.Value":       {},
+	".google.protobuf.ListValue":   {Type: "array", Items: &openAPISchema{}},
+	".google.protobuf.Empty":       {Type: "object"},
+	".google.protobuf.Any":         {Type: "object", Properties: map[string]*openAPISchema{"@type": {Type: "string"}}, AdditionalProperties: true},
+	".google.protobuf.DoubleValue": {Type: "number", Format: "double"},
+	".google.protobuf.FloatValue":  {Type: "number", Format: "float"},
+	".google.protobuf.Int32Value":  {Type: "integer", Format: "int32"},
+	".google.protobuf.UInt32Value": {Type: "integer", Format: "int64"},
+	".google.protobuf.Int64Value":  {Type: "string", Format: "int64"},
+	".google.protobuf.UInt64Value": {Type: "string", Format: "uint64"},
+	".google.protobuf.BoolValue":   {Type: "boolean"},
+	".google.protobuf.StringValue": {Type: "string"},
+	".google.protobuf.BytesValue":  {Type: "string", Format: "byte"},
+	descriptor.HTTPBodyType:        {Type: "string", Format: "binary"},
+}
+
+// scalarSchemas are the schemas of the scalar fields. The 64-bit integers are strings as jsonpb marshals them.
+var scalarSchemas = map[protodescriptor.FieldDescriptorProto_Type]openAPISchema{
+	protodescriptor.FieldDescriptorProto_TYPE_DOUBLE:   {Type: "number", Format: "double"},
+	protodescriptor.FieldDescriptorProto_TYPE_FLOAT:    {Type: "number", Format: "float"},
+	protodescriptor.FieldDescriptorProto_TYPE_INT32:    {Type: "integer", Format: "int32"},
+	protodescriptor.FieldDescriptorProto_TYPE_SINT32:   {Type: "integer", Format: "int32"},
+	protodescriptor.FieldDescriptorProto_TYPE_SFIXED32: {Type: "integer", Format: "int32"},
+	protodescriptor.FieldDescriptorProto_TYPE_UINT32:   {Type: "integer", Format: "int64"},
+	protodescriptor.FieldDescriptorProto_TYPE_FIXED32:  {Type: "integer", Format: "int64"},
+	protodescriptor.FieldDescriptorProto_TYPE_INT64:    {Type: "string", Format: "int64"},
+	protodescriptor.FieldDescriptorProto_TYPE_SINT64:   {Type: "string", Format: "int64"},
+	protodescriptor.FieldDescriptorProto_TYPE_SFIXED64: {Type: "string", Format: "int64"},
+	protodescriptor.FieldDescriptorProto_TYPE_UINT64:   {Type: "string", Format: "uint64"},
+	protodescriptor.FieldDescriptorProto_TYPE_FIXED64:  {Type: "string", Format: "uint64"},
+	protodescriptor.FieldDescriptorProto_TYPE_BOOL:     {Type: "boolean"},
+	protodescriptor.FieldDescriptorProto_TYPE_STRING:   {Type: "string"},
+	protodescriptor.FieldDescriptorProto_TYPE_BYTES:    {Type: "string", Format: "byte"},
+}
+
+// defaultOutputName is the name of the document without the "merge_file_name" parameter.
+const defaultOutputName = "apidocs"
+
+type generator struct {
+	reg *descriptor.Registry
+}
+
+// New returns a new generator which generates one OpenAPI v3 document of the transmitted routes
+// of all the gateway services of the target files, named after the "merge_file_name" parameter
+// or else defaultOutputName.
+func New(reg *descriptor.Registry) gen.Generator {
+	return &generator{reg: reg}
+}
+
+func (g *generator) Generate(targets []*descriptor.File) ([]*plugin.CodeGeneratorResponse_File, error) {
+	b := &builder{
+		reg:       g.reg,
+		jsonNames: g.reg.GetUseJSONNamesForFields(),
+		names:     schemaNames(g.reg),
+		targets:   make(map[*descriptor.File]bool),
+		paths:     make(map[*descriptor.File]map[interface{}]string),
+		doc: &openAPIDocument{
+			OpenAPI: "3.0.3",
+			Info:    openAPIInfo{Version: "1.0.0"},
+			Paths:   make(map[string]openAPIPathItem),
+			Components: openAPIComponents{
+				Schemas: make(map[string]*openAPISchema),
+			},
+		},
+	}
+	for _, file := range targets {
+		b.targets[file] = true
+		if b.doc.Info.Title == "" {
+			b.doc.Info.Title = file.GetPackage()
+		}
+	}
+	for _, file := range targets {
+		glog.V(1).Infof("Processing %s", file.GetName())
+		if err := b.addFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if len(b.doc.Paths) == 0 {
+		glog.V(1).Infof("%v", errNoTargetRoute)
+		return nil, nil
+	}
+	for len(b.pending) > 0 {
+		msg := b.pending[0]
+		b.pending = b.pending[1:]
+		if err := b.addMessage(msg); err != nil {
+			return nil, err
+		}
+	}
+	b.doc.Components.Schemas[errorSchema] = &openAPISchema{
+		Type:        "object",
+		Description: "The error body of the gateway, unless configured with runtime.WithErrors or runtime.WithEnvelope.",
+		Properties: map[string]*openAPISchema{
+			"error":   {Type: "string"},
+			"code":    {Type: "integer", Format: "int32", Description: "The gRPC status code."},
+			"message": {Type: "string"},
+			"details": {Type: "array", Items: &openAPISchema{Ref: "#/components/schemas/protobufAny"}},
+		},
+	}
+	b.doc.Components.Schemas["protobufAny"] = &openAPISchema{
+		Type:                 "object",
+		Properties:           map[string]*openAPISchema{"@type": {Type: "string"}},
+		AdditionalProperties: true,
+	}
+
+	data, err := json.MarshalIndent(b.doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	name := g.reg.GetMergeFileName()
+	if name == "" {
+		name = defaultOutputName
+	}
+	output := fmt.Sprintf("%s.openapi.json", name)
+	glog.V(1).Infof("Will emit %s", output)
+	return []*plugin.CodeGeneratorResponse_File{{
+		Name:    proto.String(output),
+		Content: proto.String(string(data) + "\n"),
+	}}, nil
+}
+
+// schemaNames returns the names of the schemas of all the messages and enums of "reg": their fully
+// qualified names if GetUseFQNForSwaggerName, or else the last two elements of the names concatenated
+// if unique, and all the elements otherwise.
+func schemaNames(reg *descriptor.Registry) map[string]string {
+	fqns := append(reg.GetAllFQMNs(), reg.GetAllFQENs()...)
+	names := make(map[string]string, len(fqns))
+	if reg.GetUseFQNForSwaggerName() {
+		for _, fqn := range fqns {
+			names[fqn] = strings.TrimPrefix(fqn, ".")
+		}
+		return names
+	}
+	short := func(fqn string) string {
+		parts := strings.Split(strings.TrimPrefix(fqn, "."), ".")
+		if len(parts) > 2 {
+			parts = parts[len(parts)-2:]
+		}
+		return strings.Join(parts, "")
+	}
+	count := make(map[string]int)
+	for _, fqn := range fqns {
+		count[short(fqn)]++
+	}
+	for _, fqn := range fqns {
+		if name := short(fqn); count[name] == 1 {
+			names[fqn] = name
+		} else {
+			names[fqn] = strings.Replace(strings.TrimPrefix(fqn, "."), ".", "", -1)
+		}
+	}
+	return names
+}
+
+// builder collects the operations and the schemas of the document.
+type builder struct {
+	reg       *descriptor.Registry
+	jsonNames bool
+	names     map[string]string
+	targets   map[*descriptor.File]bool
+	doc       *openAPIDocument
+
+	emitted map[string]bool
+	pending []*descriptor.Message
+	// paths are the source code paths of the messages and the enums of each file.
+	paths map[*descriptor.File]map[interface{}]string
+}
+
+func (b *builder) addFile(file *descriptor.File) error {
+	b.reg.LoadComments(file)
+	for _, svc := range file.Services {
+		tag := svc.GetName()
+		if b.reg.IsIncludePackageInTags() && file.GetPackage() != "" {
+			tag = file.GetPackage() + "." + tag
+		}
+		found := false
+		for _, m := range svc.Methods {
+			if len(m.Bindings) == 0 || !m.CanOutput() {
+				continue
+			}
+			found = true
+			for _, binding := range m.Bindings {
+				if err := b.addOperation(tag, binding); err != nil {
+					return err
+				}
+			}
+		}
+		if found {
+			b.doc.Tags = append(b.doc.Tags, openAPITag{
+				Name:        tag,
+				Description: strings.Join(descriptor.DocLines(svc.Comment), "\n"),
+			})
+		}
+	}
+	return nil
+}
+
+var pathVarRegexp = regexp.MustCompile(`\{([^}=]+)=[^}]*\}`)
+
+func (b *builder) addOperation(tag string, binding *descriptor.Binding) error {
+	m := binding.Method
+	svc := m.Service
+	opID := svc.GetName() + "_" + m.GetName()
+	if binding.Index > 0 {
+		opID = fmt.Sprintf("%s_%d", opID, binding.Index)
+	}
+	op := &openAPIOperation{
+		Tags:        []string{tag},
+		OperationID: opID,
+		Responses:   make(map[string]*openAPIResponse),
+		Extensions:  make(map[string]interface{}),
+	}
+	if lines := descriptor.DocLines(m.Comment); len(lines) > 0 {
+		op.Summary = lines[0]
+		if len(lines) > 1 {
+			op.Description = strings.Join(lines, "\n")
+		}
+	}
+
+	// the target of the gateway, as the Method of the runtime routes.
+	target := svc.File.GoPkg.Name + "." + m.GetTargetSvrName()
+	op.Extensions["x-gateway-service"] = strings.TrimPrefix(svc.FQSN(), ".")
+	op.Extensions["x-target-service"] = target
+	op.Extensions["x-target-method"] = target + "/" + m.GetName()
+	if pkg := strings.TrimSuffix(m.GetTargetSvrPackage(), "."); pkg != "" {
+		op.Extensions["x-target-package"] = pkg
+	}
+	switch {
+	case m.GetClientStreaming() && m.GetServerStreaming():
+		op.Extensions["x-streaming"] = "bidi"
+	case m.GetClientStreaming():
+		op.Extensions["x-streaming"] = "client"
+	case m.GetServerStreaming():
+		op.Extensions["x-streaming"] = "server"
+	}
+	session, err := m.GetSessionRole()
+	if err != nil {
+		return err
+	}
+	op.Extensions["x-session"] = session
+
+	if err := b.addAuth(op, m); err != nil {
+		return err
+	}
+	if err := b.addParameters(op, binding); err != nil {
+		return err
+	}
+	if err := b.addRequestBody(op, binding); err != nil {
+		return err
+	}
+	if err := b.addResponses(op, binding); err != nil {
+		return err
+	}
+
+	path := pathVarRegexp.ReplaceAllString(binding.PathTmpl.Template, "{$1}")
+	item, ok := b.doc.Paths[path]
+	if !ok {
+		item = make(openAPIPathItem)
+		b.doc.Paths[path] = item
+	}
+	method := strings.ToLower(binding.HTTPMethod)
+	if prev, ok := item[method]; ok {
+		return fmt.Errorf("%s %s of %s.%s is already bound by %s", binding.HTTPMethod, path, svc.GetName(), m.GetName(), prev.OperationID)
+	}
+	item[method] = op
+	return nil
+}
+
+// addAuth documents the authentication required by the "@auth", "@scope" and "@role" tags of "m".
+func (b *builder) addAuth(op *openAPIOperation, m *descriptor.Method) error {
+	mode, err := m.GetAuthMode()
+	if err != nil {
+		return err
+	}
+	if mode == "none" {
+		return nil
+	}
+	op.Security = []map[string][]string{{bearerAuth: {}}}
+	if mode == "optional" {
+		// an empty requirement lets the anonymous callers in.
+		op.Security = append(op.Security, map[string][]string{})
+	}
+	op.Responses["401"] = &openAPIResponse{Description: "The caller is not authenticated.", Content: b.errorContent()}
+	scopes, roles := m.GetScopes(), m.GetRoles()
+	if len(scopes) > 0 {
+		op.Extensions["x-scopes"] = scopes
+	}
+	if len(roles) > 0 {
+		op.Extensions["x-roles"] = roles
+	}
+	if len(scopes) > 0 || len(roles) > 0 {
+		op.Responses["403"] = &openAPIResponse{Description: "The caller lacks the scopes or the roles.", Content: b.errorContent()}
+	}
+	if b.doc.Components.SecuritySchemes == nil {
+		b.doc.Components.SecuritySchemes = map[string]*openAPISecurityScheme{
+			bearerAuth: {
+				Type:         "http",
+				Scheme:       "bearer",
+				BearerFormat: "JWT",
+				Description:  "The token checked by the authenticator of runtime.WithAuthenticator.",
+			},
+		}
+	}
+	return nil
+}
+
+func (b *builder) addParameters(op *openAPIOperation, binding *descriptor.Binding) error {
+	seen := make(map[string]bool)
+	add := func(p *openAPIParameter) {
+		key := p.In + ":" + strings.ToLower(p.Name)
+		if !seen[key] {
+			seen[key] = true
+			op.Parameters = append(op.Parameters, p)
+		}
+	}
+	for _, p := range binding.PathParams {
+		s, err := b.fieldSchema(p.Target)
+		if err != nil {
+			return err
+		}
+		add(&openAPIParameter{Name: p.FieldPath.String(), In: "path", Description: b.fieldComment(p.Target), Required: true, Schema: s})
+	}
+	for _, p := range binding.HeaderParams {
+		s, err := b.fieldSchema(p.Target)
+		if err != nil {
+			return err
+		}
+		add(&openAPIParameter{Name: p.Name, In: p.Source, Description: b.fieldComment(p.Target), Schema: s})
+	}
+	mappings, err := binding.Method.GetMetadataMappings()
+	if err != nil {
+		return err
+	}
+	for _, mapping := range mappings {
+		add(&openAPIParameter{
+			Name:        mapping.Name,
+			In:          mapping.Source,
+			Description: fmt.Sprintf("Forwarded to the target as the gRPC metadata %q.", mapping.MetadataKey()),
+			Required:    mapping.Required,
+			Schema:      &openAPISchema{Type: "string", Pattern: mapping.Pattern},
+		})
+	}
+	for _, path := range b.reg.QueryParams(binding) {
+		f := path[len(path)-1].Target
+		s, err := b.fieldSchema(f)
+		if err != nil {
+			return err
+		}
+		add(&openAPIParameter{Name: path.String(), In: "query", Description: b.fieldComment(f), Schema: s})
+	}
+	return nil
+}
+
+func (b *builder) addRequestBody(op *openAPIOperation, binding *descriptor.Binding) error {
+	if binding.Body == nil {
+		return nil
+	}
+	body := &openAPIRequestBody{Required: true}
+	if binding.HasHTTPBodyRequest() {
+		body.Content = map[string]*openAPIMediaType{"*/*": {Schema: &openAPISchema{Type: "string", Format: "binary"}}}
+	} else {
+		var s *openAPISchema
+		var err error
+		if fp := binding.Body.FieldPath; len(fp) > 0 {
+			s, err = b.fieldSchema(fp[len(fp)-1].Target)
+		} else {
+			s, err = b.messageRef(binding.Method.RequestType)
+		}
+		if err != nil {
+			return err
+		}
+		body.Content = map[string]*openAPIMediaType{"application/json": {Schema: s}}
+	}
+	form, err := b.formSchema(binding)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		body.Content["multipart/form-data"] = &openAPIMediaType{Schema: form}
+	}
+	if binding.Method.GetClientStreaming() {
+		body.Description = "A stream of messages, one JSON per line, or the raw data of a google.api.HttpBody."
+	}
+	op.RequestBody = body
+	return nil
+}
+
+// formSchema returns the schema of the multipart/form-data body of the "@upload" tags of the method
+// of "binding", or nil if it has none: the file parts and the other fields of the request as form values.
+func (b *builder) formSchema(binding *descriptor.Binding) (*openAPISchema, error) {
+	uploads, err := binding.Method.GetUploads()
+	if err != nil || len(uploads) == 0 {
+		return nil, err
+	}
+	form := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	for _, u := range uploads {
+		form.Properties[u.Part] = &openAPISchema{Type: "string", Format: "binary"}
+	}
+	params, err := b.reg.FormParams(binding)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range params {
+		f := path[len(path)-1].Target
+		fs, err := b.fieldSchema(f)
+		if err != nil {
+			return nil, err
+		}
+		form.Properties[path.String()] = b.describe(fs, b.fieldComment(f))
+	}
+	return form, nil
+}
+
+func (b *builder) addResponses(op *openAPIOperation, binding *descriptor.Binding) error {
+	m := binding.Method
+	st, err := m.GetResponseStatus()
+	if err != nil {
+		return err
+	}
+	code := "200"
+	if st.Code != 0 {
+		code = strconv.Itoa(st.Code)
+	}
+	resp := &openAPIResponse{Description: "A successful response."}
+	if st.Field != "" {
+		resp.Description = fmt.Sprintf("A successful response, with the status of the field %s.", st.Field)
+	}
+
+	var s *openAPISchema
+	mediaType := "application/json"
+	switch {
+	case binding.HasHTTPBodyResponse():
+		mediaType = "*/*"
+		s = &openAPISchema{Type: "string", Format: "binary"}
+	case binding.ResponseBody != nil && len(binding.ResponseBody.FieldPath) > 0:
+		fp := binding.ResponseBody.FieldPath
+		s, err = b.fieldSchema(fp[len(fp)-1].Target)
+	default:
+		s, err = b.messageRef(m.ResponseType)
+	}
+	if err != nil {
+		return err
+	}
+	if !m.GetServerStreaming() && !binding.HasHTTPBodyResponse() {
+		if s, err = b.omitResponseFields(binding, s); err != nil {
+			return err
+		}
+	}
+	if m.GetServerStreaming() && !binding.HasHTTPBodyResponse() {
+		resp.Description = "A stream of results, one JSON per line, ending with an error if the call fails."
+		s = &openAPISchema{
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"result": s,
+				"error":  {Ref: "#/components/schemas/" + streamErrorSchema},
+			},
+		}
+		b.addStreamErrorSchema()
+	}
+	resp.Content = map[string]*openAPIMediaType{mediaType: {Schema: s}}
+
+	headers, err := m.GetResponseHeaders()
+	if err != nil {
+		return err
+	}
+	for _, h := range headers {
+		f, err := b.reg.LookupField(m.ResponseType, h.Field)
+		if err != nil {
+			return err
+		}
+		hs, err := b.fieldSchema(f)
+		if err != nil {
+			return err
+		}
+		if resp.Headers == nil {
+			resp.Headers = make(map[string]*openAPIHeader)
+		}
+		resp.Headers[h.Header] = &openAPIHeader{Schema: hs}
+	}
+	op.Responses[code] = resp
+	op.Responses["default"] = &openAPIResponse{Description: "An error response.", Content: b.errorContent()}
+	return nil
+}
+
+// omitResponseFields returns the response schema "s" of "binding" without the fields which the
+// gateway moves to the headers or the status, inlining the messages they are in.
+func (b *builder) omitResponseFields(binding *descriptor.Binding, s *openAPISchema) (*openAPISchema, error) {
+	m := binding.Method
+	omitted, err := m.GetOmittedResponseFields()
+	if err != nil || len(omitted) == 0 {
+		return s, err
+	}
+	msg, prefix := m.ResponseType, ""
+	if binding.ResponseBody != nil && len(binding.ResponseBody.FieldPath) > 0 {
+		fp := binding.ResponseBody.FieldPath
+		f := fp[len(fp)-1].Target
+		if f.GetType() != protodescriptor.FieldDescriptorProto_TYPE_MESSAGE || f.GetLabel() == protodescriptor.FieldDescriptorProto_LABEL_REPEATED {
+			return s, nil
+		}
+		if msg, err = b.reg.LookupMsg("", f.GetTypeName()); err != nil {
+			return nil, err
+		}
+		prefix = fp.String() + "."
+	}
+	var paths [][]string
+	for _, path := range omitted {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, strings.Split(strings.TrimPrefix(path, prefix), "."))
+		}
+	}
+	if len(paths) == 0 {
+		return s, nil
+	}
+	return b.omitFields(msg, paths)
+}
+
+// omitFields returns the schema of "msg" without the fields at "paths".
+func (b *builder) omitFields(msg *descriptor.Message, paths [][]string) (*openAPISchema, error) {
+	s, err := b.messageSchema(msg)
+	if err != nil {
+		return nil, err
+	}
+	nested := make(map[string][][]string)
+	var names []string
+	for _, path := range paths {
+		if len(path) == 1 {
+			f, err := b.reg.LookupField(msg, path[0])
+			if err != nil {
+				return nil, err
+			}
+			delete(s.Properties, b.jsonName(f))
+			continue
+		}
+		if _, ok := nested[path[0]]; !ok {
+			names = append(names, path[0])
+		}
+		nested[path[0]] = append(nested[path[0]], path[1:])
+	}
+	for _, name := range names {
+		f, err := b.reg.LookupField(msg, name)
+		if err != nil {
+			return nil, err
+		}
+		child, err := b.reg.LookupMsg("", f.GetTypeName())
+		if err != nil {
+			return nil, err
+		}
+		fs, err := b.omitFields(child, nested[name])
+		if err != nil {
+			return nil, err
+		}
+		if doc := b.fieldComment(f); doc != "" {
+			fs.Description = doc
+		}
+		s.Properties[b.jsonName(f)] = fs
+	}
+	return s, nil
+}
+
+func (b *builder) errorContent() map[string]*openAPIMediaType {
+	return map[string]*openAPIMediaType{"application/json": {Schema: &openAPISchema{Ref: "#/components/schemas/" + errorSchema}}}
+}
+
+func (b *builder) addStreamErrorSchema() {
+	b.doc.Components.Schemas[streamErrorSchema] = &openAPISchema{
+		Type: "object",
+		Properties: map[string]*openAPISchema{
+			"grpc_code":   {Type: "integer", Format: "int32"},
+			"http_code":   {Type: "integer", Format: "int32"},
+			"message":     {Type: "string"},
+			"http_status": {Type: "string"},
+			"details":     {Type: "array", Items: &openAPISchema{Ref: "#/components/schemas/protobufAny"}},
+		},
+	}
+}
+
+// messageRef returns the schema of "msg", a reference to its component which is queued for addition.
+func (b *builder) messageRef(msg *descriptor.Message) (*openAPISchema, error) {
+	if s, ok := wellKnownSchemas[msg.FQMN()]; ok {
+		return &s, nil
+	}
+	if !b.emitted[msg.FQMN()] {
+		b.pending = append(b.pending, msg)
+	}
+	return &openAPISchema{Ref: "#/components/schemas/" + b.names[msg.FQMN()]}, nil
+}
+
+// fieldSchema returns the schema of the JSON of "f".
+func (b *builder) fieldSchema(f *descriptor.Field) (*openAPISchema, error) {
+	var s *openAPISchema
+	switch f.GetType() {
+	case protodescriptor.FieldDescriptorProto_TYPE_ENUM:
+		e, err := b.reg.LookupEnum("", f.GetTypeName())
+		if err != nil {
+			return nil, err
+		}
+		b.addEnum(e)
+		s = &openAPISchema{Ref: "#/components/schemas/" + b.names[e.FQEN()]}
+	case protodescriptor.FieldDescriptorProto_TYPE_MESSAGE, protodescriptor.FieldDescriptorProto_TYPE_GROUP:
+		msg, err := b.reg.LookupMsg("", f.GetTypeName())
+		if err != nil {
+			return nil, err
+		}
+		if msg.GetOptions().GetMapEntry() {
+			if len(msg.Fields) != 2 {
+				return nil, fmt.Errorf("map entry %s has %d fields", msg.FQMN(), len(msg.Fields))
+			}
+			value, err := b.fieldSchema(msg.Fields[1])
+			if err != nil {
+				return nil, err
+			}
+			return &openAPISchema{Type: "object", AdditionalProperties: value}, nil
+		}
+		if s, err = b.messageRef(msg); err != nil {
+			return nil, err
+		}
+	default:
+		scalar, ok := scalarSchemas[f.GetType()]
+		if !ok {
+			return nil, fmt.Errorf("unsupported type %s of field %s", f.GetType(), f.GetName())
+		}
+		s = &scalar
+	}
+	if f.GetLabel() == protodescriptor.FieldDescriptorProto_LABEL_REPEATED {
+		s = &openAPISchema{Type: "array", Items: s}
+	}
+	return s, nil
+}
+
+func (b *builder) addMessage(msg *descriptor.Message) error {
+	if b.emitted == nil {
+		b.emitted = make(map[string]bool)
+	}
+	if b.emitted[msg.FQMN()] {
+		return nil
+	}
+	b.emitted[msg.FQMN()] = true
+	s, err := b.messageSchema(msg)
+	if err != nil {
+		return err
+	}
+	b.doc.Components.Schemas[b.names[msg.FQMN()]] = s
+	return nil
+}
+
+// messageSchema returns the object schema of the fields of "msg".
+func (b *builder) messageSchema(msg *descriptor.Message) (*openAPISchema, error) {
+	s := &openAPISchema{
+		Type:        "object",
+		Description: b.comment(msg.File, b.sourcePath(msg.File, msg.DescriptorProto)),
+		Properties:  make(map[string]*openAPISchema),
+	}
+	for _, f := range msg.Fields {
+		fs, err := b.fieldSchema(f)
+		if err != nil {
+			return nil, err
+		}
+		s.Properties[b.jsonName(f)] = b.describe(fs, b.fieldComment(f))
+	}
+	return s, nil
+}
+
+// describe returns the schema "s" with the description "doc", if any.
+func (b *builder) describe(s *openAPISchema, doc string) *openAPISchema {
+	if doc == "" {
+		return s
+	}
+	if s.Ref != "" {
+		// the siblings of $ref are ignored.
+		s = &openAPISchema{AllOf: []*openAPISchema{s}}
+	}
+	s.Description = doc
+	return s
+}
+
+// jsonName returns the name of "f" in the JSON bodies.
+func (b *builder) jsonName(f *descriptor.Field) string {
+	if b.jsonNames && f.GetJsonName() != "" {
+		return f.GetJsonName()
+	}
+	return f.GetName()
+}
+
+func (b *builder) addEnum(e *descriptor.Enum) {
+	name := b.names[e.FQEN()]
+	if _, ok := b.doc.Components.Schemas[name]; ok {
+		return
+	}
+	path := b.sourcePath(e.File, e.EnumDescriptorProto)
+	lines := []string{b.comment(e.File, path)}
+	s := &openAPISchema{Type: "string"}
+	for i, v := range e.GetValue() {
+		s.Enum = append(s.Enum, v.GetName())
+		if doc := b.comment(e.File, fmt.Sprintf("%s,2,%d", path, i)); doc != "" {
+			lines = append(lines, fmt.Sprintf("- %s: %s", v.GetName(), strings.Replace(doc, "\n", " ", -1)))
+		}
+	}
+	s.Description = strings.TrimSpace(strings.Join(lines, "\n"))
+	b.doc.Components.Schemas[name] = s
+}
+
+// fieldComment returns the comment of "f", if its message is of a target file.
+func (b *builder) fieldComment(f *descriptor.Field) string {
+	msg := f.Message
+	path := b.sourcePath(msg.File, msg.DescriptorProto)
+	for i, field := range msg.Fields {
+		if field == f {
+			return b.comment(msg.File, fmt.Sprintf("%s,2,%d", path, i))
+		}
+	}
+	return ""
+}
+
+// sourcePath returns the source code path of the message or the enum "desc" of "file".
+func (b *builder) sourcePath(file *descriptor.File, desc interface{}) string {
+	paths, ok := b.paths[file]
+	if !ok {
+		paths = descriptor.SourcePaths(file.FileDescriptorProto)
+		b.paths[file] = paths
+	}
+	return paths[desc]
+}
+
+// comment returns the comment at the source code "path" of "file", if it is a target file.
+func (b *builder) comment(file *descriptor.File, path string) string {
+	if !b.targets[file] || path == "" {
+		return ""
+	}
+	return strings.Join(descriptor.DocLines(b.reg.FileComments[file.GetName()][path]), "\n")
+}
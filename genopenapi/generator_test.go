@@ -0,0 +1,169 @@
+package genopenapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+)
+
+// loadRequest loads the request of room.proto shared by the tests of the generators.
+func loadRequest(t *testing.T) *plugin.CodeGeneratorRequest {
+	b, err := ioutil.ReadFile("../testdata/room.prototext")
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile() failed with %v", err)
+	}
+	var req plugin.CodeGeneratorRequest
+	if err := proto.UnmarshalText(string(b), &req); err != nil {
+		t.Fatalf("proto.UnmarshalText() failed with %v", err)
+	}
+	return &req
+}
+
+func generateDoc(t *testing.T, tune func(reg *descriptor.Registry)) map[string]interface{} {
+	req := loadRequest(t)
+	reg := descriptor.NewRegistry()
+	tune(reg)
+	if err := reg.Load(req); err != nil {
+		t.Fatalf("reg.Load() failed with %v", err)
+	}
+	file, err := reg.LookupFile("room.proto")
+	if err != nil {
+		t.Fatalf("reg.LookupFile() failed with %v", err)
+	}
+	reg.AddComments("room.proto", descriptor.SourceComments(file.FileDescriptorProto))
+	if err := reg.ParseCommentsSource(req.ProtoFile); err != nil {
+		t.Fatalf("reg.ParseCommentsSource() failed with %v", err)
+	}
+	files, err := New(reg).Generate([]*descriptor.File{file})
+	if err != nil {
+		t.Fatalf("Generate() failed with %v", err)
+	}
+	if len(files) != 1 || files[0].GetName() != "apidocs.openapi.json" {
+		t.Fatalf("Generate() = %v; want apidocs.openapi.json", files)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(files[0].GetContent()), &doc); err != nil {
+		t.Fatalf("json.Unmarshal() failed with %v", err)
+	}
+	return doc
+}
+
+// lookup returns the value at the keys of "v".
+func lookup(t *testing.T, v interface{}, keys ...interface{}) interface{} {
+	for _, key := range keys {
+		switch k := key.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				t.Fatalf("%v is not an object to lookup %q", v, k)
+			}
+			v = m[k]
+		case int:
+			a, ok := v.([]interface{})
+			if !ok || k >= len(a) {
+				t.Fatalf("%v is not an array to lookup %d", v, k)
+			}
+			v = a[k]
+		}
+	}
+	return v
+}
+
+func TestGenerate(t *testing.T) {
+	doc := generateDoc(t, func(reg *descriptor.Registry) {})
+
+	paths := lookup(t, doc, "paths").(map[string]interface{})
+	if _, ok := paths["/v1/hidden"]; ok {
+		t.Errorf("paths = %v; want not to contain the routes without @transmit", paths)
+	}
+	if got, want := len(paths), 5; got != want {
+		t.Errorf("len(paths) = %d; want %d", got, want)
+	}
+	for _, c := range []struct {
+		keys []interface{}
+		want interface{}
+	}{
+		{[]interface{}{"tags", 0, "name"}, "RoomService"},
+		{[]interface{}{"tags", 0, "description"}, "RoomService serves the <rooms>."},
+		{[]interface{}{"tags", 1, "name"}, "AdminService"},
+
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "operationId"}, "RoomService_ListRooms"},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "summary"}, "ListRooms lists the rooms of a user."},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "description"}, "ListRooms lists the rooms of a user.\nThe rooms are paged."},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "x-target-service"}, "room.Lister"},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "x-target-method"}, "room.Lister/ListRooms"},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "x-scopes"}, []interface{}{"room.read"}},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "security"}, []interface{}{map[string]interface{}{"bearerAuth": []interface{}{}}}},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "parameters", 0, "name"}, "owner_id"},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "parameters", 0, "required"}, true},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "parameters", 1, "name"}, "page.page_token"},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "parameters", 1, "in"}, "query"},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "responses", "200", "content", "application/json", "schema", "$ref"}, "#/components/schemas/roomListRoomsReply"},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "responses", "403", "content", "application/json", "schema", "$ref"}, "#/components/schemas/gatewayError"},
+
+		{[]interface{}{"paths", "/v1/rooms:list", "post", "requestBody", "content", "application/json", "schema", "$ref"}, "#/components/schemas/roomListRoomsRequest"},
+
+		{[]interface{}{"paths", "/v1/rooms", "post", "x-target-package"}, "admin"},
+		{[]interface{}{"paths", "/v1/rooms", "post", "requestBody", "content", "application/json", "schema", "$ref"}, "#/components/schemas/roomRoom"},
+		{[]interface{}{"paths", "/v1/rooms", "post", "responses", "201", "headers", "X-Room-Id", "schema", "format"}, "int64"},
+		{[]interface{}{"paths", "/v1/rooms", "post", "responses", "200"}, nil},
+
+		{[]interface{}{"paths", "/v1/rooms:watch", "get", "x-streaming"}, "server"},
+		{[]interface{}{"paths", "/v1/rooms:watch", "get", "security"}, []interface{}{map[string]interface{}{"bearerAuth": []interface{}{}}, map[string]interface{}{}}},
+		{[]interface{}{"paths", "/v1/rooms:watch", "get", "parameters", 0, "name"}, "X-Trace-Id"},
+		{[]interface{}{"paths", "/v1/rooms:watch", "get", "parameters", 0, "in"}, "header"},
+		{[]interface{}{"paths", "/v1/rooms:watch", "get", "responses", "200", "content", "application/json", "schema", "properties", "result", "$ref"}, "#/components/schemas/roomRoom"},
+
+		{[]interface{}{"paths", "/v1/rooms/{room_id}/icon", "put", "requestBody", "content", "application/json", "schema", "$ref"}, "#/components/schemas/roomSetIconRequest"},
+		{[]interface{}{"paths", "/v1/rooms/{room_id}/icon", "put", "requestBody", "content", "multipart/form-data", "schema", "properties", "icon"}, map[string]interface{}{"type": "string", "format": "binary"}},
+		{[]interface{}{"paths", "/v1/rooms/{room_id}/icon", "put", "requestBody", "content", "multipart/form-data", "schema", "properties", "note", "type"}, "string"},
+		{[]interface{}{"paths", "/v1/rooms/{room_id}/icon", "put", "requestBody", "content", "multipart/form-data", "schema", "properties", "icon_name"}, nil},
+		{[]interface{}{"paths", "/v1/rooms/{room_id}/icon", "put", "requestBody", "content", "multipart/form-data", "schema", "properties", "room_id"}, nil},
+		{[]interface{}{"paths", "/v1/rooms/{room_id}/icon", "put", "responses", "200", "headers", "Location", "schema", "type"}, "string"},
+		{[]interface{}{"paths", "/v1/rooms/{room_id}/icon", "put", "responses", "200", "content", "application/json", "schema", "properties", "icon_url"}, nil},
+		{[]interface{}{"paths", "/v1/rooms/{room_id}/icon", "put", "responses", "200", "content", "application/json", "schema", "properties", "room", "$ref"}, "#/components/schemas/roomRoom"},
+
+		{[]interface{}{"components", "schemas", "roomRoom", "description"}, "Room is a chat room."},
+		{[]interface{}{"components", "schemas", "roomRoom", "properties", "room_id", "type"}, "string"},
+		{[]interface{}{"components", "schemas", "roomRoom", "properties", "room_id", "description"}, "room_id is the id of the room."},
+		{[]interface{}{"components", "schemas", "roomRoom", "properties", "status", "$ref"}, "#/components/schemas/roomStatus"},
+		{[]interface{}{"components", "schemas", "roomStatus", "enum"}, []interface{}{"UNKNOWN", "ACTIVE"}},
+		{[]interface{}{"components", "schemas", "commonPage", "properties", "size", "format"}, "int32"},
+		{[]interface{}{"components", "schemas", "roomListRoomsReply", "properties", "rooms", "items", "$ref"}, "#/components/schemas/roomRoom"},
+		{[]interface{}{"components", "schemas", "roomRoomLabelsEntry"}, nil},
+		{[]interface{}{"components", "schemas", "gatewayStreamError", "properties", "grpc_code", "type"}, "integer"},
+		{[]interface{}{"components", "securitySchemes", "bearerAuth", "scheme"}, "bearer"},
+	} {
+		if got := lookup(t, doc, c.keys...); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("doc%v = %#v; want %#v", c.keys, got, c.want)
+		}
+	}
+}
+
+func TestGenerateNaming(t *testing.T) {
+	doc := generateDoc(t, func(reg *descriptor.Registry) {
+		reg.SetUseJSONNamesForFields(true)
+		reg.SetUseFQNForSwaggerName(true)
+		reg.SetIncludePackageInTags(true)
+	})
+	for _, c := range []struct {
+		keys []interface{}
+		want interface{}
+	}{
+		{[]interface{}{"tags", 0, "name"}, "room.RoomService"},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "tags"}, []interface{}{"room.RoomService"}},
+		{[]interface{}{"paths", "/v1/users/{owner_id}/rooms", "get", "parameters", 1, "name"}, "page.page_token"},
+		{[]interface{}{"components", "schemas", "room.Room", "properties", "roomId", "type"}, "string"},
+		{[]interface{}{"components", "schemas", "room.ListRoomsReply", "properties", "rooms", "items", "$ref"}, "#/components/schemas/room.Room"},
+	} {
+		if got := lookup(t, doc, c.keys...); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("doc%v = %#v; want %#v", c.keys, got, c.want)
+		}
+	}
+}
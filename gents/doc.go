@@ -0,0 +1,2 @@
+// Package gents provides a code generator for the TypeScript type definitions and fetch functions of the gateway routes.
+package gents
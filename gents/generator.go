@@ -0,0 +1,463 @@
+package gents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	protodescriptor "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	gogen "github.com/golang/protobuf/protoc-gen-go/generator"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+	gen "github.com/generalzgd/protoc-gen-grpc-httpgw/generator"
+)
+
+var (
+	errNoTargetType = errors.New("no message, enum or service defined in the file")
+)
+
+// wellKnownTypes are the TypeScript types of the messages with a special JSON mapping.
+var wellKnownTypes = map[string]string{
+	".google.protobuf.Timestamp":   "string",
+	".google.protobuf.Duration":    "string",
+	".google.protobuf.FieldMask":   "string",
+	".google.protobuf.Struct":      "{ [key: string]: unknown }",
+	".google.protobuf.Value":       "unknown",
+	".google.protobuf.ListValue":   "unknown[]",
+	".google.protobuf.Empty":       "Record<string, never>",
+	".google.protobuf.Any":         `{ "@type": string; [key: string]: unknown }`,
+	".google.protobuf.DoubleValue": "number",
+	".google.protobuf.FloatValue":  "number",
+	".google.protobuf.Int32Value":  "number",
+	".google.protobuf.UInt32Value": "number",
+	".google.protobuf.Int64Value":  "string",
+	".google.protobuf.UInt64Value": "string",
+	".google.protobuf.BoolValue":   "boolean",
+	".google.protobuf.StringValue": "string",
+	".google.protobuf.BytesValue":  "string",
+	descriptor.HTTPBodyType:        "HttpBody",
+}
+
+type generator struct {
+	reg            *descriptor.Registry
+	sourceRelative bool
+}
+
+// New returns a new generator which generates a TypeScript file of the types and the routes of each proto file,
+// next to where the gateway file would be. "pathType" is the "paths" parameter.
+func New(reg *descriptor.Registry, pathType string) gen.Generator {
+	return &generator{
+		reg:            reg,
+		sourceRelative: pathType == "source_relative",
+	}
+}
+
+func (g *generator) Generate(targets []*descriptor.File) ([]*plugin.CodeGeneratorResponse_File, error) {
+	var files []*plugin.CodeGeneratorResponse_File
+	for _, file := range targets {
+		glog.V(1).Infof("Processing %s", file.GetName())
+		code, err := g.generate(file)
+		if err == errNoTargetType {
+			glog.V(1).Infof("%s: %v", file.GetName(), err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := file.GetName()
+		if !g.sourceRelative && file.GoPkg.Path != "" {
+			name = fmt.Sprintf("%s/%s", file.GoPkg.Path, filepath.Base(name))
+		}
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		output := fmt.Sprintf("%s.pb.httpgw.ts", base)
+		files = append(files, &plugin.CodeGeneratorResponse_File{
+			Name:    proto.String(output),
+			Content: proto.String(code),
+		})
+		glog.V(1).Infof("Will emit %s", output)
+	}
+	return files, nil
+}
+
+func (g *generator) generate(file *descriptor.File) (string, error) {
+	if len(file.Messages) == 0 && len(file.Enums) == 0 && len(file.Services) == 0 {
+		return "", errNoTargetType
+	}
+	b := &builder{
+		reg:       g.reg,
+		file:      file,
+		jsonNames: g.reg.GetUseJSONNamesForFields(),
+		comments:  g.reg.FileComments[file.GetName()],
+		paths:     descriptor.SourcePaths(file.FileDescriptorProto),
+		names:     make(map[string]string),
+		taken:     make(map[string]bool),
+		emitted:   make(map[string]bool),
+	}
+	// the types of the file keep their own names, the ones of the imported files get a package prefix on conflicts.
+	for _, msg := range file.Messages {
+		b.typeName(msg.FQMN(), msg.File, msg.Outers, msg.GetName())
+	}
+	for _, e := range file.Enums {
+		b.typeName(e.FQEN(), e.File, e.Outers, e.GetName())
+	}
+	for _, e := range file.Enums {
+		b.addEnum(e)
+	}
+	for _, msg := range file.Messages {
+		if err := b.addMessage(msg); err != nil {
+			return "", err
+		}
+	}
+
+	g.reg.LoadComments(file)
+	for _, svc := range file.Services {
+		for _, m := range svc.Methods {
+			if len(m.Bindings) == 0 || !m.CanOutput() || m.GetClientStreaming() {
+				continue
+			}
+			for _, binding := range m.Bindings {
+				fn, err := b.function(binding)
+				if err != nil {
+					return "", err
+				}
+				b.funcs = append(b.funcs, fn)
+			}
+		}
+	}
+	// the imported types are emitted as they are found, including the ones they refer to.
+	for len(b.pending) > 0 {
+		msg := b.pending[0]
+		b.pending = b.pending[1:]
+		if err := b.addMessage(msg); err != nil {
+			return "", err
+		}
+	}
+
+	return applyTemplate(param{
+		File:                file,
+		Enums:               b.enums,
+		Interfaces:          b.interfaces,
+		Funcs:               b.funcs,
+		PathParamSeparator:  string(g.reg.GetRepeatedPathParamSeparator()),
+		HTTPBodyContentType: b.fieldName("content_type", "contentType"),
+	})
+}
+
+// builder collects the TypeScript declarations of a file.
+type builder struct {
+	reg       *descriptor.Registry
+	file      *descriptor.File
+	jsonNames bool
+	comments  map[string]string
+	paths     map[interface{}]string
+
+	names   map[string]string
+	taken   map[string]bool
+	emitted map[string]bool
+	pending []*descriptor.Message
+
+	enums      []*tsEnum
+	interfaces []*tsInterface
+	funcs      []*tsFunc
+}
+
+// tsEnum is a string enum of the names of the values of a proto enum, as marshaled by jsonpb.
+type tsEnum struct {
+	Name    string
+	Comment []string
+	Values  []tsValue
+}
+
+type tsValue struct {
+	Name    string
+	Comment []string
+}
+
+type tsInterface struct {
+	Name    string
+	Comment []string
+	Fields  []tsField
+}
+
+type tsField struct {
+	Name    string
+	Type    string
+	Comment []string
+}
+
+// tsFunc is the function calling a binding.
+type tsFunc struct {
+	Name       string
+	Comment    []string
+	HTTPMethod string
+	Path       string
+	Request    string
+	Response   string
+	Stream     bool
+	// Route is the JSON of the route of the binding.
+	Route string
+}
+
+// route is the description of a binding used by the functions at runtime. The field paths are
+// the ones of the TypeScript types, the query keys the proto field paths parsed by the gateway.
+type route struct {
+	Method           string      `json:"method"`
+	Path             string      `json:"path"`
+	Body             string      `json:"body,omitempty"`
+	ResponseBody     string      `json:"responseBody,omitempty"`
+	Query            [][2]string `json:"query,omitempty"`
+	Headers          [][3]string `json:"headers,omitempty"`
+	HTTPBodyRequest  bool        `json:"httpBodyRequest,omitempty"`
+	HTTPBodyResponse bool        `json:"httpBodyResponse,omitempty"`
+}
+
+// typeName returns the TypeScript name of the message or enum "fqn", reserving it at the first call.
+func (b *builder) typeName(fqn string, file *descriptor.File, outers []string, name string) string {
+	if n, ok := b.names[fqn]; ok {
+		return n
+	}
+	n := strings.Join(append(append([]string(nil), outers...), name), "_")
+	if b.taken[n] || n == "HttpBody" {
+		n = strings.Replace(gogen.CamelCase(file.GetPackage()), ".", "_", -1) + "_" + n
+	}
+	for i, base := 2, n; b.taken[n]; i++ {
+		n = fmt.Sprintf("%s_%d", base, i)
+	}
+	b.names[fqn] = n
+	b.taken[n] = true
+	return n
+}
+
+// fieldName returns "name" or "jsonName" as the marshaler of the gateway names the field.
+func (b *builder) fieldName(name, jsonName string) string {
+	if b.jsonNames && jsonName != "" {
+		return jsonName
+	}
+	return name
+}
+
+func (b *builder) tsFieldName(f *descriptor.Field) string {
+	return b.fieldName(f.GetName(), f.GetJsonName())
+}
+
+func (b *builder) addEnum(e *descriptor.Enum) {
+	if b.emitted[e.FQEN()] {
+		return
+	}
+	b.emitted[e.FQEN()] = true
+	path := b.paths[e.EnumDescriptorProto]
+	te := &tsEnum{
+		Name:    b.typeName(e.FQEN(), e.File, e.Outers, e.GetName()),
+		Comment: b.comment(e.File, path),
+	}
+	for i, v := range e.GetValue() {
+		te.Values = append(te.Values, tsValue{
+			Name:    v.GetName(),
+			Comment: b.comment(e.File, fmt.Sprintf("%s,2,%d", path, i)),
+		})
+	}
+	b.enums = append(b.enums, te)
+}
+
+func (b *builder) addMessage(msg *descriptor.Message) error {
+	if b.emitted[msg.FQMN()] || msg.GetOptions().GetMapEntry() {
+		return nil
+	}
+	if _, ok := wellKnownTypes[msg.FQMN()]; ok {
+		return nil
+	}
+	b.emitted[msg.FQMN()] = true
+	path := b.paths[msg.DescriptorProto]
+	ti := &tsInterface{
+		Name:    b.typeName(msg.FQMN(), msg.File, msg.Outers, msg.GetName()),
+		Comment: b.comment(msg.File, path),
+	}
+	b.interfaces = append(b.interfaces, ti)
+	for i, f := range msg.Fields {
+		t, err := b.fieldType(f)
+		if err != nil {
+			return err
+		}
+		ti.Fields = append(ti.Fields, tsField{
+			Name:    quoteName(b.tsFieldName(f)),
+			Type:    t,
+			Comment: b.comment(msg.File, fmt.Sprintf("%s,2,%d", path, i)),
+		})
+	}
+	return nil
+}
+
+// fieldType returns the TypeScript type of the JSON of "f", queuing the declarations of the types it refers to.
+func (b *builder) fieldType(f *descriptor.Field) (string, error) {
+	var t string
+	switch f.GetType() {
+	case protodescriptor.FieldDescriptorProto_TYPE_DOUBLE,
+		protodescriptor.FieldDescriptorProto_TYPE_FLOAT,
+		protodescriptor.FieldDescriptorProto_TYPE_INT32,
+		protodescriptor.FieldDescriptorProto_TYPE_UINT32,
+		protodescriptor.FieldDescriptorProto_TYPE_SINT32,
+		protodescriptor.FieldDescriptorProto_TYPE_FIXED32,
+		protodescriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		t = "number"
+	case protodescriptor.FieldDescriptorProto_TYPE_INT64,
+		protodescriptor.FieldDescriptorProto_TYPE_UINT64,
+		protodescriptor.FieldDescriptorProto_TYPE_SINT64,
+		protodescriptor.FieldDescriptorProto_TYPE_FIXED64,
+		protodescriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		// jsonpb marshals the 64-bit integers as strings, which keeps their precision in JavaScript.
+		t = "string"
+	case protodescriptor.FieldDescriptorProto_TYPE_BOOL:
+		t = "boolean"
+	case protodescriptor.FieldDescriptorProto_TYPE_STRING,
+		protodescriptor.FieldDescriptorProto_TYPE_BYTES:
+		t = "string"
+	case protodescriptor.FieldDescriptorProto_TYPE_ENUM:
+		e, err := b.reg.LookupEnum("", f.GetTypeName())
+		if err != nil {
+			return "", err
+		}
+		if e.File != b.file {
+			b.addEnum(e)
+		}
+		t = b.typeName(e.FQEN(), e.File, e.Outers, e.GetName())
+	case protodescriptor.FieldDescriptorProto_TYPE_MESSAGE,
+		protodescriptor.FieldDescriptorProto_TYPE_GROUP:
+		msg, err := b.reg.LookupMsg("", f.GetTypeName())
+		if err != nil {
+			return "", err
+		}
+		if msg.GetOptions().GetMapEntry() {
+			if len(msg.Fields) != 2 {
+				return "", fmt.Errorf("map entry %s has %d fields", msg.FQMN(), len(msg.Fields))
+			}
+			value, err := b.fieldType(msg.Fields[1])
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("{ [key: string]: %s }", value), nil
+		}
+		t = b.messageType(msg)
+	default:
+		return "", fmt.Errorf("unsupported type %s of field %s", f.GetType(), f.GetName())
+	}
+	if f.GetLabel() == protodescriptor.FieldDescriptorProto_LABEL_REPEATED {
+		if strings.Contains(t, " ") {
+			t = "(" + t + ")"
+		}
+		t += "[]"
+	}
+	return t, nil
+}
+
+// messageType returns the TypeScript type of "msg", queuing its declaration if it is not of the file.
+func (b *builder) messageType(msg *descriptor.Message) string {
+	if t, ok := wellKnownTypes[msg.FQMN()]; ok {
+		return t
+	}
+	if msg.File != b.file && !b.emitted[msg.FQMN()] {
+		b.pending = append(b.pending, msg)
+	}
+	return b.typeName(msg.FQMN(), msg.File, msg.Outers, msg.GetName())
+}
+
+// function returns the function calling "binding".
+func (b *builder) function(binding *descriptor.Binding) (*tsFunc, error) {
+	m := binding.Method
+	name := lowerFirst(gogen.CamelCase(m.Service.GetName())) + gogen.CamelCase(m.GetName())
+	if binding.Index > 0 {
+		name = fmt.Sprintf("%s_%d", name, binding.Index)
+	}
+	r := route{
+		Method:           binding.HTTPMethod,
+		Path:             binding.PathTmpl.Template,
+		HTTPBodyRequest:  binding.HasHTTPBodyRequest(),
+		HTTPBodyResponse: binding.HasHTTPBodyResponse(),
+	}
+	for _, p := range binding.PathParams {
+		protoPath := p.FieldPath.String()
+		tsPath := b.tsPath(p.FieldPath)
+		r.Path = strings.Replace(r.Path, "{"+protoPath+"}", "{"+tsPath+"}", 1)
+		r.Path = strings.Replace(r.Path, "{"+protoPath+"=", "{"+tsPath+"=", 1)
+	}
+	if binding.Body != nil {
+		if r.Body = b.tsPath(binding.Body.FieldPath); r.Body == "" {
+			r.Body = "*"
+		}
+	}
+	if binding.ResponseBody != nil {
+		r.ResponseBody = b.tsPath(binding.ResponseBody.FieldPath)
+	}
+	for _, p := range binding.HeaderParams {
+		r.Headers = append(r.Headers, [3]string{p.Source, p.Name, b.tsPath(p.FieldPath)})
+	}
+	for _, p := range b.reg.QueryParams(binding) {
+		r.Query = append(r.Query, [2]string{b.tsPath(p), p.String()})
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	fn := &tsFunc{
+		Name:       name,
+		Comment:    docLines(m.Comment),
+		HTTPMethod: binding.HTTPMethod,
+		Path:       binding.PathTmpl.Template,
+		Request:    b.messageType(m.RequestType),
+		Response:   b.messageType(m.ResponseType),
+		Stream:     m.GetServerStreaming(),
+		Route:      string(data),
+	}
+	return fn, nil
+}
+
+// tsPath returns the path of the TypeScript fields of "path".
+func (b *builder) tsPath(path descriptor.FieldPath) string {
+	names := make([]string, len(path))
+	for i, c := range path {
+		names[i] = b.tsFieldName(c.Target)
+	}
+	return strings.Join(names, ".")
+}
+
+// comment returns the lines of the comment at the source code "path" of "file", if it is a target file.
+func (b *builder) comment(file *descriptor.File, path string) []string {
+	if file != b.file || path == "" {
+		return nil
+	}
+	return docLines(b.comments[path])
+}
+
+// docLines returns the lines of a JSDoc comment of "comment".
+func docLines(comment string) []string {
+	lines := descriptor.DocLines(comment)
+	for i, line := range lines {
+		lines[i] = strings.Replace(line, "*/", "*\\/", -1)
+	}
+	return lines
+}
+
+var identRegexp = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// quoteName quotes the property "name" if it is not an identifier.
+func quoteName(name string) string {
+	if identRegexp.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
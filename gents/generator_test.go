@@ -0,0 +1,86 @@
+package gents
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+)
+
+// loadRequest loads the request of room.proto shared by the tests of the generators.
+func loadRequest(t *testing.T) *plugin.CodeGeneratorRequest {
+	b, err := ioutil.ReadFile("../testdata/room.prototext")
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile() failed with %v", err)
+	}
+	var req plugin.CodeGeneratorRequest
+	if err := proto.UnmarshalText(string(b), &req); err != nil {
+		t.Fatalf("proto.UnmarshalText() failed with %v", err)
+	}
+	return &req
+}
+
+func generateTS(t *testing.T, jsonNames bool) string {
+	req := loadRequest(t)
+	reg := descriptor.NewRegistry()
+	reg.SetUseJSONNamesForFields(jsonNames)
+	if err := reg.Load(req); err != nil {
+		t.Fatalf("reg.Load() failed with %v", err)
+	}
+	file, err := reg.LookupFile("room.proto")
+	if err != nil {
+		t.Fatalf("reg.LookupFile() failed with %v", err)
+	}
+	reg.AddComments("room.proto", descriptor.SourceComments(file.FileDescriptorProto))
+	if err := reg.ParseCommentsSource(req.ProtoFile); err != nil {
+		t.Fatalf("reg.ParseCommentsSource() failed with %v", err)
+	}
+	files, err := New(reg, "source_relative").Generate([]*descriptor.File{file})
+	if err != nil {
+		t.Fatalf("Generate() failed with %v", err)
+	}
+	if len(files) != 1 || files[0].GetName() != "room.pb.httpgw.ts" {
+		t.Fatalf("Generate() = %v; want room.pb.httpgw.ts", files)
+	}
+	return files[0].GetContent()
+}
+
+func TestGenerate(t *testing.T) {
+	got := generateTS(t, false)
+	for _, want := range []string{
+		"export enum Status {\n  UNKNOWN = \"UNKNOWN\",\n  /** ACTIVE rooms take messages. */\n  ACTIVE = \"ACTIVE\",\n}",
+		"/** Room is a chat room. */\nexport interface Room {\n  /** room_id is the id of the room. */\n  room_id?: string;\n  status?: Status;\n  labels?: { [key: string]: string };\n  parent?: Room;\n  tags?: string[];\n}",
+		"export interface ListRoomsRequest {\n  owner_id?: string;\n  page?: Page;\n  statuses?: Status[];\n}",
+		"export interface ListRoomsReply {\n  rooms?: Room[];\n}",
+		"export interface Page {\n  page_token?: string;\n  size?: number;\n}",
+		`const route_roomServiceListRooms: Route = {"method":"GET","path":"/v1/users/{owner_id}/rooms","query":[["page.page_token","page.page_token"],["page.size","page.size"],["statuses","statuses"]]};`,
+		"/**\n * ListRooms lists the rooms of a user.\n * The rooms are paged.\n *\n * GET /v1/users/{owner_id}/rooms\n */\nexport function roomServiceListRooms(req: ListRoomsRequest, opts?: CallOptions): Promise<ListRoomsReply> {",
+		`const route_roomServiceListRooms_1: Route = {"method":"POST","path":"/v1/rooms:list","body":"*"};`,
+		"export function roomServiceListRooms_1(req: ListRoomsRequest, opts?: CallOptions): Promise<ListRoomsReply> {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Generate() = %s; want to contain %s", got, want)
+		}
+	}
+	for _, unwanted := range []string{"@transmit", "@target", "LabelsEntry", "roomServiceHidden"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("Generate() contains %s; want not", unwanted)
+		}
+	}
+
+	got = generateTS(t, true)
+	for _, want := range []string{
+		"  roomId?: string;\n",
+		"  pageToken?: string;\n",
+		`"path":"/v1/users/{ownerId}/rooms","query":[["page.pageToken","page.page_token"],["page.size","page.size"],["statuses","statuses"]]`,
+		`const httpBodyContentType = "contentType";`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Generate() with json names = %s; want to contain %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package gents
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+)
+
+type param struct {
+	*descriptor.File
+	Enums      []*tsEnum
+	Interfaces []*tsInterface
+	Funcs      []*tsFunc
+	// PathParamSeparator joins the values of the repeated path parameters.
+	PathParamSeparator string
+	// HTTPBodyContentType is the name of the content type field of google.api.HttpBody.
+	HTTPBodyContentType string
+}
+
+func applyTemplate(p param) (string, error) {
+	w := bytes.NewBuffer(nil)
+	if err := tsTemplate.Execute(w, p); err != nil {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+// jsdoc formats "lines" as a JSDoc comment indented by "indent", or nothing if there are no lines.
+func jsdoc(indent string, lines []string) string {
+	switch len(lines) {
+	case 0:
+		return ""
+	case 1:
+		return indent + "/** " + lines[0] + " */\n"
+	}
+	var b strings.Builder
+	b.WriteString(indent + "/**\n")
+	for _, line := range lines {
+		b.WriteString(strings.TrimRight(indent+" * "+line, " ") + "\n")
+	}
+	b.WriteString(indent + " */\n")
+	return b.String()
+}
+
+// funcDoc returns the lines of the JSDoc comment of "fn": the comment of the method and the route.
+func funcDoc(fn *tsFunc) []string {
+	lines := append([]string(nil), fn.Comment...)
+	if len(lines) > 0 {
+		lines = append(lines, "")
+	}
+	return append(lines, fn.HTTPMethod+" "+fn.Path)
+}
+
+var (
+	funcMap = template.FuncMap{
+		"jsdoc":   jsdoc,
+		"funcDoc": funcDoc,
+	}
+
+	tsTemplate = template.Must(template.New("ts").Funcs(funcMap).Parse(`// Code generated by protoc-gen-grpc-httpgw. DO NOT EDIT.
+// source: {{.GetName}}
+/* eslint-disable */
+{{range $e := .Enums}}
+{{jsdoc "" $e.Comment}}export enum {{$e.Name}} {
+{{- range $v := $e.Values}}
+{{jsdoc "  " $v.Comment}}  {{$v.Name}} = "{{$v.Name}}",
+{{- end}}
+}
+{{end}}
+{{- range $i := .Interfaces}}
+{{jsdoc "" $i.Comment}}export interface {{$i.Name}} {
+{{- range $f := $i.Fields}}
+{{jsdoc "  " $f.Comment}}  {{$f.Name}}?: {{$f.Type}};
+{{- end}}
+}
+{{end}}
+/** HttpBody is a google.api.HttpBody, sent and received as the raw body of the routes. */
+export interface HttpBody {
+  {{.HTTPBodyContentType}}?: string;
+  /** data is base64 in a string, or else raw. The responses hold a Blob, or the chunks of a stream a Uint8Array. */
+  data?: string | Blob | ArrayBuffer | Uint8Array;
+  extensions?: unknown[];
+}
+
+/** ClientConfig configures the requests of the functions of this file. */
+export interface ClientConfig {
+  /** baseURL is prepended to the paths of the routes, e.g. "https://api.example.com". */
+  baseURL?: string;
+  /** headers are sent with all the requests, e.g. {Authorization: "Bearer ..."}. */
+  headers?: { [name: string]: string };
+  /** fetch is called instead of the global fetch. */
+  fetch?: (input: string, init: RequestInit) => Promise<Response>;
+  /** init is merged into the init of all the requests, e.g. {credentials: "include"}. */
+  init?: RequestInit;
+  /** envelope unwraps the responses of the gateways configured with runtime.WithEnvelope. */
+  envelope?: Envelope;
+}
+
+/** Envelope describes the envelope of the responses. */
+export interface Envelope {
+  /** codeField is the name of the code member, "code" if empty. */
+  codeField?: string;
+  /** messageField is the name of the message member, "msg" if empty. */
+  messageField?: string;
+  /** dataField is the name of the member holding the reply, "data" if empty. */
+  dataField?: string;
+  /** successCode is the code of the replies, 0 if empty. */
+  successCode?: number;
+}
+
+/** CallOptions configures a request. */
+export interface CallOptions {
+  /** headers are added to the request. */
+  headers?: { [name: string]: string };
+  signal?: AbortSignal;
+}
+
+/** config is the configuration of the requests, e.g. config.baseURL = "https://api.example.com". */
+export const config: ClientConfig = {};
+
+/** GatewayError is the error of a request answered with an error status. */
+export class GatewayError extends Error {
+  /** status is the HTTP status. */
+  status: number;
+  /** code is the gRPC code of the error body, its name for application/problem+json, or the code of the envelope. */
+  code?: number | string;
+  /** body is the error body, parsed if JSON. */
+  body: unknown;
+
+  constructor(status: number, message: string, code: number | string | undefined, body: unknown) {
+    super(message);
+    Object.setPrototypeOf(this, GatewayError.prototype);
+    this.name = "GatewayError";
+    this.status = status;
+    this.code = code;
+    this.body = body;
+  }
+}
+
+interface Route {
+  method: string;
+  /** path is the path template, with the field paths of the request. */
+  path: string;
+  /** body is "*" for the whole request, or else a field path. */
+  body?: string;
+  responseBody?: string;
+  /** query are the field paths and the keys of the query parameters. */
+  query?: [string, string][];
+  /** headers are the sources ("header" or "cookie"), the names and the field paths of the header parameters. */
+  headers?: [string, string, string][];
+  httpBodyRequest?: boolean;
+  httpBodyResponse?: boolean;
+}
+
+const pathParamSeparator = {{printf "%q" .PathParamSeparator}};
+const httpBodyContentType = {{printf "%q" .HTTPBodyContentType}};
+
+function getField(msg: any, path: string): any {
+  for (const name of path.split(".")) {
+    if (msg === undefined || msg === null) {
+      return undefined;
+    }
+    msg = msg[name];
+  }
+  return msg;
+}
+
+function wrapField(path: string | undefined, value: any): any {
+  if (path) {
+    const names = path.split(".");
+    for (let i = names.length - 1; i >= 0; i--) {
+      value = { [names[i]]: value };
+    }
+  }
+  return value;
+}
+
+function paramString(v: any): string {
+  return Array.isArray(v) ? v.join(pathParamSeparator) : String(v);
+}
+
+function expandPath(tmpl: string, req: any): string {
+  return tmpl.replace(/\{([^}=]+)(=[^}]*)?\}/g, (_: string, path: string, pattern?: string) => {
+    const v = getField(req, path);
+    if (v === undefined || v === null || v === "") {
+      throw new Error("missing path parameter " + path);
+    }
+    const s = paramString(v);
+    if (pattern && (pattern.indexOf("/") >= 0 || pattern.indexOf("**") >= 0)) {
+      return s.split("/").map(encodeURIComponent).join("/");
+    }
+    return encodeURIComponent(s);
+  });
+}
+
+function rawData(data: string | Blob | ArrayBuffer | Uint8Array | undefined): any {
+  if (typeof data !== "string") {
+    return data;
+  }
+  const bin = atob(data);
+  const buf = new Uint8Array(bin.length);
+  for (let i = 0; i < bin.length; i++) {
+    buf[i] = bin.charCodeAt(i);
+  }
+  return buf;
+}
+
+function newRequest(route: Route, req: any, opts?: CallOptions): [string, RequestInit] {
+  let url = (config.baseURL || "").replace(/\/$/, "") + expandPath(route.path, req);
+  const params: string[] = [];
+  for (const [path, key] of route.query || []) {
+    const v = getField(req, path);
+    if (v === undefined || v === null) {
+      continue;
+    }
+    for (const value of Array.isArray(v) ? v : [v]) {
+      params.push(encodeURIComponent(key) + "=" + encodeURIComponent(String(value)));
+    }
+  }
+  if (params.length > 0) {
+    url += "?" + params.join("&");
+  }
+
+  const headers: { [name: string]: string } = Object.assign({}, config.headers);
+  const cookies: string[] = [];
+  for (const [source, name, path] of route.headers || []) {
+    const v = getField(req, path);
+    if (v === undefined || v === null) {
+      continue;
+    }
+    if (source === "cookie") {
+      cookies.push(name + "=" + paramString(v));
+    } else {
+      headers[name] = paramString(v);
+    }
+  }
+  if (cookies.length > 0) {
+    headers["Cookie"] = cookies.join("; ");
+  }
+  let body: any;
+  if (route.httpBodyRequest) {
+    const httpBody = route.body === "*" ? req : getField(req, route.body || "");
+    if (httpBody && httpBody[httpBodyContentType]) {
+      headers["Content-Type"] = httpBody[httpBodyContentType];
+    }
+    body = rawData(httpBody && httpBody.data);
+  } else if (route.body) {
+    body = JSON.stringify(route.body === "*" ? req : getField(req, route.body));
+    headers["Content-Type"] = "application/json";
+  }
+  Object.assign(headers, opts && opts.headers);
+  const init: RequestInit = Object.assign({}, config.init, { method: route.method, headers, body });
+  if (opts && opts.signal) {
+    init.signal = opts.signal;
+  }
+  return [url, init];
+}
+
+function unwrapEnvelope(envelope: Envelope, status: number, body: any): any {
+  const code = body[envelope.codeField || "code"];
+  if (code !== (envelope.successCode || 0)) {
+    throw new GatewayError(status, body[envelope.messageField || "msg"] || "", code, body);
+  }
+  return body[envelope.dataField || "data"];
+}
+
+async function decodeError(resp: Response): Promise<GatewayError> {
+  const text = await resp.text();
+  let body: any;
+  try {
+    body = JSON.parse(text);
+  } catch (e) {
+    return new GatewayError(resp.status, resp.statusText, undefined, text);
+  }
+  if (body === null || typeof body !== "object") {
+    return new GatewayError(resp.status, resp.statusText, undefined, body);
+  }
+  if ((resp.headers.get("Content-Type") || "").indexOf("application/problem+json") === 0) {
+    return new GatewayError(resp.status, body.detail || resp.statusText, body.code, body);
+  }
+  if (config.envelope) {
+    const e = config.envelope;
+    return new GatewayError(resp.status, body[e.messageField || "msg"] || resp.statusText, body[e.codeField || "code"], body);
+  }
+  return new GatewayError(resp.status, body.message || resp.statusText, body.code, body);
+}
+
+async function call(route: Route, req: any, opts?: CallOptions): Promise<any> {
+  const [url, init] = newRequest(route, req, opts);
+  const resp = await (config.fetch || fetch)(url, init);
+  if (!resp.ok) {
+    throw await decodeError(resp);
+  }
+  if (route.httpBodyResponse) {
+    return wrapField(route.responseBody, { [httpBodyContentType]: resp.headers.get("Content-Type") || "", data: await resp.blob() });
+  }
+  const text = await resp.text();
+  let data = text ? JSON.parse(text) : {};
+  if (config.envelope) {
+    data = unwrapEnvelope(config.envelope, resp.status, data);
+  }
+  return wrapField(route.responseBody, data === null ? {} : data);
+}
+
+async function* stream(route: Route, req: any, opts?: CallOptions): AsyncGenerator<any> {
+  const [url, init] = newRequest(route, req, opts);
+  const resp = await (config.fetch || fetch)(url, init);
+  if (!resp.ok) {
+    throw await decodeError(resp);
+  }
+  if (!resp.body) {
+    return;
+  }
+  const reader = resp.body.getReader();
+  try {
+    if (route.httpBodyResponse) {
+      let contentType = resp.headers.get("Content-Type") || "";
+      for (;;) {
+        const { done, value } = await reader.read();
+        if (done) {
+          return;
+        }
+        yield { [httpBodyContentType]: contentType, data: value };
+        contentType = "";
+      }
+    }
+    // the messages are sent one per line, as {"result": ...} or {"error": ...}.
+    const decoder = new TextDecoder();
+    let buf = "";
+    for (;;) {
+      const { done, value } = await reader.read();
+      buf += done ? decoder.decode() : decoder.decode(value, { stream: true });
+      const lines = buf.split("\n");
+      buf = done ? "" : lines.pop() || "";
+      for (const line of lines) {
+        if (line.trim() === "") {
+          continue;
+        }
+        const chunk = JSON.parse(line);
+        if (config.envelope) {
+          yield unwrapEnvelope(config.envelope, resp.status, chunk);
+          continue;
+        }
+        if (chunk.error) {
+          throw new GatewayError(chunk.error.http_code, chunk.error.message, chunk.error.grpc_code, chunk.error);
+        }
+        yield chunk.result;
+      }
+      if (done) {
+        return;
+      }
+    }
+  } finally {
+    reader.cancel().catch(() => undefined);
+  }
+}
+{{range $fn := .Funcs}}
+const route_{{$fn.Name}}: Route = {{$fn.Route}};
+
+{{jsdoc "" (funcDoc $fn)}}
+{{- if $fn.Stream -}}
+export function {{$fn.Name}}(req: {{$fn.Request}}, opts?: CallOptions): AsyncGenerator<{{$fn.Response}}> {
+  return stream(route_{{$fn.Name}}, req, opts);
+}
+{{- else -}}
+export function {{$fn.Name}}(req: {{$fn.Request}}, opts?: CallOptions): Promise<{{$fn.Response}}> {
+  return call(route_{{$fn.Name}}, req, opts);
+}
+{{- end}}
+{{end}}`))
+)
@@ -9,6 +9,7 @@ require (
 	github.com/grpc-ecosystem/grpc-gateway v1.9.5
 	github.com/toolkits/slice v0.0.0-20141116085117-e44a80af2484
 	google.golang.org/genproto v0.0.0-20190404172233-64821d5d2107
+	google.golang.org/grpc v1.19.0
 )
 
 replace (
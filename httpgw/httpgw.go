@@ -0,0 +1,35 @@
+// Package httpgw provides the custom options of protoc-gen-grpc-httpgw defined in httpgw.proto.
+//
+// The extensions are written by hand as GrpcAPIService in the descriptor package is,
+// so that the generator does not depend on protoc to be built.
+package httpgw
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// E_FromHeader is the "httpgw.from_header" field option.
+var E_FromHeader = &proto.ExtensionDesc{
+	ExtendedType:  (*descriptor.FieldOptions)(nil),
+	ExtensionType: (*string)(nil),
+	Field:         52101,
+	Name:          "httpgw.from_header",
+	Tag:           "bytes,52101,opt,name=from_header",
+	Filename:      "httpgw/httpgw.proto",
+}
+
+// E_FromCookie is the "httpgw.from_cookie" field option.
+var E_FromCookie = &proto.ExtensionDesc{
+	ExtendedType:  (*descriptor.FieldOptions)(nil),
+	ExtensionType: (*string)(nil),
+	Field:         52102,
+	Name:          "httpgw.from_cookie",
+	Tag:           "bytes,52102,opt,name=from_cookie",
+	Filename:      "httpgw/httpgw.proto",
+}
+
+func init() {
+	proto.RegisterExtension(E_FromHeader)
+	proto.RegisterExtension(E_FromCookie)
+}
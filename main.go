@@ -15,7 +15,6 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 
 	"github.com/golang/glog"
@@ -24,7 +23,12 @@ import (
 	"github.com/grpc-ecosystem/grpc-gateway/codegenerator"
 
 	"github.com/generalzgd/protoc-gen-grpc-httpgw/descriptor"
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/genclient"
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/gendoc"
 	"github.com/generalzgd/protoc-gen-grpc-httpgw/gengateway"
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/genopenapi"
+	"github.com/generalzgd/protoc-gen-grpc-httpgw/gents"
+	gen "github.com/generalzgd/protoc-gen-grpc-httpgw/generator"
 )
 
 var (
@@ -44,6 +48,12 @@ var (
 	//file               = flag.String("file", "./test_in.bts", "where to load data from")
 	debug = flag.Bool("debug", false, "")
 	definePrefix       = flag.String("define_prefix", "", "var define prefix")
+	httpClient         = flag.Bool("http_client", false, "also generate a typed HTTP client of each gateway service into *.pb.httpclient.go")
+	lang               = flag.String("lang", "go", "language of the generated code: `go` for the gateway, `ts` for TypeScript types and fetch functions into *.pb.httpgw.ts, `openapi` for one OpenAPI v3 document of the transmitted routes, `md` or `html` for the API reference of each gateway service")
+	useJSONNames       = flag.Bool("json_names_for_fields", false, "with lang=ts, openapi, md or html, name the fields by their json_name, as the marshalers with OrigName false do")
+	mergeFileName      = flag.String("merge_file_name", "apidocs", "with lang=openapi, the document is written into <merge_file_name>.openapi.json")
+	includePackageTags = flag.Bool("include_package_in_tags", false, "with lang=openapi, prefix the tags of the operations with the proto package")
+	fqnForSchemaName   = flag.Bool("fqn_for_swagger_name", false, "with lang=openapi, name the schemas by the fully qualified names of the messages")
 )
 
 // Variables set by goreleaser at build time
@@ -106,7 +116,23 @@ func main() {
 		}
 	}
 
-	g := gengateway.New(reg, *useRequestContext, *registerFuncSuffix, *pathType, *allowPatchFeature)
+	var g, cg gen.Generator
+	switch *lang {
+	case "go":
+		g = gengateway.New(reg, *useRequestContext, *registerFuncSuffix, *pathType, *allowPatchFeature)
+		if *httpClient {
+			cg = genclient.New(reg, *pathType)
+		}
+	case "ts":
+		g = gents.New(reg, *pathType)
+	case "openapi":
+		g = genopenapi.New(reg)
+	case "md", "html":
+		g = gendoc.New(reg, *pathType, *lang == "html")
+	default:
+		emitError(fmt.Errorf("unknown lang %q, want go, ts, openapi, md or html", *lang))
+		return
+	}
 
 	if *grpcAPIConfiguration != "" {
 		if err := reg.LoadGrpcAPIServiceFromYAML(*grpcAPIConfiguration); err != nil {
@@ -120,6 +146,10 @@ func main() {
 	reg.SetAllowDeleteBody(*allowDeleteBody)
 	reg.SetAllowRepeatedFieldsInBody(*allowRepeatedFieldsInBody)
 	reg.SetAllowColonFinalSegments(*allowColonFinalSegments)
+	reg.SetUseJSONNamesForFields(*useJSONNames)
+	reg.SetMergeFileName(*mergeFileName)
+	reg.SetIncludePackageInTags(*includePackageTags)
+	reg.SetUseFQNForSwaggerName(*fqnForSchemaName)
 	if err := reg.SetRepeatedPathParamSeparator(*repeatedPathParamSeparator); err != nil {
 		emitError(err)
 		return
@@ -137,8 +167,7 @@ func main() {
 		}
 		targets = append(targets, f)
 		//
-		comments := extractComments(f)
-		reg.AddComments(*f.Name, comments)
+		reg.AddComments(*f.Name, descriptor.SourceComments(f.FileDescriptorProto))
 	}
 
 	if err := reg.ParseCommentsSource(req.ProtoFile); err != nil {
@@ -146,6 +175,11 @@ func main() {
 	}
 
 	out, err := g.Generate(targets)
+	if err == nil && cg != nil {
+		var clients []*plugin.CodeGeneratorResponse_File
+		clients, err = cg.Generate(targets)
+		out = append(out, clients...)
+	}
 	glog.V(1).Info("Processed code generator request")
 	if err != nil {
 		emitError(err)
@@ -154,21 +188,6 @@ func main() {
 	emitFiles(out)
 }
 
-func extractComments(file *descriptor.File) map[string]string {
-	comments := make(map[string]string)
-	for _, loc := range file.GetSourceCodeInfo().GetLocation() {
-		if loc.LeadingComments == nil {
-			continue
-		}
-		var t []string
-		for _, n := range loc.Path {
-			t = append(t, strconv.Itoa(int(n)))
-		}
-		comments[strings.Join(t, ",")] = strings.TrimSpace(*loc.LeadingComments)
-	}
-	return comments
-}
-
 func emitFiles(out []*plugin.CodeGeneratorResponse_File) {
 	emitResp(&plugin.CodeGeneratorResponse{File: out})
 }
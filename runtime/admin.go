@@ -0,0 +1,569 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+)
+
+// LatencyBuckets are the upper bounds of the latency histograms of the Admin.
+var LatencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// DefaultRecentErrors is the number of recent errors kept by the Admin if Admin.RecentErrors is 0.
+const DefaultRecentErrors = 100
+
+// Admin is an http.Handler showing the internal state of the gateway: the registered routes,
+// their counters and latency histograms, the connection pool, the circuit breakers and the
+// recent errors, with a "try it" form sending requests to the routes.
+// It is enabled for the routes of a Register*HandlerClient call with WithAdmin, and should be
+// served on a separate listener, e.g.
+//   go http.ListenAndServe("127.0.0.1:9901", admin)
+// It serves
+//   GET  /        the HTML page
+//   GET  /routes  the routes and their stats as JSON
+//   GET  /conns   the connection pool as JSON
+//   GET  /errors  the recent errors as JSON, the latest first
+//   POST /try     a request to the gateway, {"method": "GET", "path": "/v1/...", "header": {...}, "body": "..."}
+// relative to the path it is mounted at.
+type Admin struct {
+	// Handler is the gateway handler the "try it" requests are sent to, e.g. the runtime.ServeMux.
+	// The form is disabled if nil.
+	Handler http.Handler
+	// ConnPool is the connection pool shown, if not nil.
+	ConnPool *ConnPool
+	// CircuitBreakers reports the states of the circuit breakers by name, if not nil.
+	// The gateway has no circuit breakers of its own.
+	CircuitBreakers func() map[string]string
+	// RecentErrors is the number of recent errors kept, DefaultRecentErrors if 0.
+	RecentErrors int
+
+	mu     sync.Mutex
+	routes []*Route
+	stats  map[*Route]*routeStats
+	errors []AdminError
+	next   int
+}
+
+// WithAdmin records the requests of the registered routes into "a".
+func WithAdmin(a *Admin) GatewayOption {
+	return func(g *Gateway) {
+		g.admin = a
+	}
+}
+
+// AdminError is a recent error of a route.
+type AdminError struct {
+	Time   time.Time `json:"time"`
+	Route  string    `json:"route"`
+	Method string    `json:"method"`
+	Status int       `json:"status"`
+	Error  string    `json:"error"`
+}
+
+// LatencyHistogram is a snapshot of the latencies of a route.
+type LatencyHistogram struct {
+	// BoundsMs are the upper bounds of the buckets in milliseconds, the last bucket is unbounded.
+	BoundsMs []float64 `json:"bounds_ms"`
+	// Counts are the numbers of requests in each bucket.
+	Counts []int64 `json:"counts"`
+	// SumMs is the total latency in milliseconds.
+	SumMs float64 `json:"sum_ms"`
+}
+
+// RouteStats is a snapshot of a route and its counters.
+type RouteStats struct {
+	Service    string           `json:"service"`
+	HTTPMethod string           `json:"http_method"`
+	Path       string           `json:"path"`
+	Method     string           `json:"method"`
+	Streaming  StreamingKind    `json:"streaming"`
+	Requests   int64            `json:"requests"`
+	Errors     int64            `json:"errors"`
+	InFlight   int64            `json:"in_flight"`
+	Statuses   map[string]int64 `json:"statuses"`
+	Latency    LatencyHistogram `json:"latency"`
+}
+
+type routeStats struct {
+	requests int64
+	errors   int64
+	inFlight int64
+	statuses map[int]int64
+	counts   []int64
+	sum      time.Duration
+}
+
+func (a *Admin) addRoutes(routes []*Route) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stats == nil {
+		a.stats = make(map[*Route]*routeStats)
+	}
+	for _, r := range routes {
+		if _, ok := a.stats[r]; ok {
+			continue
+		}
+		a.routes = append(a.routes, r)
+		a.stats[r] = &routeStats{statuses: make(map[int]int64), counts: make([]int64, len(LatencyBuckets)+1)}
+	}
+}
+
+func (a *Admin) begin(route *Route) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if st, ok := a.stats[route]; ok {
+		st.inFlight++
+	}
+}
+
+func (a *Admin) end(route *Route, code int, latency time.Duration, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st, ok := a.stats[route]
+	if !ok {
+		return
+	}
+	st.inFlight--
+	st.requests++
+	st.statuses[code]++
+	i := sort.Search(len(LatencyBuckets), func(i int) bool { return latency <= LatencyBuckets[i] })
+	st.counts[i]++
+	st.sum += latency
+	if err == nil && code < http.StatusBadRequest {
+		return
+	}
+	st.errors++
+	msg := http.StatusText(code)
+	if err != nil {
+		msg = status.Convert(err).Message()
+	}
+	max := a.RecentErrors
+	if max <= 0 {
+		max = DefaultRecentErrors
+	}
+	e := AdminError{Time: time.Now(), Route: RouteKey(route), Method: route.Method, Status: code, Error: msg}
+	if len(a.errors) < max {
+		a.errors = append(a.errors, e)
+	} else {
+		a.errors[a.next%len(a.errors)] = e
+	}
+	a.next++
+}
+
+// Routes returns the registered routes and their stats, in the order of registration.
+func (a *Admin) Routes() []RouteStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	bounds := make([]float64, len(LatencyBuckets))
+	for i, b := range LatencyBuckets {
+		bounds[i] = float64(b) / float64(time.Millisecond)
+	}
+	result := make([]RouteStats, 0, len(a.routes))
+	for _, r := range a.routes {
+		st := a.stats[r]
+		rs := RouteStats{
+			Service:    r.Service,
+			HTTPMethod: r.HTTPMethod,
+			Path:       r.Path,
+			Method:     r.Method,
+			Streaming:  r.Streaming,
+			Requests:   st.requests,
+			Errors:     st.errors,
+			InFlight:   st.inFlight,
+			Statuses:   make(map[string]int64, len(st.statuses)),
+			Latency: LatencyHistogram{
+				BoundsMs: bounds,
+				Counts:   append([]int64(nil), st.counts...),
+				SumMs:    float64(st.sum) / float64(time.Millisecond),
+			},
+		}
+		for code, n := range st.statuses {
+			rs.Statuses[strconv.Itoa(code)] = n
+		}
+		result = append(result, rs)
+	}
+	return result
+}
+
+// Errors returns the recent errors, the latest first.
+func (a *Admin) Errors() []AdminError {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	result := make([]AdminError, 0, len(a.errors))
+	for i := 1; i <= len(a.errors); i++ {
+		result = append(result, a.errors[(a.next-i+len(a.errors))%len(a.errors)])
+	}
+	return result
+}
+
+type adminRecordKey struct{}
+
+// adminRecord is where HTTPError leaves the error of the observed request.
+type adminRecord struct {
+	err error
+}
+
+// ObserveRequest starts recording a request of "route" into the Admin, if any.
+// It returns the context and the writer to handle the request with, and the function
+// to call when the request is done.
+func (g *Gateway) ObserveRequest(ctx context.Context, w http.ResponseWriter, req *http.Request, route *Route) (context.Context, http.ResponseWriter, func()) {
+	if g.admin == nil {
+		return ctx, w, func() {}
+	}
+	begin := time.Now()
+	rec := &adminRecord{}
+	ow := &observedResponseWriter{ResponseWriter: w}
+	g.admin.begin(route)
+	return context.WithValue(ctx, adminRecordKey{}, rec), ow, func() {
+		code := ow.status
+		if code == 0 {
+			code = http.StatusOK
+		}
+		g.admin.end(route, code, time.Since(begin), rec.err)
+	}
+}
+
+// recordError leaves "err" to the observed request of "ctx", if any.
+func recordError(ctx context.Context, err error) {
+	if rec, ok := ctx.Value(adminRecordKey{}).(*adminRecord); ok {
+		rec.err = err
+	}
+}
+
+// observedResponseWriter remembers the status written.
+type observedResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *observedResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *observedResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *observedResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *observedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack not supported")
+}
+
+// AdminTryRequest is the request of the "try it" form.
+type AdminTryRequest struct {
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Header map[string]string `json:"header"`
+	Body   string            `json:"body"`
+}
+
+// AdminTryResponse is the response to a "try it" request.
+type AdminTryResponse struct {
+	Status  int               `json:"status"`
+	Header  map[string]string `json:"header"`
+	Body    string            `json:"body"`
+	Latency string            `json:"latency"`
+}
+
+// tryResponseWriter buffers the response of a "try it" request or of a sub-request of a batch.
+type tryResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *tryResponseWriter) Header() http.Header { return w.header }
+
+func (w *tryResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *tryResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *tryResponseWriter) Flush() {}
+
+// ServeHTTP serves the admin pages.
+func (a *Admin) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	switch {
+	case strings.HasSuffix(path, "/routes"):
+		a.writeJSON(w, a.Routes())
+	case strings.HasSuffix(path, "/conns"):
+		var conns []ConnState
+		if a.ConnPool != nil {
+			conns = a.ConnPool.States()
+		}
+		a.writeJSON(w, conns)
+	case strings.HasSuffix(path, "/errors"):
+		a.writeJSON(w, a.Errors())
+	case strings.HasSuffix(path, "/try"):
+		a.serveTry(w, req)
+	default:
+		a.serveIndex(w, req)
+	}
+}
+
+func (a *Admin) writeJSON(w http.ResponseWriter, v interface{}) {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(buf); err != nil {
+		grpclog.Infof("Failed to write response: %v", err)
+	}
+}
+
+// sameOrigin reports whether "req" has no Origin header, or one of the host it is sent to.
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == req.Host
+}
+
+func (a *Admin) serveTry(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(req) {
+		http.Error(w, "cross-origin request", http.StatusForbidden)
+		return
+	}
+	if ct := req.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		// application/json is not a simple content type, the browsers preflight it
+		// and refuse to send it from other origins.
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if a.Handler == nil {
+		http.Error(w, "no gateway handler", http.StatusNotImplemented)
+		return
+	}
+	var tr AdminTryRequest
+	if err := json.NewDecoder(req.Body).Decode(&tr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if tr.Method == "" || !strings.HasPrefix(tr.Path, "/") {
+		http.Error(w, "method and path are required", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), 30*time.Second)
+	defer cancel()
+	treq, err := http.NewRequest(tr.Method, tr.Path, strings.NewReader(tr.Body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	treq = treq.WithContext(ctx)
+	treq.RemoteAddr = req.RemoteAddr
+	for k, v := range tr.Header {
+		treq.Header.Set(k, v)
+	}
+	if tr.Body != "" && treq.Header.Get("Content-Type") == "" {
+		treq.Header.Set("Content-Type", "application/json")
+	}
+	begin := time.Now()
+	tw := &tryResponseWriter{header: make(http.Header)}
+	a.Handler.ServeHTTP(tw, treq)
+	resp := AdminTryResponse{
+		Status:  tw.status,
+		Header:  make(map[string]string, len(tw.header)),
+		Body:    tw.body.String(),
+		Latency: time.Since(begin).String(),
+	}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	for k := range tw.header {
+		resp.Header[k] = strings.Join(tw.header[k], ", ")
+	}
+	a.writeJSON(w, resp)
+}
+
+func (a *Admin) serveIndex(w http.ResponseWriter, req *http.Request) {
+	data := struct {
+		Routes          []RouteStats
+		Conns           []ConnState
+		CircuitBreakers map[string]string
+		Errors          []AdminError
+		Try             bool
+	}{
+		Routes: a.Routes(),
+		Errors: a.Errors(),
+		Try:    a.Handler != nil,
+	}
+	if a.ConnPool != nil {
+		data.Conns = a.ConnPool.States()
+	}
+	if a.CircuitBreakers != nil {
+		data.CircuitBreakers = a.CircuitBreakers()
+	}
+	var buf bytes.Buffer
+	if err := adminTemplate.Execute(&buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		grpclog.Infof("Failed to write response: %v", err)
+	}
+}
+
+var adminTemplate = template.Must(template.New("admin").Funcs(template.FuncMap{
+	"ms": func(f float64) string { return time.Duration(f * float64(time.Millisecond)).String() },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>httpgw admin</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; margin: 16px; }
+table { border-collapse: collapse; margin-bottom: 16px; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+textarea, input, select { font-family: monospace; }
+pre { background: #f6f6f6; padding: 8px; }
+</style>
+</head>
+<body>
+<h2>Routes</h2>
+<table>
+<tr><th>service</th><th>route</th><th>target</th><th>streaming</th><th>requests</th><th>errors</th><th>in flight</th><th>statuses</th><th>latency (&le; bound: count)</th></tr>
+{{- range .Routes}}
+<tr>
+<td>{{.Service}}</td><td>{{.HTTPMethod}} {{.Path}}</td><td>{{.Method}}</td><td>{{.Streaming}}</td>
+<td>{{.Requests}}</td><td>{{.Errors}}</td><td>{{.InFlight}}</td>
+<td>{{range $s, $n := .Statuses}}{{$s}}: {{$n}}<br>{{end}}</td>
+<td>{{$counts := .Latency.Counts}}{{range $i, $b := .Latency.BoundsMs}}{{with index $counts $i}}{{ms $b}}: {{.}}<br>{{end}}{{end}}</td>
+</tr>
+{{- end}}
+</table>
+
+<h2>Connections</h2>
+{{- if .Conns}}
+<table>
+<tr><th>service</th><th>target</th><th>state</th><th>endpoints</th></tr>
+{{- range .Conns}}
+<tr><td>{{.Service}}</td><td>{{.Target}}</td><td>{{.State}}</td><td>{{range .Addrs}}{{.}}<br>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>no connection pool</p>
+{{- end}}
+
+<h2>Circuit breakers</h2>
+{{- if .CircuitBreakers}}
+<table>
+<tr><th>name</th><th>state</th></tr>
+{{- range $name, $state := .CircuitBreakers}}
+<tr><td>{{$name}}</td><td>{{$state}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>no circuit breakers</p>
+{{- end}}
+
+<h2>Recent errors</h2>
+<table>
+<tr><th>time</th><th>route</th><th>target</th><th>status</th><th>error</th></tr>
+{{- range .Errors}}
+<tr><td>{{.Time.Format "2006-01-02 15:04:05.000"}}</td><td>{{.Route}}</td><td>{{.Method}}</td><td>{{.Status}}</td><td>{{.Error}}</td></tr>
+{{- end}}
+</table>
+
+{{- if .Try}}
+<h2>Try it</h2>
+<form id="try">
+<select id="route" onchange="pick()">
+<option value="">-- route --</option>
+{{- range .Routes}}
+<option value="{{.HTTPMethod}} {{.Path}}">{{.HTTPMethod}} {{.Path}}</option>
+{{- end}}
+</select><br>
+<input id="method" size="8" placeholder="GET"> <input id="path" size="80" placeholder="/v1/..."><br>
+<textarea id="header" rows="3" cols="100" placeholder="Header: value"></textarea><br>
+<textarea id="body" rows="8" cols="100" placeholder="{}"></textarea><br>
+<button type="submit">send</button>
+</form>
+<pre id="result"></pre>
+<script>
+function pick() {
+  var v = document.getElementById("route").value.split(" ");
+  document.getElementById("method").value = v[0] || "";
+  document.getElementById("path").value = v[1] || "";
+}
+document.getElementById("try").onsubmit = function(e) {
+  e.preventDefault();
+  var header = {};
+  document.getElementById("header").value.split("\n").forEach(function(line) {
+    var i = line.indexOf(":");
+    if (i > 0) { header[line.slice(0, i).trim()] = line.slice(i + 1).trim(); }
+  });
+  fetch(location.pathname.replace(/\/$/, "") + "/try", {method: "POST", headers: {"Content-Type": "application/json"}, body: JSON.stringify({
+    method: document.getElementById("method").value,
+    path: document.getElementById("path").value,
+    header: header,
+    body: document.getElementById("body").value
+  })}).then(function(r) { return r.text(); }).then(function(t) {
+    document.getElementById("result").textContent = t;
+  });
+};
+</script>
+{{- end}}
+</body>
+</html>
+`))
+
+// AddRoutes registers "routes" to the Admin, if any, before they serve any request.
+func (g *Gateway) AddRoutes(routes []*Route) {
+	if g.admin != nil {
+		g.admin.addRoutes(routes)
+	}
+}
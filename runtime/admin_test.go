@@ -0,0 +1,133 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdmin(t *testing.T) {
+	read := &Route{Service: "zqproto.ImGate", HTTPMethod: "GET", Path: "/v1/imgate/read/{uid}", Method: "zqproto.Im/Read", Streaming: StreamingUnary}
+	login := &Route{Service: "zqproto.ImGate", HTTPMethod: "POST", Path: "/v1/imgate/login", Method: "zqproto.Authorize/Login", Streaming: StreamingUnary}
+
+	mux := grpcgw.NewServeMux()
+	admin := &Admin{Handler: mux, RecentErrors: 2, CircuitBreakers: func() map[string]string {
+		return map[string]string{"zqproto.Im": "closed"}
+	}}
+	gw := NewGateway(WithAdmin(admin))
+	gw.AddRoutes([]*Route{read, login})
+	gw.AddRoutes([]*Route{read})
+
+	serve := func(route *Route, err error) {
+		ctx, w, observed := gw.ObserveRequest(context.Background(), httptest.NewRecorder(), httptest.NewRequest(route.HTTPMethod, "/", nil), route)
+		defer observed()
+		if err != nil {
+			gw.HTTPError(ctx, mux, &grpcgw.JSONPb{}, w, httptest.NewRequest(route.HTTPMethod, "/", nil), err)
+			return
+		}
+		w.Write([]byte("{}"))
+	}
+	serve(read, nil)
+	serve(read, nil)
+	serve(login, status.Error(codes.Unauthenticated, "bad password"))
+	serve(login, status.Error(codes.PermissionDenied, "banned"))
+	serve(login, status.Error(codes.Unavailable, "down"))
+
+	routes := admin.Routes()
+	if len(routes) != 2 {
+		t.Fatalf("len(Routes()) = %d; want 2", len(routes))
+	}
+	if r := routes[0]; r.Path != read.Path || r.Requests != 2 || r.Errors != 0 || r.InFlight != 0 || r.Statuses["200"] != 2 {
+		t.Errorf("Routes()[0] = %+v; want 2 successful requests of %s", r, read.Path)
+	}
+	if r := routes[1]; r.Requests != 3 || r.Errors != 3 || r.Statuses["401"] != 1 || r.Statuses["503"] != 1 {
+		t.Errorf("Routes()[1] = %+v; want 3 failed requests of %s", r, login.Path)
+	}
+	var n int64
+	for _, c := range routes[0].Latency.Counts {
+		n += c
+	}
+	if n != 2 || len(routes[0].Latency.Counts) != len(LatencyBuckets)+1 {
+		t.Errorf("Routes()[0].Latency = %+v; want 2 requests in %d buckets", routes[0].Latency, len(LatencyBuckets)+1)
+	}
+
+	errs := admin.Errors()
+	if len(errs) != 2 || errs[0].Error != "down" || errs[1].Error != "banned" || errs[0].Status != http.StatusServiceUnavailable || errs[0].Route != "POST /v1/imgate/login" {
+		t.Errorf("Errors() = %+v; want the last 2 errors, the latest first", errs)
+	}
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/routes", nil))
+	var got []RouteStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != 2 {
+		t.Errorf("GET /routes wrote %s; want the 2 routes", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/", nil))
+	for _, want := range []string{"/v1/imgate/read/{uid}", "zqproto.Authorize/Login", "banned", "closed", "Try it"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET / does not show %q", want)
+		}
+	}
+}
+
+func TestAdminTry(t *testing.T) {
+	mux := grpcgw.NewServeMux()
+	mux.Handle("POST", literalPattern("/v1/echo"), func(w http.ResponseWriter, req *http.Request, _ map[string]string) {
+		w.Header().Set("X-Echo", req.Header.Get("X-Echo"))
+		w.WriteHeader(http.StatusCreated)
+		var buf [64]byte
+		n, _ := req.Body.Read(buf[:])
+		w.Write(buf[:n])
+	})
+	admin := &Admin{Handler: mux}
+
+	rec := httptest.NewRecorder()
+	body := `{"method": "POST", "path": "/v1/echo", "header": {"X-Echo": "1"}, "body": "{\"a\":1}"}`
+	req := httptest.NewRequest("POST", "/try", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "http://"+req.Host)
+	admin.ServeHTTP(rec, req)
+	var resp AdminTryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("POST /try wrote %s; want a JSON response", rec.Body.String())
+	}
+	if resp.Status != http.StatusCreated || resp.Header["X-Echo"] != "1" || resp.Body != `{"a":1}` {
+		t.Errorf("POST /try = %+v; want the echo", resp)
+	}
+	if _, err := time.ParseDuration(resp.Latency); err != nil {
+		t.Errorf("POST /try latency = %q; want a duration", resp.Latency)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/try", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /try answered %d; want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/try", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	admin.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("POST /try of text/plain answered %d; want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/try", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "https://evil.example.com")
+	admin.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("POST /try from another origin answered %d; want %d", rec.Code, http.StatusForbidden)
+	}
+}
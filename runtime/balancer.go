@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"context"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+// HashBalancerName is the name of the gRPC balancer routing the calls by the
+// hash key of their context, with the default HashRing parameters, e.g.
+//   grpc.Dial("dns:///im-backend:9090", grpc.WithInsecure(), grpc.WithBalancerName(gwruntime.HashBalancerName))
+// The calls without a hash key go to the least loaded endpoint.
+const HashBalancerName = "consistent_hash"
+
+func init() {
+	balancer.Register(NewHashBalancerBuilder(HashBalancerName, 0, 0))
+}
+
+// NewHashBalancerBuilder returns a builder of consistent hash balancers named "name",
+// with the HashRing parameters "replicas" and "loadFactor".
+// It should be registered with balancer.Register.
+func NewHashBalancerBuilder(name string, replicas int, loadFactor float64) balancer.Builder {
+	return &hashBalancerBuilder{name: name, replicas: replicas, loadFactor: loadFactor}
+}
+
+type hashBalancerBuilder struct {
+	name       string
+	replicas   int
+	loadFactor float64
+}
+
+// Build builds a balancer with its own ring, so that the loads of the endpoints
+// survive the pickers rebuilt as the endpoints change.
+func (b *hashBalancerBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := &hashPickerBuilder{ring: NewHashRing(b.replicas, b.loadFactor)}
+	return base.NewBalancerBuilderWithConfig(b.name, pb, base.Config{HealthCheck: true}).Build(cc, opts)
+}
+
+func (b *hashBalancerBuilder) Name() string {
+	return b.name
+}
+
+type hashPickerBuilder struct {
+	ring *HashRing
+}
+
+func (b *hashPickerBuilder) Build(readySCs map[resolver.Address]balancer.SubConn) balancer.Picker {
+	subConns := make(map[string]balancer.SubConn, len(readySCs))
+	endpoints := make([]string, 0, len(readySCs))
+	for addr, sc := range readySCs {
+		subConns[addr.Addr] = sc
+		endpoints = append(endpoints, addr.Addr)
+	}
+	b.ring.Set(endpoints)
+	if len(readySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	return &hashPicker{ring: b.ring, subConns: subConns}
+}
+
+type hashPicker struct {
+	ring     *HashRing
+	subConns map[string]balancer.SubConn
+}
+
+func (p *hashPicker) Pick(ctx context.Context, opts balancer.PickOptions) (balancer.SubConn, func(balancer.DoneInfo), error) {
+	key, _ := HashKeyFromContext(ctx)
+	addr, done, ok := p.ring.Pick(key)
+	if !ok {
+		return nil, nil, balancer.ErrNoSubConnAvailable
+	}
+	sc, ok := p.subConns[addr]
+	if !ok {
+		// the ring has been updated by a newer picker.
+		done()
+		return nil, nil, balancer.ErrNoSubConnAvailable
+	}
+	return sc, func(balancer.DoneInfo) { done() }, nil
+}
@@ -0,0 +1,240 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/grpclog"
+)
+
+const (
+	// DefaultBatchPath is the path of the batch endpoint if Batch.Path is empty.
+	DefaultBatchPath = "/batch"
+	// DefaultBatchMaxItems is the number of sub-requests allowed in a batch if Batch.MaxItems is 0.
+	DefaultBatchMaxItems = 20
+	// DefaultBatchConcurrency is the number of sub-requests run at once if Batch.Concurrency is 0.
+	DefaultBatchConcurrency = 4
+	// DefaultBatchMaxSize is the size limit of the batch request body if Batch.MaxSize is 0.
+	DefaultBatchMaxSize = 4 << 20
+)
+
+// Batch configures the endpoint running several routed calls in one HTTP request.
+// The endpoint takes a JSON array of sub-requests:
+//   POST /batch
+//   [
+//     {"method": "GET", "path": "/v1/im/rooms?limit=10"},
+//     {"method": "POST", "path": "/v1/im/send", "headers": {"X-Trace": "1"}, "body": {"room_id": 1, "text": "hi"}}
+//   ]
+// where a string "body" is the raw body of a sub-request whose Content-Type is not JSON,
+// and returns the array of their responses, in order:
+//   [
+//     {"status": 200, "headers": {"Content-Type": ["application/json"]}, "body": {"rooms": []}},
+//     {"status": 403, "headers": {"Content-Type": ["application/json"]}, "body": {"code": 7, "message": "..."}}
+//   ]
+// Each sub-request is served by the mux as a request of its own, with the headers of the batch request
+// overridden by its "headers", so it goes through the routing, the beginHandler, the authentication and
+// the connection to its target like any other.
+type Batch struct {
+	// Path is the path of the endpoint, DefaultBatchPath if empty.
+	Path string
+	// MaxItems is the number of sub-requests allowed in a batch, DefaultBatchMaxItems if 0.
+	MaxItems int
+	// Concurrency is the number of sub-requests run at once, DefaultBatchConcurrency if 0.
+	Concurrency int
+	// MaxSize is the size limit of the batch request body, DefaultBatchMaxSize if 0.
+	MaxSize int64
+}
+
+// WithBatch serves the batch endpoint on the mux of the Register*HandlerClient call.
+// The endpoint runs the routes of all the services registered on the mux, so it is only
+// needed in one of the calls.
+func WithBatch(b Batch) GatewayOption {
+	return func(g *Gateway) {
+		if b.Path = "/" + strings.Trim(b.Path, "/"); b.Path == "/" {
+			b.Path = DefaultBatchPath
+		}
+		if b.MaxItems == 0 {
+			b.MaxItems = DefaultBatchMaxItems
+		}
+		if b.Concurrency == 0 {
+			b.Concurrency = DefaultBatchConcurrency
+		}
+		if b.MaxSize == 0 {
+			b.MaxSize = DefaultBatchMaxSize
+		}
+		g.batch = &b
+	}
+}
+
+// BatchRequest is a sub-request of a batch.
+type BatchRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is the JSON body of the sub-request. A string is sent as is if the
+	// Content-Type of the sub-request is not JSON, e.g. text/plain.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResponse is the response to a sub-request of a batch.
+type BatchResponse struct {
+	Status int `json:"status"`
+	// Headers are the values of the response headers, which are not joined since
+	// some of them, e.g. Set-Cookie, cannot be.
+	Headers http.Header `json:"headers,omitempty"`
+	// Body is the JSON body of the response, or a string for the other media types.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// HandleBatch registers the batch endpoint on "mux", if configured with WithBatch.
+func (g *Gateway) HandleBatch(mux *grpcgw.ServeMux) {
+	if g.batch == nil {
+		return
+	}
+	mux.Handle("POST", literalPattern(g.batch.Path), func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		g.serveBatch(mux, w, req)
+	})
+}
+
+func (g *Gateway) serveBatch(h http.Handler, w http.ResponseWriter, req *http.Request) {
+	b := g.batch
+	w, compressed := g.CompressResponse(w, req)
+	defer compressed()
+	if err := g.DecodeRequest(req); err != nil {
+		code := http.StatusBadRequest
+		if se, ok := err.(*statusError); ok {
+			code = se.status
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, b.MaxSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > b.MaxSize {
+		http.Error(w, fmt.Sprintf("batch is larger than %d bytes", b.MaxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var items []BatchRequest
+	if err := json.Unmarshal(data, &items); err != nil {
+		http.Error(w, "batch is not an array of requests: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(items) > b.MaxItems {
+		http.Error(w, fmt.Sprintf("batch has %d requests, more than %d", len(items), b.MaxItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	resps := make([]BatchResponse, len(items))
+	runConcurrently(len(items), b.Concurrency, func(i int) {
+		resps[i] = g.serveBatchItem(h, req, &items[i])
+	})
+
+	buf, err := json.Marshal(resps)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		grpclog.Infof("Failed to write response: %v", err)
+	}
+}
+
+// runConcurrently calls "f" with 0 to n-1, running at most "concurrency" calls at once.
+func runConcurrently(n, concurrency int, f func(i int)) {
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// batchHeaders are the headers of the batch request which are not passed to the sub-requests.
+var batchHeaders = []string{"Content-Length", "Content-Type", "Content-Encoding", "Accept-Encoding"}
+
+// serveBatchItem serves the sub-request "item" of the batch request "req" with "h".
+func (g *Gateway) serveBatchItem(h http.Handler, req *http.Request, item *BatchRequest) (resp BatchResponse) {
+	fail := func(status int, msg string) BatchResponse {
+		body, _ := json.Marshal(msg)
+		return BatchResponse{Status: status, Body: body}
+	}
+	if item.Method == "" || !strings.HasPrefix(item.Path, "/") {
+		return fail(http.StatusBadRequest, "method and path are required")
+	}
+	if p := strings.SplitN(item.Path, "?", 2)[0]; p == g.batch.Path {
+		return fail(http.StatusBadRequest, "nested batch")
+	}
+	sreq, err := http.NewRequest(strings.ToUpper(item.Method), item.Path, nil)
+	if err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	}
+	sreq = sreq.WithContext(req.Context())
+	sreq.RemoteAddr = req.RemoteAddr
+	sreq.Host = req.Host
+	for k, v := range req.Header {
+		sreq.Header[k] = v
+	}
+	for _, k := range batchHeaders {
+		sreq.Header.Del(k)
+	}
+	for k, v := range item.Headers {
+		sreq.Header.Set(k, v)
+	}
+	body := []byte(item.Body)
+	if len(body) > 0 {
+		if sreq.Header.Get("Content-Type") == "" {
+			sreq.Header.Set("Content-Type", "application/json")
+		}
+		// A string is the raw body of the other media types, and a JSON value of the JSON ones.
+		var s string
+		if mediaType, _, _ := mime.ParseMediaType(sreq.Header.Get("Content-Type")); !strings.Contains(mediaType, "json") && json.Unmarshal(body, &s) == nil {
+			body = []byte(s)
+		}
+	}
+	sreq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	sreq.ContentLength = int64(len(body))
+
+	defer func() {
+		if r := recover(); r != nil {
+			// e.g. http.ErrAbortHandler of a stream failed halfway.
+			grpclog.Infof("Batch request %s %s panicked: %v", item.Method, item.Path, r)
+			resp = fail(http.StatusBadGateway, "request aborted")
+		}
+	}()
+	tw := &tryResponseWriter{header: make(http.Header)}
+	h.ServeHTTP(tw, sreq)
+	resp = BatchResponse{Status: tw.status, Headers: tw.header}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	if tw.body.Len() == 0 {
+		return resp
+	}
+	mediaType, _, _ := mime.ParseMediaType(tw.header.Get("Content-Type"))
+	if strings.Contains(mediaType, "json") && json.Valid(tw.body.Bytes()) {
+		resp.Body = tw.body.Bytes()
+	} else {
+		resp.Body, _ = json.Marshal(tw.body.String())
+	}
+	return resp
+}
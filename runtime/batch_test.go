@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+)
+
+func TestBatch(t *testing.T) {
+	mux := grpcgw.NewServeMux()
+	var running, maxRunning int32
+	echo := grpcgw.MustPattern(grpcgw.NewPattern(1, []int{2, 0}, []string{"echo"}, ""))
+	mux.Handle("POST", echo, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Header().Set("Content-Type", req.Header.Get("Content-Type"))
+		w.Header().Set("X-Token", req.Header.Get("Authorization"))
+		http.SetCookie(w, &http.Cookie{Name: "a", Value: "1", Expires: time.Unix(0, 0).UTC()})
+		http.SetCookie(w, &http.Cookie{Name: "b", Value: "2"})
+		w.Write(body)
+	})
+	gw := NewGateway(WithBatch(Batch{Path: "v1/batch", Concurrency: 2, MaxItems: 7}))
+	gw.HandleBatch(mux)
+
+	batch := `[
+		{"method": "POST", "path": "/echo", "body": {"id": 1}},
+		{"method": "POST", "path": "/echo", "headers": {"Authorization": "Bearer b", "Content-Type": "text/plain"}, "body": "hi"},
+		{"method": "POST", "path": "/echo", "body": "{\"id\":2}"},
+		{"method": "GET", "path": "/missing"},
+		{"method": "POST", "path": "/v1/batch", "body": []},
+		{"method": "POST", "path": "/echo"},
+		{"path": "/echo"}
+	]`
+	req := httptest.NewRequest("POST", "/v1/batch", strings.NewReader(batch))
+	req.Header.Set("Authorization", "Bearer a")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch wrote %d %s; want 200", rec.Code, rec.Body.String())
+	}
+	var resps []BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resps); err != nil {
+		t.Fatalf("batch wrote %s: %v", rec.Body.String(), err)
+	}
+	want := []struct {
+		status int
+		token  string
+		body   string
+	}{
+		{http.StatusOK, "Bearer a", `{"id":1}`},
+		{http.StatusOK, "Bearer b", `"hi"`},
+		{http.StatusOK, "Bearer a", `"{\"id\":2}"`},
+		{http.StatusNotFound, "", ""},
+		{http.StatusBadRequest, "", `"nested batch"`},
+		{http.StatusOK, "Bearer a", ""},
+		{http.StatusBadRequest, "", `"method and path are required"`},
+	}
+	if len(resps) != len(want) {
+		t.Fatalf("batch returned %d responses; want %d", len(resps), len(want))
+	}
+	for i, w := range want {
+		if resps[i].Status != w.status || resps[i].Headers.Get("X-Token") != w.token || (w.body != "" && string(resps[i].Body) != w.body) {
+			t.Errorf("response %d = %d %q %s; want %d %q %s", i, resps[i].Status, resps[i].Headers.Get("X-Token"), resps[i].Body, w.status, w.token, w.body)
+		}
+	}
+	cookies := []string{"a=1; Expires=Thu, 01 Jan 1970 00:00:00 GMT", "b=2"}
+	if got := resps[0].Headers["Set-Cookie"]; !reflect.DeepEqual(got, cookies) {
+		t.Errorf("response 0 has Set-Cookie %q; want %q", got, cookies)
+	}
+	if maxRunning > 2 {
+		t.Errorf("batch ran %d requests at once; want at most 2", maxRunning)
+	}
+
+	for _, body := range []string{`{}`, `[{}, {}, {}, {}, {}, {}, {}, {}]`} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/batch", strings.NewReader(body)))
+		if rec.Code == http.StatusOK {
+			t.Errorf("batch %s succeeded; want failure", body)
+		}
+	}
+}
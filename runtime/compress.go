@@ -0,0 +1,399 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultCompressionMinSize is the minimum size of the compressed responses if Compression.MinSize is 0.
+	DefaultCompressionMinSize = 1024
+	// DefaultMaxDecodedSize is the size limit of the decoded request bodies if Compression.MaxDecodedSize is 0.
+	DefaultMaxDecodedSize = 32 << 20
+)
+
+// Encoding is a content coding of the HTTP bodies, e.g. "br" with a brotli package:
+//   gwruntime.Encoding{
+//   	Name:      "br",
+//   	NewWriter: func(w io.Writer) (io.WriteCloser, error) { return brotli.NewWriter(w), nil },
+//   	NewReader: func(r io.Reader) (io.ReadCloser, error) { return ioutil.NopCloser(brotli.NewReader(r)), nil },
+//   }
+type Encoding struct {
+	// Name is the token of the coding in Accept-Encoding and Content-Encoding.
+	Name string
+	// NewWriter returns a writer compressing into "w", nil if the coding is not used for the responses.
+	// The writer should implement Flush() error for the server streams.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader decompressing "r", nil if the coding is not accepted for the requests.
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// Compression configures the compression of the responses and the decoding of the request bodies.
+type Compression struct {
+	// MinSize is the minimum size of the compressed responses, DefaultCompressionMinSize if 0.
+	// The server streams are compressed whatever their size.
+	MinSize int
+	// Level is the level of gzip and deflate, from 1 (best speed) to 9 (best compression),
+	// the default level of compress/flate if 0.
+	Level int
+	// MaxDecodedSize is the size limit of a request body after decoding, DefaultMaxDecodedSize if 0,
+	// against decompression bombs.
+	MaxDecodedSize int64
+	// Encodings are the codings preferred over gzip and deflate, in order.
+	Encodings []Encoding
+}
+
+// WithCompression compresses the responses of the registered routes as negotiated with
+// Accept-Encoding, gzip and deflate being built in, and decodes their request bodies by Content-Encoding.
+func WithCompression(c Compression) GatewayOption {
+	return func(g *Gateway) {
+		if c.MinSize == 0 {
+			c.MinSize = DefaultCompressionMinSize
+		}
+		if c.Level == 0 {
+			c.Level = flate.DefaultCompression
+		}
+		if c.MaxDecodedSize == 0 {
+			c.MaxDecodedSize = DefaultMaxDecodedSize
+		}
+		level := c.Level
+		c.Encodings = append(append([]Encoding(nil), c.Encodings...),
+			Encoding{
+				Name: "gzip",
+				NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+					return gzip.NewWriterLevel(w, level)
+				},
+				NewReader: func(r io.Reader) (io.ReadCloser, error) {
+					return gzip.NewReader(r)
+				},
+			},
+			Encoding{
+				Name: "deflate",
+				NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+					return zlib.NewWriterLevel(w, level)
+				},
+				NewReader: newDeflateReader,
+			},
+		)
+		g.compression = &c
+	}
+}
+
+// newDeflateReader reads "deflate" bodies, which are zlib streams by the RFC,
+// but raw deflate streams from some clients.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+func (c *Compression) encoding(name string) *Encoding {
+	for i := range c.Encodings {
+		if strings.EqualFold(c.Encodings[i].Name, name) {
+			return &c.Encodings[i]
+		}
+	}
+	if strings.EqualFold(name, "x-gzip") {
+		return c.encoding("gzip")
+	}
+	return nil
+}
+
+// negotiate returns the response coding accepted by "accept", the value of Accept-Encoding, or nil.
+// The codings of the highest quality are picked in the order of Encodings.
+func (c *Compression) negotiate(accept string) *Encoding {
+	q := make(map[string]float64)
+	wildcard := -1.0
+	for _, item := range strings.Split(accept, ",") {
+		params := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+		v := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					v = f
+				}
+			}
+		}
+		if name == "x-gzip" {
+			name = "gzip"
+		}
+		if name == "*" {
+			wildcard = v
+			continue
+		}
+		q[name] = v
+	}
+	var best *Encoding
+	bestQ := 0.0
+	for i := range c.Encodings {
+		e := &c.Encodings[i]
+		if e.NewWriter == nil {
+			continue
+		}
+		v, ok := q[strings.ToLower(e.Name)]
+		if !ok {
+			v = wildcard
+		}
+		if v > bestQ {
+			best, bestQ = e, v
+		}
+	}
+	return best
+}
+
+// errDecodedTooLarge is returned by the decoded request bodies over the limit.
+type errDecodedTooLarge int64
+
+func (e errDecodedTooLarge) Error() string {
+	return fmt.Sprintf("request body is larger than %d bytes after decoding", int64(e))
+}
+
+// decodedBody reads a decoded request body up to a limit.
+type decodedBody struct {
+	io.Reader
+	decoders []io.Closer
+	body     io.Closer
+	left     int64
+	limit    int64
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		// one more byte tells a body of exactly the limit from a larger one.
+		var one [1]byte
+		if n, _ := b.Reader.Read(one[:]); n > 0 {
+			return 0, errDecodedTooLarge(b.limit)
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.Reader.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
+
+func (b *decodedBody) Close() error {
+	for _, d := range b.decoders {
+		d.Close()
+	}
+	return b.body.Close()
+}
+
+// DecodeRequest replaces the body of "req" with its decoding by Content-Encoding, if any.
+// The decoded body fails to read over Compression.MaxDecodedSize bytes.
+// It fails with 415 for the unknown codings.
+func (g *Gateway) DecodeRequest(req *http.Request) error {
+	c := g.compression
+	if c == nil {
+		return nil
+	}
+	header := req.Header.Get("Content-Encoding")
+	if header == "" {
+		return nil
+	}
+	var names []string
+	for _, name := range strings.Split(header, ",") {
+		if name = strings.TrimSpace(name); name != "" && !strings.EqualFold(name, "identity") {
+			names = append(names, name)
+		}
+	}
+	body := &decodedBody{Reader: req.Body, body: req.Body, left: c.MaxDecodedSize, limit: c.MaxDecodedSize}
+	// the codings are listed in the order they were applied.
+	for i := len(names) - 1; i >= 0; i-- {
+		e := c.encoding(names[i])
+		if e == nil || e.NewReader == nil {
+			body.Close()
+			return &statusError{
+				st:     status.Newf(codes.InvalidArgument, "unsupported Content-Encoding %q", names[i]),
+				status: http.StatusUnsupportedMediaType,
+			}
+		}
+		r, err := e.NewReader(body.Reader)
+		if err != nil {
+			body.Close()
+			return status.Errorf(codes.InvalidArgument, "bad %s request body: %v", names[i], err)
+		}
+		body.Reader = r
+		body.decoders = append(body.decoders, r)
+	}
+	req.Body = body
+	req.ContentLength = -1
+	req.Header.Del("Content-Length")
+	req.Header.Del("Content-Encoding")
+	return nil
+}
+
+// CompressResponse returns the writer compressing the response to "req" as negotiated,
+// and the function to call when the response is written.
+// The responses smaller than Compression.MinSize, already encoded, or of a media type which does
+// not compress well, e.g. images, are written as is.
+func (g *Gateway) CompressResponse(w http.ResponseWriter, req *http.Request) (http.ResponseWriter, func()) {
+	c := g.compression
+	if c == nil {
+		return w, func() {}
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	e := c.negotiate(req.Header.Get("Accept-Encoding"))
+	if e == nil || req.Method == "HEAD" {
+		return w, func() {}
+	}
+	cw := &compressResponseWriter{ResponseWriter: w, encoding: e, minSize: c.MinSize}
+	return cw, cw.finish
+}
+
+// compressResponseWriter buffers the beginning of the response until it knows whether to compress it.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding *Encoding
+	minSize  int
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf.Write(b)
+	if w.buf.Len() >= w.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide writes the header, compressing the rest of the response if "compress" and the response allows,
+// and the buffered beginning.
+func (w *compressResponseWriter) decide(compress bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h := w.Header()
+	if compress && bodyAllowed(w.status) && w.status != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		enc, err := w.encoding.NewWriter(w.ResponseWriter)
+		if err != nil {
+			grpclog.Infof("Failed to compress the response with %s: %v", w.encoding.Name, err)
+		} else {
+			w.enc = enc
+			h.Set("Content-Encoding", w.encoding.Name)
+			h.Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// Flush compresses the server streams whatever their size.
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			grpclog.Infof("Failed to write response: %v", err)
+		}
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			grpclog.Infof("Failed to flush response: %v", err)
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack not supported")
+}
+
+func (w *compressResponseWriter) finish() {
+	if !w.decided {
+		if w.status == 0 && w.buf.Len() == 0 {
+			// nothing written, e.g. after a hijack.
+			return
+		}
+		if err := w.decide(false); err != nil {
+			grpclog.Infof("Failed to write response: %v", err)
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Close(); err != nil {
+			grpclog.Infof("Failed to write response: %v", err)
+		}
+	}
+}
+
+// compressible tells whether the responses of the media type "contentType" are worth compressing.
+func compressible(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.Contains(mediaType, "json"),
+		strings.Contains(mediaType, "xml"),
+		strings.Contains(mediaType, "javascript"),
+		strings.Contains(mediaType, "protobuf"),
+		mediaType == "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
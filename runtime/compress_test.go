@@ -0,0 +1,166 @@
+package runtime
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+)
+
+func TestCompressResponse(t *testing.T) {
+	gw := NewGateway(WithCompression(Compression{MinSize: 16}))
+	large := strings.Repeat(`{"id":1}`, 10)
+	for _, spec := range []struct {
+		accept, contentType, body, encoding string
+	}{
+		{accept: "gzip, deflate", contentType: "application/json", body: large, encoding: "gzip"},
+		{accept: "gzip;q=0.5, deflate", contentType: "application/json", body: large, encoding: "deflate"},
+		{accept: "*", contentType: "application/json", body: large, encoding: "gzip"},
+		{accept: "gzip;q=0, *;q=0", contentType: "application/json", body: large},
+		{accept: "", contentType: "application/json", body: large},
+		{accept: "gzip", contentType: "application/json", body: "{}"},
+		{accept: "gzip", contentType: "image/png", body: large},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", spec.accept)
+		rec := httptest.NewRecorder()
+		w, finish := gw.CompressResponse(rec, req)
+		w.Header().Set("Content-Type", spec.contentType)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(spec.body))
+		finish()
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("CompressResponse(%q) wrote %d; want %d", spec.accept, rec.Code, http.StatusCreated)
+		}
+		if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("CompressResponse(%q) wrote Vary %q; want Accept-Encoding", spec.accept, got)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != spec.encoding {
+			t.Errorf("CompressResponse(%q, %s, %d bytes) wrote Content-Encoding %q; want %q", spec.accept, spec.contentType, len(spec.body), got, spec.encoding)
+			continue
+		}
+		var body []byte
+		var err error
+		switch spec.encoding {
+		case "gzip":
+			r, _ := gzip.NewReader(rec.Body)
+			body, err = ioutil.ReadAll(r)
+		case "deflate":
+			r, _ := zlib.NewReader(rec.Body)
+			body, err = ioutil.ReadAll(r)
+		default:
+			body = rec.Body.Bytes()
+		}
+		if err != nil || string(body) != spec.body {
+			t.Errorf("CompressResponse(%q) wrote %q, %v; want %q", spec.accept, body, err, spec.body)
+		}
+	}
+
+	// the streams are compressed from the first flush.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	w, finish := gw.CompressResponse(rec, req)
+	w.Write([]byte(`{"result":1}`))
+	w.(http.Flusher).Flush()
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" || !rec.Flushed {
+		t.Errorf("CompressResponse() of a flushed stream wrote Content-Encoding %q, flushed %v; want gzip, true", got, rec.Flushed)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() of the flushed stream failed with %v", err)
+	}
+	var chunk [64]byte
+	if n, _ := r.Read(chunk[:]); string(chunk[:n]) != `{"result":1}` {
+		t.Errorf("CompressResponse() flushed %q; want %q", chunk[:n], `{"result":1}`)
+	}
+	finish()
+
+	w, _ = NewGateway().CompressResponse(rec, req)
+	if w != http.ResponseWriter(rec) {
+		t.Errorf("CompressResponse() without compression wrapped the writer")
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	gw := NewGateway(WithCompression(Compression{MaxDecodedSize: 64}))
+	encode := func(encoding, s string) *bytes.Buffer {
+		var buf bytes.Buffer
+		switch encoding {
+		case "gzip":
+			w := gzip.NewWriter(&buf)
+			w.Write([]byte(s))
+			w.Close()
+		case "deflate":
+			w := zlib.NewWriter(&buf)
+			w.Write([]byte(s))
+			w.Close()
+		case "raw":
+			w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+			w.Write([]byte(s))
+			w.Close()
+		}
+		return &buf
+	}
+	for _, spec := range []struct {
+		encoding, header string
+	}{
+		{encoding: "gzip", header: "gzip"},
+		{encoding: "gzip", header: "x-gzip"},
+		{encoding: "deflate", header: "deflate"},
+		{encoding: "raw", header: "deflate"},
+	} {
+		req := httptest.NewRequest("POST", "/", encode(spec.encoding, `{"id":1}`))
+		req.Header.Set("Content-Encoding", spec.header)
+		if err := gw.DecodeRequest(req); err != nil {
+			t.Fatalf("DecodeRequest(%s as %s) failed with %v; want success", spec.encoding, spec.header, err)
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil || string(body) != `{"id":1}` {
+			t.Errorf("DecodeRequest(%s as %s) body = %q, %v; want %q", spec.encoding, spec.header, body, err, `{"id":1}`)
+		}
+		if req.Header.Get("Content-Encoding") != "" {
+			t.Errorf("DecodeRequest(%s) kept Content-Encoding", spec.header)
+		}
+	}
+
+	// decompression bomb.
+	req := httptest.NewRequest("POST", "/", encode("gzip", strings.Repeat("0", 65)))
+	req.Header.Set("Content-Encoding", "gzip")
+	if err := gw.DecodeRequest(req); err != nil {
+		t.Fatalf("DecodeRequest() failed with %v; want success", err)
+	}
+	if _, err := ioutil.ReadAll(req.Body); err == nil {
+		t.Errorf("reading a body decoded over the limit succeeded; want failure")
+	}
+	req = httptest.NewRequest("POST", "/", encode("gzip", strings.Repeat("0", 64)))
+	req.Header.Set("Content-Encoding", "gzip")
+	gw.DecodeRequest(req)
+	if body, err := ioutil.ReadAll(req.Body); err != nil || len(body) != 64 {
+		t.Errorf("reading a body decoded to the limit = %d bytes, %v; want 64 bytes", len(body), err)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader("x"))
+	req.Header.Set("Content-Encoding", "compress")
+	err := gw.DecodeRequest(req)
+	rec := httptest.NewRecorder()
+	gw.HTTPError(grpcgw.NewServerMetadataContext(context.Background(), grpcgw.ServerMetadata{}), grpcgw.NewServeMux(), &grpcgw.JSONPb{}, rec, req, err)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("DecodeRequest(compress) wrote %d; want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader("x"))
+	req.Header.Set("Content-Encoding", "gzip")
+	if err := NewGateway().DecodeRequest(req); err != nil || req.Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("DecodeRequest() without compression = %v; want the request as is", err)
+	}
+}
@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/golang/protobuf/proto"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/metadata"
+)
+
+// BeginHandler is called by the generated handlers before the request is decoded.
+// "meth" is the target method in the form of "package.Service/Method".
+// A nil Decision continues the call.
+type BeginHandler func(ctx context.Context, meth string, req *http.Request) *Decision
+
+// DecisionAction is what the handler does after a BeginHandler returns.
+type DecisionAction int
+
+const (
+	// ActionContinue forwards the request to the target service.
+	ActionContinue DecisionAction = iota
+	// ActionReject answers with Status and Body without calling the target service.
+	ActionReject
+	// ActionRedirect redirects the client to Location with Status.
+	ActionRedirect
+	// ActionRespond answers with Message without calling the target service.
+	ActionRespond
+)
+
+// Decision is the result of a BeginHandler.
+type Decision struct {
+	Action DecisionAction
+	// Status is the HTTP status of ActionReject, ActionRedirect and ActionRespond.
+	Status int
+	// Body is marshaled with the outbound marshaler by ActionReject.
+	// The status text is written if it is nil.
+	Body interface{}
+	// Location is the target of ActionRedirect.
+	Location string
+	// Message is the response of ActionRespond.
+	Message proto.Message
+	// Context replaces the context of the call by ActionContinue, if not nil.
+	// It should be derived from the one passed to the BeginHandler.
+	Context context.Context
+	// Metadata is added to the outgoing gRPC metadata by ActionContinue.
+	Metadata metadata.MD
+}
+
+// Continue returns a Decision to forward the request.
+func Continue() *Decision {
+	return &Decision{Action: ActionContinue}
+}
+
+// Reject returns a Decision to answer with "code" and "body" instead of forwarding the request.
+func Reject(code int, body interface{}) *Decision {
+	return &Decision{Action: ActionReject, Status: code, Body: body}
+}
+
+// Redirect returns a Decision to redirect the client to "location".
+// "code" defaults to 302 if 0.
+func Redirect(code int, location string) *Decision {
+	if code == 0 {
+		code = http.StatusFound
+	}
+	return &Decision{Action: ActionRedirect, Status: code, Location: location}
+}
+
+// Respond returns a Decision to answer with "msg" instead of forwarding the request.
+func Respond(msg proto.Message) *Decision {
+	return &Decision{Action: ActionRespond, Status: http.StatusOK, Message: msg}
+}
+
+// WithContext sets the context of the forwarded call.
+func (d *Decision) WithContext(ctx context.Context) *Decision {
+	d.Context = ctx
+	return d
+}
+
+// WithMetadata adds key-value pairs to the outgoing gRPC metadata of the forwarded call.
+func (d *Decision) WithMetadata(kv ...string) *Decision {
+	d.Metadata = metadata.Join(d.Metadata, metadata.Pairs(kv...))
+	return d
+}
+
+type decisionMetadataKey struct{}
+
+// ApplyDecision carries out "d". It returns the context to continue the call with and true
+// if the request is to be forwarded, or false if the response is written already.
+// The metadata of the decision is sent by ApplyMetadata.
+func (g *Gateway) ApplyDecision(ctx context.Context, mux *grpcgw.ServeMux, marshaler grpcgw.Marshaler, w http.ResponseWriter, req *http.Request, d *Decision) (context.Context, bool) {
+	if d == nil {
+		return ctx, true
+	}
+	switch d.Action {
+	case ActionContinue:
+		return d.continueContext(ctx), true
+	case ActionReject:
+		code := d.Status
+		if code == 0 {
+			code = http.StatusForbidden
+		}
+		if d.Body == nil {
+			grpcgw.OtherErrorHandler(w, req, http.StatusText(code), code)
+			return ctx, false
+		}
+		// the body is written as is, not in the envelope.
+		marshaler = unwrapMarshaler(marshaler)
+		buf, err := marshaler.Marshal(d.Body)
+		if err != nil {
+			grpclog.Infof("Failed to marshal rejection body: %v", err)
+			grpcgw.OtherErrorHandler(w, req, http.StatusText(code), code)
+			return ctx, false
+		}
+		w.Header().Set("Content-Type", marshaler.ContentType())
+		w.WriteHeader(code)
+		if _, err := w.Write(buf); err != nil {
+			grpclog.Infof("Failed to write response: %v", err)
+		}
+	case ActionRedirect:
+		http.Redirect(w, req, d.Location, d.Status)
+	case ActionRespond:
+		if d.Status != 0 && d.Status != http.StatusOK {
+			w = &statusResponseWriter{ResponseWriter: w, status: d.Status}
+		}
+		grpcgw.ForwardResponseMessage(ctx, mux, marshaler, w, req, d.Message, mux.GetForwardResponseOptions()...)
+	default:
+		grpcgw.OtherErrorHandler(w, req, "unknown decision", http.StatusInternalServerError)
+	}
+	return ctx, false
+}
+
+// continueContext returns the context to continue the call with after the ActionContinue "d".
+func (d *Decision) continueContext(ctx context.Context) context.Context {
+	if d.Context != nil {
+		ctx = d.Context
+	}
+	if len(d.Metadata) > 0 {
+		ctx = context.WithValue(ctx, decisionMetadataKey{}, d.Metadata)
+	}
+	return ctx
+}
+
+// decisionMetadata returns the metadata of the Decision applied to "ctx".
+func decisionMetadata(ctx context.Context) metadata.MD {
+	md, _ := ctx.Value(decisionMetadataKey{}).(metadata.MD)
+	return md
+}
@@ -0,0 +1,83 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/metadata"
+)
+
+type ctxKey struct{}
+
+func TestGatewayApplyDecision(t *testing.T) {
+	g := NewGateway()
+	mux := grpcgw.NewServeMux()
+	marshaler := &grpcgw.JSONPb{OrigName: true}
+	for _, spec := range []struct {
+		decision *Decision
+		ok       bool
+		code     int
+		body     string
+		location string
+	}{
+		{decision: nil, ok: true},
+		{decision: Continue(), ok: true},
+		{decision: Reject(http.StatusTooManyRequests, nil), code: http.StatusTooManyRequests, body: "Too Many Requests"},
+		{decision: Reject(http.StatusUnauthorized, map[string]interface{}{"code": 1001, "msg": "not login yet"}), code: http.StatusUnauthorized, body: `{"code":1001,"msg":"not login yet"}`},
+		{decision: Redirect(0, "/login"), code: http.StatusFound, location: "/login"},
+		{decision: Respond(&descriptor.FieldDescriptorProto{Name: proto.String("cached")}), code: http.StatusOK, body: `{"name":"cached"}`},
+		{decision: &Decision{Action: ActionRespond, Status: http.StatusAccepted, Message: &descriptor.FieldDescriptorProto{}}, code: http.StatusAccepted, body: `{}`},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		_, ok := g.ApplyDecision(context.Background(), mux, marshaler, rec, req, spec.decision)
+		if ok != spec.ok {
+			t.Errorf("ApplyDecision(%#v) = %v; want %v", spec.decision, ok, spec.ok)
+			continue
+		}
+		if ok {
+			if rec.Body.Len() > 0 {
+				t.Errorf("ApplyDecision(%#v) wrote %q; want nothing", spec.decision, rec.Body.String())
+			}
+			continue
+		}
+		if rec.Code != spec.code {
+			t.Errorf("ApplyDecision(%#v) wrote status %d; want %d", spec.decision, rec.Code, spec.code)
+		}
+		if got := strings.TrimSpace(rec.Body.String()); spec.body != "" && got != spec.body {
+			t.Errorf("ApplyDecision(%#v) wrote %q; want %q", spec.decision, got, spec.body)
+		}
+		if got := rec.Header().Get("Location"); got != spec.location {
+			t.Errorf("ApplyDecision(%#v) redirected to %q; want %q", spec.decision, got, spec.location)
+		}
+	}
+}
+
+func TestGatewayApplyDecisionContinue(t *testing.T) {
+	g := NewGateway(WithOutboundMetadataAllowlist("tenant"))
+	base := context.WithValue(context.Background(), ctxKey{}, "v")
+	d := Continue().WithContext(base).WithMetadata("tenant", "t1", "dropped", "x")
+
+	ctx, ok := g.ApplyDecision(context.Background(), grpcgw.NewServeMux(), &grpcgw.JSONPb{}, httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), d)
+	if !ok {
+		t.Fatalf("ApplyDecision(Continue()) = false; want true")
+	}
+	if got := ctx.Value(ctxKey{}); got != "v" {
+		t.Errorf("ctx.Value(ctxKey{}) = %v; want %q", got, "v")
+	}
+	ctx, err := g.ApplyMetadata(ctx, httptest.NewRequest("GET", "/", nil), &Route{})
+	if err != nil {
+		t.Fatalf("ApplyMetadata() failed with %v; want success", err)
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if want := metadata.Pairs("tenant", "t1"); !reflect.DeepEqual(md, want) {
+		t.Errorf("outgoing metadata = %v; want %v", md, want)
+	}
+}
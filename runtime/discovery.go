@@ -0,0 +1,520 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/resolver"
+)
+
+// Discovery maps the target services to their addresses, which may change over time.
+// The services are named as in the methods passed to the callbacks of the generated
+// code, "package.Service", e.g. "zqproto.Authorize".
+type Discovery interface {
+	// Watch calls "update" with the addresses of "service" now and whenever they change,
+	// until the returned function is called.
+	Watch(service string, update func(addrs []string)) (stop func(), err error)
+}
+
+// lookupAddrs returns the addresses of "service" in "all", falling back to
+// its name without the package, e.g. "Authorize" for "zqproto.Authorize".
+func lookupAddrs(all map[string][]string, service string) ([]string, bool) {
+	if addrs, ok := all[service]; ok {
+		return addrs, true
+	}
+	if i := strings.LastIndex(service, "."); i >= 0 {
+		addrs, ok := all[service[i+1:]]
+		return addrs, ok
+	}
+	return nil, false
+}
+
+// StaticDiscovery is a Discovery with fixed addresses, keyed by the service names
+// with or without the package.
+type StaticDiscovery map[string][]string
+
+// Watch calls "update" once with the addresses of "service".
+func (d StaticDiscovery) Watch(service string, update func(addrs []string)) (func(), error) {
+	addrs, ok := lookupAddrs(d, service)
+	if !ok {
+		return nil, fmt.Errorf("no addresses of service %s", service)
+	}
+	update(addrs)
+	return func() {}, nil
+}
+
+// discoveryWatchers notifies the watchers of the services whose addresses change.
+type discoveryWatchers struct {
+	mu       sync.Mutex
+	all      map[string][]string
+	watchers map[*discoveryWatcher]struct{}
+}
+
+type discoveryWatcher struct {
+	service string
+	update  func(addrs []string)
+	addrs   []string
+}
+
+func (ws *discoveryWatchers) watch(service string, update func(addrs []string)) (func(), error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	addrs, ok := lookupAddrs(ws.all, service)
+	if !ok {
+		return nil, fmt.Errorf("no addresses of service %s", service)
+	}
+	w := &discoveryWatcher{service: service, update: update, addrs: addrs}
+	if ws.watchers == nil {
+		ws.watchers = make(map[*discoveryWatcher]struct{})
+	}
+	ws.watchers[w] = struct{}{}
+	update(addrs)
+	return func() {
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		delete(ws.watchers, w)
+	}, nil
+}
+
+// set replaces all the addresses. The services which disappear keep their last addresses.
+func (ws *discoveryWatchers) set(all map[string][]string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.all = all
+	for w := range ws.watchers {
+		addrs, ok := lookupAddrs(all, w.service)
+		if !ok || reflect.DeepEqual(addrs, w.addrs) {
+			continue
+		}
+		w.addrs = addrs
+		w.update(addrs)
+	}
+}
+
+// FileDiscovery is a Discovery reading the addresses from a JSON or YAML file,
+// which is reloaded when it changes, e.g.
+//   zqproto.Authorize:
+//     - 10.0.0.1:9090
+//     - 10.0.0.2:9090
+//   Im: [10.0.0.3:9090]
+type FileDiscovery struct {
+	watchers discoveryWatchers
+	file     *fileWatcher
+}
+
+// DefaultDiscoveryInterval is how often FileDiscovery and DNSSRVDiscovery check for changes by default.
+const DefaultDiscoveryInterval = 5 * time.Second
+
+// NewFileDiscovery loads the addresses in "path" and checks it for changes
+// every "interval", DefaultDiscoveryInterval if 0, until Close is called.
+// A file which fails to load on a change is logged and the last addresses are kept.
+func NewFileDiscovery(path string, interval time.Duration) (*FileDiscovery, error) {
+	if interval <= 0 {
+		interval = DefaultDiscoveryInterval
+	}
+	d := &FileDiscovery{}
+	file, err := newFileWatcher(path, interval, d.load)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load service addresses: %v", err)
+	}
+	d.file = file
+	return d, nil
+}
+
+// Watch calls "update" with the addresses of "service" now and after each change of the file.
+func (d *FileDiscovery) Watch(service string, update func(addrs []string)) (func(), error) {
+	return d.watchers.watch(service, update)
+}
+
+// Close stops checking the file for changes.
+func (d *FileDiscovery) Close() {
+	d.file.close()
+}
+
+func (d *FileDiscovery) load(data []byte) error {
+	var all map[string][]string
+	if err := yaml.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for service, addrs := range all {
+		sort.Strings(addrs)
+		for _, addr := range addrs {
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				return fmt.Errorf("bad address %q of service %s: %v", addr, service, err)
+			}
+		}
+	}
+	d.watchers.set(all)
+	return nil
+}
+
+// fileWatcher loads a file, and reloads it whenever its modification time or size changes.
+type fileWatcher struct {
+	path    string
+	load    func(data []byte) error
+	modTime time.Time
+	size    int64
+	done    chan struct{}
+	once    sync.Once
+}
+
+// newFileWatcher loads "path" with "load" and checks it for changes every "interval" until closed.
+// A file which fails to load on a change is logged, and "load" should keep the last state then.
+func newFileWatcher(path string, interval time.Duration, load func(data []byte) error) (*fileWatcher, error) {
+	w := &fileWatcher{path: path, load: load, done: make(chan struct{})}
+	if _, err := w.reload(); err != nil {
+		return nil, err
+	}
+	go w.reloadLoop(interval)
+	return w, nil
+}
+
+func (w *fileWatcher) close() {
+	w.once.Do(func() { close(w.done) })
+}
+
+func (w *fileWatcher) reloadLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if _, err := w.reload(); err != nil {
+				grpclog.Warningf("Failed to reload '%v': %v", w.path, err)
+			}
+		}
+	}
+}
+
+// reload loads the file if it has changed since the last load, and reports whether it has.
+func (w *fileWatcher) reload() (bool, error) {
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return false, err
+	}
+	if fi.ModTime().Equal(w.modTime) && fi.Size() == w.size {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return false, err
+	}
+	if err := w.load(data); err != nil {
+		return false, fmt.Errorf("failed to parse '%v': %v", w.path, err)
+	}
+	w.modTime, w.size = fi.ModTime(), fi.Size()
+	return true, nil
+}
+
+// DNSSRVDiscovery is a Discovery looking up the DNS SRV records of the services.
+type DNSSRVDiscovery struct {
+	// Names maps the service names, with or without the package, to the SRV names,
+	// e.g. "_grpc._tcp.im.default.svc.cluster.local".
+	Names map[string]string
+	// Interval is how often the records are looked up, DefaultDiscoveryInterval if 0.
+	Interval time.Duration
+	// Resolver looks up the records, net.DefaultResolver if nil.
+	Resolver *net.Resolver
+
+	lookupSRV func(ctx context.Context, name string) ([]*net.SRV, error)
+}
+
+func (d *DNSSRVDiscovery) lookup(ctx context.Context, name string) ([]string, error) {
+	lookupSRV := d.lookupSRV
+	if lookupSRV == nil {
+		r := d.Resolver
+		if r == nil {
+			r = net.DefaultResolver
+		}
+		lookupSRV = func(ctx context.Context, name string) ([]*net.SRV, error) {
+			_, srvs, err := r.LookupSRV(ctx, "", "", name)
+			return srvs, err
+		}
+	}
+	srvs, err := lookupSRV(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// Watch looks up the SRV records of "service" now and every Interval.
+// A failed lookup after the first one is logged and the last addresses are kept.
+func (d *DNSSRVDiscovery) Watch(service string, update func(addrs []string)) (func(), error) {
+	name, ok := d.Names[service]
+	if !ok {
+		if i := strings.LastIndex(service, "."); i >= 0 {
+			name, ok = d.Names[service[i+1:]]
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("no SRV name of service %s", service)
+	}
+	addrs, err := d.lookup(context.Background(), name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up SRV %s of service %s: %v", name, service, err)
+	}
+	update(addrs)
+
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultDiscoveryInterval
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			next, err := d.lookup(context.Background(), name)
+			if err != nil {
+				grpclog.Warningf("Failed to look up SRV %s of service %s: %v", name, service, err)
+				continue
+			}
+			if !reflect.DeepEqual(next, addrs) {
+				addrs = next
+				update(addrs)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+// NewDiscoveryResolverBuilder returns a gRPC resolver builder of "scheme", resolving the targets
+// "<scheme>:///<service>" with "d". It should be registered with resolver.Register.
+func NewDiscoveryResolverBuilder(scheme string, d Discovery) resolver.Builder {
+	return &discoveryResolverBuilder{scheme: scheme, discovery: d}
+}
+
+type discoveryResolverBuilder struct {
+	scheme    string
+	discovery Discovery
+}
+
+func (b *discoveryResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOption) (resolver.Resolver, error) {
+	return watchResolver(b.discovery, target.Endpoint, cc)
+}
+
+// watchResolver returns a resolver updating "cc" with the addresses of "service" found by "d".
+func watchResolver(d Discovery, service string, cc resolver.ClientConn) (resolver.Resolver, error) {
+	stop, err := d.Watch(service, func(addrs []string) {
+		state := resolver.State{Addresses: make([]resolver.Address, 0, len(addrs))}
+		for _, addr := range addrs {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+		}
+		cc.UpdateState(state)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &discoveryResolver{stop: stop}, nil
+}
+
+func (b *discoveryResolverBuilder) Scheme() string {
+	return b.scheme
+}
+
+type discoveryResolver struct {
+	stop func()
+}
+
+func (*discoveryResolver) ResolveNow(resolver.ResolveNowOption) {}
+
+func (r *discoveryResolver) Close() {
+	r.stop()
+}
+
+// ConnFunc returns the function making the connections of the generated handlers:
+// "getClientConn" if not nil, or else a dial to the address returned by "getEndpoint" with "opts",
+// closed after each call.
+func ConnFunc(opts []grpc.DialOption, getEndpoint func(string) string, getClientConn func(string) (*grpc.ClientConn, func(), error)) func(meth string) (*grpc.ClientConn, func(), error) {
+	return func(meth string) (*grpc.ClientConn, func(), error) {
+		if getClientConn != nil {
+			return getClientConn(meth)
+		}
+		addr := getEndpoint(meth)
+		conn, err := grpc.Dial(addr, opts...)
+		return conn, func() { conn.Close() }, err
+	}
+}
+
+// poolScheme is the scheme of the targets dialed by the pools, "httpgw-pool://<pool id>/<service>".
+// It is registered once, the pools are found by the authority of the targets.
+const poolScheme = "httpgw-pool"
+
+var (
+	registerPoolScheme sync.Once
+	poolsMu            sync.Mutex
+	pools              = make(map[string]*poolDiscovery)
+	poolIDs            int32
+)
+
+type poolResolverBuilder struct{}
+
+func (poolResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOption) (resolver.Resolver, error) {
+	poolsMu.Lock()
+	d, ok := pools[target.Authority]
+	poolsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no open connection pool %q", target.Authority)
+	}
+	return watchResolver(d, target.Endpoint, cc)
+}
+
+func (poolResolverBuilder) Scheme() string {
+	return poolScheme
+}
+
+// ConnPool keeps one gRPC connection per target service, whose addresses are resolved
+// by a Discovery and balanced with round robin unless another balancer is dialed with.
+// Its GetClientConn method is the "getClientConn" callback of the generated Register functions.
+type ConnPool struct {
+	id   string
+	opts []grpc.DialOption
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+
+	// addrsMu is apart from mu, which is held while the resolvers are built.
+	addrsMu sync.Mutex
+	addrs   map[string][]string
+}
+
+// NewConnPool returns a pool dialing the services found by "d" with "opts".
+// All the pools share one gRPC resolver scheme; a pool is removed from it by Close.
+func NewConnPool(d Discovery, opts ...grpc.DialOption) *ConnPool {
+	registerPoolScheme.Do(func() {
+		resolver.Register(poolResolverBuilder{})
+	})
+	p := &ConnPool{
+		id:    fmt.Sprintf("p%d", atomic.AddInt32(&poolIDs, 1)),
+		opts:  append([]grpc.DialOption{grpc.WithBalancerName(roundrobin.Name)}, opts...),
+		conns: make(map[string]*grpc.ClientConn),
+		addrs: make(map[string][]string),
+	}
+	poolsMu.Lock()
+	pools[p.id] = &poolDiscovery{Discovery: d, pool: p}
+	poolsMu.Unlock()
+	return p
+}
+
+// poolDiscovery records the addresses of the services into the pool.
+type poolDiscovery struct {
+	Discovery
+	pool *ConnPool
+}
+
+func (d *poolDiscovery) Watch(service string, update func(addrs []string)) (func(), error) {
+	return d.Discovery.Watch(service, func(addrs []string) {
+		d.pool.addrsMu.Lock()
+		d.pool.addrs[service] = append([]string(nil), addrs...)
+		d.pool.addrsMu.Unlock()
+		update(addrs)
+	})
+}
+
+// GetClientConn returns the connection to the service of "meth" in the form of
+// "package.Service/Method". The returned function does nothing, the connection is
+// closed by Close.
+func (p *ConnPool) GetClientConn(meth string) (*grpc.ClientConn, func(), error) {
+	service := meth
+	if i := strings.Index(meth, "/"); i >= 0 {
+		service = meth[:i]
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if conn, ok := p.conns[service]; ok {
+		return conn, func() {}, nil
+	}
+	conn, err := grpc.Dial(poolScheme+"://"+p.id+"/"+service, p.opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.conns[service] = conn
+	return conn, func() {}, nil
+}
+
+// Conns returns the connections of the pool by service.
+func (p *ConnPool) Conns() map[string]*grpc.ClientConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conns := make(map[string]*grpc.ClientConn, len(p.conns))
+	for service, conn := range p.conns {
+		conns[service] = conn
+	}
+	return conns
+}
+
+// ConnState is the state of a connection of a ConnPool.
+type ConnState struct {
+	// Service is the target service in the form of "package.Service".
+	Service string `json:"service"`
+	// Target is the dialed target.
+	Target string `json:"target"`
+	// State is the connectivity state of the connection, e.g. "READY".
+	State string `json:"state"`
+	// Addrs are the addresses of the service last found by the Discovery.
+	Addrs []string `json:"addrs"`
+}
+
+// States returns the states of the connections of the pool, sorted by service.
+func (p *ConnPool) States() []ConnState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addrsMu.Lock()
+	defer p.addrsMu.Unlock()
+	states := make([]ConnState, 0, len(p.conns))
+	for service, conn := range p.conns {
+		states = append(states, ConnState{
+			Service: service,
+			Target:  conn.Target(),
+			State:   conn.GetState().String(),
+			Addrs:   append([]string(nil), p.addrs[service]...),
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Service < states[j].Service })
+	return states
+}
+
+// Close closes all the connections of the pool and removes it from the resolver scheme.
+func (p *ConnPool) Close() error {
+	poolsMu.Lock()
+	delete(pools, p.id)
+	poolsMu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var firstErr error
+	for service, conn := range p.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(p.conns, service)
+	}
+	return firstErr
+}
@@ -0,0 +1,230 @@
+package runtime
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+func TestStaticDiscovery(t *testing.T) {
+	d := StaticDiscovery{"Authorize": {"10.0.0.1:9090"}, "zqproto.Im": {"10.0.0.2:9090"}}
+	for service, want := range map[string][]string{
+		"zqproto.Authorize": {"10.0.0.1:9090"},
+		"zqproto.Im":        {"10.0.0.2:9090"},
+	} {
+		var got []string
+		if _, err := d.Watch(service, func(addrs []string) { got = addrs }); err != nil {
+			t.Errorf("Watch(%q) failed with %v; want success", service, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("Watch(%q) updated with %q; want %q", service, got, want)
+		}
+	}
+	if _, err := d.Watch("zqproto.Missing", func([]string) {}); err == nil {
+		t.Errorf("Watch(%q) succeeded; want failure", "zqproto.Missing")
+	}
+}
+
+func writeDiscoveryFile(t *testing.T, path, src string) {
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// make sure the modification time changes on coarse file systems.
+	mtime := time.Now().Add(time.Duration(len(src)) * time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitAddrs(t *testing.T, updates <-chan []string, want []string) {
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-updates:
+			if reflect.DeepEqual(got, want) {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("no update with %q", want)
+		}
+	}
+}
+
+func TestFileDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "services.yaml")
+	writeDiscoveryFile(t, path, "zqproto.Authorize:\n  - 10.0.0.2:9090\n  - 10.0.0.1:9090\nIm: [10.0.0.3:9090]\n")
+	d, err := NewFileDiscovery(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewFileDiscovery() failed with %v; want success", err)
+	}
+	defer d.Close()
+
+	updates := make(chan []string, 10)
+	stop, err := d.Watch("zqproto.Authorize", func(addrs []string) { updates <- addrs })
+	if err != nil {
+		t.Fatalf("Watch() failed with %v; want success", err)
+	}
+	waitAddrs(t, updates, []string{"10.0.0.1:9090", "10.0.0.2:9090"})
+
+	// a broken file keeps the last addresses.
+	writeDiscoveryFile(t, path, "zqproto.Authorize: [10.0.0.1]\n")
+	writeDiscoveryFile(t, path, `{"zqproto.Authorize": ["10.0.0.4:9090"], "Im": ["10.0.0.3:9090"]}`)
+	waitAddrs(t, updates, []string{"10.0.0.4:9090"})
+
+	stop()
+	writeDiscoveryFile(t, path, `{"zqproto.Authorize": ["10.0.0.5:9090", "10.0.0.6:9090"]}`)
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case addrs := <-updates:
+		t.Errorf("update with %q after stop; want none", addrs)
+	default:
+	}
+
+	if _, err := NewFileDiscovery(filepath.Join(dir, "missing.yaml"), 0); err == nil {
+		t.Errorf("NewFileDiscovery() with a missing file succeeded; want failure")
+	}
+}
+
+func TestDNSSRVDiscovery(t *testing.T) {
+	records := make(chan []*net.SRV, 1)
+	records <- []*net.SRV{{Target: "im-1.im.svc.", Port: 9090}, {Target: "im-0.im.svc.", Port: 9090}}
+	var last []*net.SRV
+	d := &DNSSRVDiscovery{
+		Names:    map[string]string{"Im": "_grpc._tcp.im.svc"},
+		Interval: 10 * time.Millisecond,
+		lookupSRV: func(ctx context.Context, name string) ([]*net.SRV, error) {
+			if name != "_grpc._tcp.im.svc" {
+				t.Errorf("lookupSRV(%q); want %q", name, "_grpc._tcp.im.svc")
+			}
+			select {
+			case last = <-records:
+			default:
+			}
+			return last, nil
+		},
+	}
+	updates := make(chan []string, 10)
+	stop, err := d.Watch("zqproto.Im", func(addrs []string) { updates <- addrs })
+	if err != nil {
+		t.Fatalf("Watch() failed with %v; want success", err)
+	}
+	defer stop()
+	waitAddrs(t, updates, []string{"im-0.im.svc:9090", "im-1.im.svc:9090"})
+	records <- []*net.SRV{{Target: "im-2.im.svc.", Port: 9091}}
+	waitAddrs(t, updates, []string{"im-2.im.svc:9091"})
+
+	if _, err := d.Watch("zqproto.Authorize", func([]string) {}); err == nil {
+		t.Errorf("Watch(%q) succeeded; want failure", "zqproto.Authorize")
+	}
+}
+
+// startHealthServer starts a gRPC server reporting "name" as serving.
+func startHealthServer(t *testing.T, name string) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, hs)
+	go s.Serve(lis)
+	return lis.Addr().String(), s.Stop
+}
+
+func TestConnPool(t *testing.T) {
+	addrA, stopA := startHealthServer(t, "a")
+	defer stopA()
+	addrB, stopB := startHealthServer(t, "b")
+	defer stopB()
+
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.json")
+	writeDiscoveryFile(t, path, `{"Health": ["`+addrA+`"]}`)
+	d, err := NewFileDiscovery(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewFileDiscovery() failed with %v; want success", err)
+	}
+	defer d.Close()
+
+	pool := NewConnPool(d, grpc.WithInsecure())
+	defer pool.Close()
+	conn, closeFunc, err := pool.GetClientConn("grpc.health.v1.Health/Check")
+	if err != nil {
+		t.Fatalf("GetClientConn() failed with %v; want success", err)
+	}
+	defer closeFunc()
+	if again, _, _ := pool.GetClientConn("grpc.health.v1.Health/Watch"); again != conn {
+		t.Errorf("GetClientConn() dialed the service twice; want one connection")
+	}
+
+	// the service "a" is only known by the server at addrA.
+	client := healthpb.NewHealthClient(conn)
+	check := func(name string) codes.Code {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: name}, grpc.WaitForReady(true))
+		return status.Code(err)
+	}
+	if code := check("a"); code != codes.OK {
+		t.Fatalf("Check(a) = %v; want OK", code)
+	}
+
+	writeDiscoveryFile(t, path, `{"Health": ["`+addrB+`"]}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for check("b") != codes.OK {
+		if time.Now().After(deadline) {
+			t.Fatalf("Check(b) never succeeded after the reload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := check("a"); code != codes.NotFound {
+		t.Errorf("Check(a) after the reload = %v; want NotFound", code)
+	}
+	if got := len(pool.Conns()); got != 1 {
+		t.Errorf("len(Conns()) = %d; want 1", got)
+	}
+	states := pool.States()
+	if len(states) != 1 || states[0].Service != "grpc.health.v1.Health" || states[0].State != "READY" || !reflect.DeepEqual(states[0].Addrs, []string{addrB}) {
+		t.Errorf("States() = %+v; want the READY connection to %s", states, addrB)
+	}
+}
+
+func TestConnPoolSharedScheme(t *testing.T) {
+	d := StaticDiscovery{"Health": {"127.0.0.1:1"}}
+	p1, p2 := NewConnPool(d, grpc.WithInsecure()), NewConnPool(d, grpc.WithInsecure())
+	if resolver.Get(poolScheme) == nil {
+		t.Fatalf("resolver.Get(%q) = nil; want the scheme of the pools", poolScheme)
+	}
+	if p1.id == p2.id {
+		t.Errorf("the pools share the id %q; want one id per pool", p1.id)
+	}
+	p1.Close()
+	p2.Close()
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	if _, ok := pools[p1.id]; ok {
+		t.Errorf("pools[%q] is set after Close(); want the pool removed", p1.id)
+	}
+}
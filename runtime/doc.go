@@ -0,0 +1,7 @@
+// Package runtime contains the runtime support of the code generated by protoc-gen-grpc-httpgw.
+//
+// The generated Register*HandlerClient functions accept GatewayOption values
+// which configure the behaviours implemented here, e.g. the session subsystem.
+// Generated files import this package as "gwruntime" so that it does not collide
+// with github.com/grpc-ecosystem/grpc-gateway/runtime.
+package runtime
@@ -0,0 +1,166 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/status"
+)
+
+// Envelope wraps the JSON responses in an object like {"code": 0, "msg": "", "data": {...}}.
+// Replies, messages of server streams and errors are all wrapped.
+// Responses of other content types, e.g. application/octet-stream, are not.
+type Envelope struct {
+	// CodeField is the name of the code member, "code" if empty.
+	CodeField string
+	// MessageField is the name of the message member, "msg" if empty.
+	MessageField string
+	// DataField is the name of the member holding the reply, "data" if empty.
+	DataField string
+	// DetailsField is the name of the member holding the google.rpc.Status details of errors.
+	// The details are not written if empty.
+	DetailsField string
+	// SuccessCode is the code of the replies.
+	SuccessCode int
+	// SuccessMessage is the message of the replies.
+	SuccessMessage string
+	// Code maps the status of an error to the code of the envelope.
+	// The gRPC status code is used if nil.
+	Code func(st *status.Status) int
+	// Message maps the status of an error to the message of the envelope.
+	// The status message is used if nil.
+	Message func(st *status.Status) string
+}
+
+// WithEnvelope wraps the JSON responses of the registered routes in "e".
+func WithEnvelope(e Envelope) GatewayOption {
+	return func(g *Gateway) {
+		if e.CodeField == "" {
+			e.CodeField = "code"
+		}
+		if e.MessageField == "" {
+			e.MessageField = "msg"
+		}
+		if e.DataField == "" {
+			e.DataField = "data"
+		}
+		g.envelope = &e
+	}
+}
+
+// OutboundMarshaler returns the marshaler to write the responses with.
+// It wraps "m" in the envelope if it is enabled and "m" marshals JSON.
+func (g *Gateway) OutboundMarshaler(m grpcgw.Marshaler) grpcgw.Marshaler {
+	if g.envelope == nil || !strings.Contains(m.ContentType(), "json") {
+		return m
+	}
+	return &envelopeMarshaler{Marshaler: m, envelope: g.envelope}
+}
+
+// unwrapMarshaler returns the marshaler wrapped by OutboundMarshaler.
+func unwrapMarshaler(m grpcgw.Marshaler) grpcgw.Marshaler {
+	if em, ok := m.(*envelopeMarshaler); ok {
+		return em.Marshaler
+	}
+	return m
+}
+
+type envelopeMarshaler struct {
+	grpcgw.Marshaler
+	envelope *Envelope
+	// st is the status of the error written by Gateway.HTTPError, nil for the replies.
+	st *status.Status
+}
+
+// failing returns the marshaler of the error body of "st".
+func (m *envelopeMarshaler) failing(st *status.Status) *envelopeMarshaler {
+	return &envelopeMarshaler{Marshaler: m.Marshaler, envelope: m.envelope, st: st}
+}
+
+// streamErrorChunk is the error payload of server streams, i.e. runtime.StreamError.
+type streamErrorChunk interface {
+	GetGrpcCode() int32
+	GetMessage() string
+	GetDetails() []*any.Any
+}
+
+// Marshal wraps "v" in the envelope. "v" is one of
+//   - a reply message,
+//   - a chunk of a server stream, map[string]proto.Message{"result": msg} or {"error": err},
+//   - the error body of runtime.DefaultHTTPError, replaced by the one of the status given by Gateway.HTTPError.
+func (m *envelopeMarshaler) Marshal(v interface{}) ([]byte, error) {
+	if m.st != nil {
+		return m.failure(m.st)
+	}
+	if chunk, ok := v.(map[string]proto.Message); ok {
+		if result, ok := chunk["result"]; ok {
+			return m.success(result)
+		}
+		if serr, ok := chunk["error"].(streamErrorChunk); ok {
+			return m.failure(status.FromProto(&spb.Status{
+				Code:    serr.GetGrpcCode(),
+				Message: serr.GetMessage(),
+				Details: serr.GetDetails(),
+			}))
+		}
+	}
+	return m.success(v)
+}
+
+func (m *envelopeMarshaler) success(data interface{}) ([]byte, error) {
+	buf, err := m.Marshaler.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return m.write(m.envelope.SuccessCode, m.envelope.SuccessMessage, json.RawMessage(buf), nil)
+}
+
+func (m *envelopeMarshaler) failure(st *status.Status) ([]byte, error) {
+	code := int(st.Code())
+	if m.envelope.Code != nil {
+		code = m.envelope.Code(st)
+	}
+	msg := st.Message()
+	if m.envelope.Message != nil {
+		msg = m.envelope.Message(st)
+	}
+	var details json.RawMessage
+	if m.envelope.DetailsField != "" && len(st.Proto().GetDetails()) > 0 {
+		buf, err := m.Marshaler.Marshal(st.Proto().GetDetails())
+		if err != nil {
+			return nil, err
+		}
+		details = buf
+	}
+	return m.write(code, msg, nil, details)
+}
+
+func (m *envelopeMarshaler) write(code int, msg string, data, details json.RawMessage) ([]byte, error) {
+	body := map[string]interface{}{
+		m.envelope.CodeField:    code,
+		m.envelope.MessageField: msg,
+	}
+	if data != nil {
+		body[m.envelope.DataField] = data
+	}
+	if details != nil {
+		body[m.envelope.DetailsField] = details
+	}
+	return marshalJSONObject(body)
+}
+
+// marshalJSONObject marshals "body" without escaping HTML characters, unlike json.Marshal.
+func marshalJSONObject(body map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(body); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
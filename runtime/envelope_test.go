@@ -0,0 +1,99 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func decodeJSON(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("json.Unmarshal(%q) failed with %v; want success", s, err)
+	}
+	return v
+}
+
+func TestEnvelope(t *testing.T) {
+	g := NewGateway(WithEnvelope(Envelope{
+		MessageField:   "message",
+		DetailsField:   "details",
+		SuccessMessage: "ok",
+		Code: func(st *status.Status) int {
+			for _, d := range st.Details() {
+				if pf, ok := d.(*errdetails.PreconditionFailure); ok && pf.Violations[0].Type == "ROOM_CLOSED" {
+					return 4001
+				}
+			}
+			return 1000 + int(st.Code())
+		},
+	}))
+	mux := grpcgw.NewServeMux()
+	ctx := grpcgw.NewServerMetadataContext(context.Background(), grpcgw.ServerMetadata{})
+	req := httptest.NewRequest("GET", "/", nil)
+	m := g.OutboundMarshaler(&grpcgw.JSONPb{OrigName: true})
+
+	if got := g.OutboundMarshaler(&grpcgw.ProtoMarshaller{}); !reflect.DeepEqual(got, &grpcgw.ProtoMarshaller{}) {
+		t.Errorf("OutboundMarshaler(ProtoMarshaller) = %#v; want it unwrapped", got)
+	}
+	if got := NewGateway().OutboundMarshaler(&grpcgw.JSONPb{}); !reflect.DeepEqual(got, &grpcgw.JSONPb{}) {
+		t.Errorf("OutboundMarshaler() without envelope = %#v; want it unwrapped", got)
+	}
+
+	rec := httptest.NewRecorder()
+	grpcgw.ForwardResponseMessage(ctx, mux, m, rec, req, &descriptor.FieldDescriptorProto{Name: proto.String("uid")})
+	want := decodeJSON(t, `{"code":0,"message":"ok","data":{"name":"uid"}}`)
+	if got := decodeJSON(t, rec.Body.String()); !reflect.DeepEqual(got, want) {
+		t.Errorf("reply = %v; want %v", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	st, err := status.New(codes.FailedPrecondition, "room closed").WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{Type: "ROOM_CLOSED"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.HTTPError(ctx, mux, m, rec, req, st.Err())
+	want = decodeJSON(t, `{"code":4001,"message":"room closed","details":[{"@type":"type.googleapis.com/google.rpc.PreconditionFailure","violations":[{"type":"ROOM_CLOSED"}]}]}`)
+	if got := decodeJSON(t, rec.Body.String()); !reflect.DeepEqual(got, want) {
+		t.Errorf("error = %v; want %v", got, want)
+	}
+	if rec.Code != 400 {
+		t.Errorf("error status = %d; want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	msgs := []proto.Message{&descriptor.FieldDescriptorProto{Name: proto.String("m1")}}
+	recv := func() (proto.Message, error) {
+		if len(msgs) == 0 {
+			return nil, status.Error(codes.NotFound, "gone")
+		}
+		msg := msgs[0]
+		msgs = msgs[1:]
+		return msg, nil
+	}
+	grpcgw.ForwardResponseStream(ctx, mux, m, rec, req, recv)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("stream = %q; want 2 chunks", rec.Body.String())
+	}
+	for i, want := range []string{
+		`{"code":0,"message":"ok","data":{"name":"m1"}}`,
+		`{"code":1005,"message":"gone"}`,
+	} {
+		if got, want := decodeJSON(t, lines[i]), decodeJSON(t, want); !reflect.DeepEqual(got, want) {
+			t.Errorf("chunk %d = %v; want %v", i, got, want)
+		}
+	}
+}
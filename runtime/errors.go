@@ -0,0 +1,282 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProblemContentType is the content type of the RFC 7807 error bodies.
+const ProblemContentType = "application/problem+json"
+
+// ErrorConfig customizes how the errors of the calls are written.
+type ErrorConfig struct {
+	// Status maps gRPC codes to HTTP statuses. The codes not in it are mapped
+	// by runtime.HTTPStatusFromCode.
+	Status map[codes.Code]int
+	// Problem writes the errors of JSON requests as RFC 7807 application/problem+json.
+	// It takes precedence over the envelope.
+	Problem bool
+	// ProblemType is the prefix of the "type" member of the problem bodies, followed by
+	// the ErrorInfo reason or the gRPC code name. The type is "about:blank" if empty.
+	ProblemType string
+	// Production hides the messages of the Internal and Unknown errors.
+	Production bool
+}
+
+// errorConfigFile is the YAML form of ErrorConfig, e.g.
+//
+//   status:
+//     NOT_FOUND: 404
+//     UNAVAILABLE: 503
+//   problem: true
+//   problem_type: https://zhanqi.tv/errors/
+//   production: true
+type errorConfigFile struct {
+	Status      map[string]int `json:"status"`
+	Problem     bool           `json:"problem"`
+	ProblemType string         `json:"problem_type"`
+	Production  bool           `json:"production"`
+}
+
+// LoadErrorConfigFromYAML loads an ErrorConfig from a YAML file.
+// The keys of "status" are the gRPC code names, e.g. NOT_FOUND.
+func LoadErrorConfigFromYAML(path string) (*ErrorConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error config from '%v': %v", path, err)
+	}
+	var file errorConfigFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse error config in '%v': %v", path, err)
+	}
+	cfg := &ErrorConfig{
+		Status:      make(map[codes.Code]int, len(file.Status)),
+		Problem:     file.Problem,
+		ProblemType: file.ProblemType,
+		Production:  file.Production,
+	}
+	for name, st := range file.Status {
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(fmt.Sprintf("%q", strings.ToUpper(name)))); err != nil {
+			return nil, fmt.Errorf("unknown gRPC code %s in '%v'", name, path)
+		}
+		if http.StatusText(st) == "" {
+			return nil, fmt.Errorf("unknown HTTP status %d of %s in '%v'", st, name, path)
+		}
+		cfg.Status[code] = st
+	}
+	return cfg, nil
+}
+
+// WithErrorConfig customizes the errors written by the registered routes.
+func WithErrorConfig(cfg ErrorConfig) GatewayOption {
+	return func(g *Gateway) {
+		g.errors = &cfg
+	}
+}
+
+// HTTPStatus returns the HTTP status of the gRPC code "code".
+func (g *Gateway) HTTPStatus(code codes.Code) int {
+	if g.errors != nil {
+		if st, ok := g.errors.Status[code]; ok {
+			return st
+		}
+	}
+	return grpcgw.HTTPStatusFromCode(code)
+}
+
+// HTTPError writes "err" with runtime.HTTPError, applying the ErrorConfig if any.
+func (g *Gateway) HTTPError(ctx context.Context, mux *grpcgw.ServeMux, marshaler grpcgw.Marshaler, w http.ResponseWriter, req *http.Request, err error) {
+	recordError(ctx, err)
+	st := g.errorStatus(err)
+	se, fixed := err.(*statusError)
+	if g.errors == nil {
+		if fixed {
+			w = &errorStatusWriter{ResponseWriter: w, status: se.status}
+		}
+		if em, ok := marshaler.(*envelopeMarshaler); ok {
+			marshaler = em.failing(st)
+		}
+		grpcgw.HTTPError(ctx, mux, marshaler, w, req, err)
+		return
+	}
+	code := g.HTTPStatus(st.Code())
+	if fixed {
+		code = se.status
+	}
+	if code != grpcgw.HTTPStatusFromCode(st.Code()) {
+		w = &errorStatusWriter{ResponseWriter: w, status: code}
+	}
+	if em, ok := marshaler.(*envelopeMarshaler); !ok || g.errors.Problem {
+		marshaler = &errorMarshaler{Marshaler: unwrapMarshaler(marshaler), config: g.errors, status: code, st: st}
+	} else {
+		marshaler = em.failing(st)
+	}
+	grpcgw.HTTPError(ctx, mux, marshaler, w, req, st.Err())
+}
+
+// errorStatus returns the gRPC status of "err" as written to the clients: without the message
+// of the Internal and Unknown errors in production.
+func (g *Gateway) errorStatus(err error) *status.Status {
+	st, ok := status.FromError(err)
+	if !ok {
+		st = status.New(codes.Unknown, err.Error())
+	}
+	if g.errors != nil && g.errors.Production && (st.Code() == codes.Internal || st.Code() == codes.Unknown) {
+		pb := proto.Clone(st.Proto()).(*spb.Status)
+		pb.Message = http.StatusText(http.StatusInternalServerError)
+		st = status.FromProto(pb)
+	}
+	return st
+}
+
+// statusError is a gRPC status error written with a fixed HTTP status, whatever the error mapping is.
+type statusError struct {
+	st     *status.Status
+	status int
+}
+
+func (e *statusError) Error() string {
+	return e.st.Err().Error()
+}
+
+// GRPCStatus returns the gRPC status of the error, for status.FromError.
+func (e *statusError) GRPCStatus() *status.Status {
+	return e.st
+}
+
+// errorStatusWriter writes "status" instead of the status chosen by runtime.HTTPError.
+type errorStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *errorStatusWriter) WriteHeader(int) {
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// errorMarshaler writes the error body of "st" with the typed details, or as an RFC 7807 problem,
+// in place of the body of runtime.DefaultHTTPError.
+type errorMarshaler struct {
+	grpcgw.Marshaler
+	config *ErrorConfig
+	status int
+	st     *status.Status
+}
+
+func (m *errorMarshaler) problem() bool {
+	return m.config.Problem && strings.Contains(m.Marshaler.ContentType(), "json")
+}
+
+func (m *errorMarshaler) ContentType() string {
+	if m.problem() {
+		return ProblemContentType
+	}
+	return m.Marshaler.ContentType()
+}
+
+// Marshal marshals the body of the error. The marshaler is made for a single error, so "v" is
+// the body of the same status written by runtime.DefaultHTTPError, and is only kept for non-JSON content types.
+func (m *errorMarshaler) Marshal(v interface{}) ([]byte, error) {
+	if !strings.Contains(m.Marshaler.ContentType(), "json") {
+		return m.Marshaler.Marshal(v)
+	}
+	st := m.st
+	body := make(map[string]interface{})
+	if m.problem() {
+		typ := "about:blank"
+		if m.config.ProblemType != "" {
+			typ = m.config.ProblemType + st.Code().String()
+		}
+		body["type"] = typ
+		body["title"] = http.StatusText(m.status)
+		body["status"] = m.status
+		body["detail"] = st.Message()
+		body["code"] = st.Code().String()
+		if info, ok := findErrorInfo(st.Proto().GetDetails()); ok && m.config.ProblemType != "" && info.Reason != "" {
+			body["type"] = m.config.ProblemType + info.Reason
+		}
+	} else {
+		body["error"] = st.Message()
+		body["message"] = st.Message()
+		body["code"] = int32(st.Code())
+	}
+	var others []*any.Any
+	for _, detail := range st.Proto().GetDetails() {
+		switch {
+		case ptypes.Is(detail, &errdetails.BadRequest{}):
+			var br errdetails.BadRequest
+			if err := ptypes.UnmarshalAny(detail, &br); err != nil {
+				return nil, err
+			}
+			var violations []map[string]string
+			for _, fv := range br.GetFieldViolations() {
+				violations = append(violations, map[string]string{"field": fv.GetField(), "description": fv.GetDescription()})
+			}
+			body["field_violations"] = violations
+		case detail.GetTypeUrl() == errorInfoTypeURL:
+			var info errorInfo
+			if err := proto.Unmarshal(detail.GetValue(), &info); err != nil {
+				return nil, err
+			}
+			body["reason"] = info.Reason
+			if info.Domain != "" {
+				body["domain"] = info.Domain
+			}
+			if len(info.Metadata) > 0 {
+				body["metadata"] = info.Metadata
+			}
+		default:
+			others = append(others, detail)
+		}
+	}
+	if len(others) > 0 {
+		buf, err := m.Marshaler.Marshal(others)
+		if err != nil {
+			return nil, err
+		}
+		body["details"] = json.RawMessage(buf)
+	}
+	return marshalJSONObject(body)
+}
+
+// errorInfoTypeURL is the type URL of google.rpc.ErrorInfo.
+const errorInfoTypeURL = "type.googleapis.com/google.rpc.ErrorInfo"
+
+// errorInfo mirrors google.rpc.ErrorInfo, which the vendored errdetails package predates.
+type errorInfo struct {
+	Reason   string            `protobuf:"bytes,1,opt,name=reason,proto3"`
+	Metadata map[string]string `protobuf:"bytes,2,rep,name=metadata,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Domain   string            `protobuf:"bytes,3,opt,name=domain,proto3"`
+}
+
+func (m *errorInfo) Reset()         { *m = errorInfo{} }
+func (m *errorInfo) String() string { return proto.CompactTextString(m) }
+func (*errorInfo) ProtoMessage()    {}
+
+func findErrorInfo(details []*any.Any) (*errorInfo, bool) {
+	for _, detail := range details {
+		if detail.GetTypeUrl() != errorInfoTypeURL {
+			continue
+		}
+		var info errorInfo
+		if err := proto.Unmarshal(detail.GetValue(), &info); err == nil {
+			return &info, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,173 @@
+package runtime
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testErrorWithDetails(t *testing.T, code codes.Code, msg string) error {
+	info, err := proto.Marshal(&errorInfo{Reason: "ROOM_CLOSED", Domain: "im.zhanqi.tv", Metadata: map[string]string{"room": "42"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	br, err := ptypes.MarshalAny(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "room_id", Description: "closed"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry, err := ptypes.MarshalAny(&errdetails.RetryInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status.FromProto(&spb.Status{
+		Code:    int32(code),
+		Message: msg,
+		Details: []*any.Any{{TypeUrl: errorInfoTypeURL, Value: info}, br, retry},
+	}).Err()
+}
+
+func TestGatewayHTTPError(t *testing.T) {
+	mux := grpcgw.NewServeMux()
+	ctx := grpcgw.NewServerMetadataContext(context.Background(), grpcgw.ServerMetadata{})
+	for _, spec := range []struct {
+		name        string
+		gw          *Gateway
+		err         error
+		code        int
+		contentType string
+		body        string
+	}{
+		{
+			name:        "upstream",
+			gw:          NewGateway(),
+			err:         status.Error(codes.NotFound, "no room"),
+			code:        404,
+			contentType: "application/json",
+			body:        `{"error":"no room","message":"no room","code":5}`,
+		},
+		{
+			name: "typed details",
+			gw: NewGateway(WithErrorConfig(ErrorConfig{
+				Status: map[codes.Code]int{codes.FailedPrecondition: 409},
+			})),
+			err:         testErrorWithDetails(t, codes.FailedPrecondition, "room closed"),
+			code:        409,
+			contentType: "application/json",
+			body: `{"error":"room closed","message":"room closed","code":9,
+				"reason":"ROOM_CLOSED","domain":"im.zhanqi.tv","metadata":{"room":"42"},
+				"field_violations":[{"field":"room_id","description":"closed"}],
+				"details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo"}]}`,
+		},
+		{
+			name: "problem",
+			gw: NewGateway(WithErrorConfig(ErrorConfig{
+				Problem:     true,
+				ProblemType: "https://zhanqi.tv/errors/",
+			})),
+			err:         testErrorWithDetails(t, codes.FailedPrecondition, "room closed"),
+			code:        400,
+			contentType: ProblemContentType,
+			body: `{"type":"https://zhanqi.tv/errors/ROOM_CLOSED","title":"Bad Request","status":400,
+				"detail":"room closed","code":"FailedPrecondition",
+				"reason":"ROOM_CLOSED","domain":"im.zhanqi.tv","metadata":{"room":"42"},
+				"field_violations":[{"field":"room_id","description":"closed"}],
+				"details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo"}]}`,
+		},
+		{
+			name:        "production",
+			gw:          NewGateway(WithErrorConfig(ErrorConfig{Problem: true, Production: true})),
+			err:         status.Error(codes.Internal, "sql: connection refused"),
+			code:        500,
+			contentType: ProblemContentType,
+			body:        `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"Internal Server Error","code":"Internal"}`,
+		},
+		{
+			name: "envelope",
+			gw: NewGateway(
+				WithEnvelope(Envelope{}),
+				WithErrorConfig(ErrorConfig{Status: map[codes.Code]int{codes.NotFound: 200}, Production: true}),
+			),
+			err:         status.Error(codes.Unknown, "panic"),
+			code:        500,
+			contentType: "application/json",
+			body:        `{"code":2,"msg":"Internal Server Error"}`,
+		},
+		{
+			name: "envelope mapped",
+			gw: NewGateway(
+				WithEnvelope(Envelope{}),
+				WithErrorConfig(ErrorConfig{Status: map[codes.Code]int{codes.NotFound: 200}}),
+			),
+			err:         status.Error(codes.NotFound, "no room"),
+			code:        200,
+			contentType: "application/json",
+			body:        `{"code":5,"msg":"no room"}`,
+		},
+	} {
+		rec := httptest.NewRecorder()
+		m := spec.gw.OutboundMarshaler(&grpcgw.JSONPb{OrigName: true})
+		spec.gw.HTTPError(ctx, mux, m, rec, httptest.NewRequest("GET", "/", nil), spec.err)
+		if rec.Code != spec.code {
+			t.Errorf("%s: status = %d; want %d", spec.name, rec.Code, spec.code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != spec.contentType {
+			t.Errorf("%s: Content-Type = %q; want %q", spec.name, got, spec.contentType)
+		}
+		if got, want := decodeJSON(t, rec.Body.String()), decodeJSON(t, spec.body); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: body = %v; want %v", spec.name, got, want)
+		}
+	}
+}
+
+func TestLoadErrorConfigFromYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "errors.yaml")
+	src := "status:\n  NOT_FOUND: 404\n  unavailable: 503\n  INVALID_ARGUMENT: 422\nproblem: true\nproduction: true\n"
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadErrorConfigFromYAML(path)
+	if err != nil {
+		t.Fatalf("LoadErrorConfigFromYAML() failed with %v; want success", err)
+	}
+	want := &ErrorConfig{
+		Status:     map[codes.Code]int{codes.NotFound: 404, codes.Unavailable: 503, codes.InvalidArgument: 422},
+		Problem:    true,
+		Production: true,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("LoadErrorConfigFromYAML() = %#v; want %#v", cfg, want)
+	}
+	if got := NewGateway(WithErrorConfig(*cfg)).HTTPStatus(codes.InvalidArgument); got != 422 {
+		t.Errorf("HTTPStatus(InvalidArgument) = %d; want 422", got)
+	}
+
+	for _, src := range []string{"status:\n  NOPE: 404\n", "status:\n  NOT_FOUND: 999\n"} {
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadErrorConfigFromYAML(path); err == nil {
+			t.Errorf("LoadErrorConfigFromYAML() with %q succeeded; want failure", src)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package runtime
+
+// StreamingKind tells which sides of a method stream.
+type StreamingKind string
+
+const (
+	// StreamingUnary methods take and return one message.
+	StreamingUnary StreamingKind = "unary"
+	// StreamingClient methods take a stream of messages.
+	StreamingClient StreamingKind = "client"
+	// StreamingServer methods return a stream of messages.
+	StreamingServer StreamingKind = "server"
+	// StreamingBidi methods take and return streams of messages.
+	StreamingBidi StreamingKind = "bidi"
+)
+
+// Route describes a route registered by the generated code and the options
+// parsed from the comment tags of its method.
+// The generated files export the routes of each service as {Service}Routes.
+type Route struct {
+	// Service is the gateway service in the form of "package.Service".
+	Service string
+	// HTTPMethod is the HTTP method of the route, e.g. "POST".
+	HTTPMethod string
+	// Path is the path template of the route, e.g. "/v1/rooms/{room_id}".
+	Path string
+	// Body is the "body" of the http rule: empty if none, "*" for the whole request message,
+	// or else a field path.
+	Body string
+	// ResponseBody is the "response_body" of the http rule, empty for the whole response message.
+	ResponseBody string
+	// Method is the target method in the form of "package.Service/Method".
+	Method string
+	// Streaming tells which sides of the target method stream.
+	Streaming StreamingKind
+	// Session is the role of the route in the session subsystem.
+	Session SessionRole
+	// Auth tells whether the route requires an authenticated caller.
+	Auth AuthMode
+	// Scopes are the scopes the caller must be granted all of.
+	Scopes []string
+	// Roles are the roles the caller must have one of.
+	Roles []string
+	// Metadata are the headers and cookies forwarded as gRPC metadata.
+	Metadata []MetadataMapping
+	// ResponseHeaders are the fields of the response written into HTTP headers.
+	ResponseHeaders []ResponseHeader
+	// Status is the HTTP status of the successful responses, 200 if 0.
+	Status int
+	// StatusField is the field of the response holding the HTTP status.
+	// It takes precedence over Status unless its value is 0.
+	StatusField string
+	// OmitStatusField removes StatusField from the response body.
+	OmitStatusField bool
+	// HashKey is the source of the key routing the calls to the same endpoint.
+	HashKey HashKey
+	// Uploads are the file parts of the multipart/form-data requests mapped to bytes fields.
+	Uploads []Upload
+}
+
+// Gateway holds the runtime configuration shared by the routes registered
+// within one Register*HandlerClient call.
+type Gateway struct {
+	sessions          *SessionManager
+	authenticator     Authenticator
+	metadataMappings  []MetadataMapping
+	metadataAllowlist []string
+	requestHooks      []RequestHook
+	responseHooks     []ResponseHook
+	envelope          *Envelope
+	errors            *ErrorConfig
+	routeStates       RouteStates
+	admin             *Admin
+	compression       *Compression
+	batch             *Batch
+	jsonrpc           *JSONRPCServer
+}
+
+// GatewayOption configures a Gateway.
+type GatewayOption func(*Gateway)
+
+// NewGateway returns a new Gateway configured with "opts".
+func NewGateway(opts ...GatewayOption) *Gateway {
+	g := &Gateway{}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// WithSessionManager enables the session subsystem for the registered routes.
+func WithSessionManager(m *SessionManager) GatewayOption {
+	return func(g *Gateway) {
+		g.sessions = m
+	}
+}
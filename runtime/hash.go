@@ -0,0 +1,230 @@
+package runtime
+
+import (
+	"context"
+	"hash/crc32"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// HashKeySource is the part of the call a HashKey reads from.
+type HashKeySource string
+
+const (
+	// HashKeyFromField reads a scalar field of the request message, e.g. "user.uid".
+	HashKeyFromField HashKeySource = "field"
+	// HashKeyFromPath reads a path parameter.
+	HashKeyFromPath HashKeySource = "path"
+	// HashKeyFromHeader reads a request header.
+	HashKeyFromHeader HashKeySource = "header"
+	// HashKeyFromCookie reads a request cookie.
+	HashKeyFromCookie HashKeySource = "cookie"
+	// HashKeyFromSession reads a value of the session.
+	HashKeyFromSession HashKeySource = "session"
+)
+
+// HashKey is the source of the key routing the calls of a route to the same endpoint.
+// It is declared with the "@hashkey" comment tag of the service or the method.
+// The key is carried by the context of the gRPC call, where the balancer
+// registered as HashBalancerName reads it.
+type HashKey struct {
+	Source HashKeySource
+	Name   string
+}
+
+type hashKeyKey struct{}
+
+// hashKeyHolder is filled in by HookRequest for the keys read from the request message,
+// which is decoded after the context of the call is made.
+type hashKeyHolder struct {
+	key string
+	set bool
+}
+
+// NewHashKeyContext returns a context carrying "key" to the consistent hash balancer.
+func NewHashKeyContext(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyKey{}, &hashKeyHolder{key: key, set: true})
+}
+
+// HashKeyFromContext returns the hash key carried by "ctx" and whether there is one.
+func HashKeyFromContext(ctx context.Context) (string, bool) {
+	h, ok := ctx.Value(hashKeyKey{}).(*hashKeyHolder)
+	if !ok || !h.set {
+		return "", false
+	}
+	return h.key, true
+}
+
+// ApplyHashKey stores the hash key of "route" in the context of the call.
+// A missing value is not an error: the call is then routed to the least loaded endpoint.
+func (g *Gateway) ApplyHashKey(ctx context.Context, req *http.Request, pathParams map[string]string, route *Route) (context.Context, error) {
+	key := route.HashKey
+	var v string
+	switch key.Source {
+	case "":
+		return ctx, nil
+	case HashKeyFromField:
+		return context.WithValue(ctx, hashKeyKey{}, &hashKeyHolder{}), nil
+	case HashKeyFromPath:
+		v = pathParams[key.Name]
+	case HashKeyFromHeader:
+		v, _ = RequestValue(req, MetadataFromHeader, key.Name)
+	case HashKeyFromCookie:
+		v, _ = RequestValue(req, MetadataFromCookie, key.Name)
+	case HashKeyFromSession:
+		if sess, ok := SessionFromContext(ctx); ok {
+			v = sess.Values[key.Name]
+		}
+	}
+	if v == "" {
+		return ctx, nil
+	}
+	return NewHashKeyContext(ctx, v), nil
+}
+
+// setFieldHashKey fills in the hash key of "route" read from the request message "msg".
+func setFieldHashKey(ctx context.Context, route *Route, msg proto.Message) {
+	if route.HashKey.Source != HashKeyFromField {
+		return
+	}
+	h, ok := ctx.Value(hashKeyKey{}).(*hashKeyHolder)
+	if !ok || h.set {
+		return
+	}
+	v, err := responseField(msg, route.HashKey.Name)
+	if err != nil {
+		return
+	}
+	if values := headerValues(v); len(values) > 0 {
+		h.key, h.set = values[0], true
+	}
+}
+
+const (
+	// DefaultHashReplicas is the number of points of each endpoint on a HashRing.
+	DefaultHashReplicas = 160
+	// DefaultHashLoadFactor is the load factor of a HashRing.
+	DefaultHashLoadFactor = 1.25
+)
+
+// HashRing is a consistent hash ring with bounded loads: an endpoint takes at most
+// loadFactor times the average number of the calls in flight, and the calls over it
+// move on to the next endpoints on the ring. So a key sticks to its endpoint unless
+// the endpoint is overloaded or leaves, and only the keys of the joining or leaving
+// endpoints move when the endpoints change.
+// A HashRing is safe for concurrent use.
+type HashRing struct {
+	replicas   int
+	loadFactor float64
+
+	mu     sync.Mutex
+	hashes []uint32
+	owners map[uint32]string
+	loads  map[string]int
+	total  int
+}
+
+// NewHashRing returns an empty ring placing "replicas" points per endpoint, with the
+// load bound "loadFactor", which must be greater than 1.
+// The defaults are used for the zero values.
+func NewHashRing(replicas int, loadFactor float64) *HashRing {
+	if replicas <= 0 {
+		replicas = DefaultHashReplicas
+	}
+	if loadFactor <= 1 {
+		loadFactor = DefaultHashLoadFactor
+	}
+	return &HashRing{
+		replicas:   replicas,
+		loadFactor: loadFactor,
+		owners:     make(map[uint32]string),
+		loads:      make(map[string]int),
+	}
+}
+
+// Set replaces the endpoints of the ring. The loads of the remaining endpoints are kept.
+func (r *HashRing) Set(endpoints []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	loads := make(map[string]int, len(endpoints))
+	r.total = 0
+	r.hashes = r.hashes[:0]
+	r.owners = make(map[uint32]string, len(endpoints)*r.replicas)
+	for _, ep := range endpoints {
+		if _, ok := loads[ep]; ok {
+			continue
+		}
+		loads[ep] = r.loads[ep]
+		r.total += loads[ep]
+		for i := 0; i < r.replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + ep))
+			if _, ok := r.owners[h]; ok {
+				continue
+			}
+			r.owners[h] = ep
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	r.loads = loads
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Endpoints returns the endpoints of the ring in order.
+func (r *HashRing) Endpoints() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	endpoints := make([]string, 0, len(r.loads))
+	for ep := range r.loads {
+		endpoints = append(endpoints, ep)
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// Pick returns the endpoint of "key" and a function to call when the call is done,
+// or false if the ring is empty. An empty key picks the least loaded endpoint.
+func (r *HashRing) Pick(key string) (string, func(), bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.loads) == 0 {
+		return "", nil, false
+	}
+	var picked string
+	if key == "" {
+		for ep, load := range r.loads {
+			if picked == "" || load < r.loads[picked] || (load == r.loads[picked] && ep < picked) {
+				picked = ep
+			}
+		}
+	} else {
+		capacity := int(math.Ceil(r.loadFactor * float64(r.total+1) / float64(len(r.loads))))
+		h := crc32.ChecksumIEEE([]byte(key))
+		start := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+		for i := 0; i < len(r.hashes); i++ {
+			ep := r.owners[r.hashes[(start+i)%len(r.hashes)]]
+			if r.loads[ep] < capacity {
+				picked = ep
+				break
+			}
+		}
+	}
+	r.loads[picked]++
+	r.total++
+	var once sync.Once
+	return picked, func() { once.Do(func() { r.release(picked) }) }, true
+}
+
+func (r *HashRing) release(ep string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loads[ep] > 0 {
+		r.loads[ep]--
+		r.total--
+	}
+}
@@ -0,0 +1,197 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestHashRingSticky(t *testing.T) {
+	r := NewHashRing(0, 0)
+	if _, _, ok := r.Pick("u1"); ok {
+		t.Errorf("Pick() on an empty ring succeeded; want failure")
+	}
+	r.Set([]string{"10.0.0.1:9090", "10.0.0.2:9090", "10.0.0.3:9090"})
+
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("u%d", i)
+		ep, done, ok := r.Pick(key)
+		if !ok {
+			t.Fatalf("Pick(%q) failed; want success", key)
+		}
+		done()
+		owners[key] = ep
+	}
+	for key, want := range owners {
+		ep, done, _ := r.Pick(key)
+		done()
+		if ep != want {
+			t.Errorf("Pick(%q) = %q; want %q", key, ep, want)
+		}
+	}
+
+	// only the keys of the joining endpoint move.
+	r.Set([]string{"10.0.0.1:9090", "10.0.0.2:9090", "10.0.0.3:9090", "10.0.0.4:9090"})
+	moved := 0
+	for key, old := range owners {
+		ep, done, _ := r.Pick(key)
+		done()
+		if ep != old {
+			moved++
+			if ep != "10.0.0.4:9090" {
+				t.Errorf("Pick(%q) = %q after a join; want %q or the new endpoint", key, ep, old)
+			}
+		}
+	}
+	if moved == 0 || moved > len(owners)/2 {
+		t.Errorf("%d of %d keys moved after a join; want about a quarter", moved, len(owners))
+	}
+
+	// only the keys of the leaving endpoint move.
+	r.Set([]string{"10.0.0.1:9090", "10.0.0.2:9090", "10.0.0.3:9090"})
+	for key, old := range owners {
+		ep, done, _ := r.Pick(key)
+		done()
+		if ep != old {
+			t.Errorf("Pick(%q) = %q after a leave; want %q", key, ep, old)
+		}
+	}
+}
+
+func TestHashRingBoundedLoad(t *testing.T) {
+	r := NewHashRing(0, 1.25)
+	endpoints := []string{"a", "b", "c", "d"}
+	r.Set(endpoints)
+
+	// a hot key overflows to the other endpoints.
+	loads := make(map[string]int)
+	var dones []func()
+	for i := 0; i < 100; i++ {
+		ep, done, _ := r.Pick("hot")
+		loads[ep]++
+		dones = append(dones, done)
+	}
+	for _, ep := range endpoints {
+		if loads[ep] > 32 {
+			t.Errorf("load of %s = %d; want at most 32", ep, loads[ep])
+		}
+	}
+	for _, done := range dones {
+		done()
+		done()
+	}
+
+	// the loads are released, so the key sticks again.
+	first, done, _ := r.Pick("hot")
+	done()
+	for i := 0; i < 10; i++ {
+		ep, done, _ := r.Pick("hot")
+		done()
+		if ep != first {
+			t.Errorf("Pick(%q) = %q; want %q", "hot", ep, first)
+		}
+	}
+
+	// calls without a key go to the least loaded endpoint.
+	_, hold, _ := r.Pick("hot")
+	defer hold()
+	if ep, done, _ := r.Pick(""); ep == first {
+		t.Errorf("Pick(%q) = %q; want one of the idle endpoints", "", ep)
+	} else {
+		done()
+	}
+}
+
+func TestGatewayApplyHashKey(t *testing.T) {
+	g := NewGateway()
+	req := httptest.NewRequest("GET", "/v1/rooms/42", nil)
+	req.Header.Set("X-User-Id", "u1")
+	req.AddCookie(&http.Cookie{Name: "ZQ_GUID", Value: "g1"})
+	sessCtx := context.WithValue(context.Background(), sessionKey{}, &Session{Values: map[string]string{"uid": "s1"}})
+	pathParams := map[string]string{"room_id": "42"}
+
+	for _, spec := range []struct {
+		key  HashKey
+		want string
+	}{
+		{key: HashKey{Source: HashKeyFromPath, Name: "room_id"}, want: "42"},
+		{key: HashKey{Source: HashKeyFromHeader, Name: "X-User-Id"}, want: "u1"},
+		{key: HashKey{Source: HashKeyFromCookie, Name: "ZQ_GUID"}, want: "g1"},
+		{key: HashKey{Source: HashKeyFromSession, Name: "uid"}, want: "s1"},
+		{key: HashKey{Source: HashKeyFromHeader, Name: "X-Missing"}},
+		{},
+	} {
+		ctx, err := g.ApplyHashKey(sessCtx, req, pathParams, &Route{HashKey: spec.key})
+		if err != nil {
+			t.Errorf("ApplyHashKey(%v) failed with %v; want success", spec.key, err)
+			continue
+		}
+		key, ok := HashKeyFromContext(ctx)
+		if key != spec.want || ok != (spec.want != "") {
+			t.Errorf("HashKeyFromContext() after ApplyHashKey(%v) = %q, %v; want %q", spec.key, key, ok, spec.want)
+		}
+	}
+
+	route := &Route{Method: "im.Im/Read", HashKey: HashKey{Source: HashKeyFromField, Name: "name"}}
+	ctx, err := g.ApplyHashKey(context.Background(), req, pathParams, route)
+	if err != nil {
+		t.Fatalf("ApplyHashKey(%v) failed with %v; want success", route.HashKey, err)
+	}
+	if key, ok := HashKeyFromContext(ctx); ok {
+		t.Errorf("HashKeyFromContext() before the message is decoded = %q; want none", key)
+	}
+	if err := g.HookRequest(ctx, req, route, &descriptor.FieldDescriptorProto{Name: proto.String("u2")}); err != nil {
+		t.Fatalf("HookRequest() failed with %v; want success", err)
+	}
+	if key, _ := HashKeyFromContext(ctx); key != "u2" {
+		t.Errorf("HashKeyFromContext() after HookRequest() = %q; want %q", key, "u2")
+	}
+}
+
+type fakeSubConn struct {
+	addr string
+}
+
+func (*fakeSubConn) UpdateAddresses([]resolver.Address) {}
+func (*fakeSubConn) Connect()                           {}
+
+func TestHashPicker(t *testing.T) {
+	pb := &hashPickerBuilder{ring: NewHashRing(0, 0)}
+	if _, _, err := pb.Build(nil).Pick(context.Background(), balancer.PickOptions{}); err != balancer.ErrNoSubConnAvailable {
+		t.Errorf("Pick() without SubConns failed with %v; want %v", err, balancer.ErrNoSubConnAvailable)
+	}
+
+	readySCs := make(map[resolver.Address]balancer.SubConn)
+	for _, addr := range []string{"10.0.0.1:9090", "10.0.0.2:9090", "10.0.0.3:9090"} {
+		readySCs[resolver.Address{Addr: addr}] = &fakeSubConn{addr: addr}
+	}
+	p := pb.Build(readySCs)
+	ctx := NewHashKeyContext(context.Background(), "u1")
+	sc, done, err := p.Pick(ctx, balancer.PickOptions{})
+	if err != nil {
+		t.Fatalf("Pick() failed with %v; want success", err)
+	}
+	done(balancer.DoneInfo{})
+	want := sc.(*fakeSubConn).addr
+	for i := 0; i < 10; i++ {
+		sc, done, err := p.Pick(ctx, balancer.PickOptions{})
+		if err != nil {
+			t.Fatalf("Pick() failed with %v; want success", err)
+		}
+		done(balancer.DoneInfo{})
+		if got := sc.(*fakeSubConn).addr; got != want {
+			t.Errorf("Pick() = %q; want %q", got, want)
+		}
+	}
+	if got := balancer.Get(HashBalancerName); got == nil || got.Name() != HashBalancerName {
+		t.Errorf("balancer.Get(%q) = %v; want the consistent hash balancer", HashBalancerName, got)
+	}
+}
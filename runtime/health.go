@@ -0,0 +1,242 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/utilities"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/grpclog"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HealthTarget is a target service checked by a HealthChecker.
+type HealthTarget struct {
+	// Name is the target service in the form of "package.Service", where package is the "@tarpkg"
+	// of the target if any, or else the Go package of the gateway.
+	Name string
+	// Method is a method of the target service, passed to the connection callbacks as the routes
+	// of the method pass it.
+	Method string
+}
+
+// HealthOption configures a HealthChecker.
+type HealthOption func(*HealthChecker)
+
+// WithCriticalTargets makes the readiness depend on the targets "names" only,
+// instead of all the targets.
+func WithCriticalTargets(names ...string) HealthOption {
+	return func(h *HealthChecker) {
+		for _, name := range names {
+			h.critical[name] = true
+		}
+	}
+}
+
+// WithHealthService sets the grpc.health.v1 service name checked on the target "name".
+// The overall health of the server, i.e. the empty service name, is checked by default.
+func WithHealthService(name, service string) HealthOption {
+	return func(h *HealthChecker) {
+		h.services[name] = service
+	}
+}
+
+// WithHealthTimeout sets the timeout of the checks, 1s by default.
+func WithHealthTimeout(timeout time.Duration) HealthOption {
+	return func(h *HealthChecker) {
+		h.timeout = timeout
+	}
+}
+
+// WithHealthPaths sets the paths registered by HealthChecker.Register, "/healthz" and "/readyz" by default.
+func WithHealthPaths(healthz, readyz string) HealthOption {
+	return func(h *HealthChecker) {
+		h.healthzPath, h.readyzPath = healthz, readyz
+	}
+}
+
+// HealthChecker checks the target services of the gateway services with the grpc.health.v1 protocol.
+// It is shared by the Register*HealthHandler calls of the services to check together.
+type HealthChecker struct {
+	critical    map[string]bool
+	services    map[string]string
+	timeout     time.Duration
+	healthzPath string
+	readyzPath  string
+
+	mu      sync.Mutex
+	targets []healthTarget
+	muxes   map[*grpcgw.ServeMux]bool
+}
+
+// healthTarget is a target with the connections of the service it is added by.
+type healthTarget struct {
+	HealthTarget
+	makeConn func(meth string) (*grpc.ClientConn, func(), error)
+}
+
+// NewHealthChecker returns a checker without targets, which are added by AddTargets.
+func NewHealthChecker(opts ...HealthOption) *HealthChecker {
+	h := &HealthChecker{
+		critical:    make(map[string]bool),
+		services:    make(map[string]string),
+		timeout:     time.Second,
+		healthzPath: "/healthz",
+		readyzPath:  "/readyz",
+		muxes:       make(map[*grpcgw.ServeMux]bool),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// AddTargets adds "targets", connected to with "makeConn", to the checks.
+// The targets already added by another service are checked once.
+func (h *HealthChecker) AddTargets(targets []HealthTarget, makeConn func(meth string) (*grpc.ClientConn, func(), error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	seen := make(map[string]bool, len(h.targets))
+	for _, t := range h.targets {
+		seen[t.Name] = true
+	}
+	for _, t := range targets {
+		if seen[t.Name] {
+			continue
+		}
+		seen[t.Name] = true
+		h.targets = append(h.targets, healthTarget{HealthTarget: t, makeConn: makeConn})
+	}
+}
+
+// TargetHealth is the health of a target service.
+type TargetHealth struct {
+	// Status is the grpc.health.v1 serving status, e.g. "SERVING", or "UNKNOWN" if the check failed.
+	Status string `json:"status"`
+	// Critical tells whether the readiness depends on the target.
+	Critical bool `json:"critical"`
+	// Error is the reason of the failed check.
+	Error string `json:"error,omitempty"`
+}
+
+// HealthReport is the result of HealthChecker.Check.
+type HealthReport struct {
+	// Status is "ok" if the gateway is ready, "unavailable" otherwise.
+	Status string `json:"status"`
+	// Targets are the healths of the target services by name.
+	Targets map[string]TargetHealth `json:"targets"`
+}
+
+// Ready tells whether the report is ready.
+func (r *HealthReport) Ready() bool {
+	return r.Status == "ok"
+}
+
+// Check checks all the targets concurrently. The gateway is ready if all the critical targets,
+// or all the targets if none is critical, are serving.
+func (h *HealthChecker) Check(ctx context.Context) *HealthReport {
+	h.mu.Lock()
+	targets := h.targets
+	h.mu.Unlock()
+	report := &HealthReport{Status: "ok", Targets: make(map[string]TargetHealth, len(targets))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target healthTarget) {
+			defer wg.Done()
+			th := h.check(ctx, target)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Targets[target.Name] = th
+			if th.Status != healthpb.HealthCheckResponse_SERVING.String() && (th.Critical || len(h.critical) == 0) {
+				report.Status = "unavailable"
+			}
+		}(target)
+	}
+	wg.Wait()
+	return report
+}
+
+func (h *HealthChecker) check(ctx context.Context, target healthTarget) TargetHealth {
+	th := TargetHealth{Status: healthpb.HealthCheckResponse_UNKNOWN.String(), Critical: h.critical[target.Name]}
+	conn, closeFunc, err := target.makeConn(target.Method)
+	if err != nil {
+		th.Error = err.Error()
+		return th
+	}
+	defer closeFunc()
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: h.services[target.Name]})
+	if err != nil {
+		th.Error = err.Error()
+		return th
+	}
+	th.Status = resp.GetStatus().String()
+	return th
+}
+
+// ServeHealthz writes the report of all the targets. It answers 200 as long as the gateway is alive.
+func (h *HealthChecker) ServeHealthz(w http.ResponseWriter, req *http.Request) {
+	h.write(w, req, h.Check(req.Context()), http.StatusOK)
+}
+
+// ServeReadyz writes the report of all the targets, with 503 if the gateway is not ready.
+func (h *HealthChecker) ServeReadyz(w http.ResponseWriter, req *http.Request) {
+	report := h.Check(req.Context())
+	code := http.StatusOK
+	if !report.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	h.write(w, req, report, code)
+}
+
+func (h *HealthChecker) write(w http.ResponseWriter, req *http.Request, report *HealthReport, code int) {
+	buf, err := marshalJSONObject(map[string]interface{}{"status": report.Status, "targets": report.Targets})
+	if err != nil {
+		grpcgw.OtherErrorHandler(w, req, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if _, err := w.Write(buf); err != nil {
+		grpclog.Infof("Failed to write response: %v", err)
+	}
+}
+
+// Register registers the GET handlers of the health and the readiness paths to "mux",
+// unless they are already.
+func (h *HealthChecker) Register(mux *grpcgw.ServeMux) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.muxes[mux] {
+		return
+	}
+	h.muxes[mux] = true
+	mux.Handle("GET", literalPattern(h.healthzPath), func(w http.ResponseWriter, req *http.Request, _ map[string]string) {
+		h.ServeHealthz(w, req)
+	})
+	mux.Handle("GET", literalPattern(h.readyzPath), func(w http.ResponseWriter, req *http.Request, _ map[string]string) {
+		h.ServeReadyz(w, req)
+	})
+}
+
+// literalPattern returns the pattern matching the path "path" without variables.
+func literalPattern(path string) grpcgw.Pattern {
+	var ops []int
+	var pool []string
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		if seg == "" {
+			continue
+		}
+		ops = append(ops, int(utilities.OpLitPush), len(pool))
+		pool = append(pool, seg)
+	}
+	return grpcgw.MustPattern(grpcgw.NewPattern(1, ops, pool, ""))
+}
@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthChecker(t *testing.T) {
+	addrA, stopA := startHealthServer(t, "a")
+	defer stopA()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(s, hs)
+	go s.Serve(lis)
+	defer s.Stop()
+	addrB := lis.Addr().String()
+
+	endpoints := map[string]string{
+		"gw.Authorize/Login": addrA,
+		"gw.Im/Read":         addrB,
+	}
+	makeConn := ConnFunc([]grpc.DialOption{grpc.WithInsecure()}, func(meth string) string { return endpoints[meth] }, nil)
+	targets := []HealthTarget{
+		{Name: "gw.Authorize", Method: "gw.Authorize/Login"},
+		{Name: "gw.Im", Method: "gw.Im/Read"},
+	}
+
+	type report struct {
+		Status  string                  `json:"status"`
+		Targets map[string]TargetHealth `json:"targets"`
+	}
+	get := func(h *HealthChecker, path string) (int, report) {
+		mux := grpcgw.NewServeMux()
+		h.Register(mux)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var r report
+		if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+			t.Fatalf("GET %s = %q; want a JSON report: %v", path, rec.Body.String(), err)
+		}
+		return rec.Code, r
+	}
+
+	all := NewHealthChecker()
+	all.AddTargets(targets, makeConn)
+	if code, r := get(all, "/healthz"); code != 200 || r.Status != "unavailable" {
+		t.Errorf("GET /healthz = %d, %q; want 200, %q", code, r.Status, "unavailable")
+	} else {
+		if got := r.Targets["gw.Authorize"].Status; got != "SERVING" {
+			t.Errorf("status of gw.Authorize = %q; want SERVING", got)
+		}
+		if got := r.Targets["gw.Im"].Status; got != "NOT_SERVING" {
+			t.Errorf("status of gw.Im = %q; want NOT_SERVING", got)
+		}
+	}
+	if code, _ := get(all, "/readyz"); code != 503 {
+		t.Errorf("GET /readyz with all targets = %d; want 503", code)
+	}
+
+	critical := NewHealthChecker(WithCriticalTargets("gw.Authorize"), WithHealthPaths("/imgate/healthz", "/imgate/readyz"))
+	critical.AddTargets(targets, makeConn)
+	if code, r := get(critical, "/imgate/readyz"); code != 200 || r.Status != "ok" || !r.Targets["gw.Authorize"].Critical || r.Targets["gw.Im"].Critical {
+		t.Errorf("GET /imgate/readyz with critical targets = %d, %+v; want 200 with gw.Authorize critical", code, r)
+	}
+
+	// the services sharing a checker are checked together, on the paths registered once.
+	mux := grpcgw.NewServeMux()
+	shared := NewHealthChecker()
+	shared.AddTargets(targets[:1], makeConn)
+	shared.Register(mux)
+	shared.AddTargets(targets, makeConn)
+	shared.Register(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	var union report
+	if err := json.Unmarshal(rec.Body.Bytes(), &union); err != nil || rec.Code != 503 || len(union.Targets) != 2 {
+		t.Errorf("GET /readyz of two services = %d, %s; want 503 with both targets", rec.Code, rec.Body.String())
+	}
+
+	// the service "a" is serving on addrA only.
+	named := NewHealthChecker(WithHealthService("gw.Authorize", "b"))
+	named.AddTargets(targets[:1], makeConn)
+	if r := named.Check(context.Background()); r.Ready() || r.Targets["gw.Authorize"].Error == "" {
+		t.Errorf("Check() of an unknown service = %+v; want not ready with an error", r)
+	}
+
+	// an unreachable target fails within the timeout.
+	endpoints["gw.Im/Read"] = "127.0.0.1:1"
+	down := NewHealthChecker(WithHealthTimeout(100 * time.Millisecond))
+	down.AddTargets(targets[1:], makeConn)
+	begin := time.Now()
+	if r := down.Check(context.Background()); r.Ready() || r.Targets["gw.Im"].Status != "UNKNOWN" {
+		t.Errorf("Check() of an unreachable target = %+v; want not ready with UNKNOWN", r)
+	}
+	if d := time.Since(begin); d > 2*time.Second {
+		t.Errorf("Check() of an unreachable target took %v; want about the timeout", d)
+	}
+}
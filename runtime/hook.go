@@ -0,0 +1,127 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/golang/protobuf/proto"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RequestHook is called by the generated code with the request message decoded
+// from "req", before it is sent to the target method "meth" in the form of
+// "package.Service/Method". For client streaming methods it is called with each message.
+// The hook may modify "msg". A returned error aborts the call and is written with
+// runtime.HTTPError, so it should be made with status.Error to choose the HTTP status.
+type RequestHook func(ctx context.Context, meth string, req *http.Request, msg proto.Message) error
+
+// WithRequestHook adds a hook called with the decoded request messages.
+// The hooks are called in the order they are added.
+func WithRequestHook(hook RequestHook) GatewayOption {
+	return func(g *Gateway) {
+		g.requestHooks = append(g.requestHooks, hook)
+	}
+}
+
+// HookRequest calls the request hooks with "msg", stopping at the first error.
+// Then it reads the hash key of the route from "msg" if the key is a field.
+func (g *Gateway) HookRequest(ctx context.Context, req *http.Request, route *Route, msg proto.Message) error {
+	for _, hook := range g.requestHooks {
+		if err := hook(ctx, route.Method, req, msg); err != nil {
+			return err
+		}
+	}
+	setFieldHashKey(ctx, route, msg)
+	return nil
+}
+
+// Response is the result of a call passed to the response hooks.
+type Response struct {
+	// Message is the reply, nil if Err is not nil. A hook may replace it.
+	Message proto.Message
+	// Err is the error of the call. A hook may replace it, or clear it and set Message.
+	// If the hooks leave neither, the call fails with codes.Internal.
+	Err error
+	// Metadata holds the gRPC header and trailer metadata received from the target service.
+	// The trailer is not available for the messages of server streaming methods.
+	Metadata grpcgw.ServerMetadata
+	// Header are the HTTP response headers. Changes made after the first message
+	// of a server streaming method has been written have no effect.
+	Header http.Header
+	// Trailer are the HTTP trailers to send after the response body.
+	Trailer http.Header
+}
+
+// ResponseHook is called by the generated code with the result of the call to
+// the target method "meth", before the response is written.
+// For server streaming methods it is called with each received message or error.
+type ResponseHook func(ctx context.Context, meth string, req *http.Request, resp *Response)
+
+// WithResponseHook adds a hook called with the results of the calls.
+// The hooks are called in the order they are added.
+func WithResponseHook(hook ResponseHook) GatewayOption {
+	return func(g *Gateway) {
+		g.responseHooks = append(g.responseHooks, hook)
+	}
+}
+
+// HookResponse calls the response hooks with the reply "msg" or the error "err"
+// of the call, and returns the replacement reply and error.
+// "ctx" must hold the ServerMetadata of the call.
+func (g *Gateway) HookResponse(ctx context.Context, w http.ResponseWriter, req *http.Request, route *Route, msg proto.Message, err error) (proto.Message, error) {
+	if err != nil {
+		// drop the typed nil returned along with the error.
+		msg = nil
+	}
+	if len(g.responseHooks) == 0 {
+		return msg, err
+	}
+	md, _ := grpcgw.ServerMetadataFromContext(ctx)
+	resp := &Response{
+		Message:  msg,
+		Err:      err,
+		Metadata: md,
+		Header:   w.Header(),
+		Trailer:  make(http.Header),
+	}
+	for _, hook := range g.responseHooks {
+		hook(ctx, route.Method, req, resp)
+	}
+	for k, vs := range resp.Trailer {
+		for _, v := range vs {
+			w.Header().Add(http.TrailerPrefix+k, v)
+		}
+	}
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	if resp.Message == nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("the response hooks of %s left neither a reply nor an error", route.Method))
+	}
+	return resp.Message, nil
+}
+
+// HookStream returns a function which receives the messages of a server streaming call
+// with "recv" and passes each of them to the response hooks. io.EOF is not passed.
+// The stream ends after the first error, even if a hook replaces it with a message.
+func (g *Gateway) HookStream(ctx context.Context, w http.ResponseWriter, req *http.Request, route *Route, recv func() (proto.Message, error)) func() (proto.Message, error) {
+	if len(g.responseHooks) == 0 {
+		return recv
+	}
+	var done bool
+	return func() (proto.Message, error) {
+		if done {
+			return nil, io.EOF
+		}
+		msg, err := recv()
+		if err == io.EOF {
+			return nil, err
+		}
+		done = err != nil
+		return g.HookResponse(ctx, w, req, route, msg, err)
+	}
+}
@@ -0,0 +1,158 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGatewayHookRequest(t *testing.T) {
+	route := &Route{Method: "im.Im/Read"}
+	var calls []string
+	g := NewGateway(
+		WithRequestHook(func(ctx context.Context, meth string, req *http.Request, msg proto.Message) error {
+			calls = append(calls, "owner:"+meth)
+			m := msg.(*descriptor.FieldDescriptorProto)
+			if m.GetName() != req.Header.Get("X-Uid") {
+				return status.Error(codes.PermissionDenied, "not your room")
+			}
+			m.JsonName = proto.String("checked")
+			return nil
+		}),
+		WithRequestHook(func(ctx context.Context, meth string, req *http.Request, msg proto.Message) error {
+			calls = append(calls, "second")
+			return nil
+		}),
+	)
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Uid", "u1")
+	msg := &descriptor.FieldDescriptorProto{Name: proto.String("u1")}
+	if err := g.HookRequest(context.Background(), req, route, msg); err != nil {
+		t.Fatalf("HookRequest() failed with %v; want success", err)
+	}
+	if msg.GetJsonName() != "checked" {
+		t.Errorf("msg.JsonName = %q; want the hook to set it", msg.GetJsonName())
+	}
+	if got, want := len(calls), 2; got != want || calls[0] != "owner:im.Im/Read" {
+		t.Errorf("calls = %q; want both hooks called in order", calls)
+	}
+
+	calls = nil
+	err := g.HookRequest(context.Background(), req, route, &descriptor.FieldDescriptorProto{Name: proto.String("u2")})
+	if got, want := status.Code(err), codes.PermissionDenied; got != want {
+		t.Errorf("status.Code(HookRequest()) = %v; want %v", got, want)
+	}
+	if len(calls) != 1 {
+		t.Errorf("calls = %q; want the hooks after the failed one skipped", calls)
+	}
+
+	if err := NewGateway().HookRequest(context.Background(), req, route, msg); err != nil {
+		t.Errorf("HookRequest() without hooks failed with %v; want success", err)
+	}
+}
+
+func TestGatewayHookResponse(t *testing.T) {
+	route := &Route{Method: "auth.Authorize/Login"}
+	g := NewGateway(WithResponseHook(func(ctx context.Context, meth string, req *http.Request, resp *Response) {
+		if resp.Err != nil {
+			if status.Code(resp.Err) == codes.Canceled {
+				// cleared without a replacement.
+				resp.Err = nil
+				return
+			}
+			if status.Code(resp.Err) == codes.NotFound {
+				resp.Err = nil
+				resp.Message = &descriptor.FieldDescriptorProto{Name: proto.String("fallback")}
+			}
+			return
+		}
+		resp.Header.Set("X-Request-Id", resp.Metadata.HeaderMD.Get("request-id")[0])
+		resp.Trailer.Set("X-Checksum", "abc")
+		if resp.Message.(*descriptor.FieldDescriptorProto).GetName() == "secret" {
+			resp.Message = nil
+			resp.Err = status.Error(codes.PermissionDenied, "hidden")
+		}
+	}))
+	ctx := grpcgw.NewServerMetadataContext(context.Background(), grpcgw.ServerMetadata{
+		HeaderMD: metadata.Pairs("request-id", "r1"),
+	})
+	req := httptest.NewRequest("POST", "/", nil)
+
+	rec := httptest.NewRecorder()
+	msg, err := g.HookResponse(ctx, rec, req, route, &descriptor.FieldDescriptorProto{Name: proto.String("ok")}, nil)
+	if err != nil || msg.(*descriptor.FieldDescriptorProto).GetName() != "ok" {
+		t.Errorf("HookResponse() = %v, %v; want the reply unchanged", msg, err)
+	}
+	if got := rec.Header().Get("X-Request-Id"); got != "r1" {
+		t.Errorf("header X-Request-Id = %q; want %q", got, "r1")
+	}
+	if got := rec.Header().Get(http.TrailerPrefix + "X-Checksum"); got != "abc" {
+		t.Errorf("trailer X-Checksum = %q; want %q", got, "abc")
+	}
+
+	_, err = g.HookResponse(ctx, httptest.NewRecorder(), req, route, &descriptor.FieldDescriptorProto{Name: proto.String("secret")}, nil)
+	if got, want := status.Code(err), codes.PermissionDenied; got != want {
+		t.Errorf("status.Code(HookResponse()) = %v; want %v", got, want)
+	}
+
+	var typedNil *descriptor.FieldDescriptorProto
+	msg, err = g.HookResponse(ctx, httptest.NewRecorder(), req, route, typedNil, status.Error(codes.NotFound, "no"))
+	if err != nil || msg.(*descriptor.FieldDescriptorProto).GetName() != "fallback" {
+		t.Errorf("HookResponse() = %v, %v; want the error replaced with the fallback", msg, err)
+	}
+
+	msg, err = g.HookResponse(ctx, httptest.NewRecorder(), req, route, typedNil, status.Error(codes.Canceled, "no"))
+	if msg != nil || status.Code(err) != codes.Internal {
+		t.Errorf("HookResponse() = %v, %v; want an internal error when the error is cleared without a reply", msg, err)
+	}
+}
+
+func TestGatewayHookStream(t *testing.T) {
+	var seen []string
+	g := NewGateway(WithResponseHook(func(ctx context.Context, meth string, req *http.Request, resp *Response) {
+		if resp.Err != nil {
+			seen = append(seen, "error")
+			resp.Err, resp.Message = nil, &descriptor.FieldDescriptorProto{Name: proto.String("recovered")}
+			return
+		}
+		seen = append(seen, resp.Message.(*descriptor.FieldDescriptorProto).GetName())
+	}))
+	msgs := []string{"m1", "m2"}
+	recv := func() (proto.Message, error) {
+		if len(msgs) == 0 {
+			return nil, status.Error(codes.Unavailable, "broken")
+		}
+		m := &descriptor.FieldDescriptorProto{Name: proto.String(msgs[0])}
+		msgs = msgs[1:]
+		return m, nil
+	}
+	hooked := g.HookStream(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), &Route{}, recv)
+	var got []string
+	for {
+		msg, err := hooked()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("hooked() failed with %v; want success", err)
+		}
+		got = append(got, msg.(*descriptor.FieldDescriptorProto).GetName())
+	}
+	if want := []string{"m1", "m2", "recovered"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("received %q; want %q", got, want)
+	}
+	if want := []string{"m1", "m2", "error"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("hooks saw %q; want %q", seen, want)
+	}
+}
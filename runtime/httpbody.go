@@ -0,0 +1,138 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+)
+
+// DecodeHTTPBody decodes the body of "req" as is into the google.api.HttpBody at "path" of "msg",
+// "*" for "msg" itself: its data is the body, and its content type the Content-Type of the request.
+func DecodeHTTPBody(req *http.Request, msg proto.Message, path string) error {
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return setHTTPBody(msg, path, req.Header.Get("Content-Type"), data)
+}
+
+// DecodeHTTPBodyChunks decodes the body of "req" as is into the google.api.HttpBody at "path" of
+// the messages of a client streaming method, made by "newMsg" and passed to "send": the body is
+// split into chunks of DefaultUploadChunkSize bytes, one per message, and only the first message
+// takes the content type. One message is sent if the body is empty. An error of "send" is returned as is.
+func DecodeHTTPBodyChunks(req *http.Request, path string, newMsg func() proto.Message, send func(proto.Message) error) error {
+	contentType := req.Header.Get("Content-Type")
+	return sendChunks(req.Body, DefaultUploadChunkSize, 0, nil, newMsg, func(msg proto.Message, chunk []byte, first bool) error {
+		if !first {
+			contentType = ""
+		}
+		return setHTTPBody(msg, path, contentType, chunk)
+	}, send)
+}
+
+func setHTTPBody(msg proto.Message, path, contentType string, data []byte) error {
+	prefix := ""
+	if path != "" && path != "*" {
+		prefix = path + "."
+	}
+	if err := setRequestField(msg, prefix+"content_type", reflect.ValueOf(contentType)); err != nil {
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+	if err := setRequestField(msg, prefix+"data", reflect.ValueOf(data)); err != nil {
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+	return nil
+}
+
+// responseBody is implemented by the responses of the routes with a "response_body".
+type responseBody interface {
+	XXX_ResponseBody() interface{}
+}
+
+// httpBodyOf returns the google.api.HttpBody of the response "resp".
+func httpBodyOf(resp proto.Message) (*httpbody.HttpBody, bool) {
+	var v interface{} = resp
+	if rb, ok := resp.(responseBody); ok {
+		v = rb.XXX_ResponseBody()
+	}
+	body, ok := v.(*httpbody.HttpBody)
+	if ok && body == nil {
+		body = &httpbody.HttpBody{}
+	}
+	return body, ok
+}
+
+// ForwardHTTPBody forwards the google.api.HttpBody response "resp" as is, with its content type.
+// It replaces runtime.ForwardResponseMessage for the routes returning a google.api.HttpBody.
+// The errors are written by g.HTTPError.
+func (g *Gateway) ForwardHTTPBody(ctx context.Context, mux *grpcgw.ServeMux, marshaler grpcgw.Marshaler, w http.ResponseWriter, req *http.Request, resp proto.Message, opts ...func(context.Context, http.ResponseWriter, proto.Message) error) {
+	m := &grpcgw.HTTPBodyMarshaler{Marshaler: unwrapMarshaler(marshaler)}
+	body, ok := httpBodyOf(resp)
+	if !ok {
+		g.HTTPError(ctx, mux, marshaler, w, req, status.Errorf(codes.Internal, "response %T is not a google.api.HttpBody", resp))
+		return
+	}
+	grpcgw.ForwardResponseMessage(ctx, mux, m, w, req, body, opts...)
+}
+
+// ForwardHTTPBodyStream forwards the stream of google.api.HttpBody responses as one chunked body,
+// with the content type of the first message, flushing each message as it comes.
+// It replaces runtime.ForwardResponseStream for the routes streaming google.api.HttpBody.
+// An error after the first message aborts the response, so that the client does not take
+// the truncated body as complete. The errors before the first message are written by g.HTTPError.
+func (g *Gateway) ForwardHTTPBodyStream(ctx context.Context, mux *grpcgw.ServeMux, marshaler grpcgw.Marshaler, w http.ResponseWriter, req *http.Request, recv func() (proto.Message, error), opts ...func(context.Context, http.ResponseWriter, proto.Message) error) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		grpclog.Infof("Flush not supported in %T", w)
+		g.HTTPError(ctx, mux, marshaler, w, req, status.Error(codes.Internal, "unexpected type of web server"))
+		return
+	}
+	m := &grpcgw.HTTPBodyMarshaler{Marshaler: unwrapMarshaler(marshaler)}
+	for first := true; ; first = false {
+		resp, err := recv()
+		if err == io.EOF {
+			if first {
+				grpcgw.ForwardResponseMessage(ctx, mux, m, w, req, &httpbody.HttpBody{ContentType: "application/octet-stream"}, opts...)
+			}
+			return
+		}
+		var body *httpbody.HttpBody
+		if err == nil {
+			if body, ok = httpBodyOf(resp); !ok {
+				err = status.Errorf(codes.Internal, "response %T is not a google.api.HttpBody", resp)
+			}
+		}
+		if err != nil {
+			if first {
+				g.HTTPError(ctx, mux, marshaler, w, req, err)
+				return
+			}
+			grpclog.Infof("Failed to receive response chunk: %v", err)
+			panic(http.ErrAbortHandler)
+		}
+		if first {
+			grpcgw.ForwardResponseMessage(ctx, mux, m, w, req, body, opts...)
+		} else {
+			for _, opt := range opts {
+				if err := opt(ctx, w, body); err != nil {
+					grpclog.Infof("Error handling ForwardResponseOptions: %v", err)
+					panic(http.ErrAbortHandler)
+				}
+			}
+			if _, err := w.Write(body.GetData()); err != nil {
+				grpclog.Infof("Failed to send response chunk: %v", err)
+				return
+			}
+		}
+		f.Flush()
+	}
+}
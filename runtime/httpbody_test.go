@@ -0,0 +1,123 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/empty"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestDecodeHTTPBody(t *testing.T) {
+	req := httptest.NewRequest("PUT", "/v1/put", strings.NewReader("a,b\n1,2\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	var body httpbody.HttpBody
+	if err := DecodeHTTPBody(req, &body, "*"); err != nil {
+		t.Fatalf("DecodeHTTPBody() failed with %v; want success", err)
+	}
+	if want := (&httpbody.HttpBody{ContentType: "text/csv", Data: []byte("a,b\n1,2\n")}); !proto.Equal(&body, want) {
+		t.Errorf("DecodeHTTPBody() = %v; want %v", &body, want)
+	}
+
+	var sent []*httpbody.HttpBody
+	req = httptest.NewRequest("PUT", "/v1/put", strings.NewReader(strings.Repeat("x", DefaultUploadChunkSize+1)))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	err := DecodeHTTPBodyChunks(req, "*", func() proto.Message { return &httpbody.HttpBody{} }, func(msg proto.Message) error {
+		sent = append(sent, msg.(*httpbody.HttpBody))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DecodeHTTPBodyChunks() failed with %v; want success", err)
+	}
+	if len(sent) != 2 || len(sent[0].Data) != DefaultUploadChunkSize || string(sent[1].Data) != "x" ||
+		sent[0].ContentType != "application/octet-stream" || sent[1].ContentType != "" {
+		t.Errorf("DecodeHTTPBodyChunks() sent %d messages; want a full chunk with the content type and a 1 byte chunk", len(sent))
+	}
+}
+
+type testResponseBody struct {
+	proto.Message
+	body *httpbody.HttpBody
+}
+
+func (r testResponseBody) XXX_ResponseBody() interface{} {
+	return r.body
+}
+
+func TestForwardHTTPBody(t *testing.T) {
+	mux := grpcgw.NewServeMux()
+	ctx := grpcgw.NewServerMetadataContext(context.Background(), grpcgw.ServerMetadata{HeaderMD: metadata.Pairs("x-export", "1")})
+	g := NewGateway(WithEnvelope(Envelope{}))
+	marshaler := g.OutboundMarshaler(&grpcgw.JSONPb{OrigName: true})
+	png := &httpbody.HttpBody{ContentType: "image/png", Data: []byte("\x89PNG")}
+	for _, resp := range []proto.Message{png, testResponseBody{Message: &httpbody.HttpBody{}, body: png}} {
+		rec := httptest.NewRecorder()
+		g.ForwardHTTPBody(ctx, mux, marshaler, rec, httptest.NewRequest("GET", "/", nil), resp)
+		if got := rec.Header().Get("Content-Type"); got != "image/png" {
+			t.Errorf("ForwardHTTPBody(%T) wrote Content-Type %q; want %q", resp, got, "image/png")
+		}
+		if got := rec.Body.String(); got != "\x89PNG" {
+			t.Errorf("ForwardHTTPBody(%T) wrote %q; want %q", resp, got, "\x89PNG")
+		}
+		if got := rec.Header().Get("Grpc-Metadata-X-Export"); got != "1" {
+			t.Errorf("ForwardHTTPBody(%T) wrote Grpc-Metadata-X-Export %q; want %q", resp, got, "1")
+		}
+	}
+
+	// the error is wrapped in the envelope like the errors of the other routes.
+	rec := httptest.NewRecorder()
+	g.ForwardHTTPBody(ctx, mux, marshaler, rec, httptest.NewRequest("GET", "/", nil), &empty.Empty{})
+	want := decodeJSON(t, `{"code":13,"msg":"response *empty.Empty is not a google.api.HttpBody"}`)
+	if got := decodeJSON(t, rec.Body.String()); rec.Code != http.StatusInternalServerError || !reflect.DeepEqual(got, want) {
+		t.Errorf("ForwardHTTPBody(*empty.Empty) wrote %d %v; want %d %v", rec.Code, got, http.StatusInternalServerError, want)
+	}
+}
+
+func TestForwardHTTPBodyStream(t *testing.T) {
+	g := NewGateway(WithErrorConfig(ErrorConfig{Problem: true}))
+	mux := grpcgw.NewServeMux()
+	ctx := grpcgw.NewServerMetadataContext(context.Background(), grpcgw.ServerMetadata{})
+	stream := func(msgs []proto.Message, err error) func() (proto.Message, error) {
+		return func() (proto.Message, error) {
+			if len(msgs) == 0 {
+				return nil, err
+			}
+			msg := msgs[0]
+			msgs = msgs[1:]
+			return msg, nil
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	chunks := []proto.Message{
+		&httpbody.HttpBody{ContentType: "text/csv", Data: []byte("a,b\n")},
+		&httpbody.HttpBody{Data: []byte("1,2\n")},
+	}
+	g.ForwardHTTPBodyStream(ctx, mux, &grpcgw.JSONPb{}, rec, httptest.NewRequest("GET", "/", nil), stream(chunks, io.EOF))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" || rec.Body.String() != "a,b\n1,2\n" || !rec.Flushed {
+		t.Errorf("ForwardHTTPBodyStream() wrote %d %q %q; want 200 text/csv %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String(), "a,b\n1,2\n")
+	}
+
+	rec = httptest.NewRecorder()
+	g.ForwardHTTPBodyStream(ctx, mux, &grpcgw.JSONPb{}, rec, httptest.NewRequest("GET", "/", nil), stream(nil, status.Error(codes.NotFound, "no export")))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != ProblemContentType {
+		t.Errorf("ForwardHTTPBodyStream() of a failed stream wrote %d %q; want %d %q", rec.Code, rec.Header().Get("Content-Type"), http.StatusNotFound, ProblemContentType)
+	}
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("ForwardHTTPBodyStream() of a stream failed after the first message panicked with %v; want http.ErrAbortHandler", r)
+		}
+	}()
+	g.ForwardHTTPBodyStream(ctx, mux, &grpcgw.JSONPb{}, httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), stream(chunks[:1], status.Error(codes.Internal, "disk error")))
+}
@@ -0,0 +1,131 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/golang/protobuf/proto"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+)
+
+// Handlers are the callbacks passed to a Register*HandlerClient call.
+type Handlers struct {
+	// MakeConn returns the connection to the target method "meth" and the function releasing it, see ConnFunc.
+	MakeConn func(meth string) (*grpc.ClientConn, func(), error)
+	// Begin decides how to handle each call, if not nil.
+	Begin BeginHandler
+	// Done is called after each successful call, if not nil, with the reply of a unary method
+	// and nil for a server streaming method, whose replies are streamed afterwards.
+	Done func(string, proto.Message, http.ResponseWriter, *http.Request)
+}
+
+// Reply is the answer to a call of a route: one of the fields is set.
+type Reply struct {
+	// Fallback is the static response of the route answered instead of calling the target, see RouteState.
+	Fallback *StaticResponse
+	// Decision is the decision of the BeginHandler answered instead of calling the target,
+	// whose action is not ActionContinue.
+	Decision *Decision
+	// Message is the reply of a unary or client streaming target method.
+	Message proto.Message
+	// Recv receives the replies of a server streaming target method, io.EOF after the last one.
+	Recv func() (proto.Message, error)
+}
+
+// CallFunc decodes the request message of a call and calls the target method with it over "conn".
+// It calls the request hooks, see HookRequest. The reply is the Message of a unary method,
+// or the Recv of a server streaming one.
+type CallFunc func(ctx context.Context, conn *grpc.ClientConn) (*Reply, grpcgw.ServerMetadata, error)
+
+// AnswerFunc writes "reply" as the response of a call.
+type AnswerFunc func(ctx context.Context, reply *Reply) error
+
+// Invoke runs a call of "route" the same way for its REST handlers and the JSON-RPC endpoint:
+// the route state, the BeginHandler, the session, the authentication, the metadata, the hash key
+// read from "pathParams", the connection to the target, "call", the response hooks, the end of
+// the session and the Done handler, before "answer" writes the reply. The connection is released
+// after "answer" returns, so the replies of a server streaming method are received by it.
+// It returns the context to write the error with, if any, which has the gRPC metadata of the reply.
+func (g *Gateway) Invoke(ctx context.Context, mux *grpcgw.ServeMux, w http.ResponseWriter, req *http.Request, route *Route, pathParams map[string]string, h *Handlers, call CallFunc, answer AnswerFunc) (context.Context, error) {
+	fallback, err := g.routeCheck(w, route)
+	if err != nil {
+		return ctx, err
+	}
+	if fallback != nil {
+		return ctx, answer(ctx, &Reply{Fallback: fallback})
+	}
+	if h.Begin != nil {
+		if d := h.Begin(ctx, route.Method, req); d != nil {
+			if d.Action != ActionContinue {
+				return ctx, answer(ctx, &Reply{Decision: d})
+			}
+			ctx = d.continueContext(ctx)
+		}
+	}
+
+	rctx, err := grpcgw.AnnotateContext(ctx, mux, req)
+	if err != nil {
+		return ctx, err
+	}
+	if rctx, err = g.BeginSession(rctx, w, req, route); err != nil {
+		return ctx, err
+	}
+	if rctx, err = g.Authenticate(rctx, req, route); err != nil {
+		return ctx, err
+	}
+	if rctx, err = g.ApplyMetadata(rctx, req, route); err != nil {
+		return ctx, err
+	}
+	if rctx, err = g.ApplyHashKey(rctx, req, pathParams, route); err != nil {
+		return ctx, err
+	}
+
+	conn, closeFunc, err := h.MakeConn(route.Method)
+	if err != nil {
+		return ctx, err
+	}
+	defer closeFunc()
+
+	reply, md, err := call(rctx, conn)
+	ctx = grpcgw.NewServerMetadataContext(ctx, md)
+	if route.Streaming == StreamingServer || route.Streaming == StreamingBidi {
+		if err != nil {
+			return ctx, err
+		}
+		if h.Done != nil {
+			// the replies are streamed after the call is done, so there is no reply to pass.
+			h.Done(route.Method, nil, w, req)
+		}
+		return ctx, answer(ctx, &Reply{Recv: g.HookStream(ctx, w, req, route, reply.Recv)})
+	}
+
+	var resp proto.Message
+	if reply != nil {
+		resp = reply.Message
+	}
+	if resp, err = g.HookResponse(ctx, w, req, route, resp, err); err != nil {
+		return ctx, err
+	}
+	if err := g.FinishSession(rctx, w, req, route, resp); err != nil {
+		return ctx, err
+	}
+	if h.Done != nil {
+		h.Done(route.Method, resp, w, req)
+	}
+	return ctx, answer(ctx, &Reply{Message: resp})
+}
+
+// AnswerEarly writes the Fallback or the Decision of "reply", answered instead of calling the target,
+// as the REST handlers do. It returns false if "reply" is a reply of the target, left to the caller.
+func (g *Gateway) AnswerEarly(ctx context.Context, mux *grpcgw.ServeMux, marshaler grpcgw.Marshaler, w http.ResponseWriter, req *http.Request, reply *Reply) bool {
+	switch {
+	case reply.Fallback != nil:
+		reply.Fallback.write(w)
+	case reply.Decision != nil:
+		g.ApplyDecision(ctx, mux, marshaler, w, req, reply.Decision)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGatewayInvoke(t *testing.T) {
+	unary := &Route{HTTPMethod: "POST", Path: "/v1/echo", Method: "gw.Echo/Echo", Streaming: StreamingUnary}
+	stream := &Route{HTTPMethod: "GET", Path: "/v1/watch", Method: "gw.Echo/Watch", Streaming: StreamingServer}
+	var hooked []string
+	hook := WithResponseHook(func(ctx context.Context, meth string, req *http.Request, resp *Response) {
+		if resp.Err == nil {
+			hooked = append(hooked, resp.Message.(*descriptor.UninterpretedOption).GetIdentifierValue())
+		}
+	})
+	states := NewMemoryRouteStates()
+	gw := NewGateway(hook, WithRouteStates(states))
+	mux := grpcgw.NewServeMux()
+	var conns, done int
+	var doneReply proto.Message
+	h := &Handlers{
+		MakeConn: func(meth string) (*grpc.ClientConn, func(), error) {
+			conns++
+			return nil, func() { conns-- }, nil
+		},
+		Begin: func(ctx context.Context, meth string, req *http.Request) *Decision {
+			if req.Header.Get("Authorization") == "" {
+				return Reject(http.StatusUnauthorized, nil)
+			}
+			return nil
+		},
+		Done: func(meth string, reply proto.Message, w http.ResponseWriter, req *http.Request) {
+			done++
+			doneReply = reply
+		},
+	}
+	message := func(v string) *descriptor.UninterpretedOption {
+		return &descriptor.UninterpretedOption{IdentifierValue: proto.String(v)}
+	}
+	call := func(ctx context.Context, conn *grpc.ClientConn) (*Reply, grpcgw.ServerMetadata, error) {
+		return &Reply{Message: message("a")}, grpcgw.ServerMetadata{}, nil
+	}
+	invoke := func(route *Route, auth bool, call CallFunc) (*Reply, int, error) {
+		req := httptest.NewRequest(route.HTTPMethod, route.Path, nil)
+		if auth {
+			req.Header.Set("Authorization", "Bearer a")
+		}
+		var answered *Reply
+		var open int
+		_, err := gw.Invoke(context.Background(), mux, httptest.NewRecorder(), req, route, nil, h, call, func(ctx context.Context, reply *Reply) error {
+			answered, open = reply, conns
+			if reply.Recv == nil {
+				return nil
+			}
+			for {
+				if _, err := reply.Recv(); err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+			}
+		})
+		return answered, open, err
+	}
+
+	if reply, _, err := invoke(unary, false, call); err != nil || reply.Decision == nil || reply.Decision.Action != ActionReject {
+		t.Errorf("Invoke() without authorization answered %+v, %v; want the rejection", reply, err)
+	}
+	if done != 0 || len(hooked) != 0 {
+		t.Errorf("rejected Invoke() called the done handler %d times and the hooks with %v; want neither", done, hooked)
+	}
+
+	reply, open, err := invoke(unary, true, call)
+	if err != nil || !proto.Equal(reply.Message, message("a")) {
+		t.Fatalf("Invoke() answered %+v, %v; want the reply", reply, err)
+	}
+	if open != 1 || conns != 0 {
+		t.Errorf("Invoke() answered with %d connections open and left %d; want 1 and 0", open, conns)
+	}
+	if done != 1 || !proto.Equal(doneReply, message("a")) || len(hooked) != 1 {
+		t.Errorf("Invoke() called the done handler %d times with %v and the hooks with %v; want once with the reply", done, doneReply, hooked)
+	}
+
+	hooked, done = nil, 0
+	sent := []string{"b", "c"}
+	reply, open, err = invoke(stream, true, func(ctx context.Context, conn *grpc.ClientConn) (*Reply, grpcgw.ServerMetadata, error) {
+		i := 0
+		return &Reply{Recv: func() (proto.Message, error) {
+			if i == len(sent) {
+				return nil, io.EOF
+			}
+			i++
+			return message(sent[i-1]), nil
+		}}, grpcgw.ServerMetadata{}, nil
+	})
+	if err != nil || reply.Recv == nil || open != 1 {
+		t.Fatalf("streaming Invoke() answered %+v, %v with %d connections open; want the stream over the open connection", reply, err, open)
+	}
+	if done != 1 || doneReply != nil || len(hooked) != 2 {
+		t.Errorf("streaming Invoke() called the done handler %d times with %v and the hooks with %v; want once with nil, and the hooks with each message", done, doneReply, hooked)
+	}
+
+	if _, _, err := invoke(unary, true, func(ctx context.Context, conn *grpc.ClientConn) (*Reply, grpcgw.ServerMetadata, error) {
+		return nil, grpcgw.ServerMetadata{}, status.Error(codes.NotFound, "no such thing")
+	}); status.Code(err) != codes.NotFound {
+		t.Errorf("failed Invoke() = %v; want the error of the call", err)
+	}
+
+	states.Set(RouteKey(unary), &RouteState{Fallback: &StaticResponse{Body: `{}`}})
+	if reply, _, err := invoke(unary, false, call); err != nil || reply.Fallback == nil {
+		t.Errorf("Invoke() of a route with a fallback answered %+v, %v; want the fallback", reply, err)
+	}
+	states.Set(RouteKey(unary), &RouteState{Disabled: true})
+	if _, _, err := invoke(unary, true, call); status.Code(err) != codes.Unavailable {
+		t.Errorf("Invoke() of a disabled route = %v; want Unavailable", err)
+	}
+}
@@ -0,0 +1,562 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultJSONRPCPath is the path of the JSON-RPC endpoint if JSONRPCServer.Path is empty.
+	DefaultJSONRPCPath = "/jsonrpc"
+	// DefaultJSONRPCMaxBatch is the number of calls allowed in a batch if JSONRPCServer.MaxBatch is 0.
+	DefaultJSONRPCMaxBatch = 20
+	// DefaultJSONRPCConcurrency is the number of calls of a batch run at once if JSONRPCServer.Concurrency is 0.
+	DefaultJSONRPCConcurrency = 4
+	// DefaultJSONRPCMaxSize is the size limit of the request body if JSONRPCServer.MaxSize is 0.
+	DefaultJSONRPCMaxSize = 4 << 20
+)
+
+// The error codes of JSON-RPC 2.0.
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+	// JSONRPCServerError is the base of the codes of the other gRPC statuses,
+	// which are JSONRPCServerError minus the gRPC code, e.g. -32005 for NotFound.
+	JSONRPCServerError = -32000
+)
+
+// JSONRPCError is the error of a JSON-RPC call.
+type JSONRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// JSONRPCErrorData is the data of the errors of the calls failed with a gRPC status.
+type JSONRPCErrorData struct {
+	// GRPCCode is the name of the gRPC code, e.g. "NotFound".
+	GRPCCode string `json:"grpc_code"`
+	// Body is the body of a rejection by the BeginHandler.
+	Body interface{} `json:"body,omitempty"`
+}
+
+// JSONRPCMethod is a method served by the JSON-RPC endpoint.
+// The generated files export the methods of each service as {Service}JSONRPCMethods.
+type JSONRPCMethod struct {
+	// Name is the name of the method in the form of "Service.Method".
+	Name string
+	// Route is the route of the first binding of the method, whose options apply to the calls.
+	Route *Route
+	// NewRequest returns a new request message of the method.
+	NewRequest func() proto.Message
+	// Bind sets the fields of "msg" bound to the headers and the cookies of the request
+	// by the route, if any.
+	Bind func(req *http.Request, msg proto.Message) error
+	// Invoke calls the target method with "msg" over "conn". The reply has its Message set,
+	// or its Recv for a server streaming method.
+	Invoke func(ctx context.Context, conn *grpc.ClientConn, msg proto.Message, opts ...grpc.CallOption) (*Reply, error)
+}
+
+// JSONRPCServer serves the unary and server streaming "@transmit" methods as JSON-RPC 2.0 methods named
+// "Service.Method", with the params as the request message and the result as the response message,
+// or the array of the response messages of a server streaming method:
+//   POST /jsonrpc
+//   {"jsonrpc": "2.0", "method": "ImGate.Login", "params": {"name": "a"}, "id": 1}
+//
+//   {"jsonrpc": "2.0", "result": {"token": "..."}, "id": 1}
+// The client streaming methods and the methods without http binding are not served.
+// Batches and notifications are supported. A call is run by Gateway.Invoke like the requests of
+// the REST routes of the method, and is recorded by the Admin with the first route: the fields
+// bound to the headers and the cookies are read from them, the path parameters from the same-named
+// fields of the params, and the "@resheader" headers of the unary methods are set on the HTTP response,
+// a batch having the headers of all its calls. The "@status" of the route does not apply, the JSON-RPC
+// responses being 200.
+// It is shared by the Register*HandlerClient calls of the services to serve with WithJSONRPC.
+type JSONRPCServer struct {
+	// Path is the path of the endpoint, DefaultJSONRPCPath if empty.
+	Path string
+	// MaxBatch is the number of calls allowed in a batch, DefaultJSONRPCMaxBatch if 0.
+	MaxBatch int
+	// Concurrency is the number of calls of a batch run at once, DefaultJSONRPCConcurrency if 0.
+	Concurrency int
+	// MaxSize is the size limit of the request body, DefaultJSONRPCMaxSize if 0.
+	MaxSize int64
+
+	mu      sync.RWMutex
+	methods map[string]*jsonrpcBinding
+	muxes   map[*grpcgw.ServeMux]bool
+}
+
+// jsonrpcBinding binds a method to the gateway and the handlers of its Register*HandlerClient call.
+type jsonrpcBinding struct {
+	*JSONRPCMethod
+	gw       *Gateway
+	mux      *grpcgw.ServeMux
+	handlers *Handlers
+	qps      func(time.Duration)
+}
+
+// WithJSONRPC serves the unary and server streaming methods of the service on the JSON-RPC endpoint of "s".
+func WithJSONRPC(s *JSONRPCServer) GatewayOption {
+	return func(g *Gateway) {
+		g.jsonrpc = s
+	}
+}
+
+// HandleJSONRPC adds "methods" to the JSON-RPC server configured with WithJSONRPC, if any,
+// and registers its endpoint on "mux" unless it is already.
+// The other arguments are the ones of the Register*HandlerClient call.
+func (g *Gateway) HandleJSONRPC(mux *grpcgw.ServeMux, methods []*JSONRPCMethod, handlers *Handlers, qpsHandler func(time.Duration)) {
+	s := g.jsonrpc
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.methods == nil {
+		s.methods = make(map[string]*jsonrpcBinding)
+		s.muxes = make(map[*grpcgw.ServeMux]bool)
+	}
+	for _, m := range methods {
+		s.methods[m.Name] = &jsonrpcBinding{
+			JSONRPCMethod: m,
+			gw:            g,
+			mux:           mux,
+			handlers:      handlers,
+			qps:           qpsHandler,
+		}
+	}
+	if s.muxes[mux] {
+		return
+	}
+	s.muxes[mux] = true
+	mux.Handle("POST", literalPattern(s.path()), func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		w, compressed := g.CompressResponse(w, req)
+		defer compressed()
+		if err := g.DecodeRequest(req); err != nil {
+			code := http.StatusBadRequest
+			if se, ok := err.(*statusError); ok {
+				code = se.status
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		s.ServeHTTP(w, req)
+	})
+}
+
+func (s *JSONRPCServer) path() string {
+	if p := "/" + strings.Trim(s.Path, "/"); p != "/" {
+		return p
+	}
+	return DefaultJSONRPCPath
+}
+
+func (s *JSONRPCServer) maxBatch() int {
+	if s.MaxBatch > 0 {
+		return s.MaxBatch
+	}
+	return DefaultJSONRPCMaxBatch
+}
+
+func (s *JSONRPCServer) concurrency() int {
+	if s.Concurrency > 0 {
+		return s.Concurrency
+	}
+	return DefaultJSONRPCConcurrency
+}
+
+func (s *JSONRPCServer) maxSize() int64 {
+	if s.MaxSize > 0 {
+		return s.MaxSize
+	}
+	return DefaultJSONRPCMaxSize
+}
+
+// Methods returns the names of the methods served, in no particular order.
+func (s *JSONRPCServer) Methods() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	return names
+}
+
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	// ID is nil for the notifications, and "null" for the calls with a null id.
+	ID json.RawMessage `json:"id"`
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// ServeHTTP serves a JSON-RPC call or batch. The responses are 200 with the JSON-RPC
+// errors in the body, or 204 if there are only notifications.
+func (s *JSONRPCServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, s.maxSize()+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > s.maxSize() {
+		http.Error(w, fmt.Sprintf("request is larger than %d bytes", s.maxSize()), http.StatusRequestEntityTooLarge)
+		return
+	}
+	data = bytes.TrimSpace(data)
+
+	if len(data) == 0 || data[0] != '[' {
+		resp, ok := s.serveCall(w, req, data)
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		s.write(w, resp)
+		return
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		s.write(w, jsonrpcFailure(nil, &JSONRPCError{Code: JSONRPCParseError, Message: err.Error()}))
+		return
+	}
+	if len(items) == 0 {
+		s.write(w, jsonrpcFailure(nil, &JSONRPCError{Code: JSONRPCInvalidRequest, Message: "empty batch"}))
+		return
+	}
+	if len(items) > s.maxBatch() {
+		s.write(w, jsonrpcFailure(nil, &JSONRPCError{Code: JSONRPCInvalidRequest, Message: fmt.Sprintf("batch has %d calls, more than %d", len(items), s.maxBatch())}))
+		return
+	}
+	resps := make([]*jsonrpcResponse, len(items))
+	headers := make([]http.Header, len(items))
+	runConcurrently(len(items), s.concurrency(), func(i int) {
+		// the calls write their headers, e.g. the session cookies, apart from each other.
+		tw := &tryResponseWriter{header: make(http.Header)}
+		if resp, ok := s.serveCall(tw, req, items[i]); ok {
+			resps[i] = resp
+		}
+		headers[i] = tw.header
+	})
+	var out []*jsonrpcResponse
+	for i, resp := range resps {
+		for k, vs := range headers[i] {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+		if resp != nil {
+			out = append(out, resp)
+		}
+	}
+	if len(out) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.write(w, out)
+}
+
+func (s *JSONRPCServer) write(w http.ResponseWriter, v interface{}) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		grpclog.Infof("Failed to write response: %v", err)
+	}
+}
+
+func jsonrpcFailure(id json.RawMessage, err *JSONRPCError) *jsonrpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &jsonrpcResponse{JSONRPC: "2.0", Error: err, ID: id}
+}
+
+// serveCall serves the call "data" of a request, writing its headers to "w".
+// It returns false for the notifications, which have no response.
+func (s *JSONRPCServer) serveCall(w http.ResponseWriter, req *http.Request, data []byte) (*jsonrpcResponse, bool) {
+	var call jsonrpcRequest
+	if err := json.Unmarshal(data, &call); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			return jsonrpcFailure(nil, &JSONRPCError{Code: JSONRPCInvalidRequest, Message: err.Error()}), true
+		}
+		return jsonrpcFailure(nil, &JSONRPCError{Code: JSONRPCParseError, Message: err.Error()}), true
+	}
+	if len(call.ID) > 0 && !validJSONRPCID(call.ID) {
+		return jsonrpcFailure(nil, &JSONRPCError{Code: JSONRPCInvalidRequest, Message: "id must be a string, a number or null"}), true
+	}
+	if call.JSONRPC != "2.0" || call.Method == "" {
+		return jsonrpcFailure(call.ID, &JSONRPCError{Code: JSONRPCInvalidRequest, Message: `jsonrpc must be "2.0" and method is required`}), true
+	}
+	s.mu.RLock()
+	b := s.methods[call.Method]
+	s.mu.RUnlock()
+
+	var result json.RawMessage
+	var rerr *JSONRPCError
+	if b == nil {
+		rerr = &JSONRPCError{Code: JSONRPCMethodNotFound, Message: fmt.Sprintf("method %q not found", call.Method)}
+	} else {
+		result, rerr = b.call(w, req, call.Params)
+	}
+	if call.ID == nil {
+		return nil, false
+	}
+	if rerr != nil {
+		return jsonrpcFailure(call.ID, rerr), true
+	}
+	return &jsonrpcResponse{JSONRPC: "2.0", Result: result, ID: call.ID}, true
+}
+
+func validJSONRPCID(id json.RawMessage) bool {
+	switch id[0] {
+	case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	}
+	return false
+}
+
+// call calls the method with "params" like the REST handlers of its route do.
+func (b *jsonrpcBinding) call(w http.ResponseWriter, req *http.Request, params json.RawMessage) (json.RawMessage, *JSONRPCError) {
+	begin := time.Now()
+	if b.qps != nil {
+		defer func() { b.qps(time.Since(begin)) }()
+	}
+	g, route := b.gw, b.Route
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	ctx, w, observed := g.ObserveRequest(ctx, w, req, route)
+	defer observed()
+
+	result, err := b.invoke(ctx, w, req, params)
+	if err != nil {
+		recordError(ctx, err)
+		if e, ok := err.(*JSONRPCError); ok {
+			return nil, e
+		}
+		return nil, g.jsonrpcError(err)
+	}
+	return result, nil
+}
+
+// invoke calls the method with "params". The errors are gRPC errors, or JSON-RPC ones
+// for the params and the rejections.
+func (b *jsonrpcBinding) invoke(ctx context.Context, w http.ResponseWriter, req *http.Request, params json.RawMessage) (json.RawMessage, error) {
+	g, route := b.gw, b.Route
+	inbound, outbound := grpcgw.MarshalerForRequest(b.mux, req)
+	inbound, outbound = jsonrpcMarshaler(inbound), jsonrpcMarshaler(outbound)
+
+	msg := b.NewRequest()
+	if p := bytes.TrimSpace(params); len(p) > 0 && string(p) != "null" {
+		if p[0] != '{' {
+			return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: "params must be an object"}
+		}
+		if err := inbound.Unmarshal(p, msg); err != nil {
+			return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: err.Error()}
+		}
+	}
+
+	var result json.RawMessage
+	call := func(ctx context.Context, conn *grpc.ClientConn) (*Reply, grpcgw.ServerMetadata, error) {
+		var md grpcgw.ServerMetadata
+		if b.Bind != nil {
+			if err := b.Bind(req, msg); err != nil {
+				return nil, md, err
+			}
+		}
+		if err := g.HookRequest(ctx, req, route, msg); err != nil {
+			return nil, md, err
+		}
+		reply, err := b.Invoke(ctx, conn, msg, grpc.Header(&md.HeaderMD), grpc.Trailer(&md.TrailerMD))
+		return reply, md, err
+	}
+	answer := func(ctx context.Context, reply *Reply) error {
+		var err error
+		switch {
+		case reply.Fallback != nil:
+			result = jsonrpcValue([]byte(reply.Fallback.Body))
+		case reply.Decision != nil:
+			result, err = b.decide(outbound, reply.Decision)
+		case reply.Recv != nil:
+			result, err = b.collect(outbound, reply.Recv)
+		default:
+			// the status of the route does not apply, the JSON-RPC responses being 200.
+			var resp proto.Message
+			if _, resp, err = g.PrepareResponse(w, route, reply.Message); err != nil {
+				return err
+			}
+			result, err = b.marshal(outbound, resp)
+		}
+		return err
+	}
+	if _, err := g.Invoke(ctx, b.mux, w, req, route, jsonrpcPathParams(route, msg), b.handlers, call, answer); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// decide returns the result of the decision "d" of the BeginHandler, which is not ActionContinue.
+func (b *jsonrpcBinding) decide(m grpcgw.Marshaler, d *Decision) (json.RawMessage, error) {
+	switch d.Action {
+	case ActionReject:
+		code := d.Status
+		if code == 0 {
+			code = http.StatusForbidden
+		}
+		c := codeOfHTTPStatus(code)
+		return nil, &JSONRPCError{Code: jsonrpcCode(c), Message: http.StatusText(code), Data: JSONRPCErrorData{GRPCCode: c.String(), Body: d.Body}}
+	case ActionRespond:
+		return b.marshal(m, d.Message)
+	}
+	return nil, status.Errorf(codes.FailedPrecondition, "decision %d not supported by JSON-RPC", d.Action)
+}
+
+// jsonrpcPathParams returns the path parameter of the hash key of "route", if it is one,
+// read from the same-named field of the params "msg", as the calls have no path.
+func jsonrpcPathParams(route *Route, msg proto.Message) map[string]string {
+	if route.HashKey.Source != HashKeyFromPath {
+		return nil
+	}
+	v, err := responseField(msg, route.HashKey.Name)
+	if err != nil {
+		return nil
+	}
+	if values := headerValues(v); len(values) > 0 {
+		return map[string]string{route.HashKey.Name: values[0]}
+	}
+	return nil
+}
+
+// collect returns the result of a server streaming method: the array of the messages received with "recv".
+func (b *jsonrpcBinding) collect(m grpcgw.Marshaler, recv func() (proto.Message, error)) (json.RawMessage, error) {
+	items := []json.RawMessage{}
+	for {
+		msg, err := recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		item, err := b.marshal(m, msg)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	buf, err := json.Marshal(items)
+	if err != nil {
+		return nil, &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()}
+	}
+	return buf, nil
+}
+
+func (b *jsonrpcBinding) marshal(m grpcgw.Marshaler, msg proto.Message) (json.RawMessage, error) {
+	buf, err := m.Marshal(msg)
+	if err != nil {
+		return nil, &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()}
+	}
+	return buf, nil
+}
+
+// jsonrpcMarshaler returns the marshaler of the params and the results: "m" without
+// the envelope if it is a JSON one, or else the default JSON marshaler.
+func jsonrpcMarshaler(m grpcgw.Marshaler) grpcgw.Marshaler {
+	m = unwrapMarshaler(m)
+	if strings.Contains(m.ContentType(), "json") {
+		return m
+	}
+	return &grpcgw.JSONPb{OrigName: true}
+}
+
+// jsonrpcValue returns "data" as a JSON value: itself if it is valid JSON, or else a string.
+func jsonrpcValue(data []byte) json.RawMessage {
+	if json.Valid(data) {
+		return data
+	}
+	buf, _ := json.Marshal(string(data))
+	return buf
+}
+
+// jsonrpcCode returns the JSON-RPC error code of the gRPC code "c".
+func jsonrpcCode(c codes.Code) int {
+	switch c {
+	case codes.InvalidArgument:
+		return JSONRPCInvalidParams
+	case codes.Unimplemented:
+		return JSONRPCMethodNotFound
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		return JSONRPCInternalError
+	}
+	return JSONRPCServerError - int(c)
+}
+
+// jsonrpcError returns the JSON-RPC error of the gRPC error "err", from the same status as HTTPError writes.
+func (g *Gateway) jsonrpcError(err error) *JSONRPCError {
+	st := g.errorStatus(err)
+	return &JSONRPCError{Code: jsonrpcCode(st.Code()), Message: st.Message(), Data: JSONRPCErrorData{GRPCCode: st.Code().String()}}
+}
+
+// codeOfHTTPStatus returns the gRPC code closest to the HTTP status "code".
+func codeOfHTTPStatus(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if code >= 500 {
+		return codes.Internal
+	}
+	return codes.FailedPrecondition
+}
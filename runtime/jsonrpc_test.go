@@ -0,0 +1,268 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestJSONRPC(t *testing.T) {
+	echo := &JSONRPCMethod{
+		Name:       "Test.Echo",
+		Route:      &Route{Service: "gw.Test", HTTPMethod: "POST", Path: "/v1/echo", Method: "gw.Echo/Echo"},
+		NewRequest: func() proto.Message { return &descriptor.UninterpretedOption{} },
+		Invoke: func(ctx context.Context, conn *grpc.ClientConn, msg proto.Message, opts ...grpc.CallOption) (*Reply, error) {
+			req := msg.(*descriptor.UninterpretedOption)
+			if req.GetIdentifierValue() == "missing" {
+				return nil, status.Error(codes.NotFound, "no such thing")
+			}
+			return &Reply{Message: &descriptor.UninterpretedOption{IdentifierValue: proto.String(req.GetIdentifierValue() + "!")}}, nil
+		},
+	}
+	var invoked []string
+	hooked := WithRequestHook(func(ctx context.Context, meth string, req *http.Request, msg proto.Message) error {
+		invoked = append(invoked, meth)
+		return nil
+	})
+	server := &JSONRPCServer{Concurrency: 1}
+	gw := NewGateway(WithJSONRPC(server), hooked)
+	mux := grpcgw.NewServeMux()
+	makeConn := func(meth string) (*grpc.ClientConn, func(), error) { return nil, func() {}, nil }
+	begin := func(ctx context.Context, meth string, req *http.Request) *Decision {
+		if req.Header.Get("Authorization") == "" {
+			return Reject(http.StatusUnauthorized, map[string]string{"reason": "login"})
+		}
+		return nil
+	}
+	gw.HandleJSONRPC(mux, []*JSONRPCMethod{echo}, &Handlers{MakeConn: makeConn, Begin: begin}, nil)
+
+	post := func(body string, auth bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/jsonrpc", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if auth {
+			req.Header.Set("Authorization", "Bearer a")
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	type response struct {
+		JSONRPC string          `json:"jsonrpc"`
+		Result  json.RawMessage `json:"result"`
+		Error   *struct {
+			Code int `json:"code"`
+			Data struct {
+				GRPCCode string `json:"grpc_code"`
+			} `json:"data"`
+		} `json:"error"`
+		ID json.RawMessage `json:"id"`
+	}
+
+	rec := post(`{"jsonrpc": "2.0", "method": "Test.Echo", "params": {"identifier_value": "hi"}, "id": "a"}`, true)
+	var single response
+	if err := json.Unmarshal(rec.Body.Bytes(), &single); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("call wrote %d %s; want 200 and a response", rec.Code, rec.Body.String())
+	}
+	if single.JSONRPC != "2.0" || string(single.ID) != `"a"` || string(single.Result) != `{"identifier_value":"hi!"}` || single.Error != nil {
+		t.Errorf("call = %s; want the result %s with id \"a\"", rec.Body.String(), `{"identifier_value":"hi!"}`)
+	}
+
+	invoked = nil
+	rec = post(`[
+		{"jsonrpc": "2.0", "method": "Test.Echo", "params": {"identifier_value": "x"}, "id": 1},
+		{"jsonrpc": "2.0", "method": "Test.Echo", "params": {"identifier_value": "notified"}},
+		{"jsonrpc": "2.0", "method": "Test.Nope", "id": 2},
+		{"jsonrpc": "2.0", "method": "Test.Echo", "params": [1], "id": 3},
+		{"jsonrpc": "2.0", "method": "Test.Echo", "params": {"identifier_value": "missing"}, "id": 4},
+		{"method": "Test.Echo", "id": 5},
+		{"jsonrpc": "2.0", "method": "Test.Echo", "id": null},
+		1
+	]`, true)
+	var batch []response
+	if err := json.Unmarshal(rec.Body.Bytes(), &batch); err != nil {
+		t.Fatalf("batch wrote %s: %v", rec.Body.String(), err)
+	}
+	want := []struct {
+		id, result string
+		code       int
+		grpcCode   string
+	}{
+		{id: "1", result: `{"identifier_value":"x!"}`},
+		{id: "2", code: JSONRPCMethodNotFound},
+		{id: "3", code: JSONRPCInvalidParams},
+		{id: "4", code: -32005, grpcCode: "NotFound"},
+		{id: "5", code: JSONRPCInvalidRequest},
+		{id: "null", result: `{"identifier_value":"!"}`},
+		{id: "null", code: JSONRPCInvalidRequest},
+	}
+	if len(batch) != len(want) {
+		t.Fatalf("batch returned %d responses; want %d: %s", len(batch), len(want), rec.Body.String())
+	}
+	for i, w := range want {
+		got := batch[i]
+		code := 0
+		grpcCode := ""
+		if got.Error != nil {
+			code, grpcCode = got.Error.Code, got.Error.Data.GRPCCode
+		}
+		if string(got.ID) != w.id || string(got.Result) != w.result || code != w.code || grpcCode != w.grpcCode {
+			t.Errorf("response %d = id %s result %s code %d %q; want id %s result %s code %d %q", i, got.ID, got.Result, code, grpcCode, w.id, w.result, w.code, w.grpcCode)
+		}
+	}
+	if len(invoked) != 4 {
+		t.Errorf("request hook called %d times; want 4 including the notification", len(invoked))
+	}
+
+	if rec := post(`{"jsonrpc": "2.0", "method": "Test.Echo"}`, true); rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("notification wrote %d %q; want 204 without body", rec.Code, rec.Body.String())
+	}
+	for body, code := range map[string]int{
+		`{"jsonrpc": "2.0", "method": "Test.Echo", "id": 1}`: -32016,
+		`{"jsonrpc": "2.0", "method"`:                         JSONRPCParseError,
+		`[]`:                                                  JSONRPCInvalidRequest,
+	} {
+		rec := post(body, false)
+		var resp response
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == nil || resp.Error.Code != code {
+			t.Errorf("call %s wrote %s; want error %d", body, rec.Body.String(), code)
+		}
+	}
+}
+
+func TestJSONRPCBinding(t *testing.T) {
+	echo := &JSONRPCMethod{
+		Name: "Test.Echo",
+		Route: &Route{
+			Service: "gw.Test", HTTPMethod: "POST", Path: "/v1/echo/{identifier_value}", Method: "gw.Echo/Echo",
+			HashKey:         HashKey{Source: HashKeyFromPath, Name: "identifier_value"},
+			ResponseHeaders: []ResponseHeader{{Field: "identifier_value", Header: "X-Id", Omit: true}},
+			Status:          http.StatusCreated,
+		},
+		NewRequest: func() proto.Message { return &descriptor.UninterpretedOption{} },
+		Bind: func(req *http.Request, msg proto.Message) error {
+			if v, ok := RequestValue(req, MetadataFromHeader, "X-Aggregate"); ok {
+				msg.(*descriptor.UninterpretedOption).AggregateValue = proto.String(v)
+			}
+			return nil
+		},
+		Invoke: func(ctx context.Context, conn *grpc.ClientConn, msg proto.Message, opts ...grpc.CallOption) (*Reply, error) {
+			req := msg.(*descriptor.UninterpretedOption)
+			key, _ := HashKeyFromContext(ctx)
+			return &Reply{Message: &descriptor.UninterpretedOption{
+				IdentifierValue: req.IdentifierValue,
+				AggregateValue:  proto.String(req.GetAggregateValue() + "/" + key),
+			}}, nil
+		},
+	}
+	server := &JSONRPCServer{}
+	gw := NewGateway(WithJSONRPC(server))
+	mux := grpcgw.NewServeMux()
+	makeConn := func(meth string) (*grpc.ClientConn, func(), error) { return nil, func() {}, nil }
+	gw.HandleJSONRPC(mux, []*JSONRPCMethod{echo}, &Handlers{MakeConn: makeConn}, nil)
+
+	req := httptest.NewRequest("POST", "/jsonrpc", strings.NewReader(`{"jsonrpc": "2.0", "method": "Test.Echo", "params": {"identifier_value": "k1"}, "id": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Aggregate", "a")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("call wrote %d %s; want 200 and a response", rec.Code, rec.Body.String())
+	}
+	if string(resp.Result) != `{"aggregate_value":"a/k1"}` {
+		t.Errorf("result = %s; want the header bound, the hash key read from the params and the header field omitted", resp.Result)
+	}
+	if got := rec.Header().Get("X-Id"); got != "k1" {
+		t.Errorf("X-Id = %q; want %q", got, "k1")
+	}
+}
+
+func TestJSONRPCStream(t *testing.T) {
+	watch := &JSONRPCMethod{
+		Name:       "Test.Watch",
+		Route:      &Route{Service: "gw.Test", HTTPMethod: "GET", Path: "/v1/watch", Method: "gw.Echo/Watch", Streaming: StreamingServer},
+		NewRequest: func() proto.Message { return &descriptor.UninterpretedOption{} },
+		Invoke: func(ctx context.Context, conn *grpc.ClientConn, msg proto.Message, opts ...grpc.CallOption) (*Reply, error) {
+			n, i := msg.(*descriptor.UninterpretedOption).GetPositiveIntValue(), uint64(0)
+			return &Reply{Recv: func() (proto.Message, error) {
+				if i == n {
+					return nil, io.EOF
+				}
+				i++
+				return &descriptor.UninterpretedOption{PositiveIntValue: proto.Uint64(i)}, nil
+			}}, nil
+		},
+	}
+	server := &JSONRPCServer{}
+	gw := NewGateway(WithJSONRPC(server))
+	mux := grpcgw.NewServeMux()
+	makeConn := func(meth string) (*grpc.ClientConn, func(), error) { return nil, func() {}, nil }
+	gw.HandleJSONRPC(mux, []*JSONRPCMethod{watch}, &Handlers{MakeConn: makeConn}, nil)
+
+	for params, want := range map[string]string{
+		`{"positive_int_value": 2}`: `[{"positive_int_value":"1"},{"positive_int_value":"2"}]`,
+		`{}`:                        `[]`,
+	} {
+		req := httptest.NewRequest("POST", "/jsonrpc", strings.NewReader(`{"jsonrpc": "2.0", "method": "Test.Watch", "params": `+params+`, "id": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		var resp struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || string(resp.Result) != want {
+			t.Errorf("call with %s wrote %s; want the result %s", params, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestJSONRPCError(t *testing.T) {
+	fail := &JSONRPCMethod{
+		Name:       "Test.Fail",
+		Route:      &Route{Service: "gw.Test", HTTPMethod: "POST", Path: "/v1/fail", Method: "gw.Echo/Fail"},
+		NewRequest: func() proto.Message { return &descriptor.UninterpretedOption{} },
+		Invoke: func(ctx context.Context, conn *grpc.ClientConn, msg proto.Message, opts ...grpc.CallOption) (*Reply, error) {
+			return nil, status.Error(codes.Internal, "db password is wrong")
+		},
+	}
+	server := &JSONRPCServer{}
+	admin := &Admin{}
+	gw := NewGateway(WithJSONRPC(server), WithErrorConfig(ErrorConfig{Production: true}), WithAdmin(admin))
+	gw.AddRoutes([]*Route{fail.Route})
+	mux := grpcgw.NewServeMux()
+	makeConn := func(meth string) (*grpc.ClientConn, func(), error) { return nil, func() {}, nil }
+	gw.HandleJSONRPC(mux, []*JSONRPCMethod{fail}, &Handlers{MakeConn: makeConn}, nil)
+
+	req := httptest.NewRequest("POST", "/jsonrpc", strings.NewReader(`{"jsonrpc": "2.0", "method": "Test.Fail", "id": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	var resp struct {
+		Error *JSONRPCError `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == nil {
+		t.Fatalf("call wrote %s; want an error", rec.Body.String())
+	}
+	if resp.Error.Code != JSONRPCInternalError || resp.Error.Message != http.StatusText(http.StatusInternalServerError) {
+		t.Errorf("error = %d %q; want %d %q", resp.Error.Code, resp.Error.Message, JSONRPCInternalError, http.StatusText(http.StatusInternalServerError))
+	}
+	if stats := admin.Routes(); len(stats) != 1 || stats[0].Requests != 1 || stats[0].Errors != 1 {
+		t.Errorf("admin stats = %+v; want the call recorded as an error", stats)
+	}
+	if errs := admin.Errors(); len(errs) != 1 || errs[0].Method != "gw.Echo/Fail" {
+		t.Errorf("admin errors = %+v; want the error of the call", errs)
+	}
+}
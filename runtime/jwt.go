@@ -0,0 +1,472 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthMode describes whether a route requires an authenticated caller.
+// It is set with the "@auth" comment tag of the method.
+type AuthMode string
+
+const (
+	// AuthRequired routes are rejected unless the request carries a valid credential.
+	AuthRequired AuthMode = "required"
+	// AuthOptional routes validate the credential if there is one.
+	AuthOptional AuthMode = "optional"
+	// AuthNone routes skip the authentication.
+	AuthNone AuthMode = "none"
+)
+
+// Authenticator authenticates the requests of the generated handlers.
+type Authenticator interface {
+	// Authenticate validates the credential of "req" against the requirements of "route".
+	// It returns the context to call the target method with, or a status error.
+	Authenticate(ctx context.Context, req *http.Request, route *Route) (context.Context, error)
+}
+
+// WithAuthenticator enables the authentication of the registered routes.
+func WithAuthenticator(a Authenticator) GatewayOption {
+	return func(g *Gateway) {
+		g.authenticator = a
+	}
+}
+
+// Authenticate authenticates "req" if an Authenticator is configured.
+func (g *Gateway) Authenticate(ctx context.Context, req *http.Request, route *Route) (context.Context, error) {
+	if g.authenticator == nil || route.Auth == AuthNone {
+		return ctx, nil
+	}
+	return g.authenticator.Authenticate(ctx, req, route)
+}
+
+// JWK is a JSON Web Key as defined in RFC 7517. Only the members needed to
+// verify HS256, RS256 and ES256 signatures are supported.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	// RSA public key
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC public key
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	// symmetric key
+	K string `json:"k,omitempty"`
+}
+
+type verificationKey struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+// KeySet is a set of keys to verify JWT signatures with.
+type KeySet struct {
+	keys []verificationKey
+}
+
+// ParseJWKS parses a JSON Web Key Set document.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %v", err)
+	}
+	ks := &KeySet{}
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		vk, err := k.verificationKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key #%d (kid %q) in JWKS: %v", i, k.Kid, err)
+		}
+		ks.keys = append(ks.keys, vk)
+	}
+	return ks, nil
+}
+
+// LoadJWKSFile loads a JSON Web Key Set from a local file.
+func LoadJWKSFile(path string) (*KeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS from '%v': %v", path, err)
+	}
+	return ParseJWKS(data)
+}
+
+// Len returns the number of keys in the set.
+func (ks *KeySet) Len() int {
+	return len(ks.keys)
+}
+
+func (k JWK) verificationKey() (verificationKey, error) {
+	vk := verificationKey{kid: k.Kid, alg: k.Alg}
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return vk, fmt.Errorf("bad modulus: %v", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return vk, fmt.Errorf("bad exponent: %v", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return vk, errors.New("exponent too large")
+		}
+		if vk.alg == "" {
+			vk.alg = "RS256"
+		}
+		vk.key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		if k.Crv != "P-256" {
+			return vk, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return vk, fmt.Errorf("bad x coordinate: %v", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return vk, fmt.Errorf("bad y coordinate: %v", err)
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return vk, errors.New("point is not on the curve")
+		}
+		if vk.alg == "" {
+			vk.alg = "ES256"
+		}
+		vk.key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return vk, fmt.Errorf("bad symmetric key: %v", err)
+		}
+		if vk.alg == "" {
+			vk.alg = "HS256"
+		}
+		vk.key = secret
+	default:
+		return vk, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+	switch vk.alg {
+	case "RS256", "ES256", "HS256":
+	default:
+		return vk, fmt.Errorf("unsupported algorithm %q", vk.alg)
+	}
+	return vk, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// verify checks "sig" of "signed" with the keys matching "kid" and "alg".
+func (ks *KeySet) verify(kid, alg string, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+	tried := false
+	for _, k := range ks.keys {
+		if k.alg != alg || (kid != "" && k.kid != "" && k.kid != kid) {
+			continue
+		}
+		tried = true
+		switch key := k.key.(type) {
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if len(sig) != 64 {
+				continue
+			}
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			if ecdsa.Verify(key, digest[:], r, s) {
+				return nil
+			}
+		case []byte:
+			mac := hmac.New(sha256.New, key)
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return nil
+			}
+		}
+	}
+	if !tried {
+		return fmt.Errorf("no key for kid %q and alg %q", kid, alg)
+	}
+	return errors.New("signature mismatch")
+}
+
+// Claims are the claims of a validated JWT.
+type Claims map[string]interface{}
+
+// String returns the string claim "name".
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns the claim "name" as a list. A string claim is split by spaces
+// as the "scope" claim of RFC 8693.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var list []string
+		for _, it := range v {
+			if s, ok := it.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func (c Claims) time(name string) (time.Time, bool, error) {
+	v, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("claim %q is not a number", name)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("claim %q is not a number", name)
+	}
+	return time.Unix(int64(f), 0), true, nil
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the claims attached to "ctx" by JWTAuthenticator.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(Claims)
+	return c, ok
+}
+
+// JWTAuthenticator is an Authenticator which validates bearer JSON Web Tokens
+// signed with HS256, RS256 or ES256.
+type JWTAuthenticator struct {
+	// Keys verify the token signatures. It is required.
+	Keys *KeySet
+	// Issuer is the expected "iss" claim. It is not checked if empty.
+	Issuer string
+	// Audience is the expected "aud" claim. It is not checked if empty.
+	Audience string
+	// Leeway is the allowed clock skew when checking "exp" and "nbf".
+	Leeway time.Duration
+	// ScopeClaim is the claim with the scopes of the token. "scope" is used if empty.
+	ScopeClaim string
+	// RoleClaim is the claim with the roles of the token. "roles" is used if empty.
+	RoleClaim string
+	// ForwardClaims maps claim names to the gRPC metadata keys they are forwarded as.
+	ForwardClaims map[string]string
+	// Now returns the current time. time.Now is used if nil.
+	Now func() time.Time
+}
+
+// Authenticate implements Authenticator.
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, req *http.Request, route *Route) (context.Context, error) {
+	token := bearerToken(req)
+	if token == "" {
+		if route.Auth == AuthOptional {
+			return ctx, nil
+		}
+		return ctx, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	claims, err := a.Validate(token)
+	if err != nil {
+		return ctx, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+	}
+	if err := a.authorize(claims, route); err != nil {
+		return ctx, err
+	}
+	var pairs []string
+	for claim, key := range a.ForwardClaims {
+		key = strings.ToLower(key)
+		v, ok := claims[claim]
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			pairs = append(pairs, key, v)
+		case []interface{}:
+			for _, s := range claims.Strings(claim) {
+				pairs = append(pairs, key, s)
+			}
+		default:
+			pairs = append(pairs, key, fmt.Sprint(v))
+		}
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
+	return context.WithValue(ctx, claimsKey{}, claims), nil
+}
+
+// authorize checks the scopes and the roles required by "route".
+func (a *JWTAuthenticator) authorize(claims Claims, route *Route) error {
+	scopeClaim := a.ScopeClaim
+	if scopeClaim == "" {
+		scopeClaim = "scope"
+	}
+	roleClaim := a.RoleClaim
+	if roleClaim == "" {
+		roleClaim = "roles"
+	}
+	if missing := missingValues(route.Scopes, claims.Strings(scopeClaim)); len(missing) > 0 {
+		return status.Errorf(codes.PermissionDenied, "missing scopes: %s", strings.Join(missing, " "))
+	}
+	if len(route.Roles) == 0 {
+		return nil
+	}
+	roles := claims.Strings(roleClaim)
+	for _, want := range route.Roles {
+		for _, have := range roles {
+			if want == have {
+				return nil
+			}
+		}
+	}
+	return status.Errorf(codes.PermissionDenied, "one of roles required: %s", strings.Join(route.Roles, " "))
+}
+
+func missingValues(want, have []string) []string {
+	var missing []string
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if w == h {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, w)
+		}
+	}
+	return missing
+}
+
+// Validate verifies the signature of "token" and checks its exp, nbf, iss and aud claims.
+func (a *JWTAuthenticator) Validate(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %v", err)
+	}
+	if a.Keys == nil {
+		return nil, errors.New("no key set")
+	}
+	if err := a.Keys.verify(header.Kid, header.Alg, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %v", err)
+	}
+
+	now := time.Now()
+	if a.Now != nil {
+		now = a.Now()
+	}
+	exp, ok, err := claims.time("exp")
+	if err != nil {
+		return nil, err
+	}
+	if ok && !now.Before(exp.Add(a.Leeway)) {
+		return nil, errors.New("token expired")
+	}
+	nbf, ok, err := claims.time("nbf")
+	if err != nil {
+		return nil, err
+	}
+	if ok && now.Add(a.Leeway).Before(nbf) {
+		return nil, errors.New("token not valid yet")
+	}
+	if a.Issuer != "" && claims.String("iss") != a.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.String("iss"))
+	}
+	if a.Audience != "" {
+		auds := claims.Strings("aud")
+		if aud, ok := claims["aud"].(string); ok {
+			auds = []string{aud}
+		}
+		found := false
+		for _, aud := range auds {
+			if aud == a.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("audience %q not accepted", a.Audience)
+		}
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func bearerToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return strings.TrimSpace(auth[len(prefix):])
+	}
+	return ""
+}
@@ -0,0 +1,227 @@
+package runtime
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var b64 = base64.RawURLEncoding
+
+func padded(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
+type testKeys struct {
+	rsa    *rsa.PrivateKey
+	ec     *ecdsa.PrivateKey
+	secret []byte
+	jwks   []byte
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	jwks, _ := json.Marshal(map[string][]JWK{"keys": {
+		{Kty: "RSA", Kid: "rsa1", N: b64.EncodeToString(rk.N.Bytes()), E: b64.EncodeToString(big.NewInt(int64(rk.E)).Bytes())},
+		{Kty: "EC", Kid: "ec1", Crv: "P-256", X: b64.EncodeToString(padded(ek.X, 32)), Y: b64.EncodeToString(padded(ek.Y, 32))},
+		{Kty: "oct", Kid: "hs1", K: b64.EncodeToString(secret)},
+		{Kty: "RSA", Kid: "enc1", Use: "enc", N: "AQAB", E: "AQAB"},
+	}})
+	return &testKeys{rsa: rk, ec: ek, secret: secret, jwks: jwks}
+}
+
+func (k *testKeys) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	hdr, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	body, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(hdr) + "." + b64.EncodeToString(body)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch alg {
+	case "RS256":
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(padded(r, 32), padded(s, 32)...)
+	case "HS256":
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func TestLoadJWKSFile(t *testing.T) {
+	keys := newTestKeys(t)
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, keys.jwks, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ks, err := LoadJWKSFile(path)
+	if err != nil {
+		t.Fatalf("LoadJWKSFile(%q) failed with %v; want success", path, err)
+	}
+	// the encryption key is skipped
+	if got, want := ks.Len(), 3; got != want {
+		t.Errorf("ks.Len() = %d; want %d", got, want)
+	}
+	if _, err := ParseJWKS([]byte(`{"keys":[{"kty":"EC","crv":"P-384","x":"AQ","y":"AQ"}]}`)); err == nil {
+		t.Errorf("ParseJWKS() with a P-384 key succeeded; want failure")
+	}
+}
+
+func TestJWTAuthenticatorValidate(t *testing.T) {
+	keys := newTestKeys(t)
+	ks, err := ParseJWKS(keys.jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0)
+	a := &JWTAuthenticator{
+		Keys:     ks,
+		Issuer:   "https://auth.example.com",
+		Audience: "imgate",
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return now },
+	}
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": "https://auth.example.com",
+			"aud": []string{"imgate", "other"},
+			"exp": now.Add(time.Hour).Unix(),
+			"nbf": now.Add(-time.Hour).Unix(),
+		}
+	}
+	for _, spec := range []struct {
+		name    string
+		alg     string
+		kid     string
+		mutate  func(map[string]interface{})
+		tamper  bool
+		wantErr bool
+	}{
+		{name: "rs256", alg: "RS256", kid: "rsa1"},
+		{name: "es256", alg: "ES256", kid: "ec1"},
+		{name: "hs256 without kid", alg: "HS256"},
+		{name: "alg mismatch", alg: "HS256", kid: "rsa1", wantErr: true},
+		{name: "tampered", alg: "RS256", kid: "rsa1", tamper: true, wantErr: true},
+		{name: "expired", alg: "ES256", kid: "ec1", mutate: func(c map[string]interface{}) { c["exp"] = now.Add(-2 * time.Minute).Unix() }, wantErr: true},
+		{name: "expired within leeway", alg: "ES256", kid: "ec1", mutate: func(c map[string]interface{}) { c["exp"] = now.Add(-30 * time.Second).Unix() }},
+		{name: "not yet valid", alg: "ES256", kid: "ec1", mutate: func(c map[string]interface{}) { c["nbf"] = now.Add(2 * time.Minute).Unix() }, wantErr: true},
+		{name: "wrong issuer", alg: "HS256", kid: "hs1", mutate: func(c map[string]interface{}) { c["iss"] = "evil" }, wantErr: true},
+		{name: "string audience", alg: "HS256", kid: "hs1", mutate: func(c map[string]interface{}) { c["aud"] = "imgate" }},
+		{name: "wrong audience", alg: "HS256", kid: "hs1", mutate: func(c map[string]interface{}) { c["aud"] = "other" }, wantErr: true},
+	} {
+		claims := valid()
+		if spec.mutate != nil {
+			spec.mutate(claims)
+		}
+		token := keys.sign(t, spec.alg, spec.kid, claims)
+		if spec.tamper {
+			token = keys.sign(t, spec.alg, spec.kid, map[string]interface{}{"admin": true})[:len(token)/3] + token[len(token)/3:]
+		}
+		_, err := a.Validate(token)
+		if spec.wantErr && err == nil {
+			t.Errorf("%s: Validate() succeeded; want failure", spec.name)
+		}
+		if !spec.wantErr && err != nil {
+			t.Errorf("%s: Validate() failed with %v; want success", spec.name, err)
+		}
+	}
+}
+
+func TestJWTAuthenticatorAuthenticate(t *testing.T) {
+	keys := newTestKeys(t)
+	ks, err := ParseJWKS(keys.jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &JWTAuthenticator{
+		Keys:          ks,
+		ForwardClaims: map[string]string{"sub": "uid", "roles": "Role"},
+	}
+	g := NewGateway(WithAuthenticator(a))
+	token := keys.sign(t, "RS256", "rsa1", map[string]interface{}{
+		"sub":   "10086",
+		"scope": "im:read im:write",
+		"roles": []string{"user"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	for _, spec := range []struct {
+		route *Route
+		token string
+		want  codes.Code
+	}{
+		{route: &Route{Auth: AuthRequired}, want: codes.Unauthenticated},
+		{route: &Route{Auth: AuthOptional}, want: codes.OK},
+		{route: &Route{Auth: AuthNone}, token: "garbage", want: codes.OK},
+		{route: &Route{Auth: AuthRequired}, token: "garbage", want: codes.Unauthenticated},
+		{route: &Route{Auth: AuthRequired, Scopes: []string{"im:read"}, Roles: []string{"admin", "user"}}, token: token, want: codes.OK},
+		{route: &Route{Auth: AuthRequired, Scopes: []string{"im:read", "im:admin"}}, token: token, want: codes.PermissionDenied},
+		{route: &Route{Auth: AuthRequired, Roles: []string{"admin"}}, token: token, want: codes.PermissionDenied},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if spec.token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", spec.token))
+		}
+		_, err := g.Authenticate(context.Background(), req, spec.route)
+		if got := status.Code(err); got != spec.want {
+			t.Errorf("Authenticate() with route %+v = %v; want code %v", spec.route, err, spec.want)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "bearer "+token)
+	ctx, err := g.Authenticate(context.Background(), req, &Route{Auth: AuthRequired})
+	if err != nil {
+		t.Fatalf("Authenticate() failed with %v; want success", err)
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if got := md.Get("uid"); len(got) != 1 || got[0] != "10086" {
+		t.Errorf("outgoing metadata uid = %v; want [10086]", got)
+	}
+	if got := md.Get("role"); len(got) != 1 || got[0] != "user" {
+		t.Errorf("outgoing metadata role = %v; want [user]", got)
+	}
+	if claims, ok := ClaimsFromContext(ctx); !ok || claims.String("sub") != "10086" {
+		t.Errorf("ClaimsFromContext() = %v, %v; want the claims of the token", claims, ok)
+	}
+}
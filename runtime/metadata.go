@@ -0,0 +1,224 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataSource is the part of the HTTP request a MetadataMapping reads from.
+type MetadataSource string
+
+const (
+	// MetadataFromHeader reads a request header.
+	MetadataFromHeader MetadataSource = "header"
+	// MetadataFromCookie reads a request cookie.
+	MetadataFromCookie MetadataSource = "cookie"
+)
+
+// MetadataMapping forwards a header or a cookie of the HTTP request to the
+// target service as gRPC metadata. It is declared with the "@metadata" comment
+// tag of the service or the method, or loaded with LoadMetadataMappingsFromYAML.
+type MetadataMapping struct {
+	// Source is where the value is read from.
+	Source MetadataSource `json:"source"`
+	// Name is the name of the header or the cookie.
+	Name string `json:"name"`
+	// Key is the gRPC metadata key. The lower cased Name is used if empty.
+	Key string `json:"key,omitempty"`
+	// Required rejects requests without the value.
+	Required bool `json:"required,omitempty"`
+	// Pattern is a regular expression the value must match, if not empty.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// MetadataKey returns the gRPC metadata key of the mapping.
+func (m MetadataMapping) MetadataKey() string {
+	if m.Key != "" {
+		return strings.ToLower(m.Key)
+	}
+	return strings.ToLower(m.Name)
+}
+
+// Validate checks the mapping is well formed.
+func (m MetadataMapping) Validate() error {
+	switch m.Source {
+	case MetadataFromHeader, MetadataFromCookie:
+	default:
+		return fmt.Errorf("unknown metadata source %q", m.Source)
+	}
+	if m.Name == "" {
+		return fmt.Errorf("no %s name in metadata mapping", m.Source)
+	}
+	if _, err := compilePattern(m.Pattern); err != nil {
+		return fmt.Errorf("bad pattern of %s %s: %v", m.Source, m.Name, err)
+	}
+	return nil
+}
+
+// value extracts the mapped value from "req".
+func (m MetadataMapping) value(req *http.Request) (string, error) {
+	v, _ := RequestValue(req, m.Source, m.Name)
+	if v == "" {
+		if m.Required {
+			return "", status.Errorf(codes.InvalidArgument, "missing %s %s", m.Source, m.Name)
+		}
+		return "", nil
+	}
+	re, err := compilePattern(m.Pattern)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "bad pattern of %s %s: %v", m.Source, m.Name, err)
+	}
+	if re != nil && !re.MatchString(v) {
+		return "", status.Errorf(codes.InvalidArgument, "invalid %s %s", m.Source, m.Name)
+	}
+	return v, nil
+}
+
+// RequestValue returns the value of the header or the cookie "name" of "req",
+// and whether it is present and not empty.
+// The generated code uses it to populate the fields bound with the
+// "httpgw.from_header" and "httpgw.from_cookie" field options.
+func RequestValue(req *http.Request, source MetadataSource, name string) (string, bool) {
+	var v string
+	switch source {
+	case MetadataFromHeader:
+		v = req.Header.Get(name)
+	case MetadataFromCookie:
+		if c, err := req.Cookie(name); err == nil {
+			v = c.Value
+		}
+	}
+	return v, v != ""
+}
+
+var patterns sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// LoadMetadataMappingsFromYAML loads a list of metadata mappings from a YAML file, e.g.
+//
+//   - source: cookie
+//     name: ZQ_GUID
+//     key: guid
+//     required: true
+//   - source: header
+//     name: X-Device
+//     key: device
+//     pattern: "^(ios|android|web)$"
+func LoadMetadataMappingsFromYAML(path string) ([]MetadataMapping, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata mappings from '%v': %v", path, err)
+	}
+	var mappings []MetadataMapping
+	if err := yaml.Unmarshal(data, &mappings); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata mappings in '%v': %v", path, err)
+	}
+	for _, m := range mappings {
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("%v in '%v'", err, path)
+		}
+	}
+	return mappings, nil
+}
+
+// WithMetadataMappings adds metadata mappings applied to every registered route
+// in addition to the ones declared by the comment tags.
+func WithMetadataMappings(mappings ...MetadataMapping) GatewayOption {
+	return func(g *Gateway) {
+		g.metadataMappings = append(g.metadataMappings, mappings...)
+	}
+}
+
+// WithOutboundMetadataAllowlist limits the gRPC metadata sent to the target services
+// to the given keys. A key ending with "*" allows all the keys with that prefix.
+func WithOutboundMetadataAllowlist(keys ...string) GatewayOption {
+	return func(g *Gateway) {
+		for _, k := range keys {
+			g.metadataAllowlist = append(g.metadataAllowlist, strings.ToLower(k))
+		}
+	}
+}
+
+// ApplyMetadata forwards the mapped headers and cookies of "req" and the metadata
+// of the applied Decision as outgoing gRPC metadata, and then drops the outgoing
+// metadata not in the allowlist.
+// It must be the last step which modifies the outgoing metadata before the call.
+func (g *Gateway) ApplyMetadata(ctx context.Context, req *http.Request, route *Route) (context.Context, error) {
+	declared := make(map[string]bool, len(route.Metadata))
+	mappings := make([]MetadataMapping, 0, len(g.metadataMappings)+len(route.Metadata))
+	for _, m := range route.Metadata {
+		declared[m.MetadataKey()] = true
+		mappings = append(mappings, m)
+	}
+	// the mappings declared by the route take precedence over the global ones.
+	for _, m := range g.metadataMappings {
+		if !declared[m.MetadataKey()] {
+			mappings = append(mappings, m)
+		}
+	}
+	var pairs []string
+	for _, m := range mappings {
+		v, err := m.value(req)
+		if err != nil {
+			return ctx, err
+		}
+		if v != "" {
+			pairs = append(pairs, m.MetadataKey(), v)
+		}
+	}
+	for k, vs := range decisionMetadata(ctx) {
+		for _, v := range vs {
+			pairs = append(pairs, k, v)
+		}
+	}
+	if len(pairs) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
+	}
+	if g.metadataAllowlist == nil {
+		return ctx, nil
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	allowed := metadata.MD{}
+	for k, vs := range md {
+		if g.metadataAllowed(k) {
+			allowed[k] = vs
+		}
+	}
+	return metadata.NewOutgoingContext(ctx, allowed), nil
+}
+
+func (g *Gateway) metadataAllowed(key string) bool {
+	for _, k := range g.metadataAllowlist {
+		if k == key || (strings.HasSuffix(k, "*") && strings.HasPrefix(key, strings.TrimSuffix(k, "*"))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package runtime
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGatewayApplyMetadata(t *testing.T) {
+	route := &Route{
+		Metadata: []MetadataMapping{
+			{Source: MetadataFromCookie, Name: "ZQ_GUID", Key: "guid", Required: true, Pattern: `^\d+\.\w+$`},
+			{Source: MetadataFromHeader, Name: "X-Device", Key: "device"},
+		},
+	}
+	g := NewGateway(
+		WithMetadataMappings(
+			MetadataMapping{Source: MetadataFromHeader, Name: "X-Guid", Key: "guid"},
+			MetadataMapping{Source: MetadataFromHeader, Name: "X-Trace-Id"},
+		),
+		WithOutboundMetadataAllowlist("guid", "Device", "x-trace-*"),
+	)
+	for _, spec := range []struct {
+		cookie  string
+		headers map[string]string
+		want    metadata.MD
+		code    codes.Code
+	}{
+		{
+			headers: map[string]string{"X-Device": "ios"},
+			code:    codes.InvalidArgument,
+		},
+		{
+			cookie: "not-a-guid",
+			code:   codes.InvalidArgument,
+		},
+		{
+			cookie:  "123.abc",
+			headers: map[string]string{"X-Device": "ios", "X-Guid": "ignored", "X-Trace-Id": "t1"},
+			want:    metadata.Pairs("guid", "123.abc", "device", "ios", "x-trace-id", "t1"),
+		},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if spec.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "ZQ_GUID", Value: spec.cookie})
+		}
+		for k, v := range spec.headers {
+			req.Header.Set(k, v)
+		}
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-forwarded-for", "10.0.0.1")
+		ctx, err := g.ApplyMetadata(ctx, req, route)
+		if got := status.Code(err); got != spec.code {
+			t.Errorf("ApplyMetadata() = %v; want code %v", err, spec.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		md, _ := metadata.FromOutgoingContext(ctx)
+		if !reflect.DeepEqual(md, spec.want) {
+			t.Errorf("outgoing metadata = %v; want %v", md, spec.want)
+		}
+	}
+}
+
+func TestLoadMetadataMappingsFromYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metadata.yaml")
+	yml := `
+- source: cookie
+  name: ZQ_GUID
+  key: guid
+  required: true
+- source: header
+  name: X-Device
+  pattern: "^(ios|android)$"
+`
+	if err := ioutil.WriteFile(path, []byte(yml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadMetadataMappingsFromYAML(path)
+	if err != nil {
+		t.Fatalf("LoadMetadataMappingsFromYAML(%q) failed with %v; want success", path, err)
+	}
+	want := []MetadataMapping{
+		{Source: MetadataFromCookie, Name: "ZQ_GUID", Key: "guid", Required: true},
+		{Source: MetadataFromHeader, Name: "X-Device", Pattern: "^(ios|android)$"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadMetadataMappingsFromYAML(%q) = %#v; want %#v", path, got, want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("- source: query\n  name: uid\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadMetadataMappingsFromYAML(path); err == nil {
+		t.Errorf("LoadMetadataMappingsFromYAML(%q) with a query source succeeded; want failure", path)
+	}
+}
+
+func TestRequestValue(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Device-Id", "d1")
+	req.AddCookie(&http.Cookie{Name: "ZQ_GUID", Value: "123.abc"})
+	for _, spec := range []struct {
+		source MetadataSource
+		name   string
+		want   string
+		ok     bool
+	}{
+		{source: MetadataFromHeader, name: "x-device-id", want: "d1", ok: true},
+		{source: MetadataFromCookie, name: "ZQ_GUID", want: "123.abc", ok: true},
+		{source: MetadataFromHeader, name: "ZQ_GUID"},
+		{source: MetadataFromCookie, name: "X-Device-Id"},
+	} {
+		got, ok := RequestValue(req, spec.source, spec.name)
+		if got != spec.want || ok != spec.ok {
+			t.Errorf("RequestValue(%s, %s) = %q, %v; want %q, %v", spec.source, spec.name, got, ok, spec.want, spec.ok)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/utilities"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultUploadMaxSize is the size limit of a file part if Upload.MaxSize is 0.
+	DefaultUploadMaxSize = 32 << 20
+	// DefaultUploadChunkSize is the size of the chunks sent to a client streaming method if Upload.ChunkSize is 0.
+	DefaultUploadChunkSize = 64 << 10
+	// MaxFormValueSize is the size limit of all the other parts of a multipart/form-data request.
+	MaxFormValueSize = 1 << 20
+)
+
+// Upload maps a file part of a multipart/form-data request to a bytes field of the request message.
+// It is declared with the "@upload" comment tag of the method.
+type Upload struct {
+	// Part is the form name of the file part.
+	Part string
+	// Field is the bytes field taking the content of the part.
+	Field string
+	// FilenameField is the string field taking the file name of the part, if not empty.
+	FilenameField string
+	// ContentTypeField is the string field taking the content type of the part, if not empty.
+	ContentTypeField string
+	// MaxSize is the size limit of the part, DefaultUploadMaxSize if 0.
+	// The requests over it fail with 413.
+	MaxSize int64
+	// ChunkSize is the size of the chunks sent to a client streaming method, DefaultUploadChunkSize if 0.
+	ChunkSize int64
+}
+
+func (u *Upload) maxSize() int64 {
+	if u.MaxSize > 0 {
+		return u.MaxSize
+	}
+	return DefaultUploadMaxSize
+}
+
+func (u *Upload) chunkSize() int64 {
+	if u.ChunkSize > 0 {
+		return u.ChunkSize
+	}
+	return DefaultUploadChunkSize
+}
+
+// IsMultipart tells whether the body of "req" is multipart/form-data.
+func IsMultipart(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// DecodeMultipart decodes the multipart/form-data body of "req" into "msg": the file parts of the
+// uploads of "route" into their fields, and the other parts as form values, like the query parameters.
+// The parts are read as they come without being buffered on disk.
+func DecodeMultipart(req *http.Request, route *Route, msg proto.Message) error {
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	values := make(url.Values)
+	var valueSize int64
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		upload := route.upload(part.FormName())
+		if upload == nil {
+			if err := readFormValue(part, values, &valueSize); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := readPart(part, upload.maxSize())
+		if err != nil {
+			return err
+		}
+		if err := setUploadFields(msg, upload, part, data, true); err != nil {
+			return err
+		}
+	}
+	return populateFormValues(msg, values)
+}
+
+// DecodeMultipartChunks decodes the multipart/form-data body of "req" into the messages of a client
+// streaming method, made by "newMsg" and passed to "send": the file part of the upload of "route"
+// is split into chunks of Upload.ChunkSize bytes, one per message. The first message also takes
+// the file name, the content type and the form values, which must come before the file part.
+// One message is sent if there is no file part. An error of "send" is returned as is.
+func DecodeMultipartChunks(req *http.Request, route *Route, newMsg func() proto.Message, send func(proto.Message) error) error {
+	if len(route.Uploads) != 1 {
+		return status.Errorf(codes.Internal, "route %s takes %d uploads, want 1", RouteKey(route), len(route.Uploads))
+	}
+	upload := &route.Uploads[0]
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	values := make(url.Values)
+	var valueSize int64
+	sent := false
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		if part.FormName() != upload.Part {
+			if sent {
+				return status.Errorf(codes.InvalidArgument, "part %q after the file part %q", part.FormName(), upload.Part)
+			}
+			if err := readFormValue(part, values, &valueSize); err != nil {
+				return err
+			}
+			continue
+		}
+		if sent {
+			return status.Errorf(codes.InvalidArgument, "duplicate file part %q", upload.Part)
+		}
+		err = sendChunks(part, upload.chunkSize(), upload.maxSize(), uploadTooLarge(upload), newMsg, func(msg proto.Message, chunk []byte, first bool) error {
+			if first {
+				if err := populateFormValues(msg, values); err != nil {
+					return err
+				}
+			}
+			return setUploadFields(msg, upload, part, chunk, first)
+		}, send)
+		if err != nil {
+			return err
+		}
+		sent = true
+	}
+	if sent {
+		return nil
+	}
+	msg := newMsg()
+	if err := populateFormValues(msg, values); err != nil {
+		return err
+	}
+	return send(msg)
+}
+
+// sendChunks reads "r" in chunks of "size" bytes and sends one message made by "newMsg" per chunk,
+// filled in by "fill" with the chunk and whether it is the first one. One message is sent if "r" is empty.
+// It fails with "tooLarge" over "max" bytes, if "max" is positive.
+func sendChunks(r io.Reader, size, max int64, tooLarge error, newMsg func() proto.Message, fill func(msg proto.Message, chunk []byte, first bool) error, send func(proto.Message) error) error {
+	var total int64
+	for first := true; ; first = false {
+		chunk := make([]byte, size)
+		n, err := io.ReadFull(r, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		total += int64(n)
+		if max > 0 && total > max {
+			return tooLarge
+		}
+		if n == 0 && !first {
+			return nil
+		}
+		msg := newMsg()
+		if err := fill(msg, chunk[:n], first); err != nil {
+			return err
+		}
+		if err := send(msg); err != nil {
+			return err
+		}
+		if n < len(chunk) {
+			return nil
+		}
+	}
+}
+
+// upload returns the upload of the file part "name", or nil if none.
+func (r *Route) upload(name string) *Upload {
+	for i := range r.Uploads {
+		if r.Uploads[i].Part == name {
+			return &r.Uploads[i]
+		}
+	}
+	return nil
+}
+
+func uploadTooLarge(upload *Upload) error {
+	return &statusError{
+		st:     status.Newf(codes.ResourceExhausted, "part %q is larger than %d bytes", upload.Part, upload.maxSize()),
+		status: http.StatusRequestEntityTooLarge,
+	}
+}
+
+// readPart reads the content of a file part, failing with 413 over "max" bytes.
+func readPart(part *multipart.Part, max int64) ([]byte, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(part, max+1))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if n > max {
+		return nil, uploadTooLarge(&Upload{Part: part.FormName(), MaxSize: max})
+	}
+	return buf.Bytes(), nil
+}
+
+// readFormValue reads a non-file part into "values", "size" being the size of the values read so far.
+func readFormValue(part *multipart.Part, values url.Values, size *int64) error {
+	if part.FileName() != "" {
+		return status.Errorf(codes.InvalidArgument, "unexpected file part %q", part.FormName())
+	}
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(part, MaxFormValueSize-*size+1))
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	*size += n
+	if *size > MaxFormValueSize {
+		return &statusError{
+			st:     status.Newf(codes.ResourceExhausted, "form values are larger than %d bytes", MaxFormValueSize),
+			status: http.StatusRequestEntityTooLarge,
+		}
+	}
+	if name := part.FormName(); name != "" {
+		values.Add(name, buf.String())
+	}
+	return nil
+}
+
+func populateFormValues(msg proto.Message, values url.Values) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if err := grpcgw.PopulateQueryParameters(msg, values, utilities.NewDoubleArray(nil)); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return nil
+}
+
+// setUploadFields sets the fields of "upload" in "msg" from "part" with the content "data",
+// and the file name and the content type if "meta".
+func setUploadFields(msg proto.Message, upload *Upload, part *multipart.Part, data []byte, meta bool) error {
+	if err := setRequestField(msg, upload.Field, reflect.ValueOf(data)); err != nil {
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+	if !meta {
+		return nil
+	}
+	if upload.FilenameField != "" {
+		if err := setRequestField(msg, upload.FilenameField, reflect.ValueOf(part.FileName())); err != nil {
+			return status.Errorf(codes.Internal, "%v", err)
+		}
+	}
+	if upload.ContentTypeField != "" {
+		if err := setRequestField(msg, upload.ContentTypeField, reflect.ValueOf(part.Header.Get("Content-Type"))); err != nil {
+			return status.Errorf(codes.Internal, "%v", err)
+		}
+	}
+	return nil
+}
+
+// setRequestField sets the field at "path" of "msg" to "v", allocating the messages on the way.
+func setRequestField(msg proto.Message, path string, v reflect.Value) error {
+	f := reflect.ValueOf(msg)
+	for _, name := range strings.Split(path, ".") {
+		if f.Kind() == reflect.Ptr {
+			if f.IsNil() {
+				f.Set(reflect.New(f.Type().Elem()))
+			}
+			f = f.Elem()
+		}
+		if f.Kind() != reflect.Struct {
+			return fmt.Errorf("%s is not a message", name)
+		}
+		i := protoFieldIndex(f.Type(), name)
+		if i < 0 {
+			return fmt.Errorf("no field %s in %s", name, f.Type())
+		}
+		f = f.Field(i)
+	}
+	if f.Kind() == reflect.Ptr && f.Type().Elem() == v.Type() {
+		// proto2 optional fields.
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p
+	}
+	if f.Type() != v.Type() {
+		return fmt.Errorf("field %s is %s, not %s", path, f.Type(), v.Type())
+	}
+	f.Set(v)
+	return nil
+}
@@ -0,0 +1,163 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testPart struct {
+	name, filename, contentType, body string
+}
+
+func newMultipartRequest(t *testing.T, parts ...testPart) *http.Request {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		h := make(textproto.MIMEHeader)
+		disposition := `form-data; name="` + p.name + `"`
+		if p.filename != "" {
+			disposition += `; filename="` + p.filename + `"`
+		}
+		h.Set("Content-Disposition", disposition)
+		if p.contentType != "" {
+			h.Set("Content-Type", p.contentType)
+		}
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(p.body))
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/v1/upload", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+var uploadRoute = &Route{
+	HTTPMethod: "POST",
+	Path:       "/v1/upload",
+	Uploads: []Upload{
+		{Part: "avatar", Field: "string_value", FilenameField: "identifier_value", ContentTypeField: "aggregate_value", MaxSize: 8, ChunkSize: 3},
+	},
+}
+
+func TestDecodeMultipart(t *testing.T) {
+	req := newMultipartRequest(t,
+		testPart{name: "positive_int_value", body: "42"},
+		testPart{name: "avatar", filename: "a.png", contentType: "image/png", body: "\x89PNG"},
+	)
+	if !IsMultipart(req) {
+		t.Errorf("IsMultipart() = false; want true")
+	}
+	var msg descriptor.UninterpretedOption
+	if err := DecodeMultipart(req, uploadRoute, &msg); err != nil {
+		t.Fatalf("DecodeMultipart() failed with %v; want success", err)
+	}
+	want := &descriptor.UninterpretedOption{
+		StringValue:      []byte("\x89PNG"),
+		IdentifierValue:  proto.String("a.png"),
+		AggregateValue:   proto.String("image/png"),
+		PositiveIntValue: proto.Uint64(42),
+	}
+	if !proto.Equal(&msg, want) {
+		t.Errorf("DecodeMultipart() = %v; want %v", &msg, want)
+	}
+
+	for _, spec := range []struct {
+		parts []testPart
+		code  codes.Code
+	}{
+		{parts: []testPart{{name: "avatar", filename: "a.png", body: "123456789"}}, code: codes.ResourceExhausted},
+		{parts: []testPart{{name: "other", filename: "b.png", body: "1"}}, code: codes.InvalidArgument},
+		{parts: []testPart{{name: "positive_int_value", body: "x"}}, code: codes.InvalidArgument},
+	} {
+		err := DecodeMultipart(newMultipartRequest(t, spec.parts...), uploadRoute, &descriptor.UninterpretedOption{})
+		if got := status.Code(err); got != spec.code {
+			t.Errorf("DecodeMultipart(%+v) = %v; want code %v", spec.parts, err, spec.code)
+		}
+	}
+
+	req = httptest.NewRequest("POST", "/v1/upload", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	if IsMultipart(req) {
+		t.Errorf("IsMultipart() of a JSON request = true; want false")
+	}
+}
+
+func TestDecodeMultipartChunks(t *testing.T) {
+	var sent []*descriptor.UninterpretedOption
+	newMsg := func() proto.Message { return &descriptor.UninterpretedOption{} }
+	send := func(msg proto.Message) error {
+		sent = append(sent, msg.(*descriptor.UninterpretedOption))
+		return nil
+	}
+
+	req := newMultipartRequest(t,
+		testPart{name: "positive_int_value", body: "7"},
+		testPart{name: "avatar", filename: "a.png", contentType: "image/png", body: "abcdefg"},
+	)
+	if err := DecodeMultipartChunks(req, uploadRoute, newMsg, send); err != nil {
+		t.Fatalf("DecodeMultipartChunks() failed with %v; want success", err)
+	}
+	want := []*descriptor.UninterpretedOption{
+		{StringValue: []byte("abc"), IdentifierValue: proto.String("a.png"), AggregateValue: proto.String("image/png"), PositiveIntValue: proto.Uint64(7)},
+		{StringValue: []byte("def")},
+		{StringValue: []byte("g")},
+	}
+	if len(sent) != len(want) {
+		t.Fatalf("DecodeMultipartChunks() sent %v; want %v", sent, want)
+	}
+	for i := range want {
+		if !proto.Equal(sent[i], want[i]) {
+			t.Errorf("DecodeMultipartChunks() sent[%d] = %v; want %v", i, sent[i], want[i])
+		}
+	}
+
+	// a size multiple of the chunk size sends no empty chunk.
+	sent = nil
+	if err := DecodeMultipartChunks(newMultipartRequest(t, testPart{name: "avatar", filename: "a", body: "abcdef"}), uploadRoute, newMsg, send); err != nil || len(sent) != 2 {
+		t.Errorf("DecodeMultipartChunks() of 6 bytes sent %v, %v; want 2 chunks", sent, err)
+	}
+	sent = nil
+	if err := DecodeMultipartChunks(newMultipartRequest(t, testPart{name: "positive_int_value", body: "1"}), uploadRoute, newMsg, send); err != nil || len(sent) != 1 {
+		t.Errorf("DecodeMultipartChunks() without file sent %v, %v; want 1 message", sent, err)
+	}
+
+	for _, parts := range [][]testPart{
+		{{name: "avatar", filename: "a", body: "abc"}, {name: "positive_int_value", body: "1"}},
+		{{name: "avatar", filename: "a", body: "123456789"}},
+	} {
+		sent = nil
+		if err := DecodeMultipartChunks(newMultipartRequest(t, parts...), uploadRoute, newMsg, send); err == nil {
+			t.Errorf("DecodeMultipartChunks(%+v) succeeded; want failure", parts)
+		}
+	}
+}
+
+func TestUploadTooLargeStatus(t *testing.T) {
+	err := DecodeMultipart(newMultipartRequest(t, testPart{name: "avatar", filename: "a.png", body: "123456789"}), uploadRoute, &descriptor.UninterpretedOption{})
+	mux := grpcgw.NewServeMux()
+	ctx := grpcgw.NewServerMetadataContext(context.Background(), grpcgw.ServerMetadata{})
+	for _, gw := range []*Gateway{NewGateway(), NewGateway(WithErrorConfig(ErrorConfig{Problem: true}))} {
+		rec := httptest.NewRecorder()
+		gw.HTTPError(ctx, mux, &grpcgw.JSONPb{}, rec, httptest.NewRequest("POST", "/", nil), err)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("HTTPError(%v) wrote %d; want %d", err, rec.Code, http.StatusRequestEntityTooLarge)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package runtime
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ResponseHeader writes a field of the response message into an HTTP response header.
+// It is declared with the "@resheader" comment tag of the method.
+type ResponseHeader struct {
+	// Field is the path of the field in the response message, e.g. "page.total".
+	Field string
+	// Header is the name of the HTTP header.
+	Header string
+	// Omit removes the field from the response body.
+	Omit bool
+}
+
+// PrepareResponse applies the response headers and the status declared by "route"
+// to the successful "resp". It returns the writer and the message to forward,
+// which are "w" and "resp" themselves if the route declares nothing.
+// The status is written along with the body, after the other headers are set.
+func (g *Gateway) PrepareResponse(w http.ResponseWriter, route *Route, resp proto.Message) (http.ResponseWriter, proto.Message, error) {
+	if len(route.ResponseHeaders) == 0 && route.Status == 0 && route.StatusField == "" {
+		return w, resp, nil
+	}
+	var omit []string
+	for _, h := range route.ResponseHeaders {
+		v, err := responseField(resp, h.Field)
+		if err != nil {
+			return w, resp, status.Errorf(codes.Internal, "failed to read %s for header %s: %v", h.Field, h.Header, err)
+		}
+		for _, s := range headerValues(v) {
+			w.Header().Add(h.Header, s)
+		}
+		if h.Omit {
+			omit = append(omit, h.Field)
+		}
+	}
+	code := route.Status
+	if route.StatusField != "" {
+		v, err := responseField(resp, route.StatusField)
+		if err != nil {
+			return w, resp, status.Errorf(codes.Internal, "failed to read status %s: %v", route.StatusField, err)
+		}
+		if c := statusCode(v); c != 0 {
+			code = c
+		}
+		if route.OmitStatusField {
+			omit = append(omit, route.StatusField)
+		}
+	}
+	if len(omit) > 0 {
+		resp = proto.Clone(resp)
+		for _, path := range omit {
+			if err := clearResponseField(resp, path); err != nil {
+				return w, resp, status.Errorf(codes.Internal, "failed to omit %s: %v", path, err)
+			}
+		}
+	}
+	if code == 0 || code == http.StatusOK {
+		return w, resp, nil
+	}
+	if code < 200 || code > 299 {
+		return w, resp, status.Errorf(codes.Internal, "invalid http status %d: want a 2xx code", code)
+	}
+	return &statusResponseWriter{ResponseWriter: w, status: code}, resp, nil
+}
+
+// statusResponseWriter writes "status" instead of 200, and drops the body if the status does not allow one.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code == http.StatusOK {
+		code = w.status
+	}
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !bodyAllowed(w.status) {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack not supported")
+}
+
+func bodyAllowed(code int) bool {
+	return !(code >= 100 && code < 200) && code != http.StatusNoContent && code != http.StatusNotModified
+}
+
+// responseField returns the value of the field at "path" of "msg",
+// or an invalid value if a message on the way is nil.
+func responseField(msg proto.Message, path string) (reflect.Value, error) {
+	v := reflect.ValueOf(msg)
+	for _, name := range strings.Split(path, ".") {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, nil
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("%s is not a message", name)
+		}
+		i := protoFieldIndex(v.Type(), name)
+		if i < 0 {
+			return reflect.Value{}, fmt.Errorf("no field %s in %s", name, v.Type())
+		}
+		v = v.Field(i)
+	}
+	return v, nil
+}
+
+// clearResponseField sets the field at "path" of "msg" to its zero value.
+func clearResponseField(msg proto.Message, path string) error {
+	v, err := responseField(msg, path)
+	if err != nil || !v.IsValid() {
+		return err
+	}
+	v.Set(reflect.Zero(v.Type()))
+	return nil
+}
+
+// protoFieldIndex returns the index of the field of the struct "t" generated for the proto field "name".
+func protoFieldIndex(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		for _, opt := range strings.Split(t.Field(i).Tag.Get("protobuf"), ",") {
+			if opt == "name="+name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// headerValues formats a scalar or repeated field as header values.
+// Empty strings and unset fields produce no value, while numbers always do.
+func headerValues(v reflect.Value) []string {
+	if v.Kind() == reflect.Ptr {
+		// proto2 optional fields.
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		var values []string
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, headerValues(v.Index(i))...)
+		}
+		return values
+	}
+	var s string
+	switch v.Kind() {
+	case reflect.String:
+		s = v.String()
+	case reflect.Slice:
+		s = string(v.Bytes())
+	case reflect.Bool:
+		s = strconv.FormatBool(v.Bool())
+	case reflect.Int32, reflect.Int64:
+		if e, ok := v.Interface().(fmt.Stringer); ok {
+			s = e.String()
+		} else {
+			s = strconv.FormatInt(v.Int(), 10)
+		}
+	case reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		s = strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case reflect.Float64:
+		s = strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	default:
+		s = fmt.Sprint(v.Interface())
+	}
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+// statusCode returns the integer value of an integer or enum field, 0 if it is not set.
+func statusCode(v reflect.Value) int {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	case reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package runtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGatewayPrepareResponse(t *testing.T) {
+	reply := &descriptor.DescriptorProto{
+		Name:         proto.String("Location"),
+		ReservedName: []string{"a", "b"},
+		Options:      &descriptor.MessageOptions{Deprecated: proto.Bool(true)},
+		Field: []*descriptor.FieldDescriptorProto{
+			{Name: proto.String("f")},
+		},
+	}
+	field := &descriptor.FieldDescriptorProto{
+		Name:   proto.String("f"),
+		Number: proto.Int32(http.StatusAccepted),
+	}
+	g := NewGateway()
+	for _, spec := range []struct {
+		route   *Route
+		resp    proto.Message
+		headers http.Header
+		code    int
+		body    bool
+		omitted proto.Message
+	}{
+		{
+			route: &Route{},
+			resp:  reply,
+			code:  http.StatusOK,
+			body:  true,
+		},
+		{
+			route: &Route{
+				ResponseHeaders: []ResponseHeader{
+					{Field: "name", Header: "Location", Omit: true},
+					{Field: "reserved_name", Header: "X-Reserved"},
+					{Field: "options.deprecated", Header: "X-Deprecated"},
+					{Field: "options.map_entry", Header: "X-Map-Entry"},
+				},
+				Status: http.StatusCreated,
+			},
+			resp: reply,
+			headers: http.Header{
+				"Location":     {"Location"},
+				"X-Reserved":   {"a", "b"},
+				"X-Deprecated": {"true"},
+			},
+			code: http.StatusCreated,
+			body: true,
+			omitted: &descriptor.DescriptorProto{
+				ReservedName: []string{"a", "b"},
+				Options:      &descriptor.MessageOptions{Deprecated: proto.Bool(true)},
+				Field:        reply.Field,
+			},
+		},
+		{
+			route: &Route{Status: http.StatusNoContent},
+			resp:  reply,
+			code:  http.StatusNoContent,
+		},
+		{
+			route: &Route{Status: http.StatusCreated, StatusField: "number", OmitStatusField: true},
+			resp:  field,
+			code:  http.StatusAccepted,
+			body:  true,
+			omitted: &descriptor.FieldDescriptorProto{
+				Name: proto.String("f"),
+			},
+		},
+		{
+			route: &Route{Status: http.StatusCreated, StatusField: "number"},
+			resp:  &descriptor.FieldDescriptorProto{},
+			code:  http.StatusCreated,
+			body:  true,
+		},
+	} {
+		rec := httptest.NewRecorder()
+		w, resp, err := g.PrepareResponse(rec, spec.route, spec.resp)
+		if err != nil {
+			t.Errorf("g.PrepareResponse(%#v) failed with %v; want success", spec.route, err)
+			continue
+		}
+		w.Write([]byte("body"))
+		if got, want := rec.Code, spec.code; got != want {
+			t.Errorf("status = %d; want %d; route = %#v", got, want, spec.route)
+		}
+		if got, want := rec.Body.Len() > 0, spec.body; got != want {
+			t.Errorf("body written = %v; want %v; route = %#v", got, want, spec.route)
+		}
+		if spec.headers != nil && !reflect.DeepEqual(rec.Header(), spec.headers) {
+			t.Errorf("headers = %v; want %v", rec.Header(), spec.headers)
+		}
+		want := spec.omitted
+		if want == nil {
+			want = spec.resp
+		}
+		if !proto.Equal(resp, want) {
+			t.Errorf("resp = %v; want %v", resp, want)
+		}
+	}
+	if reply.GetName() != "Location" || field.GetNumber() != http.StatusAccepted {
+		t.Errorf("the original response is modified: %v, %v", reply, field)
+	}
+
+	for _, code := range []int32{http.StatusFound, http.StatusNotFound, 999} {
+		route := &Route{StatusField: "number"}
+		resp := &descriptor.FieldDescriptorProto{Number: proto.Int32(code)}
+		_, _, err := g.PrepareResponse(httptest.NewRecorder(), route, resp)
+		if got, want := status.Code(err), codes.Internal; got != want {
+			t.Errorf("g.PrepareResponse() with status field %d failed with %v; want %v", code, err, want)
+		}
+	}
+}
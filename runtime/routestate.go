@@ -0,0 +1,240 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultMaintenanceMessage is the message of the disabled routes if RouteState.Message is empty.
+const DefaultMaintenanceMessage = "service under maintenance"
+
+// RouteState is the runtime state of a route. The zero value enables the route.
+type RouteState struct {
+	// Disabled routes answer 503 with Message, unless Fallback is set.
+	Disabled bool `json:"disabled,omitempty"`
+	// Message is the message of the 503 error, DefaultMaintenanceMessage if empty.
+	Message string `json:"message,omitempty"`
+	// RetryAfter is the value of the Retry-After header of the 503 error in seconds, if positive.
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Fallback is the static response of the route. It is written without calling the target
+	// method even if the route is not Disabled.
+	Fallback *StaticResponse `json:"fallback,omitempty"`
+}
+
+// StaticResponse is a response written as is.
+type StaticResponse struct {
+	// Status is the HTTP status, 200 if 0.
+	Status int `json:"status,omitempty"`
+	// Header are the headers of the response.
+	Header map[string]string `json:"header,omitempty"`
+	// ContentType is the content type of Body, "application/json" if empty.
+	ContentType string `json:"content_type,omitempty"`
+	// Body is the body of the response.
+	Body string `json:"body,omitempty"`
+}
+
+// RouteStates provides the states of the routes at runtime.
+type RouteStates interface {
+	// RouteState returns the state of "route", nil if the route is enabled.
+	RouteState(route *Route) *RouteState
+}
+
+// RouteKey returns the key of "route" in the RouteStates of this package: "<HTTP method> <path template>",
+// e.g. "GET /v1/rooms/{room_id}".
+func RouteKey(route *Route) string {
+	return route.HTTPMethod + " " + route.Path
+}
+
+// lookupRouteState returns the state of "route" in "states", keyed by RouteKey,
+// or else by the target method in the form of "package.Service/Method" for all its routes.
+func lookupRouteState(states map[string]*RouteState, route *Route) *RouteState {
+	if st, ok := states[RouteKey(route)]; ok {
+		return st
+	}
+	return states[route.Method]
+}
+
+// MemoryRouteStates keeps the states of the routes in memory, keyed by RouteKey,
+// or by the target method in the form of "package.Service/Method" for all its routes.
+// It is safe for concurrent use.
+type MemoryRouteStates struct {
+	mu     sync.RWMutex
+	states map[string]*RouteState
+}
+
+// NewMemoryRouteStates returns a MemoryRouteStates enabling all the routes.
+func NewMemoryRouteStates() *MemoryRouteStates {
+	return &MemoryRouteStates{states: make(map[string]*RouteState)}
+}
+
+// RouteState returns the state of "route".
+func (s *MemoryRouteStates) RouteState(route *Route) *RouteState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return lookupRouteState(s.states, route)
+}
+
+// Set sets the state of the routes of "key". A nil state enables them.
+func (s *MemoryRouteStates) Set(key string, state *RouteState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == nil {
+		delete(s.states, key)
+		return
+	}
+	s.states[key] = state
+}
+
+// Disable disables the routes of "key" with "message", asking the clients to retry after "retryAfter".
+func (s *MemoryRouteStates) Disable(key, message string, retryAfter time.Duration) {
+	s.Set(key, &RouteState{Disabled: true, Message: message, RetryAfter: int(retryAfter / time.Second)})
+}
+
+// Enable enables the routes of "key".
+func (s *MemoryRouteStates) Enable(key string) {
+	s.Set(key, nil)
+}
+
+// States returns a copy of the states by key.
+func (s *MemoryRouteStates) States() map[string]*RouteState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	states := make(map[string]*RouteState, len(s.states))
+	for key, st := range s.states {
+		states[key] = st
+	}
+	return states
+}
+
+// replace replaces all the states.
+func (s *MemoryRouteStates) replace(states map[string]*RouteState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states = states
+}
+
+// FileRouteStates reads the states of the routes from a JSON file, which is reloaded when it changes, e.g.
+//   {
+//     "zqproto.Im/Read": {"disabled": true, "message": "im under maintenance", "retry_after": 60},
+//     "GET /v1/imgate/notice": {"fallback": {"body": "{\"notice\": \"\"}"}}
+//   }
+type FileRouteStates struct {
+	states *MemoryRouteStates
+	file   *fileWatcher
+}
+
+// NewFileRouteStates loads the states in "path" and checks it for changes every "interval",
+// 5s if 0, until Close is called. A file which fails to load on a change is logged and
+// the last states are kept.
+func NewFileRouteStates(path string, interval time.Duration) (*FileRouteStates, error) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	s := &FileRouteStates{states: NewMemoryRouteStates()}
+	file, err := newFileWatcher(path, interval, func(data []byte) error {
+		var states map[string]*RouteState
+		if err := json.Unmarshal(data, &states); err != nil {
+			return err
+		}
+		for key, st := range states {
+			if st == nil {
+				delete(states, key)
+			}
+		}
+		s.states.replace(states)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load route states: %v", err)
+	}
+	s.file = file
+	return s, nil
+}
+
+// RouteState returns the state of "route".
+func (s *FileRouteStates) RouteState(route *Route) *RouteState {
+	return s.states.RouteState(route)
+}
+
+// Close stops checking the file for changes.
+func (s *FileRouteStates) Close() {
+	s.file.close()
+}
+
+// WithRouteStates makes the registered routes check their states in "states" on each request.
+func WithRouteStates(states RouteStates) GatewayOption {
+	return func(g *Gateway) {
+		g.routeStates = states
+	}
+}
+
+// CheckRoute answers the request itself if "route" is disabled or has a fallback response.
+// It returns true if the request is to be handled by the route, or false if the response is written already.
+func (g *Gateway) CheckRoute(ctx context.Context, mux *grpcgw.ServeMux, marshaler grpcgw.Marshaler, w http.ResponseWriter, req *http.Request, route *Route) bool {
+	fallback, err := g.routeCheck(w, route)
+	if err != nil {
+		g.HTTPError(ctx, mux, marshaler, w, req, err)
+		return false
+	}
+	if fallback != nil {
+		fallback.write(w)
+		return false
+	}
+	return true
+}
+
+// routeCheck returns the fallback response of "route", or the error of the route if it is disabled,
+// setting the Retry-After header on "w".
+func (g *Gateway) routeCheck(w http.ResponseWriter, route *Route) (*StaticResponse, error) {
+	if g.routeStates == nil {
+		return nil, nil
+	}
+	st := g.routeStates.RouteState(route)
+	if st == nil {
+		return nil, nil
+	}
+	if st.Fallback != nil {
+		return st.Fallback, nil
+	}
+	if !st.Disabled {
+		return nil, nil
+	}
+	if st.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(st.RetryAfter))
+	}
+	msg := st.Message
+	if msg == "" {
+		msg = DefaultMaintenanceMessage
+	}
+	// the route answers 503 whatever the error mapping is.
+	return nil, &statusError{st: status.New(codes.Unavailable, msg), status: http.StatusServiceUnavailable}
+}
+
+func (r *StaticResponse) write(w http.ResponseWriter) {
+	for k, v := range r.Header {
+		w.Header().Set(k, v)
+	}
+	contentType := r.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	code := r.Status
+	if code == 0 {
+		code = http.StatusOK
+	}
+	w.WriteHeader(code)
+	if _, err := w.Write([]byte(r.Body)); err != nil {
+		grpclog.Infof("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package runtime
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+func TestGatewayCheckRoute(t *testing.T) {
+	read := &Route{HTTPMethod: "GET", Path: "/v1/imgate/read/{uid}", Method: "zqproto.Im/Read"}
+	readPost := &Route{HTTPMethod: "POST", Path: "/v1/imgate/read", Method: "zqproto.Im/Read"}
+	notice := &Route{HTTPMethod: "GET", Path: "/v1/imgate/notice", Method: "zqproto.Im/Notice"}
+	login := &Route{HTTPMethod: "POST", Path: "/v1/imgate/login", Method: "zqproto.Authorize/Login"}
+
+	states := NewMemoryRouteStates()
+	states.Disable("zqproto.Im/Read", "", time.Minute)
+	states.Set("GET /v1/imgate/notice", &RouteState{Fallback: &StaticResponse{Header: map[string]string{"X-Fallback": "1"}, Body: `{"notice":""}`}})
+	states.Set("POST /v1/imgate/login", &RouteState{Disabled: true, Message: "login closed"})
+
+	mux := grpcgw.NewServeMux()
+	ctx := grpcgw.NewServerMetadataContext(context.Background(), grpcgw.ServerMetadata{})
+	for _, spec := range []struct {
+		gw         *Gateway
+		route      *Route
+		ok         bool
+		code       int
+		retryAfter string
+		body       string
+	}{
+		{gw: NewGateway(), route: read, ok: true},
+		{gw: NewGateway(WithRouteStates(states)), route: read, code: 503, retryAfter: "60", body: `{"error":"service under maintenance","message":"service under maintenance","code":14}`},
+		{gw: NewGateway(WithRouteStates(states)), route: readPost, code: 503, retryAfter: "60", body: `{"error":"service under maintenance","message":"service under maintenance","code":14}`},
+		{gw: NewGateway(WithRouteStates(states)), route: notice, code: 200, body: `{"notice":""}`},
+		{
+			gw:    NewGateway(WithRouteStates(states), WithErrorConfig(ErrorConfig{Status: map[codes.Code]int{codes.Unavailable: 200}})),
+			route: login, code: 503, body: `{"error":"login closed","message":"login closed","code":14}`,
+		},
+		{gw: NewGateway(WithRouteStates(states), WithEnvelope(Envelope{})), route: login, code: 503, body: `{"code":14,"msg":"login closed"}`},
+	} {
+		rec := httptest.NewRecorder()
+		m := spec.gw.OutboundMarshaler(&grpcgw.JSONPb{OrigName: true})
+		ok := spec.gw.CheckRoute(ctx, mux, m, rec, httptest.NewRequest(spec.route.HTTPMethod, "/", nil), spec.route)
+		if ok != spec.ok {
+			t.Errorf("CheckRoute(%s) = %v; want %v", RouteKey(spec.route), ok, spec.ok)
+			continue
+		}
+		if ok {
+			continue
+		}
+		if rec.Code != spec.code {
+			t.Errorf("CheckRoute(%s) wrote status %d; want %d", RouteKey(spec.route), rec.Code, spec.code)
+		}
+		if got := rec.Header().Get("Retry-After"); got != spec.retryAfter {
+			t.Errorf("CheckRoute(%s) wrote Retry-After %q; want %q", RouteKey(spec.route), got, spec.retryAfter)
+		}
+		if got, want := decodeJSON(t, rec.Body.String()), decodeJSON(t, spec.body); !reflect.DeepEqual(got, want) {
+			t.Errorf("CheckRoute(%s) wrote %v; want %v", RouteKey(spec.route), got, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	NewGateway(WithRouteStates(states)).CheckRoute(ctx, mux, &grpcgw.JSONPb{}, rec, httptest.NewRequest("GET", "/", nil), notice)
+	if got := rec.Header().Get("X-Fallback"); got != "1" {
+		t.Errorf("fallback header X-Fallback = %q; want %q", got, "1")
+	}
+
+	states.Enable("zqproto.Im/Read")
+	if !NewGateway(WithRouteStates(states)).CheckRoute(ctx, mux, &grpcgw.JSONPb{}, httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), read) {
+		t.Errorf("CheckRoute(%s) after Enable() = false; want true", RouteKey(read))
+	}
+}
+
+func TestFileRouteStates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routestate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "routes.json")
+	writeDiscoveryFile(t, path, `{"zqproto.Im/Read": {"disabled": true, "retry_after": 30}}`)
+	states, err := NewFileRouteStates(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewFileRouteStates() failed with %v; want success", err)
+	}
+	defer states.Close()
+
+	read := &Route{HTTPMethod: "GET", Path: "/v1/imgate/read/{uid}", Method: "zqproto.Im/Read"}
+	if st := states.RouteState(read); st == nil || !st.Disabled || st.RetryAfter != 30 {
+		t.Errorf("RouteState(%s) = %+v; want disabled with retry_after 30", RouteKey(read), st)
+	}
+
+	// a broken file keeps the last states.
+	writeDiscoveryFile(t, path, `{"zqproto.Im/Read": `)
+	time.Sleep(50 * time.Millisecond)
+	if st := states.RouteState(read); st == nil || !st.Disabled {
+		t.Errorf("RouteState(%s) after a broken reload = %+v; want disabled", RouteKey(read), st)
+	}
+
+	writeDiscoveryFile(t, path, `{}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for states.RouteState(read) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("RouteState(%s) never enabled after the reload", RouteKey(read))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := NewFileRouteStates(filepath.Join(dir, "missing.json"), 0); err == nil {
+		t.Errorf("NewFileRouteStates() with a missing file succeeded; want failure")
+	}
+}
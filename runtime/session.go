@@ -0,0 +1,367 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// SessionRole describes how a route interacts with the session subsystem.
+// It is set with the "@session" comment tag of the method.
+type SessionRole string
+
+const (
+	// SessionRequired routes are rejected unless the request carries a live session.
+	SessionRequired SessionRole = "required"
+	// SessionLogin routes create a session from the reply of the target method.
+	SessionLogin SessionRole = "login"
+	// SessionLogout routes destroy the session after the target method succeeded.
+	SessionLogout SessionRole = "logout"
+	// SessionNone routes neither require nor touch the session.
+	SessionNone SessionRole = "none"
+)
+
+const (
+	// DefaultSessionCookieName is the name of the session cookie if SessionManager.CookieName is empty.
+	DefaultSessionCookieName = "HTTPGW_SESSION"
+	// DefaultSessionTTL is the lifetime of a session if SessionManager.TTL is zero.
+	DefaultSessionTTL = 24 * time.Hour
+)
+
+var (
+	// ErrSessionNotFound is returned by SessionStore.Load if there is no live session with the given id.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrNotLogin is the error returned to the client if a route requires a session but there is none.
+	ErrNotLogin = status.Error(codes.Unauthenticated, "not login yet")
+)
+
+// Session is the server side state of a logged in client.
+type Session struct {
+	// ID is the value of the session cookie.
+	ID string
+	// Values are forwarded to the target services as gRPC metadata.
+	Values map[string]string
+	// ExpireAt is the time when the session expires.
+	ExpireAt time.Time
+}
+
+// SessionStore persists sessions. Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Load returns the session of "id", or ErrSessionNotFound if it does not exist or has expired.
+	Load(ctx context.Context, id string) (*Session, error)
+	// Save stores "s" until s.ExpireAt.
+	Save(ctx context.Context, s *Session) error
+	// Delete removes the session of "id". Deleting a missing session is not an error.
+	Delete(ctx context.Context, id string) error
+}
+
+// MemorySessionStore is a SessionStore which keeps sessions in memory.
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewMemorySessionStore returns a new MemorySessionStore.
+// If "sweepInterval" is positive, expired sessions are purged in the background
+// every "sweepInterval" until Close is called. Otherwise they are purged lazily.
+func NewMemorySessionStore(sweepInterval time.Duration) *MemorySessionStore {
+	s := &MemorySessionStore{
+		sessions: make(map[string]*Session),
+		done:     make(chan struct{}),
+	}
+	if sweepInterval > 0 {
+		go s.sweepLoop(sweepInterval)
+	}
+	return s
+}
+
+// Load implements SessionStore.
+func (s *MemorySessionStore) Load(ctx context.Context, id string) (*Session, error) {
+	s.mu.RLock()
+	sess, ok := s.sessions[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if !sess.ExpireAt.After(time.Now()) {
+		s.Delete(ctx, id)
+		return nil, ErrSessionNotFound
+	}
+	return copySession(sess), nil
+}
+
+// Save implements SessionStore.
+func (s *MemorySessionStore) Save(ctx context.Context, sess *Session) error {
+	s.mu.Lock()
+	s.sessions[sess.ID] = copySession(sess)
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete implements SessionStore.
+func (s *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of stored sessions, including the expired ones not purged yet.
+func (s *MemorySessionStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.sessions)
+}
+
+// Sweep purges the expired sessions.
+func (s *MemorySessionStore) Sweep() {
+	now := time.Now()
+	s.mu.Lock()
+	for id, sess := range s.sessions {
+		if !sess.ExpireAt.After(now) {
+			delete(s.sessions, id)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// Close stops the background sweeper.
+func (s *MemorySessionStore) Close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *MemorySessionStore) sweepLoop(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.Sweep()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func copySession(s *Session) *Session {
+	c := *s
+	c.Values = make(map[string]string, len(s.Values))
+	for k, v := range s.Values {
+		c.Values[k] = v
+	}
+	return &c
+}
+
+// SessionManager manages the session cookie and the session store for the generated handlers.
+type SessionManager struct {
+	// Store persists the sessions. It is required.
+	Store SessionStore
+	// TTL is the lifetime of a session. DefaultSessionTTL is used if zero.
+	TTL time.Duration
+	// Sliding extends the lifetime of a session every time it is used.
+	Sliding bool
+
+	// CookieName is the name of the session cookie. DefaultSessionCookieName is used if empty.
+	CookieName     string
+	CookiePath     string
+	CookieDomain   string
+	CookieSecure   bool
+	CookieHTTPOnly bool
+
+	// FromReply extracts the session values from the reply of a login method.
+	// Returning false refuses to create the session, e.g. if the reply carries an error code.
+	// If nil, the scalar fields of the reply are used as the session values.
+	FromReply func(meth string, reply proto.Message) (map[string]string, bool)
+}
+
+type sessionKey struct{}
+
+// SessionFromContext returns the session attached to "ctx" by the generated handler.
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*Session)
+	return s, ok
+}
+
+func (m *SessionManager) cookieName() string {
+	if m.CookieName != "" {
+		return m.CookieName
+	}
+	return DefaultSessionCookieName
+}
+
+func (m *SessionManager) ttl() time.Duration {
+	if m.TTL > 0 {
+		return m.TTL
+	}
+	return DefaultSessionTTL
+}
+
+// load returns the session referred by the cookie of "req", or ErrSessionNotFound.
+func (m *SessionManager) load(ctx context.Context, req *http.Request) (*Session, error) {
+	cookie, err := req.Cookie(m.cookieName())
+	if err != nil || cookie.Value == "" {
+		return nil, ErrSessionNotFound
+	}
+	return m.Store.Load(ctx, cookie.Value)
+}
+
+// Begin attaches the session of "req" to "ctx" and forwards its values to the
+// target service as outgoing gRPC metadata. It returns ErrNotLogin if "route"
+// requires a session and there is none.
+func (m *SessionManager) Begin(ctx context.Context, w http.ResponseWriter, req *http.Request, route *Route) (context.Context, error) {
+	if route.Session == SessionNone || route.Session == SessionLogin {
+		return ctx, nil
+	}
+	sess, err := m.load(ctx, req)
+	if err == ErrSessionNotFound {
+		return ctx, ErrNotLogin
+	}
+	if err != nil {
+		return ctx, status.Errorf(codes.Internal, "failed to load session: %v", err)
+	}
+	if m.Sliding && route.Session != SessionLogout {
+		sess.ExpireAt = time.Now().Add(m.ttl())
+		if err := m.Store.Save(ctx, sess); err != nil {
+			return ctx, status.Errorf(codes.Internal, "failed to save session: %v", err)
+		}
+		m.setCookie(w, sess)
+	}
+	var pairs []string
+	for k, v := range sess.Values {
+		pairs = append(pairs, strings.ToLower(k), v)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
+	return context.WithValue(ctx, sessionKey{}, sess), nil
+}
+
+// Finish creates the session after a login method succeeded and destroys it
+// after a logout method succeeded. It must be called before the response is written.
+func (m *SessionManager) Finish(ctx context.Context, w http.ResponseWriter, req *http.Request, route *Route, reply proto.Message) error {
+	switch route.Session {
+	case SessionLogin:
+		fromReply := m.FromReply
+		if fromReply == nil {
+			fromReply = ScalarFieldsFromReply
+		}
+		values, ok := fromReply(route.Method, reply)
+		if !ok {
+			return nil
+		}
+		// drop the previous session so that an old cookie can not be reused.
+		if old, err := m.load(ctx, req); err == nil {
+			m.Store.Delete(ctx, old.ID)
+		}
+		id, err := newSessionID()
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to create session: %v", err)
+		}
+		sess := &Session{
+			ID:       id,
+			Values:   values,
+			ExpireAt: time.Now().Add(m.ttl()),
+		}
+		if err := m.Store.Save(ctx, sess); err != nil {
+			return status.Errorf(codes.Internal, "failed to save session: %v", err)
+		}
+		m.setCookie(w, sess)
+	case SessionLogout:
+		sess, ok := SessionFromContext(ctx)
+		if !ok {
+			return nil
+		}
+		if err := m.Store.Delete(ctx, sess.ID); err != nil {
+			return status.Errorf(codes.Internal, "failed to delete session: %v", err)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     m.cookieName(),
+			Value:    "",
+			Path:     m.CookiePath,
+			Domain:   m.CookieDomain,
+			Secure:   m.CookieSecure,
+			HttpOnly: m.CookieHTTPOnly,
+			MaxAge:   -1,
+		})
+	}
+	return nil
+}
+
+func (m *SessionManager) setCookie(w http.ResponseWriter, sess *Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cookieName(),
+		Value:    sess.ID,
+		Path:     m.CookiePath,
+		Domain:   m.CookieDomain,
+		Secure:   m.CookieSecure,
+		HttpOnly: m.CookieHTTPOnly,
+		Expires:  sess.ExpireAt,
+		MaxAge:   int(time.Until(sess.ExpireAt).Seconds()),
+	})
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ScalarFieldsFromReply is the default SessionManager.FromReply.
+// It returns the top level scalar fields of "reply" keyed by their proto names.
+func ScalarFieldsFromReply(meth string, reply proto.Message) (map[string]string, bool) {
+	m := jsonpb.Marshaler{OrigName: true}
+	s, err := m.MarshalToString(reply)
+	if err != nil {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, false
+	}
+	values := make(map[string]string, len(fields))
+	for k, v := range fields {
+		switch v := v.(type) {
+		case string:
+			values[k] = v
+		case json.Number, bool:
+			values[k] = fmt.Sprint(v)
+		}
+	}
+	return values, true
+}
+
+// BeginSession attaches the session to "ctx" if the session subsystem is enabled.
+// See SessionManager.Begin.
+func (g *Gateway) BeginSession(ctx context.Context, w http.ResponseWriter, req *http.Request, route *Route) (context.Context, error) {
+	if g.sessions == nil {
+		return ctx, nil
+	}
+	return g.sessions.Begin(ctx, w, req, route)
+}
+
+// FinishSession creates or destroys the session if the session subsystem is enabled.
+// See SessionManager.Finish.
+func (g *Gateway) FinishSession(ctx context.Context, w http.ResponseWriter, req *http.Request, route *Route, reply proto.Message) error {
+	if g.sessions == nil {
+		return nil
+	}
+	return g.sessions.Finish(ctx, w, req, route, reply)
+}
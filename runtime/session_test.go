@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMemorySessionStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemorySessionStore(0)
+	defer s.Close()
+
+	if err := s.Save(ctx, &Session{ID: "live", ExpireAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Save() failed with %v; want success", err)
+	}
+	if err := s.Save(ctx, &Session{ID: "dead", ExpireAt: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatalf("Save() failed with %v; want success", err)
+	}
+	if _, err := s.Load(ctx, "live"); err != nil {
+		t.Errorf("Load(%q) failed with %v; want success", "live", err)
+	}
+	if _, err := s.Load(ctx, "dead"); err != ErrSessionNotFound {
+		t.Errorf("Load(%q) = %v; want %v", "dead", err, ErrSessionNotFound)
+	}
+	if got, want := s.Len(), 1; got != want {
+		t.Errorf("Len() = %d; want %d", got, want)
+	}
+}
+
+func TestSessionManagerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemorySessionStore(0)
+	defer store.Close()
+	m := &SessionManager{
+		Store:      store,
+		CookieName: "SID",
+		FromReply: func(meth string, reply proto.Message) (map[string]string, bool) {
+			uid := reply.(*wrappers.StringValue).GetValue()
+			return map[string]string{"Uid": uid}, uid != ""
+		},
+	}
+	login := &Route{Method: "pkg.Authorize/Login", Session: SessionLogin}
+	read := &Route{Method: "pkg.Im/Read", Session: SessionRequired}
+	logout := &Route{Method: "pkg.Authorize/Logout", Session: SessionLogout}
+
+	req := httptest.NewRequest("POST", "/v1/imgate/read", nil)
+	if _, err := m.Begin(ctx, httptest.NewRecorder(), req, read); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Begin() without cookie = %v; want code %v", err, codes.Unauthenticated)
+	}
+
+	// a refused login does not create a session
+	w := httptest.NewRecorder()
+	if err := m.Finish(ctx, w, req, login, &wrappers.StringValue{}); err != nil {
+		t.Fatalf("Finish() failed with %v; want success", err)
+	}
+	if got := store.Len(); got != 0 {
+		t.Fatalf("store.Len() = %d after a refused login; want 0", got)
+	}
+
+	w = httptest.NewRecorder()
+	if err := m.Finish(ctx, w, req, login, &wrappers.StringValue{Value: "10086"}); err != nil {
+		t.Fatalf("Finish() failed with %v; want success", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "SID" || cookies[0].Value == "" {
+		t.Fatalf("cookies = %v; want a SID cookie", cookies)
+	}
+
+	req = httptest.NewRequest("POST", "/v1/imgate/read", nil)
+	req.AddCookie(cookies[0])
+	rctx, err := m.Begin(ctx, httptest.NewRecorder(), req, read)
+	if err != nil {
+		t.Fatalf("Begin() failed with %v; want success", err)
+	}
+	md, _ := metadata.FromOutgoingContext(rctx)
+	if got, want := md.Get("uid"), "10086"; len(got) != 1 || got[0] != want {
+		t.Errorf("outgoing metadata uid = %v; want %q", got, want)
+	}
+
+	req = httptest.NewRequest("POST", "/v1/imgate/logout", nil)
+	req.AddCookie(cookies[0])
+	rctx, err = m.Begin(ctx, httptest.NewRecorder(), req, logout)
+	if err != nil {
+		t.Fatalf("Begin() failed with %v; want success", err)
+	}
+	w = httptest.NewRecorder()
+	if err := m.Finish(rctx, w, req, logout, &wrappers.StringValue{}); err != nil {
+		t.Fatalf("Finish() failed with %v; want success", err)
+	}
+	if got := w.Result().Cookies(); len(got) != 1 || got[0].MaxAge >= 0 {
+		t.Errorf("cookies = %v after logout; want an expired cookie", got)
+	}
+	if _, err := store.Load(ctx, cookies[0].Value); err != ErrSessionNotFound {
+		t.Errorf("Load() after logout = %v; want %v", err, ErrSessionNotFound)
+	}
+}
+
+func TestScalarFieldsFromReply(t *testing.T) {
+	reply := &descriptor.FieldDescriptorProto{
+		Name:    proto.String("uid"),
+		Number:  proto.Int32(3),
+		Options: &descriptor.FieldOptions{Deprecated: proto.Bool(true)},
+	}
+	got, ok := ScalarFieldsFromReply("", reply)
+	if !ok {
+		t.Fatalf("ScalarFieldsFromReply() refused the reply; want success")
+	}
+	want := map[string]string{"name": "uid", "number": "3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScalarFieldsFromReply() = %v; want %v", got, want)
+	}
+}
+
+func TestGatewayWithoutSessionManager(t *testing.T) {
+	g := NewGateway()
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := g.BeginSession(context.Background(), httptest.NewRecorder(), req, &Route{Session: SessionRequired}); err != nil {
+		t.Errorf("BeginSession() failed with %v; want success", err)
+	}
+}